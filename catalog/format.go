@@ -0,0 +1,356 @@
+package catalog
+
+import (
+	"bufio"
+	"ec-platform/models"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"path"
+	"strconv"
+	"strings"
+)
+
+// Форматы файлов каталога
+const (
+	FormatCSV  = "csv"
+	FormatJSON = "json"
+)
+
+var ErrUnsupportedFormat = errors.New("unsupported catalog format, expected csv or json")
+
+// Columns - колонки каталога в порядке экспорта
+var Columns = []string{"sku", "product_name", "price", "stock", "weight_grams", "image"}
+
+// колонки, без которых файл не принимается
+var requiredColumns = []string{"sku", "product_name", "price"}
+
+// Record - строка файла до проверки значений: колонка -> значение.
+// Err - строку не удалось разобрать (неверное число полей, не объект JSON), остальные строки читаются дальше
+type Record struct {
+	Row    int
+	Fields map[string]string
+	Err    error
+}
+
+// Reader читает строки каталога по одной. В конце файла Next возвращает io.EOF,
+// другая ошибка - файл нельзя читать дальше (неверный заголовок, синтаксис)
+type Reader interface {
+	Next() (*Record, error)
+}
+
+// FormatFromFilename определяет формат по расширению файла ("" - неизвестно)
+func FormatFromFilename(name string) string {
+	switch strings.ToLower(path.Ext(name)) {
+	case ".csv":
+		return FormatCSV
+
+	case ".json":
+		return FormatJSON
+	}
+
+	return ""
+}
+
+func NewReader(format string, r io.Reader) (Reader, error) {
+	switch format {
+	case FormatCSV:
+		return newCSVReader(r)
+
+	case FormatJSON:
+		return newJSONReader(r)
+	}
+
+	return nil, ErrUnsupportedFormat
+}
+
+type csvReader struct {
+	reader *csv.Reader
+	header []string
+}
+
+// первая строка - заголовок с названиями колонок (в любом порядке)
+func newCSVReader(r io.Reader) (*csvReader, error) {
+	reader := csv.NewReader(r)
+
+	header, err := reader.Read()
+
+	if err == io.EOF {
+		return nil, errors.New("csv header is missing")
+	}
+
+	if err != nil {
+		return nil, err
+	}
+
+	for i := range header {
+		header[i] = strings.ToLower(strings.TrimSpace(header[i]))
+	}
+
+	// Excel сохраняет CSV в UTF-8 с BOM
+	header[0] = strings.TrimPrefix(header[0], "\ufeff")
+
+	if err := checkColumns(header); err != nil {
+		return nil, err
+	}
+
+	reader.FieldsPerRecord = len(header)
+
+	return &csvReader{reader: reader, header: header}, nil
+}
+
+func (r *csvReader) Next() (*Record, error) {
+	values, err := r.reader.Read()
+
+	if err == io.EOF {
+		return nil, io.EOF
+	}
+
+	var parseErr *csv.ParseError
+
+	// Строка с другим числом полей пропускается, остальные ошибки разбора - конец файла
+	if errors.As(err, &parseErr) && parseErr.Err == csv.ErrFieldCount {
+		return &Record{
+			Row: parseErr.StartLine,
+			Err: fmt.Errorf("expected %d fields, got %d", len(r.header), len(values)),
+		}, nil
+	}
+
+	if err != nil {
+		return nil, err
+	}
+
+	line, _ := r.reader.FieldPos(0)
+	fields := make(map[string]string, len(r.header))
+
+	for i, column := range r.header {
+		fields[column] = values[i]
+	}
+
+	return &Record{Row: line, Fields: fields}, nil
+}
+
+type jsonReader struct {
+	decoder *json.Decoder
+	row     int
+	done    bool
+}
+
+// файл - массив объектов с полями-колонками
+func newJSONReader(r io.Reader) (*jsonReader, error) {
+	decoder := json.NewDecoder(r)
+	decoder.UseNumber()
+
+	token, err := decoder.Token()
+
+	if err != nil {
+		return nil, err
+	}
+
+	if delim, ok := token.(json.Delim); !ok || delim != '[' {
+		return nil, errors.New("json catalog must be an array of objects")
+	}
+
+	return &jsonReader{decoder: decoder}, nil
+}
+
+func (r *jsonReader) Next() (*Record, error) {
+	if r.done {
+		return nil, io.EOF
+	}
+
+	if !r.decoder.More() {
+		// закрывающая скобка массива, после нее в файле ничего не должно быть
+		if _, err := r.decoder.Token(); err != nil {
+			return nil, err
+		}
+
+		if _, err := r.decoder.Token(); err != io.EOF {
+			return nil, errors.New("unexpected data after json array")
+		}
+
+		r.done = true
+
+		return nil, io.EOF
+	}
+
+	var value interface{}
+
+	if err := r.decoder.Decode(&value); err != nil {
+		return nil, err
+	}
+
+	r.row++
+
+	object, ok := value.(map[string]interface{})
+
+	if !ok {
+		return &Record{Row: r.row, Err: errors.New("expected a json object")}, nil
+	}
+
+	fields := make(map[string]string, len(object))
+
+	for key, value := range object {
+		if !isColumn(key) {
+			return &Record{Row: r.row, Err: fmt.Errorf("unknown field %q", key)}, nil
+		}
+
+		switch value := value.(type) {
+		case nil:
+			fields[key] = ""
+
+		case string:
+			fields[key] = value
+
+		case json.Number:
+			fields[key] = value.String()
+
+		default:
+			return &Record{Row: r.row, Err: fmt.Errorf("field %s: expected a string or a number", key)}, nil
+		}
+	}
+
+	return &Record{Row: r.row, Fields: fields}, nil
+}
+
+// заголовок CSV: только известные колонки без повторов, обязательные - все
+func checkColumns(header []string) error {
+	seen := make(map[string]bool, len(header))
+
+	for _, column := range header {
+		if !isColumn(column) {
+			return fmt.Errorf("unknown column %q, expected %s", column, strings.Join(Columns, ", "))
+		}
+
+		if seen[column] {
+			return fmt.Errorf("duplicate column %q", column)
+		}
+
+		seen[column] = true
+	}
+
+	for _, column := range requiredColumns {
+		if !seen[column] {
+			return fmt.Errorf("required column %q is missing", column)
+		}
+	}
+
+	return nil
+}
+
+func isColumn(name string) bool {
+	for _, column := range Columns {
+		if column == name {
+			return true
+		}
+	}
+
+	return false
+}
+
+// Writer пишет строки каталога потоком; Close дописывает окончание файла
+type Writer interface {
+	Write(row models.CatalogRow) error
+	Close() error
+}
+
+func NewWriter(format string, w io.Writer) (Writer, error) {
+	switch format {
+	case FormatCSV:
+		writer := csv.NewWriter(w)
+
+		if err := writer.Write(Columns); err != nil {
+			return nil, err
+		}
+
+		return &csvWriter{writer: writer}, nil
+
+	case FormatJSON:
+		buffered := bufio.NewWriter(w)
+
+		if _, err := buffered.WriteString("["); err != nil {
+			return nil, err
+		}
+
+		return &jsonWriter{writer: buffered}, nil
+	}
+
+	return nil, ErrUnsupportedFormat
+}
+
+type csvWriter struct {
+	writer *csv.Writer
+}
+
+func (w *csvWriter) Write(row models.CatalogRow) error {
+	return w.writer.Write([]string{
+		row.SKU,
+		row.Product_Name,
+		strconv.FormatInt(int64(row.Price), 10),
+		formatOptionalInt(row.Stock),
+		formatOptionalInt(row.Weight),
+		formatOptionalString(row.Image),
+	})
+}
+
+func (w *csvWriter) Close() error {
+	w.writer.Flush()
+
+	return w.writer.Error()
+}
+
+type jsonWriter struct {
+	writer *bufio.Writer
+	count  int
+}
+
+// по объекту на строку, чтобы большой файл было удобно просматривать и сравнивать
+func (w *jsonWriter) Write(row models.CatalogRow) error {
+	data, err := json.Marshal(row)
+
+	if err != nil {
+		return err
+	}
+
+	separator := "\n"
+
+	if w.count > 0 {
+		separator = ",\n"
+	}
+
+	w.count++
+
+	if _, err := w.writer.WriteString(separator); err != nil {
+		return err
+	}
+
+	_, err = w.writer.Write(data)
+
+	return err
+}
+
+func (w *jsonWriter) Close() error {
+	if _, err := w.writer.WriteString("\n]\n"); err != nil {
+		return err
+	}
+
+	return w.writer.Flush()
+}
+
+func formatOptionalInt(value *int) string {
+	if value == nil {
+		return ""
+	}
+
+	return strconv.Itoa(*value)
+}
+
+func formatOptionalString(value *string) string {
+	if value == nil {
+		return ""
+	}
+
+	return *value
+}
@@ -0,0 +1,302 @@
+package catalog
+
+import (
+	"ec-platform/models"
+	"errors"
+	"io"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// читает файл до конца или до ошибки, после которой чтение невозможно
+func readAll(t *testing.T, format, data string) ([]*Record, error) {
+	t.Helper()
+
+	reader, err := NewReader(format, strings.NewReader(data))
+
+	if err != nil {
+		return nil, err
+	}
+
+	var records []*Record
+
+	for {
+		record, err := reader.Next()
+
+		if err == io.EOF {
+			return records, nil
+		}
+
+		if err != nil {
+			return records, err
+		}
+
+		records = append(records, record)
+	}
+}
+
+func TestFormatFromFilename(t *testing.T) {
+	tests := []struct {
+		name string
+		want string
+	}{
+		{"catalog.csv", FormatCSV},
+		{"CATALOG.CSV", FormatCSV},
+		{"export/catalog.json", FormatJSON},
+		{"catalog.xlsx", ""},
+		{"catalog", ""},
+		{"csv", ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := FormatFromFilename(tt.name); got != tt.want {
+				t.Errorf("FormatFromFilename(%q) = %q, want %q", tt.name, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestNewReaderUnsupportedFormat(t *testing.T) {
+	if _, err := NewReader("xml", strings.NewReader("")); !errors.Is(err, ErrUnsupportedFormat) {
+		t.Errorf("NewReader(xml) error = %v, want %v", err, ErrUnsupportedFormat)
+	}
+}
+
+func TestCSVHeader(t *testing.T) {
+	tests := []struct {
+		name    string
+		header  string
+		wantErr string
+	}{
+		{"all columns", "sku,product_name,price,stock,weight_grams,image", ""},
+		{"required only", "sku,product_name,price", ""},
+		{"any order and case", " Price ,SKU,Product_Name", ""},
+		{"utf-8 bom", "\ufeffsku,product_name,price", ""},
+		{"empty file", "", "csv header is missing"},
+		{"unknown column", "sku,product_name,price,color", `unknown column "color"`},
+		{"duplicate column", "sku,product_name,price,sku", `duplicate column "sku"`},
+		{"missing price", "sku,product_name,stock", `required column "price" is missing`},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := NewReader(FormatCSV, strings.NewReader(tt.header))
+
+			if tt.wantErr == "" {
+				if err != nil {
+					t.Fatalf("NewReader() error = %v, want nil", err)
+				}
+
+				return
+			}
+
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("NewReader() error = %v, want %q", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestCSVReaderRows(t *testing.T) {
+	data := "price,sku,product_name\n" +
+		"1500,TS-1,T-shirt\n" +
+		"2000,TS-2\n" +
+		"2500,TS-3,\"Hoodie\nwith zip\"\n" +
+		"3000,TS-4,Cap\n"
+
+	records, err := readAll(t, FormatCSV, data)
+
+	if err != nil {
+		t.Fatalf("read error = %v", err)
+	}
+
+	if len(records) != 4 {
+		t.Fatalf("got %d records, want 4", len(records))
+	}
+
+	want := map[string]string{"sku": "TS-1", "product_name": "T-shirt", "price": "1500"}
+
+	if !reflect.DeepEqual(records[0].Fields, want) || records[0].Row != 2 {
+		t.Errorf("record 0 = row %d %v, want row 2 %v", records[0].Row, records[0].Fields, want)
+	}
+
+	// Строка с другим числом полей - ошибка этой строки, чтение продолжается
+	if records[1].Row != 3 || records[1].Err == nil || records[1].Err.Error() != "expected 3 fields, got 2" {
+		t.Errorf("record 1 = row %d error %v, want row 3 error about field count", records[1].Row, records[1].Err)
+	}
+
+	// Номер строки - строка файла, где запись начинается
+	if records[2].Row != 4 || records[2].Fields["product_name"] != "Hoodie\nwith zip" {
+		t.Errorf("record 2 = row %d %v, want row 4 with multiline name", records[2].Row, records[2].Fields)
+	}
+
+	if records[3].Row != 6 {
+		t.Errorf("record 3 row = %d, want 6", records[3].Row)
+	}
+}
+
+func TestCSVReaderSyntaxError(t *testing.T) {
+	data := "sku,product_name,price\nTS-1,\"T-shirt,1500\n"
+
+	if _, err := readAll(t, FormatCSV, data); err == nil {
+		t.Error("read error = nil, want csv parse error")
+	}
+}
+
+func TestJSONReader(t *testing.T) {
+	tests := []struct {
+		name     string
+		data     string
+		wantErr  string
+		wantRows []*Record
+	}{
+		{
+			name: "objects",
+			data: `[{"sku":"TS-1","product_name":"T-shirt","price":1500,"stock":null},{"sku":"TS-2","product_name":"Cap","price":"990"}]`,
+			wantRows: []*Record{
+				{Row: 1, Fields: map[string]string{"sku": "TS-1", "product_name": "T-shirt", "price": "1500", "stock": ""}},
+				{Row: 2, Fields: map[string]string{"sku": "TS-2", "product_name": "Cap", "price": "990"}},
+			},
+		},
+		{
+			name:     "empty array",
+			data:     " [ ] \n",
+			wantRows: nil,
+		},
+		{
+			name:     "large price kept as written",
+			data:     `[{"sku":"TS-1","product_name":"T-shirt","price":12345678901234567890}]`,
+			wantRows: []*Record{{Row: 1, Fields: map[string]string{"sku": "TS-1", "product_name": "T-shirt", "price": "12345678901234567890"}}},
+		},
+		{
+			name:    "not an array",
+			data:    `{"sku":"TS-1"}`,
+			wantErr: "json catalog must be an array of objects",
+		},
+		{
+			name:    "data after array",
+			data:    `[] []`,
+			wantErr: "unexpected data after json array",
+		},
+		{
+			name:    "truncated",
+			data:    `[{"sku":"TS-1"}`,
+			wantErr: "unexpected end of JSON input",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			records, err := readAll(t, FormatJSON, tt.data)
+
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("read error = %v, want %q", err, tt.wantErr)
+				}
+
+				return
+			}
+
+			if err != nil {
+				t.Fatalf("read error = %v", err)
+			}
+
+			if !reflect.DeepEqual(records, tt.wantRows) {
+				t.Errorf("records = %+v, want %+v", records, tt.wantRows)
+			}
+		})
+	}
+}
+
+func TestJSONReaderRowErrors(t *testing.T) {
+	data := `[
+		"TS-1",
+		{"sku":"TS-2","color":"red"},
+		{"sku":"TS-3","price":[1500]},
+		{"sku":"TS-4","product_name":"Cap","price":990}
+	]`
+
+	records, err := readAll(t, FormatJSON, data)
+
+	if err != nil {
+		t.Fatalf("read error = %v", err)
+	}
+
+	wantErrs := []string{
+		"expected a json object",
+		`unknown field "color"`,
+		"field price: expected a string or a number",
+		"",
+	}
+
+	if len(records) != len(wantErrs) {
+		t.Fatalf("got %d records, want %d", len(records), len(wantErrs))
+	}
+
+	for i, record := range records {
+		if record.Row != i+1 {
+			t.Errorf("record %d row = %d, want %d", i, record.Row, i+1)
+		}
+
+		var got string
+
+		if record.Err != nil {
+			got = record.Err.Error()
+		}
+
+		if got != wantErrs[i] {
+			t.Errorf("record %d error = %q, want %q", i, got, wantErrs[i])
+		}
+	}
+}
+
+func TestWriterRoundTrip(t *testing.T) {
+	stock, weight, image := 10, 250, "/img/ts-1.png"
+
+	rows := []models.CatalogRow{
+		{SKU: "TS-1", Product_Name: "T-shirt", Price: 150000, Stock: &stock, Weight: &weight, Image: &image},
+		{SKU: "TS-2", Product_Name: "Cap, red", Price: 99000},
+	}
+
+	for _, format := range []string{FormatCSV, FormatJSON} {
+		t.Run(format, func(t *testing.T) {
+			var out strings.Builder
+
+			writer, err := NewWriter(format, &out)
+
+			if err != nil {
+				t.Fatalf("NewWriter() error = %v", err)
+			}
+
+			for _, row := range rows {
+				if err := writer.Write(row); err != nil {
+					t.Fatalf("Write() error = %v", err)
+				}
+			}
+
+			if err := writer.Close(); err != nil {
+				t.Fatalf("Close() error = %v", err)
+			}
+
+			records, err := readAll(t, format, out.String())
+
+			if err != nil {
+				t.Fatalf("read error = %v\n%s", err, out.String())
+			}
+
+			if len(records) != len(rows) {
+				t.Fatalf("got %d records, want %d", len(records), len(rows))
+			}
+
+			for i, record := range records {
+				row, errs := ParseRow(record.Fields)
+
+				if len(errs) > 0 || !reflect.DeepEqual(row, rows[i]) {
+					t.Errorf("row %d = %+v %v, want %+v", i, row, errs, rows[i])
+				}
+			}
+		})
+	}
+}
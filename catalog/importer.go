@@ -0,0 +1,288 @@
+package catalog
+
+import (
+	"context"
+	"ec-platform/database"
+	"ec-platform/jobs"
+	"ec-platform/models"
+	"ec-platform/storage"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+// Параметры обработки импорта
+const (
+	// строк в одной транзакции и между сохранениями прогресса
+	importBatch = 500
+	// сколько ошибок строк хранится в отчете (счетчик error_count - все)
+	MaxReportedErrors = 1000
+)
+
+// ImportJob - данные задачи models.JobCatalogImport
+type ImportJob struct {
+	Import_ID uuid.UUID `json:"import_id"`
+}
+
+// Importer выполняет импорты каталога: читает загруженный файл из хранилища импортов
+// и применяет проверенные строки пачками
+type Importer struct {
+	db    *pgxpool.Pool
+	store storage.BlobStore
+}
+
+func NewImporter(db *pgxpool.Pool, store storage.BlobStore) *Importer {
+	return &Importer{db: db, store: store}
+}
+
+// Handler - обработчик задач models.JobCatalogImport
+func (i *Importer) Handler() jobs.Handler {
+	return jobs.Typed(i.run)
+}
+
+// Строки с ошибками пропускаются и попадают в отчет, остальные применяются. Ошибка БД - повтор
+// задачи: импорт начинается с начала файла, повторное применение строк по артикулу безопасно
+func (i *Importer) run(ctx context.Context, job ImportJob) error {
+	catalogImport, err := database.GetCatalogImport(ctx, i.db, job.Import_ID)
+
+	if err == database.ErrCatalogImportNotFound {
+		log.Printf("catalog import %s not found, skipping", job.Import_ID)
+		return nil
+	}
+
+	if err != nil {
+		return err
+	}
+
+	if catalogImport.Status == models.CatalogImportStatusSucceeded || catalogImport.Status == models.CatalogImportStatusFailed {
+		return nil
+	}
+
+	blob, err := i.store.Open(ctx, catalogImport.Storage_Key)
+
+	if err == storage.ErrBlobNotFound {
+		return i.fail(ctx, catalogImport, errors.New("uploaded file is missing"))
+	}
+
+	if err != nil {
+		return err
+	}
+
+	defer blob.Close()
+
+	// Первый проход - число строк и проверка структуры файла до любых изменений каталога
+	total, err := countRows(catalogImport.Format, blob)
+
+	if err != nil {
+		return i.fail(ctx, catalogImport, err)
+	}
+
+	if _, err := blob.Seek(0, io.SeekStart); err != nil {
+		return err
+	}
+
+	if err := database.StartCatalogImport(ctx, i.db, catalogImport.Import_ID, total); err != nil {
+		return err
+	}
+
+	restartImport(catalogImport, total)
+
+	reader, err := NewReader(catalogImport.Format, blob)
+
+	if err != nil {
+		return i.fail(ctx, catalogImport, err)
+	}
+
+	checker := newRowChecker(catalogImport)
+	batch := make([]models.CatalogRow, 0, importBatch)
+
+	for {
+		record, err := reader.Next()
+
+		if err == io.EOF {
+			break
+		}
+
+		if err != nil {
+			return i.fail(ctx, catalogImport, err)
+		}
+
+		catalogImport.Processed_Rows++
+
+		if row, ok := checker.check(record); ok {
+			batch = append(batch, row)
+		}
+
+		if len(batch) == importBatch || catalogImport.Processed_Rows%importBatch == 0 {
+			if err := i.apply(ctx, catalogImport, batch); err != nil {
+				return err
+			}
+
+			batch = batch[:0]
+		}
+	}
+
+	if err := i.apply(ctx, catalogImport, batch); err != nil {
+		return err
+	}
+
+	catalogImport.Status = models.CatalogImportStatusSucceeded
+
+	if err := database.FinishCatalogImport(ctx, i.db, catalogImport); err != nil {
+		return err
+	}
+
+	i.deleteFile(ctx, catalogImport)
+
+	return nil
+}
+
+// применяет пачку строк (при dry_run только считает, сколько товаров было бы создано и изменено)
+// и сохраняет прогресс
+func (i *Importer) apply(ctx context.Context, catalogImport *models.CatalogImport, batch []models.CatalogRow) error {
+	if len(batch) > 0 {
+		var created, updated int
+		var err error
+
+		if catalogImport.Dry_Run {
+			skus := make([]string, len(batch))
+
+			for j, row := range batch {
+				skus[j] = row.SKU
+			}
+
+			updated, err = database.CountExistingSKUs(ctx, i.db, skus)
+			created = len(batch) - updated
+
+		} else {
+			created, updated, err = database.UpsertCatalogRows(ctx, i.db, batch, catalogImport.Created_By)
+		}
+
+		if err != nil {
+			return err
+		}
+
+		catalogImport.Created_Count += created
+		catalogImport.Updated_Count += updated
+	}
+
+	return database.SaveCatalogImportProgress(ctx, i.db, catalogImport)
+}
+
+// файл нельзя обработать: импорт завершается со статусом failed без повторов задачи.
+// Уже примененные пачки остаются в каталоге
+func (i *Importer) fail(ctx context.Context, catalogImport *models.CatalogImport, cause error) error {
+	failure := cause.Error()
+
+	catalogImport.Status = models.CatalogImportStatusFailed
+	catalogImport.Failure = &failure
+
+	if err := database.FinishCatalogImport(ctx, i.db, catalogImport); err != nil {
+		return err
+	}
+
+	i.deleteFile(ctx, catalogImport)
+
+	return nil
+}
+
+func (i *Importer) deleteFile(ctx context.Context, catalogImport *models.CatalogImport) {
+	if err := i.store.Delete(ctx, catalogImport.Storage_Key); err != nil {
+		log.Printf("error deleting catalog import file %s: %v", catalogImport.Storage_Key, err)
+	}
+}
+
+// Повтор задачи начинает импорт заново - счетчики прошлой попытки сброшены и в базе
+func restartImport(catalogImport *models.CatalogImport, total int) {
+	catalogImport.Status = models.CatalogImportStatusRunning
+	catalogImport.Total_Rows = total
+	catalogImport.Processed_Rows = 0
+	catalogImport.Created_Count = 0
+	catalogImport.Updated_Count = 0
+	catalogImport.Error_Count = 0
+	catalogImport.Errors = nil
+	catalogImport.Failure = nil
+}
+
+// rowChecker проверяет прочитанные строки и пишет их ошибки в отчет импорта
+type rowChecker struct {
+	catalogImport *models.CatalogImport
+	// строка, в которой артикул встретился впервые
+	seen map[string]int
+}
+
+func newRowChecker(catalogImport *models.CatalogImport) *rowChecker {
+	return &rowChecker{catalogImport: catalogImport, seen: make(map[string]int)}
+}
+
+// check возвращает строку каталога, если ее можно применить; повтор артикула - ошибка
+// со ссылкой на строку, где он встретился впервые
+func (c *rowChecker) check(record *Record) (models.CatalogRow, bool) {
+	if record.Err != nil {
+		addImportError(c.catalogImport, models.CatalogImportError{Row: record.Row, Message: record.Err.Error()})
+		return models.CatalogRow{}, false
+	}
+
+	row, fieldErrors := ParseRow(record.Fields)
+
+	if len(fieldErrors) > 0 {
+		for _, fieldError := range fieldErrors {
+			addImportError(c.catalogImport, models.CatalogImportError{
+				Row:     record.Row,
+				SKU:     row.SKU,
+				Field:   fieldError.Field,
+				Message: fieldError.Message,
+			})
+		}
+
+		return row, false
+	}
+
+	if first, ok := c.seen[row.SKU]; ok {
+		addImportError(c.catalogImport, models.CatalogImportError{
+			Row:     record.Row,
+			SKU:     row.SKU,
+			Field:   "sku",
+			Message: fmt.Sprintf("duplicate sku, first used in row %d", first),
+		})
+
+		return row, false
+	}
+
+	c.seen[row.SKU] = record.Row
+
+	return row, true
+}
+
+func addImportError(catalogImport *models.CatalogImport, importError models.CatalogImportError) {
+	catalogImport.Error_Count++
+
+	if len(catalogImport.Errors) < MaxReportedErrors {
+		catalogImport.Errors = append(catalogImport.Errors, importError)
+	}
+}
+
+// читает файл целиком и возвращает число строк; ошибка - файл нельзя обработать
+func countRows(format string, r io.Reader) (int, error) {
+	reader, err := NewReader(format, r)
+
+	if err != nil {
+		return 0, err
+	}
+
+	count := 0
+
+	for {
+		if _, err := reader.Next(); err == io.EOF {
+			return count, nil
+		} else if err != nil {
+			return 0, err
+		}
+
+		count++
+	}
+}
@@ -0,0 +1,139 @@
+package catalog
+
+import (
+	"ec-platform/models"
+	"io"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// проверяет все строки файла, как run, и возвращает строки, которые были бы применены
+func checkAll(t *testing.T, catalogImport *models.CatalogImport, format, data string) []string {
+	t.Helper()
+
+	reader, err := NewReader(format, strings.NewReader(data))
+
+	if err != nil {
+		t.Fatalf("NewReader() error = %v", err)
+	}
+
+	checker := newRowChecker(catalogImport)
+
+	var skus []string
+
+	for {
+		record, err := reader.Next()
+
+		if err == io.EOF {
+			return skus
+		}
+
+		if err != nil {
+			t.Fatalf("Next() error = %v", err)
+		}
+
+		if row, ok := checker.check(record); ok {
+			skus = append(skus, row.SKU)
+		}
+	}
+}
+
+func TestRowCheckerReportsRows(t *testing.T) {
+	data := "sku,product_name,price\n" +
+		"TS-1,T-shirt,150000\n" +
+		"TS-2,Cap\n" +
+		"TS-3,,abc\n" +
+		"TS-1,T-shirt again,160000\n" +
+		"TS-4,Hoodie,250000\n"
+
+	catalogImport := &models.CatalogImport{}
+	skus := checkAll(t, catalogImport, FormatCSV, data)
+
+	if want := []string{"TS-1", "TS-4"}; !reflect.DeepEqual(skus, want) {
+		t.Errorf("applied rows = %v, want %v", skus, want)
+	}
+
+	want := []models.CatalogImportError{
+		{Row: 3, Message: "expected 3 fields, got 2"},
+		{Row: 4, SKU: "TS-3", Field: "product_name", Message: "is required"},
+		{Row: 4, SKU: "TS-3", Field: "price", Message: "must be a non-negative integer"},
+		{Row: 5, SKU: "TS-1", Field: "sku", Message: "duplicate sku, first used in row 2"},
+	}
+
+	if !reflect.DeepEqual(catalogImport.Errors, want) {
+		t.Errorf("errors = %+v, want %+v", catalogImport.Errors, want)
+	}
+
+	if catalogImport.Error_Count != len(want) {
+		t.Errorf("error count = %d, want %d", catalogImport.Error_Count, len(want))
+	}
+}
+
+func TestRowCheckerJSONRows(t *testing.T) {
+	data := `[
+		{"sku":"TS-1","product_name":"T-shirt","price":150000},
+		{"sku":"TS-1","product_name":"T-shirt","price":150000},
+		{"sku":"TS-2","product_name":"Cap","price":-1}
+	]`
+
+	catalogImport := &models.CatalogImport{}
+	skus := checkAll(t, catalogImport, FormatJSON, data)
+
+	if want := []string{"TS-1"}; !reflect.DeepEqual(skus, want) {
+		t.Errorf("applied rows = %v, want %v", skus, want)
+	}
+
+	want := []models.CatalogImportError{
+		{Row: 2, SKU: "TS-1", Field: "sku", Message: "duplicate sku, first used in row 1"},
+		{Row: 3, SKU: "TS-2", Field: "price", Message: "must be a non-negative integer"},
+	}
+
+	if !reflect.DeepEqual(catalogImport.Errors, want) {
+		t.Errorf("errors = %+v, want %+v", catalogImport.Errors, want)
+	}
+}
+
+func TestAddImportErrorLimitsReport(t *testing.T) {
+	catalogImport := &models.CatalogImport{}
+
+	for i := 1; i <= MaxReportedErrors+5; i++ {
+		addImportError(catalogImport, models.CatalogImportError{Row: i, Message: "is required"})
+	}
+
+	if len(catalogImport.Errors) != MaxReportedErrors || catalogImport.Error_Count != MaxReportedErrors+5 {
+		t.Errorf("report = %d errors, count %d, want %d and %d",
+			len(catalogImport.Errors), catalogImport.Error_Count, MaxReportedErrors, MaxReportedErrors+5)
+	}
+}
+
+func TestRestartImportResetsCounters(t *testing.T) {
+	failure := "connection reset"
+
+	// Состояние, которое оставила прерванная попытка задачи
+	catalogImport := &models.CatalogImport{
+		Status:         models.CatalogImportStatusRunning,
+		Total_Rows:     3,
+		Processed_Rows: 2,
+		Created_Count:  1,
+		Updated_Count:  1,
+		Error_Count:    1,
+		Errors:         []models.CatalogImportError{{Row: 3, SKU: "TS-1", Field: "sku", Message: "duplicate sku, first used in row 2"}},
+		Failure:        &failure,
+	}
+
+	restartImport(catalogImport, 4)
+
+	want := models.CatalogImport{Status: models.CatalogImportStatusRunning, Total_Rows: 4}
+
+	if !reflect.DeepEqual(*catalogImport, want) {
+		t.Fatalf("after restart = %+v, want %+v", *catalogImport, want)
+	}
+
+	// Повтор снова читает файл с начала: отчет и счетчики - только этой попытки
+	checkAll(t, catalogImport, FormatCSV, "sku,product_name,price\nTS-1,T-shirt,1\nTS-1,T-shirt,1\n")
+
+	if catalogImport.Error_Count != 1 || len(catalogImport.Errors) != 1 {
+		t.Errorf("after retry = %d errors (count %d), want 1", len(catalogImport.Errors), catalogImport.Error_Count)
+	}
+}
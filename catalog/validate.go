@@ -0,0 +1,109 @@
+package catalog
+
+import (
+	"ec-platform/models"
+	"errors"
+	"math"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+)
+
+// Ограничения значений строки каталога
+const (
+	MaxSKULength  = 64
+	maxNameLength = 255
+)
+
+// FieldError - ошибка значения колонки строки каталога
+type FieldError struct {
+	Field   string
+	Message string
+}
+
+// ValidateSKU проверяет артикул: латиница, цифры, '.', '_' и '-', до MaxSKULength символов
+func ValidateSKU(sku string) error {
+	if sku == "" {
+		return errors.New("is required")
+	}
+
+	if len(sku) > MaxSKULength {
+		return errors.New("must be at most 64 characters")
+	}
+
+	for _, r := range sku {
+		if (r < 'a' || r > 'z') && (r < 'A' || r > 'Z') && (r < '0' || r > '9') && r != '.' && r != '_' && r != '-' {
+			return errors.New("may contain only latin letters, digits, '.', '_' and '-'")
+		}
+	}
+
+	return nil
+}
+
+// ParseRow превращает прочитанную строку в строку каталога и проверяет все колонки сразу,
+// чтобы в отчете были все ошибки строки
+func ParseRow(fields map[string]string) (models.CatalogRow, []FieldError) {
+	var row models.CatalogRow
+	var errs []FieldError
+
+	row.SKU = strings.TrimSpace(fields["sku"])
+
+	if err := ValidateSKU(row.SKU); err != nil {
+		errs = append(errs, FieldError{Field: "sku", Message: err.Error()})
+	}
+
+	row.Product_Name = strings.TrimSpace(fields["product_name"])
+
+	if row.Product_Name == "" {
+		errs = append(errs, FieldError{Field: "product_name", Message: "is required"})
+	} else if utf8.RuneCountInString(row.Product_Name) > maxNameLength {
+		errs = append(errs, FieldError{Field: "product_name", Message: "must be at most 255 characters"})
+	}
+
+	if price := strings.TrimSpace(fields["price"]); price == "" {
+		errs = append(errs, FieldError{Field: "price", Message: "is required"})
+	} else if value, err := strconv.ParseInt(price, 10, 64); err != nil || value < 0 {
+		errs = append(errs, FieldError{Field: "price", Message: "must be a non-negative integer"})
+	} else {
+		row.Price = models.Money(value)
+	}
+
+	var err error
+
+	if row.Stock, err = parseOptionalInt(fields["stock"]); err != nil {
+		errs = append(errs, FieldError{Field: "stock", Message: err.Error()})
+	}
+
+	if row.Weight, err = parseOptionalInt(fields["weight_grams"]); err != nil {
+		errs = append(errs, FieldError{Field: "weight_grams", Message: err.Error()})
+	}
+
+	if image := strings.TrimSpace(fields["image"]); image != "" {
+		if !strings.HasPrefix(image, "/") && !strings.HasPrefix(image, "http://") && !strings.HasPrefix(image, "https://") {
+			errs = append(errs, FieldError{Field: "image", Message: "must be an http(s) URL or a path starting with /"})
+		} else {
+			row.Image = &image
+		}
+	}
+
+	return row, errs
+}
+
+// пустое значение - nil; иначе целое от 0 до предела INTEGER
+func parseOptionalInt(value string) (*int, error) {
+	value = strings.TrimSpace(value)
+
+	if value == "" {
+		return nil, nil
+	}
+
+	number, err := strconv.ParseInt(value, 10, 64)
+
+	if err != nil || number < 0 || number > math.MaxInt32 {
+		return nil, errors.New("must be a non-negative integer")
+	}
+
+	result := int(number)
+
+	return &result, nil
+}
@@ -0,0 +1,134 @@
+package catalog
+
+import (
+	"ec-platform/models"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func intPtr(value int) *int {
+	return &value
+}
+
+func TestValidateSKU(t *testing.T) {
+	tests := []struct {
+		sku     string
+		wantErr bool
+	}{
+		{"TS-1", false},
+		{"ts_1.red", false},
+		{strings.Repeat("A", MaxSKULength), false},
+		{"", true},
+		{strings.Repeat("A", MaxSKULength+1), true},
+		{"TS 1", true},
+		{"ФУТ-1", true},
+		{"TS/1", true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.sku, func(t *testing.T) {
+			if err := ValidateSKU(tt.sku); (err != nil) != tt.wantErr {
+				t.Errorf("ValidateSKU(%q) error = %v, want error %v", tt.sku, err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestParseRow(t *testing.T) {
+	image := "https://cdn.example.com/ts-1.png"
+
+	tests := []struct {
+		name       string
+		fields     map[string]string
+		want       models.CatalogRow
+		wantFields []string
+	}{
+		{
+			name:   "required only",
+			fields: map[string]string{"sku": " TS-1 ", "product_name": " T-shirt ", "price": "150000"},
+			want:   models.CatalogRow{SKU: "TS-1", Product_Name: "T-shirt", Price: 150000},
+		},
+		{
+			name: "all columns",
+			fields: map[string]string{"sku": "TS-1", "product_name": "T-shirt", "price": "0", "stock": "10",
+				"weight_grams": " 250 ", "image": image},
+			want: models.CatalogRow{SKU: "TS-1", Product_Name: "T-shirt", Price: 0, Stock: intPtr(10), Weight: intPtr(250), Image: &image},
+		},
+		{
+			name:   "empty optional columns",
+			fields: map[string]string{"sku": "TS-1", "product_name": "T-shirt", "price": "1", "stock": "", "weight_grams": " ", "image": ""},
+			want:   models.CatalogRow{SKU: "TS-1", Product_Name: "T-shirt", Price: 1},
+		},
+		{
+			name:       "missing required",
+			fields:     map[string]string{},
+			wantFields: []string{"sku", "product_name", "price"},
+		},
+		{
+			name:       "fractional price",
+			fields:     map[string]string{"sku": "TS-1", "product_name": "T-shirt", "price": "1500.50"},
+			want:       models.CatalogRow{SKU: "TS-1", Product_Name: "T-shirt"},
+			wantFields: []string{"price"},
+		},
+		{
+			name:       "negative price",
+			fields:     map[string]string{"sku": "TS-1", "product_name": "T-shirt", "price": "-1"},
+			want:       models.CatalogRow{SKU: "TS-1", Product_Name: "T-shirt"},
+			wantFields: []string{"price"},
+		},
+		{
+			name:       "price above int64",
+			fields:     map[string]string{"sku": "TS-1", "product_name": "T-shirt", "price": "9223372036854775808"},
+			want:       models.CatalogRow{SKU: "TS-1", Product_Name: "T-shirt"},
+			wantFields: []string{"price"},
+		},
+		{
+			name:       "price with currency",
+			fields:     map[string]string{"sku": "TS-1", "product_name": "T-shirt", "price": "1500 RUB"},
+			want:       models.CatalogRow{SKU: "TS-1", Product_Name: "T-shirt"},
+			wantFields: []string{"price"},
+		},
+		{
+			name:       "long name",
+			fields:     map[string]string{"sku": "TS-1", "product_name": strings.Repeat("я", maxNameLength+1), "price": "1"},
+			want:       models.CatalogRow{SKU: "TS-1", Product_Name: strings.Repeat("я", maxNameLength+1), Price: 1},
+			wantFields: []string{"product_name"},
+		},
+		{
+			name: "bad optional columns",
+			fields: map[string]string{"sku": "TS-1", "product_name": "T-shirt", "price": "1", "stock": "-5",
+				"weight_grams": "2147483648", "image": "ftp://example.com/a.png"},
+			want:       models.CatalogRow{SKU: "TS-1", Product_Name: "T-shirt", Price: 1},
+			wantFields: []string{"stock", "weight_grams", "image"},
+		},
+		{
+			name:       "relative image path",
+			fields:     map[string]string{"sku": "TS-1", "product_name": "T-shirt", "price": "1", "image": "img/a.png"},
+			want:       models.CatalogRow{SKU: "TS-1", Product_Name: "T-shirt", Price: 1},
+			wantFields: []string{"image"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			row, errs := ParseRow(tt.fields)
+
+			var fields []string
+
+			for _, fieldError := range errs {
+				fields = append(fields, fieldError.Field)
+			}
+
+			if !reflect.DeepEqual(fields, tt.wantFields) {
+				t.Errorf("ParseRow() errors = %v, want fields %v", errs, tt.wantFields)
+			}
+
+			if tt.wantFields == nil || tt.want.SKU != "" {
+				if !reflect.DeepEqual(row, tt.want) {
+					t.Errorf("ParseRow() = %+v, want %+v", row, tt.want)
+				}
+			}
+		})
+	}
+}
@@ -4,6 +4,8 @@ import (
 	"context"
 	"ec-platform/database"
 	"ec-platform/models"
+	"ec-platform/postal"
+	"errors"
 	"log"
 	"net/http"
 	"time"
@@ -12,9 +14,12 @@ import (
 	"github.com/google/uuid"
 )
 
-func (app *Application) AddAdress() gin.HandlerFunc {
+// ограничение числа адресов пользователя по умолчанию
+const DefaultMaxAddresses = 10
+
+func (app *Application) GetAddresses() gin.HandlerFunc {
 	return func(c *gin.Context) {
-		// Получаем email пользователя из контекста
+		// Получаем email пользователя из контекста (установлен middleware)
 		email, exists := c.Get("email")
 
 		if !exists {
@@ -23,15 +28,6 @@ func (app *Application) AddAdress() gin.HandlerFunc {
 			return
 		}
 
-		// Парсим адрес из request body
-		var address models.Address
-
-		if err := c.BindJSON(&address); err != nil {
-			log.Printf("invalid request body: %v", err)
-			c.JSON(http.StatusBadRequest, gin.H{"error": "invalid request body"})
-			return
-		}
-
 		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
 		defer cancel()
 
@@ -47,32 +43,21 @@ func (app *Application) AddAdress() gin.HandlerFunc {
 		}
 
 		// Вызываем функцию из database слоя
-		addressID, err := database.AddAddress(ctx, app.DB, userID, &address)
+		addresses, err := database.GetAddresses(ctx, app.DB, userID)
 
 		if err != nil {
-			log.Printf("error adding address: %v", err)
-			c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to add address"})
+			log.Printf("error fetching addresses: %v", err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to fetch addresses"})
 			return
 		}
 
-		c.JSON(http.StatusCreated, gin.H{
-			"message":    "address added successfully",
-			"address_id": addressID,
-		})
+		c.JSON(http.StatusOK, addresses)
 	}
 }
 
-func (app *Application) EditHomeAddress() gin.HandlerFunc {
+func (app *Application) AddAdress() gin.HandlerFunc {
 	return func(c *gin.Context) {
-		addressQueryID := c.Query("id")
-
-		if addressQueryID == "" {
-			log.Println("address ID is empty")
-			c.JSON(http.StatusBadRequest, gin.H{"error": "address ID is required"})
-			return
-		}
-
-		// Получаем email пользователя из контекста (установлен middleware)
+		// Получаем email пользователя из контекста
 		email, exists := c.Get("email")
 
 		if !exists {
@@ -81,16 +66,7 @@ func (app *Application) EditHomeAddress() gin.HandlerFunc {
 			return
 		}
 
-		// Парсим UUID адреса
-		addressID, err := uuid.Parse(addressQueryID)
-
-		if err != nil {
-			log.Printf("invalid address ID format: %v", err)
-			c.JSON(http.StatusBadRequest, gin.H{"error": "invalid address ID format"})
-			return
-		}
-
-		// Парсим обновленные данные адреса из request body
+		// Парсим адрес из request body
 		var address models.Address
 
 		if err := c.BindJSON(&address); err != nil {
@@ -105,7 +81,7 @@ func (app *Application) EditHomeAddress() gin.HandlerFunc {
 		// Получаем user_id по email
 		var userID string
 
-		err = app.DB.QueryRow(ctx, "SELECT user_id FROM users WHERE email = $1", email).Scan(&userID)
+		err := app.DB.QueryRow(ctx, "SELECT user_id FROM users WHERE email = $1", email).Scan(&userID)
 
 		if err != nil {
 			log.Printf("error finding user: %v", err)
@@ -114,34 +90,170 @@ func (app *Application) EditHomeAddress() gin.HandlerFunc {
 		}
 
 		// Вызываем функцию из database слоя
-		err = database.UpdateAddress(ctx, app.DB, userID, addressID, &address)
+		addressID, err := database.AddAddress(ctx, app.DB, userID, &address, app.MaxAddresses)
 
 		if err != nil {
-			if err == database.ErrAddressNotFound {
-				c.JSON(http.StatusNotFound, gin.H{"error": "address not found"})
+			if addressValidationError(c, err) {
+				return
+			}
 
-			} else {
-				log.Printf("error updating address: %v", err)
-				c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to update address"})
+			switch err {
+			case database.ErrInvalidAddressType:
+				c.JSON(http.StatusBadRequest, gin.H{"error": "address_type must be home, work or other"})
+
+			case database.ErrAddressLimit:
+				c.JSON(http.StatusConflict, gin.H{"error": "address limit reached", "limit": app.MaxAddresses})
+
+			default:
+				log.Printf("error adding address: %v", err)
+				c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to add address"})
 			}
 
 			return
 		}
 
-		c.JSON(http.StatusOK, gin.H{"message": "address updated successfully"})
+		c.JSON(http.StatusCreated, gin.H{
+			"message":    "address added successfully",
+			"address_id": addressID,
+		})
+	}
+}
+
+// EditAddress редактирует адрес любого типа (PUT /addresses/:id)
+func (app *Application) EditAddress() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		app.updateAddress(c, c.Param("id"), "")
 	}
 }
 
+// EditHomeAddress редактирует только домашний адрес
+func (app *Application) EditHomeAddress() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		app.updateAddress(c, c.Query("id"), models.AddressTypeHome)
+	}
+}
+
+// EditWorkAddress редактирует только рабочий адрес
 func (app *Application) EditWorkAddress() gin.HandlerFunc {
 	return func(c *gin.Context) {
-		addressQueryID := c.Query("id")
+		app.updateAddress(c, c.Query("id"), models.AddressTypeWork)
+	}
+}
 
-		if addressQueryID == "" {
-			log.Println("address ID is empty")
-			c.JSON(http.StatusBadRequest, gin.H{"error": "address ID is required"})
+// общая часть редактирования адреса; непустой expectedType - адрес должен быть этого типа
+func (app *Application) updateAddress(c *gin.Context, addressQueryID string, expectedType string) {
+	if addressQueryID == "" {
+		log.Println("address ID is empty")
+		c.JSON(http.StatusBadRequest, gin.H{"error": "address ID is required"})
+		return
+	}
+
+	// Получаем email пользователя из контекста (установлен middleware)
+	email, exists := c.Get("email")
+
+	if !exists {
+		log.Println("user email not found in context")
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "unauthorized"})
+		return
+	}
+
+	// Парсим UUID адреса
+	addressID, err := uuid.Parse(addressQueryID)
+
+	if err != nil {
+		log.Printf("invalid address ID format: %v", err)
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid address ID format"})
+		return
+	}
+
+	// Парсим обновленные данные адреса из request body
+	var address models.Address
+
+	if err := c.BindJSON(&address); err != nil {
+		log.Printf("invalid request body: %v", err)
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid request body"})
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	// Получаем user_id по email
+	var userID string
+
+	err = app.DB.QueryRow(ctx, "SELECT user_id FROM users WHERE email = $1", email).Scan(&userID)
+
+	if err != nil {
+		log.Printf("error finding user: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to find user"})
+		return
+	}
+
+	// Вызываем функцию из database слоя
+	err = database.UpdateAddress(ctx, app.DB, userID, addressID, expectedType, &address)
+
+	if err != nil {
+		if addressValidationError(c, err) {
+			return
+		}
+
+		switch err {
+		case database.ErrAddressNotFound:
+			c.JSON(http.StatusNotFound, gin.H{"error": "address not found"})
+
+		case database.ErrInvalidAddressType:
+			c.JSON(http.StatusBadRequest, gin.H{"error": "address_type must be home, work or other"})
+
+		case database.ErrAddressTypeMismatch:
+			c.JSON(http.StatusConflict, gin.H{"error": "address is not a " + expectedType + " address"})
+
+		default:
+			log.Printf("error updating address: %v", err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to update address"})
+		}
+
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "address updated successfully"})
+}
+
+// ValidateAddress проверяет адрес без сохранения и возвращает его нормализованный вид
+func (app *Application) ValidateAddress() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var address models.Address
+
+		if err := c.BindJSON(&address); err != nil {
+			log.Printf("invalid request body: %v", err)
+			c.JSON(http.StatusBadRequest, gin.H{"error": "invalid request body"})
+			return
+		}
+
+		if err := postal.NormalizeAndValidate(&address); err != nil {
+			addressValidationError(c, err)
 			return
 		}
 
+		c.JSON(http.StatusOK, address)
+	}
+}
+
+// отвечает 400 с ошибками по полям, если адрес не прошел проверку; возвращает true если ошибка обработана
+func addressValidationError(c *gin.Context, err error) bool {
+	var fieldErrors postal.FieldErrors
+
+	if !errors.As(err, &fieldErrors) {
+		return false
+	}
+
+	c.JSON(http.StatusBadRequest, gin.H{"error": "invalid address", "fields": fieldErrors})
+
+	return true
+}
+
+// SetDefaultAddress назначает адрес адресом доставки или платежным по умолчанию (?kind=shipping|billing)
+func (app *Application) SetDefaultAddress() gin.HandlerFunc {
+	return func(c *gin.Context) {
 		// Получаем email пользователя из контекста (установлен middleware)
 		email, exists := c.Get("email")
 
@@ -152,7 +264,7 @@ func (app *Application) EditWorkAddress() gin.HandlerFunc {
 		}
 
 		// Парсим UUID адреса
-		addressID, err := uuid.Parse(addressQueryID)
+		addressID, err := uuid.Parse(c.Param("id"))
 
 		if err != nil {
 			log.Printf("invalid address ID format: %v", err)
@@ -160,14 +272,7 @@ func (app *Application) EditWorkAddress() gin.HandlerFunc {
 			return
 		}
 
-		// Парсим обновленные данные адреса из request body
-		var address models.Address
-
-		if err := c.BindJSON(&address); err != nil {
-			log.Printf("invalid request body: %v", err)
-			c.JSON(http.StatusBadRequest, gin.H{"error": "invalid request body"})
-			return
-		}
+		kind := c.DefaultQuery("kind", models.DefaultAddressShipping)
 
 		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
 		defer cancel()
@@ -184,21 +289,25 @@ func (app *Application) EditWorkAddress() gin.HandlerFunc {
 		}
 
 		// Вызываем функцию из database слоя
-		err = database.UpdateAddress(ctx, app.DB, userID, addressID, &address)
+		err = database.SetDefaultAddress(ctx, app.DB, userID, addressID, kind)
 
 		if err != nil {
-			if err == database.ErrAddressNotFound {
+			switch err {
+			case database.ErrAddressNotFound:
 				c.JSON(http.StatusNotFound, gin.H{"error": "address not found"})
 
-			} else {
-				log.Printf("error updating address: %v", err)
-				c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to update address"})
+			case database.ErrInvalidDefaultKind:
+				c.JSON(http.StatusBadRequest, gin.H{"error": "kind must be shipping or billing"})
+
+			default:
+				log.Printf("error setting default address: %v", err)
+				c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to set default address"})
 			}
 
 			return
 		}
 
-		c.JSON(http.StatusOK, gin.H{"message": "address updated successfully"})
+		c.JSON(http.StatusOK, gin.H{"message": "default " + kind + " address updated"})
 	}
 }
 
@@ -3,6 +3,9 @@ package controllers
 import (
 	"context"
 	"ec-platform/database"
+	"ec-platform/models"
+	"ec-platform/shipping"
+	"errors"
 	"log"
 	"net/http"
 	"time"
@@ -61,6 +64,9 @@ func (app *Application) AddToCart() gin.HandlerFunc {
 			if err == database.ErrRecordNotFound {
 				c.JSON(http.StatusNotFound, gin.H{"error": "product not found"})
 
+			} else if err == database.ErrProductArchived {
+				c.JSON(http.StatusConflict, gin.H{"error": "product is no longer available"})
+
 			} else {
 				log.Printf("error adding product to cart: %v", err)
 				c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to add product to cart"})
@@ -159,8 +165,14 @@ func (app *Application) GetItemFromCart() gin.HandlerFunc {
 			return
 		}
 
+		rate, ok := app.requestRate(ctx, c)
+
+		if !ok {
+			return
+		}
+
 		// Вызываем функцию из database слоя
-		cartItems, err := database.GetCartItems(ctx, app.DB, userID)
+		cartItems, err := database.GetCartItems(ctx, app.DB, userID, rate)
 
 		if err != nil {
 			log.Printf("error fetching cart items: %v", err)
@@ -169,12 +181,16 @@ func (app *Application) GetItemFromCart() gin.HandlerFunc {
 		}
 
 		// Подсчитываем общую стоимость
-		var totalPrice uint64
+		totalPrice, err := database.CartTotal(cartItems)
+
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "cart total is too large"})
+			return
+		}
 
 		totalItems := 0
 
 		for _, item := range cartItems {
-			totalPrice += item.Price * uint64(item.Quantity)
 			totalItems += item.Quantity
 		}
 
@@ -182,6 +198,90 @@ func (app *Application) GetItemFromCart() gin.HandlerFunc {
 			"cart":        cartItems,
 			"total_items": totalItems,
 			"total_price": totalPrice,
+			"currency":    rate.Currency,
+		})
+	}
+}
+
+// тело проверки корзины: подтверждения новых цен из предупреждений price_increased
+type cartValidationRequest struct {
+	Acknowledge []models.CartPriceAck `json:"acknowledge" validate:"dive"`
+}
+
+// ValidateCart проверяет корзину перед оформлением: рост и снижение цены с момента добавления,
+// нехватку остатка и товары в архиве. Рост цены подтверждается повторным запросом
+// {acknowledge: [{product_id, price}]} с ценой из предупреждения
+func (app *Application) ValidateCart() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		email, exists := c.Get("email")
+
+		if !exists {
+			log.Println("user email not found in context")
+			c.JSON(http.StatusUnauthorized, gin.H{"error": "unauthorized"})
+			return
+		}
+
+		var request cartValidationRequest
+
+		if c.Request.ContentLength > 0 {
+			if err := c.BindJSON(&request); err != nil {
+				log.Printf("invalid request body: %v", err)
+				c.JSON(http.StatusBadRequest, gin.H{"error": "invalid request body"})
+				return
+			}
+		}
+
+		if validationErr := validate.Struct(request); validationErr != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Validation failed: " + validationErr.Error()})
+			return
+		}
+
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+
+		var userID string
+
+		err := app.DB.QueryRow(ctx, "SELECT user_id FROM users WHERE email = $1", email).Scan(&userID)
+
+		if err != nil {
+			log.Printf("error finding user: %v", err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to find user"})
+			return
+		}
+
+		rate, ok := app.requestRate(ctx, c)
+
+		if !ok {
+			return
+		}
+
+		cartItems, warnings, canCheckout, err := database.ValidateCart(ctx, app.DB, userID, request.Acknowledge, app.BaseCurrency, rate)
+
+		if err != nil {
+			if err == database.ErrCantGetItem {
+				c.JSON(http.StatusBadRequest, gin.H{"error": "cart is empty"})
+
+			} else {
+				log.Printf("error validating cart: %v", err)
+				c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to validate cart"})
+			}
+
+			return
+		}
+
+		totalPrice, err := database.CartTotal(cartItems)
+
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "cart total is too large"})
+			return
+		}
+
+		c.JSON(http.StatusOK, gin.H{
+			"cart":         cartItems,
+			"total_price":  totalPrice,
+			"currency":     rate.Currency,
+			"warnings":     warnings,
+			"can_checkout": canCheckout,
 		})
 	}
 }
@@ -201,6 +301,19 @@ func (app *Application) BuyFromCart() gin.HandlerFunc {
 
 		defer cancel()
 
+		// Адрес, способ доставки, валюта и способ оплаты
+		params, ok := app.checkoutParams(ctx, c)
+
+		if !ok {
+			return
+		}
+
+		paymentMethod, paymentToken, ok := app.paymentParams(c)
+
+		if !ok {
+			return
+		}
+
 		// Получаем user_id по email
 		var userID string
 
@@ -213,13 +326,13 @@ func (app *Application) BuyFromCart() gin.HandlerFunc {
 		}
 
 		// Вызываем функцию из database слоя
-		orderID, totalPrice, err := database.BuyItemFromCart(ctx, app.DB, userID)
+		orderID, totalPrice, err := database.BuyItemFromCart(ctx, app.DB, userID, params)
 
 		if err != nil {
 			if err == database.ErrCantGetItem {
 				c.JSON(http.StatusBadRequest, gin.H{"error": "cart is empty"})
 
-			} else {
+			} else if !checkoutError(c, err) {
 				log.Printf("error processing cart purchase: %v", err)
 				c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to process order"})
 			}
@@ -227,11 +340,10 @@ func (app *Application) BuyFromCart() gin.HandlerFunc {
 			return
 		}
 
-		c.JSON(http.StatusOK, gin.H{
-			"message":     "order placed successfully",
-			"order_id":    orderID,
-			"total_price": totalPrice,
-		})
+		// Оплата заказа: неудачная попытка не отменяет заказ, его можно оплатить повторно
+		payment, err := app.payOrder(ctx, userID, orderID, paymentMethod, paymentToken)
+
+		app.orderPlacedResponse(c, orderID, totalPrice, payment, err)
 	}
 }
 
@@ -266,6 +378,19 @@ func (app *Application) InstantBuy() gin.HandlerFunc {
 		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
 		defer cancel()
 
+		// Адрес, способ доставки, валюта и способ оплаты
+		params, ok := app.checkoutParams(ctx, c)
+
+		if !ok {
+			return
+		}
+
+		paymentMethod, paymentToken, ok := app.paymentParams(c)
+
+		if !ok {
+			return
+		}
+
 		// Получаем user_id по email
 		var userID string
 
@@ -278,13 +403,13 @@ func (app *Application) InstantBuy() gin.HandlerFunc {
 		}
 
 		// Вызываем функцию из database слоя
-		orderID, totalPrice, err := database.InstantBuyer(ctx, app.DB, userID, productID)
+		orderID, totalPrice, err := database.InstantBuyer(ctx, app.DB, userID, productID, params)
 
 		if err != nil {
 			if err == database.ErrRecordNotFound {
 				c.JSON(http.StatusNotFound, gin.H{"error": "product not found"})
 
-			} else {
+			} else if !checkoutError(c, err) {
 				log.Printf("error processing instant buy: %v", err)
 				c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to process order"})
 			}
@@ -292,10 +417,77 @@ func (app *Application) InstantBuy() gin.HandlerFunc {
 			return
 		}
 
-		c.JSON(http.StatusOK, gin.H{
-			"message":     "order placed successfully",
-			"order_id":    orderID,
-			"total_price": totalPrice,
-		})
+		// Оплата заказа: неудачная попытка не отменяет заказ, его можно оплатить повторно
+		payment, err := app.payOrder(ctx, userID, orderID, paymentMethod, paymentToken)
+
+		app.orderPlacedResponse(c, orderID, totalPrice, payment, err)
 	}
 }
+
+// читает адрес, способ доставки и валюту оплаты из query параметров заказа
+func (app *Application) checkoutParams(ctx context.Context, c *gin.Context) (database.CheckoutParams, bool) {
+	// Без address_id используется адрес доставки по умолчанию
+	var addressID uuid.UUID
+
+	if addressQueryID := c.Query("address_id"); addressQueryID != "" {
+		parsed, err := uuid.Parse(addressQueryID)
+
+		if err != nil {
+			log.Printf("invalid address ID format: %v", err)
+			c.JSON(http.StatusBadRequest, gin.H{"error": "invalid address ID format"})
+			return database.CheckoutParams{}, false
+		}
+
+		addressID = parsed
+	}
+
+	method := c.DefaultQuery("shipping_method", shipping.MethodStandard)
+
+	rate, ok := app.requestRate(ctx, c)
+
+	if !ok {
+		return database.CheckoutParams{}, false
+	}
+
+	return database.CheckoutParams{
+		AddressID:      addressID,
+		ShippingMethod: method,
+		Rates:          app.Shipping,
+		BaseCurrency:   app.BaseCurrency,
+		Rate:           rate,
+	}, true
+}
+
+// отвечает на ошибки адреса, остатков, проверки корзины и доставки при оформлении заказа,
+// возвращает true если ошибка обработана
+func checkoutError(c *gin.Context, err error) bool {
+	var warnings database.CartWarnings
+
+	switch {
+	case errors.As(err, &warnings):
+		c.JSON(http.StatusConflict, gin.H{"error": "cart has changed, review it with POST /cart/validate", "warnings": warnings})
+
+	case errors.Is(err, database.ErrProductArchived):
+		c.JSON(http.StatusConflict, gin.H{"error": "product is no longer available"})
+
+	case errors.Is(err, database.ErrAddressNotFound):
+		c.JSON(http.StatusNotFound, gin.H{"error": "address not found"})
+
+	case errors.Is(err, database.ErrOutOfStock):
+		c.JSON(http.StatusConflict, gin.H{"error": "product is out of stock"})
+
+	case errors.Is(err, shipping.ErrUnknownMethod):
+		c.JSON(http.StatusBadRequest, gin.H{"error": "unknown shipping method"})
+
+	case errors.Is(err, shipping.ErrNoRate):
+		c.JSON(http.StatusBadRequest, gin.H{"error": "shipping is not available for this address"})
+
+	case errors.Is(err, models.ErrMoneyOverflow):
+		c.JSON(http.StatusBadRequest, gin.H{"error": "order total is too large"})
+
+	default:
+		return false
+	}
+
+	return true
+}
@@ -0,0 +1,94 @@
+package controllers
+
+import (
+	"context"
+	"ec-platform/database"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// RestoreCart - ссылка из письма о брошенной корзине: возвращает товары снимка в корзину.
+// Работает без авторизации - пользователь определяется по секретному токену ссылки
+func (app *Application) RestoreCart() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+
+		reminder, err := database.RestoreCart(ctx, app.DB, c.Param("token"))
+
+		if err != nil {
+			switch err {
+			case database.ErrCartReminderNotFound:
+				c.JSON(http.StatusNotFound, gin.H{"error": "restore link not found"})
+
+			case database.ErrCartReminderExpired:
+				c.JSON(http.StatusGone, gin.H{"error": "restore link has expired"})
+
+			default:
+				log.Printf("error restoring cart: %v", err)
+				c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to restore cart"})
+			}
+
+			return
+		}
+
+		c.JSON(http.StatusOK, gin.H{"message": "cart restored", "items": reminder.Items})
+	}
+}
+
+// GetCartRecoveryReport возвращает отчет по напоминаниям о брошенных корзинах
+// за период ?from=YYYY-MM-DD&to=YYYY-MM-DD (по умолчанию - последние 30 дней, to включительно)
+func (app *Application) GetCartRecoveryReport() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		today := time.Now().UTC().Truncate(24 * time.Hour)
+
+		from := today.AddDate(0, 0, -29)
+		to := today
+
+		if value := c.Query("from"); value != "" {
+			parsed, err := time.Parse("2006-01-02", value)
+
+			if err != nil {
+				c.JSON(http.StatusBadRequest, gin.H{"error": "invalid from date, expected YYYY-MM-DD"})
+				return
+			}
+
+			from = parsed
+		}
+
+		if value := c.Query("to"); value != "" {
+			parsed, err := time.Parse("2006-01-02", value)
+
+			if err != nil {
+				c.JSON(http.StatusBadRequest, gin.H{"error": "invalid to date, expected YYYY-MM-DD"})
+				return
+			}
+
+			to = parsed
+		}
+
+		if to.Before(from) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "to must not be before from"})
+			return
+		}
+
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+
+		report, err := database.GetCartRecoveryReport(ctx, app.DB, from, to.AddDate(0, 0, 1))
+
+		if err != nil {
+			log.Printf("error building cart recovery report: %v", err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to build cart recovery report"})
+			return
+		}
+
+		// В отчете - включительная граница периода, как в запросе
+		report.To = to
+
+		c.JSON(http.StatusOK, report)
+	}
+}
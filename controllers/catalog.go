@@ -0,0 +1,215 @@
+package controllers
+
+import (
+	"context"
+	"ec-platform/catalog"
+	"ec-platform/database"
+	"ec-platform/models"
+	"errors"
+	"log"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+)
+
+// наибольший размер файла импорта каталога
+const maxCatalogImportBytes = 50 << 20
+
+// тип содержимого файла каталога по формату
+var catalogContentTypes = map[string]string{
+	catalog.FormatCSV:  "text/csv; charset=utf-8",
+	catalog.FormatJSON: "application/json; charset=utf-8",
+}
+
+// ImportCatalog принимает файл каталога (multipart, поле file; format=csv|json или по расширению файла)
+// и ставит импорт в очередь. dry_run=true - только проверка и подсчет, каталог не меняется
+func (app *Application) ImportCatalog() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		email, exists := c.Get("email")
+
+		if !exists {
+			log.Println("user email not found in context")
+			c.JSON(http.StatusUnauthorized, gin.H{"error": "unauthorized"})
+			return
+		}
+
+		dryRun, err := strconv.ParseBool(c.DefaultQuery("dry_run", "false"))
+
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "invalid dry_run, expected true or false"})
+			return
+		}
+
+		c.Request.Body = http.MaxBytesReader(c.Writer, c.Request.Body, maxCatalogImportBytes+1<<20)
+
+		file, err := c.FormFile("file")
+
+		if err != nil {
+			var maxBytesErr *http.MaxBytesError
+
+			if errors.As(err, &maxBytesErr) {
+				c.JSON(http.StatusRequestEntityTooLarge, gin.H{"error": "catalog file is too large"})
+
+			} else {
+				log.Printf("invalid multipart form: %v", err)
+				c.JSON(http.StatusBadRequest, gin.H{"error": "expected multipart/form-data with file field"})
+			}
+
+			return
+		}
+
+		if file.Size > maxCatalogImportBytes {
+			c.JSON(http.StatusRequestEntityTooLarge, gin.H{"error": "catalog file is too large"})
+			return
+		}
+
+		format := c.DefaultQuery("format", c.PostForm("format"))
+
+		if format == "" {
+			format = catalog.FormatFromFilename(file.Filename)
+		}
+
+		contentType, ok := catalogContentTypes[format]
+
+		if !ok {
+			c.JSON(http.StatusBadRequest, gin.H{"error": catalog.ErrUnsupportedFormat.Error()})
+			return
+		}
+
+		reader, err := file.Open()
+
+		if err != nil {
+			log.Printf("error opening uploaded catalog: %v", err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to read uploaded file"})
+			return
+		}
+
+		defer reader.Close()
+
+		ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+		defer cancel()
+
+		importID := uuid.New()
+
+		catalogImport := &models.CatalogImport{
+			Import_ID:   importID,
+			Format:      format,
+			Dry_Run:     dryRun,
+			Storage_Key: "imports/" + importID.String() + "." + format,
+			Created_By:  email.(string),
+		}
+
+		if err := app.Imports.Put(ctx, catalogImport.Storage_Key, reader, contentType); err != nil {
+			log.Printf("error storing catalog import file: %v", err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to store uploaded file"})
+			return
+		}
+
+		err = database.CreateCatalogImport(ctx, app.DB, catalogImport, models.JobCatalogImport, catalog.ImportJob{Import_ID: importID})
+
+		if err != nil {
+			log.Printf("error creating catalog import: %v", err)
+
+			if err := app.Imports.Delete(ctx, catalogImport.Storage_Key); err != nil {
+				log.Printf("error deleting catalog import file %s: %v", catalogImport.Storage_Key, err)
+			}
+
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to create catalog import"})
+			return
+		}
+
+		c.JSON(http.StatusAccepted, gin.H{"import": catalogImport})
+	}
+}
+
+// последние импорты каталога
+func (app *Application) GetCatalogImports() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+
+		imports, err := database.GetCatalogImports(ctx, app.DB, 50)
+
+		if err != nil {
+			log.Printf("error fetching catalog imports: %v", err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to fetch catalog imports"})
+			return
+		}
+
+		c.JSON(http.StatusOK, gin.H{"imports": imports})
+	}
+}
+
+// GetCatalogImport - прогресс импорта и ошибки по строкам
+func (app *Application) GetCatalogImport() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		importID, err := uuid.Parse(c.Param("id"))
+
+		if err != nil {
+			log.Printf("invalid import ID format: %v", err)
+			c.JSON(http.StatusBadRequest, gin.H{"error": "invalid import ID format"})
+			return
+		}
+
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+
+		catalogImport, err := database.GetCatalogImport(ctx, app.DB, importID)
+
+		if err != nil {
+			if err == database.ErrCatalogImportNotFound {
+				c.JSON(http.StatusNotFound, gin.H{"error": "catalog import not found"})
+
+			} else {
+				log.Printf("error fetching catalog import: %v", err)
+				c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to fetch catalog import"})
+			}
+
+			return
+		}
+
+		c.JSON(http.StatusOK, gin.H{"import": catalogImport})
+	}
+}
+
+// ExportCatalog отдает весь каталог потоком в формате импорта (?format=csv|json, по умолчанию csv)
+func (app *Application) ExportCatalog() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		format := c.DefaultQuery("format", catalog.FormatCSV)
+		contentType, ok := catalogContentTypes[format]
+
+		if !ok {
+			c.JSON(http.StatusBadRequest, gin.H{"error": catalog.ErrUnsupportedFormat.Error()})
+			return
+		}
+
+		// Каталог большой: без общего таймаута, выгрузка прерывается только при отключении клиента
+		ctx := c.Request.Context()
+
+		c.Header("Content-Type", contentType)
+		c.Header("Content-Disposition", `attachment; filename="catalog-`+time.Now().UTC().Format("20060102")+"."+format+`"`)
+
+		writer, err := catalog.NewWriter(format, c.Writer)
+
+		if err == nil {
+			err = database.ExportCatalog(ctx, app.DB, writer.Write)
+		}
+
+		if err == nil {
+			err = writer.Close()
+		}
+
+		if err != nil {
+			log.Printf("error exporting catalog: %v", err)
+
+			// Пока ничего не отправлено, можно ответить ошибкой; иначе клиент получит оборванный файл
+			if !c.Writer.Written() {
+				c.Header("Content-Disposition", "")
+				c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to export catalog"})
+			}
+		}
+	}
+}
@@ -6,8 +6,16 @@ import (
 	"net/http"
 	"time"
 
+	"ec-platform/catalog"
+	"ec-platform/currency"
 	"ec-platform/database"
+	"ec-platform/jobs"
 	"ec-platform/models"
+	"ec-platform/notifications"
+	"ec-platform/payments"
+	"ec-platform/realtime"
+	"ec-platform/shipping"
+	"ec-platform/storage"
 	generate "ec-platform/tokens"
 
 	"github.com/gin-gonic/gin"
@@ -22,7 +30,29 @@ var validate = validator.New()
 
 // Application будет хранить зависимости, такие как подключение к БД
 type Application struct {
-	DB *pgxpool.Pool
+	DB       *pgxpool.Pool
+	Shipping shipping.RateTable
+	Payments *payments.Registry
+
+	// Попытки оплаты заказов (таблица payments)
+	PaymentStore database.PaymentStore
+
+	// Уведомления о переходах статуса заказов для потоков SSE
+	OrderEvents *realtime.Hub
+
+	// Сколько адресов может быть у пользователя (0 - без ограничения)
+	MaxAddresses int
+
+	// Хранилище изображений товаров и ограничения загрузки
+	Images           storage.BlobStore
+	MaxImageBytes    int64
+	MaxProductImages int
+
+	// Загруженные файлы импорта каталога (не отдаются наружу, в отличие от Images)
+	Imports storage.BlobStore
+
+	// Валюта, в которой хранятся цены каталога и тарифы доставки
+	BaseCurrency string
 }
 
 // хеширует пароль с использованием bcrypt
@@ -98,7 +128,7 @@ func (app *Application) SignUp() gin.HandlerFunc {
 		user.User_ID = user.ID.String()
 
 		// Генерируем JWT токены
-		token, refreshToken, err := generate.TokenGenerator(*user.Email, *user.First_Name, *user.Last_Name)
+		token, refreshToken, err := generate.TokenGenerator(*user.Email, *user.First_Name, *user.Last_Name, false)
 		if err != nil {
 			log.Printf("Error generating tokens: %v", err)
 			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to generate authentication tokens"})
@@ -111,13 +141,18 @@ func (app *Application) SignUp() gin.HandlerFunc {
 		user.Address_Details = make([]models.Address, 0)
 		user.Order_Status = make([]models.Order, 0)
 
+		if user.Locale == nil {
+			locale := notifications.DefaultLocale
+			user.Locale = &locale
+		}
+
 		// Вставляем нового пользователя в базу данных
 		insertQuery := `
-            INSERT INTO users (id, first_name, last_name, password, email, phone, user_id, token, refresh_token, created_at, updated_at)
-            VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11)
+            INSERT INTO users (id, first_name, last_name, password, email, phone, locale, user_id, token, refresh_token, created_at, updated_at)
+            VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12)
         `
 		_, err = app.DB.Exec(ctx, insertQuery,
-			user.ID, user.First_Name, user.Last_Name, user.Password, user.Email, user.Phone, user.User_ID, user.Token, user.Refresh_Token, user.Created_At, user.Updated_At,
+			user.ID, user.First_Name, user.Last_Name, user.Password, user.Email, user.Phone, user.Locale, user.User_ID, user.Token, user.Refresh_Token, user.Created_At, user.Updated_At,
 		)
 
 		if err != nil {
@@ -126,6 +161,13 @@ func (app *Application) SignUp() gin.HandlerFunc {
 			return
 		}
 
+		// Приветственное письмо отправляется в фоне; ошибка постановки не мешает регистрации
+		welcome := notifications.EmailJob{Template: notifications.TemplateWelcome, User_ID: user.User_ID}
+
+		if _, err := jobs.Enqueue(ctx, app.DB, models.JobSendEmail, welcome); err != nil {
+			log.Printf("Error enqueueing welcome email for %s: %v", user.User_ID, err)
+		}
+
 		c.JSON(http.StatusCreated, gin.H{"message": "User created successfully", "user_id": user.User_ID})
 	}
 }
@@ -145,7 +187,7 @@ func (app *Application) Login() gin.HandlerFunc {
 		// Ищем пользователя в базе данных по email
 		var foundUser models.User
 
-		query := "SELECT id, first_name, last_name, password, email, phone, user_id, created_at, updated_at FROM users WHERE email = $1"
+		query := "SELECT id, first_name, last_name, password, email, phone, user_id, is_admin, created_at, updated_at FROM users WHERE email = $1"
 
 		err := app.DB.QueryRow(ctx, query, user.Email).Scan(
 			&foundUser.ID,
@@ -155,6 +197,7 @@ func (app *Application) Login() gin.HandlerFunc {
 			&foundUser.Email,
 			&foundUser.Phone,
 			&foundUser.User_ID,
+			&foundUser.Is_Admin,
 			&foundUser.Created_At,
 			&foundUser.Updated_At,
 		)
@@ -173,7 +216,7 @@ func (app *Application) Login() gin.HandlerFunc {
 		}
 
 		// Генерируем новые токены
-		token, refreshToken, err := generate.TokenGenerator(*foundUser.Email, *foundUser.First_Name, *foundUser.Last_Name)
+		token, refreshToken, err := generate.TokenGenerator(*foundUser.Email, *foundUser.First_Name, *foundUser.Last_Name, foundUser.Is_Admin)
 
 		if err != nil {
 			log.Printf("Error generating tokens: %v", err)
@@ -221,12 +264,25 @@ func (app *Application) ProductViewerAdmin() gin.HandlerFunc {
 			return
 		}
 
+		if product.SKU != nil {
+			if err := catalog.ValidateSKU(*product.SKU); err != nil {
+				c.JSON(http.StatusBadRequest, gin.H{"error": "sku " + err.Error()})
+				return
+			}
+		}
+
 		// Добавляем продукт в базу данных
 		productID, err := database.AddProduct(ctx, app.DB, &product)
 
 		if err != nil {
-			log.Printf("error adding product: %v", err)
-			c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to add product"})
+			if err == database.ErrProductExists {
+				c.JSON(http.StatusConflict, gin.H{"error": "product with this sku already exists"})
+
+			} else {
+				log.Printf("error adding product: %v", err)
+				c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to add product"})
+			}
+
 			return
 		}
 
@@ -237,15 +293,76 @@ func (app *Application) ProductViewerAdmin() gin.HandlerFunc {
 	}
 }
 
+// ArchiveProduct снимает товар с продажи: он пропадает из поиска, его нельзя добавить в корзину
+// и оформить; в корзинах покупателей проверка корзины предупреждает о нем
+func (app *Application) ArchiveProduct() gin.HandlerFunc {
+	return app.setProductArchived(true)
+}
+
+// UnarchiveProduct возвращает товар из архива в продажу
+func (app *Application) UnarchiveProduct() gin.HandlerFunc {
+	return app.setProductArchived(false)
+}
+
+func (app *Application) setProductArchived(archived bool) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		productID, err := uuid.Parse(c.Param("id"))
+
+		if err != nil {
+			log.Printf("invalid product ID format: %v", err)
+			c.JSON(http.StatusBadRequest, gin.H{"error": "invalid product ID format"})
+			return
+		}
+
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+
+		if err := database.SetProductArchived(ctx, app.DB, productID, archived); err != nil {
+			if err == database.ErrRecordNotFound {
+				c.JSON(http.StatusNotFound, gin.H{"error": "product not found"})
+
+			} else {
+				log.Printf("error archiving product: %v", err)
+				c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to update product"})
+			}
+
+			return
+		}
+
+		product, err := database.GetProduct(ctx, app.DB, productID, currency.Identity(app.BaseCurrency))
+
+		if err != nil {
+			log.Printf("error fetching product: %v", err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to fetch product"})
+			return
+		}
+
+		c.JSON(http.StatusOK, gin.H{"product": product})
+	}
+}
+
 func (app *Application) SearchProduct() gin.HandlerFunc {
 	return func(c *gin.Context) {
 		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
 		defer cancel()
 
+		// Цены - в валюте из query параметра currency
+		rate, ok := app.requestRate(ctx, c)
+
+		if !ok {
+			return
+		}
+
 		// Получаем все Product из базы данных
-		query := "SELECT product_id, product_name, price, rating, image FROM products ORDER BY product_name"
+		query := `
+			SELECT p.product_id, p.product_name, pp.price, pp.compare_at_price, pp.sale_ends_at, p.rating, p.rating_count, p.image
+			FROM products p
+			JOIN LATERAL product_price_in(p.product_id, $1, $2, $3, $4) pp ON TRUE
+			WHERE p.archived_at IS NULL
+			ORDER BY p.product_name
+		`
 
-		rows, err := app.DB.Query(ctx, query)
+		rows, err := app.DB.Query(ctx, query, time.Now().UTC(), rate.Currency, rate.Value, rate.Scale)
 
 		if err != nil {
 			log.Printf("error fetching products: %v", err)
@@ -258,9 +375,9 @@ func (app *Application) SearchProduct() gin.HandlerFunc {
 		var productList []models.Product
 
 		for rows.Next() {
-			var product models.Product
+			product := models.Product{Currency: rate.Currency}
 
-			err := rows.Scan(&product.Product_ID, &product.Product_Name, &product.Price, &product.Rating, &product.Image)
+			err := rows.Scan(&product.Product_ID, &product.Product_Name, &product.Price, &product.Compare_At_Price, &product.Sale_Ends_At, &product.Rating, &product.Rating_Count, &product.Image)
 
 			if err != nil {
 				log.Printf("error scanning product: %v", err)
@@ -289,10 +406,23 @@ func (app *Application) SearchProductByQuery() gin.HandlerFunc {
 			return
 		}
 
+		// Цены - в валюте из query параметра currency
+		rate, ok := app.requestRate(ctx, c)
+
+		if !ok {
+			return
+		}
+
 		// Используем ILIKE для case-insensitive поиска в PostgreSQL
-		query := "SELECT product_id, product_name, price, rating, image FROM products WHERE product_name ILIKE '%' || $1 || '%' ORDER BY product_name"
+		query := `
+			SELECT p.product_id, p.product_name, pp.price, pp.compare_at_price, pp.sale_ends_at, p.rating, p.rating_count, p.image
+			FROM products p
+			JOIN LATERAL product_price_in(p.product_id, $2, $3, $4, $5) pp ON TRUE
+			WHERE p.product_name ILIKE '%' || $1 || '%' AND p.archived_at IS NULL
+			ORDER BY p.product_name
+		`
 
-		rows, err := app.DB.Query(ctx, query, queryParam)
+		rows, err := app.DB.Query(ctx, query, queryParam, time.Now().UTC(), rate.Currency, rate.Value, rate.Scale)
 
 		if err != nil {
 			log.Printf("error searching products: %v", err)
@@ -305,9 +435,9 @@ func (app *Application) SearchProductByQuery() gin.HandlerFunc {
 		var searchProducts []models.Product
 
 		for rows.Next() {
-			var product models.Product
+			product := models.Product{Currency: rate.Currency}
 
-			err := rows.Scan(&product.Product_ID, &product.Product_Name, &product.Price, &product.Rating, &product.Image)
+			err := rows.Scan(&product.Product_ID, &product.Product_Name, &product.Price, &product.Compare_At_Price, &product.Sale_Ends_At, &product.Rating, &product.Rating_Count, &product.Image)
 
 			if err != nil {
 				log.Printf("error scanning product: %v", err)
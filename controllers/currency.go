@@ -0,0 +1,290 @@
+package controllers
+
+import (
+	"context"
+	"ec-platform/currency"
+	"ec-platform/database"
+	"ec-platform/models"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+)
+
+// тело запроса курса валюты: десятичная строка, чтобы курс не терял точность во float
+type exchangeRateRequest struct {
+	Rate string `json:"rate" validate:"required"`
+}
+
+// тело запроса цены товара в валюте (в минорных единицах валюты)
+type currencyPriceRequest struct {
+	Price *models.Money `json:"price" validate:"required"`
+}
+
+// курс пересчета цен в валюту из query параметра currency, по умолчанию - базовая валюта.
+// Отвечает 400 на неизвестную валюту или валюту без курса
+func (app *Application) requestRate(ctx context.Context, c *gin.Context) (currency.Rate, bool) {
+	code, err := currency.Normalize(c.DefaultQuery("currency", app.BaseCurrency))
+
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "unknown currency"})
+		return currency.Rate{}, false
+	}
+
+	rate, err := database.GetRate(ctx, app.DB, app.BaseCurrency, code)
+
+	if err != nil {
+		if err == database.ErrCurrencyNotSupported {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "currency is not supported"})
+
+		} else {
+			log.Printf("error fetching exchange rate: %v", err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to fetch exchange rate"})
+		}
+
+		return currency.Rate{}, false
+	}
+
+	return rate, true
+}
+
+// код валюты из пути запроса; базовую валюту менять нельзя - ее курс всегда 1, а цены задаются напрямую
+func (app *Application) currencyParam(c *gin.Context) (string, bool) {
+	code, err := currency.Normalize(c.Param("currency"))
+
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "unknown currency"})
+		return "", false
+	}
+
+	if code == app.BaseCurrency {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "base currency has no exchange rate or currency prices"})
+		return "", false
+	}
+
+	return code, true
+}
+
+// GetCurrencies - базовая валюта и валюты с курсом, в которых можно смотреть цены и оформлять заказы
+func (app *Application) GetCurrencies() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+
+		rates, err := database.GetExchangeRates(ctx, app.DB)
+
+		if err != nil {
+			log.Printf("error fetching exchange rates: %v", err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to fetch exchange rates"})
+			return
+		}
+
+		c.JSON(http.StatusOK, gin.H{
+			"base":        app.BaseCurrency,
+			"minor_units": currency.MinorUnits(app.BaseCurrency),
+			"rates":       rates,
+		})
+	}
+}
+
+// SetExchangeRate задает курс {rate} валюты из пути: сколько единиц валюты дают за единицу базовой
+func (app *Application) SetExchangeRate() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		email, exists := c.Get("email")
+
+		if !exists {
+			log.Println("user email not found in context")
+			c.JSON(http.StatusUnauthorized, gin.H{"error": "unauthorized"})
+			return
+		}
+
+		code, ok := app.currencyParam(c)
+
+		if !ok {
+			return
+		}
+
+		var request exchangeRateRequest
+
+		if err := c.BindJSON(&request); err != nil {
+			log.Printf("invalid request body: %v", err)
+			c.JSON(http.StatusBadRequest, gin.H{"error": "invalid request body"})
+			return
+		}
+
+		if validationErr := validate.Struct(request); validationErr != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Validation failed: " + validationErr.Error()})
+			return
+		}
+
+		if _, err := currency.ParseRate(request.Rate); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+
+		updatedBy := email.(string)
+		rate := models.ExchangeRate{Currency: code, Rate: request.Rate, Updated_By: &updatedBy}
+
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+
+		if err := database.SetExchangeRate(ctx, app.DB, &rate); err != nil {
+			log.Printf("error setting exchange rate: %v", err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to set exchange rate"})
+			return
+		}
+
+		c.JSON(http.StatusOK, gin.H{"rate": rate})
+	}
+}
+
+// DeleteExchangeRate убирает курс валюты: цены и заказы в ней больше недоступны
+func (app *Application) DeleteExchangeRate() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		code, ok := app.currencyParam(c)
+
+		if !ok {
+			return
+		}
+
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+
+		if err := database.DeleteExchangeRate(ctx, app.DB, code); err != nil {
+			if err == database.ErrExchangeRateNotFound {
+				c.JSON(http.StatusNotFound, gin.H{"error": "exchange rate not found"})
+
+			} else {
+				log.Printf("error deleting exchange rate: %v", err)
+				c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to delete exchange rate"})
+			}
+
+			return
+		}
+
+		c.JSON(http.StatusOK, gin.H{"message": "exchange rate deleted"})
+	}
+}
+
+// GetProductCurrencyPrices - цены товара, заданные вручную в других валютах
+func (app *Application) GetProductCurrencyPrices() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		productID, err := uuid.Parse(c.Param("id"))
+
+		if err != nil {
+			log.Printf("invalid product ID format: %v", err)
+			c.JSON(http.StatusBadRequest, gin.H{"error": "invalid product ID format"})
+			return
+		}
+
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+
+		prices, err := database.GetProductCurrencyPrices(ctx, app.DB, productID)
+
+		if err != nil {
+			log.Printf("error fetching currency prices: %v", err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to fetch currency prices"})
+			return
+		}
+
+		c.JSON(http.StatusOK, gin.H{"prices": prices})
+	}
+}
+
+// SetProductCurrencyPrice задает цену товара {price} в валюте из пути вместо пересчета по курсу
+func (app *Application) SetProductCurrencyPrice() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		email, exists := c.Get("email")
+
+		if !exists {
+			log.Println("user email not found in context")
+			c.JSON(http.StatusUnauthorized, gin.H{"error": "unauthorized"})
+			return
+		}
+
+		productID, err := uuid.Parse(c.Param("id"))
+
+		if err != nil {
+			log.Printf("invalid product ID format: %v", err)
+			c.JSON(http.StatusBadRequest, gin.H{"error": "invalid product ID format"})
+			return
+		}
+
+		code, ok := app.currencyParam(c)
+
+		if !ok {
+			return
+		}
+
+		var request currencyPriceRequest
+
+		if err := c.BindJSON(&request); err != nil {
+			log.Printf("invalid request body: %v", err)
+			c.JSON(http.StatusBadRequest, gin.H{"error": "invalid request body"})
+			return
+		}
+
+		if validationErr := validate.Struct(request); validationErr != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Validation failed: " + validationErr.Error()})
+			return
+		}
+
+		price := models.CurrencyAmount{Amount: *request.Price, Currency: code}
+
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+
+		if err := database.SetProductCurrencyPrice(ctx, app.DB, productID, price, email.(string)); err != nil {
+			if err == database.ErrRecordNotFound {
+				c.JSON(http.StatusNotFound, gin.H{"error": "product not found"})
+
+			} else {
+				log.Printf("error setting currency price: %v", err)
+				c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to set currency price"})
+			}
+
+			return
+		}
+
+		c.JSON(http.StatusOK, gin.H{"price": price})
+	}
+}
+
+// DeleteProductCurrencyPrice убирает ручную цену: цена в валюте снова считается по курсу
+func (app *Application) DeleteProductCurrencyPrice() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		productID, err := uuid.Parse(c.Param("id"))
+
+		if err != nil {
+			log.Printf("invalid product ID format: %v", err)
+			c.JSON(http.StatusBadRequest, gin.H{"error": "invalid product ID format"})
+			return
+		}
+
+		code, ok := app.currencyParam(c)
+
+		if !ok {
+			return
+		}
+
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+
+		if err := database.DeleteProductCurrencyPrice(ctx, app.DB, productID, code); err != nil {
+			if err == database.ErrCurrencyPriceNotFound {
+				c.JSON(http.StatusNotFound, gin.H{"error": "currency price not found"})
+
+			} else {
+				log.Printf("error deleting currency price: %v", err)
+				c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to delete currency price"})
+			}
+
+			return
+		}
+
+		c.JSON(http.StatusOK, gin.H{"message": "currency price deleted"})
+	}
+}
@@ -0,0 +1,224 @@
+package controllers
+
+import (
+	"bytes"
+	"context"
+	"ec-platform/database"
+	"ec-platform/invoices"
+	"ec-platform/models"
+	"log"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+)
+
+// отдает документ в формате из query параметра format: html (по умолчанию), pdf или json
+func renderInvoice(c *gin.Context, invoice *models.Invoice) {
+	var buf bytes.Buffer
+
+	switch c.DefaultQuery("format", "html") {
+	case "json":
+		c.JSON(http.StatusOK, invoice)
+
+	case "html":
+		if err := invoices.RenderHTML(&buf, invoice); err != nil {
+			log.Printf("error rendering invoice %s: %v", invoice.Number, err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to render invoice"})
+			return
+		}
+
+		c.Data(http.StatusOK, "text/html; charset=utf-8", buf.Bytes())
+
+	case "pdf":
+		if err := invoices.RenderPDF(&buf, invoice); err != nil {
+			log.Printf("error rendering invoice %s: %v", invoice.Number, err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to render invoice"})
+			return
+		}
+
+		c.Header("Content-Disposition", `inline; filename="`+invoice.Number+`.pdf"`)
+		c.Data(http.StatusOK, "application/pdf", buf.Bytes())
+
+	default:
+		c.JSON(http.StatusBadRequest, gin.H{"error": "unknown format"})
+	}
+}
+
+// документы (счет и корректировочные счета) по заказу пользователя
+func (app *Application) GetOrderInvoices() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		// Получаем email пользователя из контекста (установлен middleware)
+		email, exists := c.Get("email")
+
+		if !exists {
+			log.Println("user email not found in context")
+			c.JSON(http.StatusUnauthorized, gin.H{"error": "unauthorized"})
+			return
+		}
+
+		// Парсим UUID заказа
+		orderID, err := uuid.Parse(c.Param("id"))
+
+		if err != nil {
+			log.Printf("invalid order ID format: %v", err)
+			c.JSON(http.StatusBadRequest, gin.H{"error": "invalid order ID format"})
+			return
+		}
+
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+
+		// Получаем user_id по email
+		var userID string
+
+		err = app.DB.QueryRow(ctx, "SELECT user_id FROM users WHERE email = $1", email).Scan(&userID)
+
+		if err != nil {
+			log.Printf("error finding user: %v", err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to find user"})
+			return
+		}
+
+		documents, err := database.GetOrderInvoices(ctx, app.DB, userID, orderID)
+
+		if err != nil {
+			if err == database.ErrOrderNotFound {
+				c.JSON(http.StatusNotFound, gin.H{"error": "order not found"})
+
+			} else {
+				log.Printf("error fetching invoices: %v", err)
+				c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to fetch invoices"})
+			}
+
+			return
+		}
+
+		c.JSON(http.StatusOK, gin.H{"order_id": orderID, "invoices": documents})
+	}
+}
+
+func (app *Application) GetInvoice() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		// Получаем email пользователя из контекста (установлен middleware)
+		email, exists := c.Get("email")
+
+		if !exists {
+			log.Println("user email not found in context")
+			c.JSON(http.StatusUnauthorized, gin.H{"error": "unauthorized"})
+			return
+		}
+
+		// Парсим UUID документа
+		invoiceID, err := uuid.Parse(c.Param("id"))
+
+		if err != nil {
+			log.Printf("invalid invoice ID format: %v", err)
+			c.JSON(http.StatusBadRequest, gin.H{"error": "invalid invoice ID format"})
+			return
+		}
+
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+
+		// Получаем user_id по email
+		var userID string
+
+		err = app.DB.QueryRow(ctx, "SELECT user_id FROM users WHERE email = $1", email).Scan(&userID)
+
+		if err != nil {
+			log.Printf("error finding user: %v", err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to find user"})
+			return
+		}
+
+		// Документ ищется только среди документов пользователя
+		invoice, err := database.GetInvoice(ctx, app.DB, userID, invoiceID)
+
+		if err != nil {
+			if err == database.ErrInvoiceNotFound {
+				c.JSON(http.StatusNotFound, gin.H{"error": "invoice not found"})
+
+			} else {
+				log.Printf("error fetching invoice: %v", err)
+				c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to fetch invoice"})
+			}
+
+			return
+		}
+
+		renderInvoice(c, invoice)
+	}
+}
+
+// реестр документов для бухгалтерии: фильтр по году и виду документа
+func (app *Application) AdminGetInvoices() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		year := 0
+
+		if value := c.Query("year"); value != "" {
+			parsed, err := strconv.Atoi(value)
+
+			if err != nil || parsed < 1 {
+				c.JSON(http.StatusBadRequest, gin.H{"error": "invalid year"})
+				return
+			}
+
+			year = parsed
+		}
+
+		kind := c.Query("kind")
+
+		if kind != "" && kind != models.InvoiceKindInvoice && kind != models.InvoiceKindCreditNote {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "unknown invoice kind"})
+			return
+		}
+
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+
+		documents, err := database.GetInvoices(ctx, app.DB, year, kind, 500)
+
+		if err != nil {
+			log.Printf("error fetching invoices: %v", err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to fetch invoices"})
+			return
+		}
+
+		c.JSON(http.StatusOK, gin.H{"invoices": documents})
+	}
+}
+
+func (app *Application) AdminGetInvoice() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		// Парсим UUID документа
+		invoiceID, err := uuid.Parse(c.Param("id"))
+
+		if err != nil {
+			log.Printf("invalid invoice ID format: %v", err)
+			c.JSON(http.StatusBadRequest, gin.H{"error": "invalid invoice ID format"})
+			return
+		}
+
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+
+		invoice, err := database.GetInvoice(ctx, app.DB, "", invoiceID)
+
+		if err != nil {
+			if err == database.ErrInvoiceNotFound {
+				c.JSON(http.StatusNotFound, gin.H{"error": "invoice not found"})
+
+			} else {
+				log.Printf("error fetching invoice: %v", err)
+				c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to fetch invoice"})
+			}
+
+			return
+		}
+
+		renderInvoice(c, invoice)
+	}
+}
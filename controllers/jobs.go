@@ -0,0 +1,59 @@
+package controllers
+
+import (
+	"context"
+	"ec-platform/database"
+	"log"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// фоновые задачи (например, status=dead - исчерпавшие попытки)
+func (app *Application) GetJobs() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+
+		jobs, err := database.GetJobs(ctx, app.DB, c.Query("status"), c.Query("type"), 100)
+
+		if err != nil {
+			log.Printf("error fetching jobs: %v", err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to fetch jobs"})
+			return
+		}
+
+		c.JSON(http.StatusOK, gin.H{"jobs": jobs})
+	}
+}
+
+// возвращает задачу из dead в очередь
+func (app *Application) RetryJob() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		jobID, err := strconv.ParseInt(c.Param("id"), 10, 64)
+
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "invalid job ID"})
+			return
+		}
+
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+
+		if err := database.RetryJob(ctx, app.DB, jobID); err != nil {
+			if err == database.ErrJobNotFound {
+				c.JSON(http.StatusNotFound, gin.H{"error": "dead job not found"})
+
+			} else {
+				log.Printf("error retrying job: %v", err)
+				c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to retry job"})
+			}
+
+			return
+		}
+
+		c.JSON(http.StatusOK, gin.H{"message": "job queued", "id": jobID})
+	}
+}
@@ -0,0 +1,322 @@
+package controllers
+
+import (
+	"context"
+	"ec-platform/database"
+	"log"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+)
+
+const (
+	defaultOrdersPageSize = 20
+	maxOrdersPageSize     = 100
+)
+
+func (app *Application) GetOrders() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		// Получаем email пользователя из контекста (установлен middleware)
+		email, exists := c.Get("email")
+
+		if !exists {
+			log.Println("user email not found in context")
+			c.JSON(http.StatusUnauthorized, gin.H{"error": "unauthorized"})
+			return
+		}
+
+		// Параметры пагинации
+		page, err := strconv.Atoi(c.DefaultQuery("page", "1"))
+
+		if err != nil || page < 1 {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "invalid page"})
+			return
+		}
+
+		limit, err := strconv.Atoi(c.DefaultQuery("limit", strconv.Itoa(defaultOrdersPageSize)))
+
+		if err != nil || limit < 1 || limit > maxOrdersPageSize {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "invalid limit"})
+			return
+		}
+
+		status := c.Query("status")
+
+		if status != "" && !database.IsValidOrderStatus(status) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "unknown order status"})
+			return
+		}
+
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+
+		// Получаем user_id по email
+		var userID string
+
+		err = app.DB.QueryRow(ctx, "SELECT user_id FROM users WHERE email = $1", email).Scan(&userID)
+
+		if err != nil {
+			log.Printf("error finding user: %v", err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to find user"})
+			return
+		}
+
+		// Вызываем функцию из database слоя
+		orders, total, err := database.GetOrders(ctx, app.DB, userID, status, limit, (page-1)*limit)
+
+		if err != nil {
+			log.Printf("error fetching orders: %v", err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to fetch orders"})
+			return
+		}
+
+		c.JSON(http.StatusOK, gin.H{
+			"orders": orders,
+			"page":   page,
+			"limit":  limit,
+			"total":  total,
+		})
+	}
+}
+
+func (app *Application) GetOrder() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		// Получаем email пользователя из контекста (установлен middleware)
+		email, exists := c.Get("email")
+
+		if !exists {
+			log.Println("user email not found in context")
+			c.JSON(http.StatusUnauthorized, gin.H{"error": "unauthorized"})
+			return
+		}
+
+		// Парсим UUID заказа
+		orderID, err := uuid.Parse(c.Param("id"))
+
+		if err != nil {
+			log.Printf("invalid order ID format: %v", err)
+			c.JSON(http.StatusBadRequest, gin.H{"error": "invalid order ID format"})
+			return
+		}
+
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+
+		// Получаем user_id по email
+		var userID string
+
+		err = app.DB.QueryRow(ctx, "SELECT user_id FROM users WHERE email = $1", email).Scan(&userID)
+
+		if err != nil {
+			log.Printf("error finding user: %v", err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to find user"})
+			return
+		}
+
+		// Вызываем функцию из database слоя (заказ ищется только среди заказов пользователя)
+		order, err := database.GetOrder(ctx, app.DB, userID, orderID)
+
+		if err != nil {
+			if err == database.ErrOrderNotFound {
+				c.JSON(http.StatusNotFound, gin.H{"error": "order not found"})
+
+			} else {
+				log.Printf("error fetching order: %v", err)
+				c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to fetch order"})
+			}
+
+			return
+		}
+
+		c.JSON(http.StatusOK, order)
+	}
+}
+
+// тело запроса отмены заказа
+type cancelOrderRequest struct {
+	Reason string `json:"reason" validate:"max=500"`
+}
+
+func (app *Application) CancelOrder() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		// Получаем email пользователя из контекста (установлен middleware)
+		email, exists := c.Get("email")
+
+		if !exists {
+			log.Println("user email not found in context")
+			c.JSON(http.StatusUnauthorized, gin.H{"error": "unauthorized"})
+			return
+		}
+
+		// Парсим UUID заказа
+		orderID, err := uuid.Parse(c.Param("id"))
+
+		if err != nil {
+			log.Printf("invalid order ID format: %v", err)
+			c.JSON(http.StatusBadRequest, gin.H{"error": "invalid order ID format"})
+			return
+		}
+
+		// Причина отмены необязательна, тело запроса может быть пустым
+		var request cancelOrderRequest
+
+		if c.Request.ContentLength > 0 {
+			if err := c.BindJSON(&request); err != nil {
+				log.Printf("invalid request body: %v", err)
+				c.JSON(http.StatusBadRequest, gin.H{"error": "invalid request body"})
+				return
+			}
+		}
+
+		if validationErr := validate.Struct(request); validationErr != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Validation failed: " + validationErr.Error()})
+			return
+		}
+
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		defer cancel()
+
+		// Получаем user_id по email
+		var userID string
+
+		err = app.DB.QueryRow(ctx, "SELECT user_id FROM users WHERE email = $1", email).Scan(&userID)
+
+		if err != nil {
+			log.Printf("error finding user: %v", err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to find user"})
+			return
+		}
+
+		// Вызываем функцию из database слоя
+		err = database.CancelOrder(ctx, app.DB, userID, orderID, request.Reason, app.RefundPayment(), app.VoidPayment())
+
+		if err != nil {
+			switch err {
+			case database.ErrOrderNotFound:
+				c.JSON(http.StatusNotFound, gin.H{"error": "order not found"})
+
+			case database.ErrOrderNotCancellable:
+				c.JSON(http.StatusConflict, gin.H{"error": "order can't be cancelled after shipment"})
+
+			default:
+				// в том числе отказ провайдера в возврате - отмена при этом откатывается
+				log.Printf("error cancelling order: %v", err)
+				c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to cancel order"})
+			}
+
+			return
+		}
+
+		c.JSON(http.StatusOK, gin.H{"message": "order cancelled", "order_id": orderID})
+	}
+}
+
+// тело запроса смены статуса заказа
+type orderStatusRequest struct {
+	Status string `json:"status" validate:"required"`
+	Note   string `json:"note"`
+}
+
+func (app *Application) UpdateOrderStatus() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		// email администратора из контекста - автор перехода
+		email, exists := c.Get("email")
+
+		if !exists {
+			log.Println("user email not found in context")
+			c.JSON(http.StatusUnauthorized, gin.H{"error": "unauthorized"})
+			return
+		}
+
+		// Парсим UUID заказа
+		orderID, err := uuid.Parse(c.Param("id"))
+
+		if err != nil {
+			log.Printf("invalid order ID format: %v", err)
+			c.JSON(http.StatusBadRequest, gin.H{"error": "invalid order ID format"})
+			return
+		}
+
+		var request orderStatusRequest
+
+		if err := c.BindJSON(&request); err != nil {
+			log.Printf("invalid request body: %v", err)
+			c.JSON(http.StatusBadRequest, gin.H{"error": "invalid request body"})
+			return
+		}
+
+		if validationErr := validate.Struct(request); validationErr != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Validation failed: " + validationErr.Error()})
+			return
+		}
+
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+
+		// Вызываем функцию из database слоя
+		err = database.TransitionOrderStatus(ctx, app.DB, orderID, request.Status, email.(string), request.Note, app.RefundPayment(), app.VoidPayment())
+
+		if err != nil {
+			switch err {
+			case database.ErrOrderNotFound:
+				c.JSON(http.StatusNotFound, gin.H{"error": "order not found"})
+
+			case database.ErrInvalidOrderStatus:
+				c.JSON(http.StatusBadRequest, gin.H{"error": "unknown order status"})
+
+			case database.ErrInvalidTransition:
+				c.JSON(http.StatusConflict, gin.H{"error": "order status transition is not allowed"})
+
+			case database.ErrPaymentNotCaptured:
+				c.JSON(http.StatusConflict, gin.H{"error": "order has no captured payment"})
+
+			case database.ErrPaymentRequired:
+				c.JSON(http.StatusConflict, gin.H{"error": "order must be paid or cash on delivery"})
+
+			default:
+				log.Printf("error updating order status: %v", err)
+				c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to update order status"})
+			}
+
+			return
+		}
+
+		c.JSON(http.StatusOK, gin.H{"message": "order status updated", "order_id": orderID, "status": request.Status})
+	}
+}
+
+func (app *Application) GetOrderStatusHistory() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		// Парсим UUID заказа
+		orderID, err := uuid.Parse(c.Param("id"))
+
+		if err != nil {
+			log.Printf("invalid order ID format: %v", err)
+			c.JSON(http.StatusBadRequest, gin.H{"error": "invalid order ID format"})
+			return
+		}
+
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+
+		// Вызываем функцию из database слоя
+		history, err := database.GetOrderStatusHistory(ctx, app.DB, orderID)
+
+		if err != nil {
+			if err == database.ErrOrderNotFound {
+				c.JSON(http.StatusNotFound, gin.H{"error": "order not found"})
+
+			} else {
+				log.Printf("error fetching order status history: %v", err)
+				c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to fetch order status history"})
+			}
+
+			return
+		}
+
+		c.JSON(http.StatusOK, gin.H{"order_id": orderID, "history": history})
+	}
+}
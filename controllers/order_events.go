@@ -0,0 +1,163 @@
+package controllers
+
+import (
+	"context"
+	"ec-platform/database"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+)
+
+// как часто в поток пишется комментарий-heartbeat (держит соединение через прокси)
+// и заодно перечитываются переходы, уведомление о которых могло потеряться
+const orderEventsHeartbeat = 15 * time.Second
+
+// GetOrderEvents - поток Server-Sent Events с переходами статуса заказа пользователя.
+// id события - id записи истории статусов: клиент, переподключившись с Last-Event-ID,
+// получает только пропущенные переходы. Без Last-Event-ID сначала отдается вся история
+func (app *Application) GetOrderEvents() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		// Получаем email пользователя из контекста (установлен middleware)
+		email, exists := c.Get("email")
+
+		if !exists {
+			log.Println("user email not found in context")
+			c.JSON(http.StatusUnauthorized, gin.H{"error": "unauthorized"})
+			return
+		}
+
+		// Парсим UUID заказа
+		orderID, err := uuid.Parse(c.Param("id"))
+
+		if err != nil {
+			log.Printf("invalid order ID format: %v", err)
+			c.JSON(http.StatusBadRequest, gin.H{"error": "invalid order ID format"})
+			return
+		}
+
+		// Last-Event-ID ставит браузер при переподключении; query-параметр - для первого подключения
+		lastEventID := c.GetHeader("Last-Event-ID")
+
+		if lastEventID == "" {
+			lastEventID = c.Query("last_event_id")
+		}
+
+		var lastID int64
+
+		if lastEventID != "" {
+			lastID, err = strconv.ParseInt(lastEventID, 10, 64)
+
+			if err != nil || lastID < 0 {
+				c.JSON(http.StatusBadRequest, gin.H{"error": "invalid Last-Event-ID"})
+				return
+			}
+		}
+
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+
+		// Получаем user_id по email
+		var userID string
+
+		err = app.DB.QueryRow(ctx, "SELECT user_id FROM users WHERE email = $1", email).Scan(&userID)
+
+		if err != nil {
+			log.Printf("error finding user: %v", err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to find user"})
+			return
+		}
+
+		// Заказ ищется только среди заказов пользователя
+		if _, err := database.GetOrder(ctx, app.DB, userID, orderID); err != nil {
+			if err == database.ErrOrderNotFound {
+				c.JSON(http.StatusNotFound, gin.H{"error": "order not found"})
+
+			} else {
+				log.Printf("error fetching order: %v", err)
+				c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to fetch order"})
+			}
+
+			return
+		}
+
+		// Подписываемся до чтения истории, чтобы не пропустить переход между ними
+		wake, unsubscribe := app.OrderEvents.Subscribe(orderID)
+		defer unsubscribe()
+
+		c.Header("Content-Type", "text/event-stream")
+		c.Header("Cache-Control", "no-cache")
+		c.Header("Connection", "keep-alive")
+		c.Header("X-Accel-Buffering", "no")
+		c.Status(http.StatusOK)
+
+		fmt.Fprint(c.Writer, "retry: 3000\n\n")
+		c.Writer.Flush()
+
+		streamCtx := c.Request.Context()
+
+		heartbeat := time.NewTicker(orderEventsHeartbeat)
+		defer heartbeat.Stop()
+
+		for {
+			if lastID, err = app.writeOrderEvents(streamCtx, c, orderID, lastID); err != nil {
+				if streamCtx.Err() == nil {
+					log.Printf("error streaming order %s events: %v", orderID, err)
+				}
+
+				return
+			}
+
+			select {
+			case <-streamCtx.Done():
+				return
+
+			case <-wake:
+
+			case <-heartbeat.C:
+				if _, err := fmt.Fprint(c.Writer, ": heartbeat\n\n"); err != nil {
+					return
+				}
+
+				c.Writer.Flush()
+			}
+		}
+	}
+}
+
+// пишет в поток переходы статуса с id больше lastID, возвращает id последнего отправленного
+func (app *Application) writeOrderEvents(ctx context.Context, c *gin.Context, orderID uuid.UUID, lastID int64) (int64, error) {
+	queryCtx, cancel := context.WithTimeout(ctx, 5*time.Second)
+	defer cancel()
+
+	changes, err := database.GetOrderStatusChangesSince(queryCtx, app.DB, orderID, lastID)
+
+	if err != nil {
+		return lastID, err
+	}
+
+	for _, change := range changes {
+		data, err := json.Marshal(change)
+
+		if err != nil {
+			return lastID, err
+		}
+
+		if _, err := fmt.Fprintf(c.Writer, "id: %d\nevent: status\ndata: %s\n\n", change.ID, data); err != nil {
+			return lastID, err
+		}
+
+		lastID = change.ID
+	}
+
+	if len(changes) > 0 {
+		c.Writer.Flush()
+	}
+
+	return lastID, nil
+}
@@ -0,0 +1,59 @@
+package controllers
+
+import (
+	"context"
+	"ec-platform/database"
+	"log"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// события outbox (например, status=failed - исчерпавшие попытки доставки)
+func (app *Application) GetOutboxEvents() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+
+		events, err := database.GetOutboxEvents(ctx, app.DB, c.Query("status"), 100)
+
+		if err != nil {
+			log.Printf("error fetching outbox events: %v", err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to fetch outbox events"})
+			return
+		}
+
+		c.JSON(http.StatusOK, gin.H{"events": events})
+	}
+}
+
+// повторная доставка события outbox
+func (app *Application) RetryOutboxEvent() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		id, err := strconv.ParseInt(c.Param("id"), 10, 64)
+
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "invalid event ID"})
+			return
+		}
+
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+
+		if err := database.RetryOutboxEvent(ctx, app.DB, id); err != nil {
+			if err == database.ErrOutboxEventNotFound {
+				c.JSON(http.StatusNotFound, gin.H{"error": "outbox event not found"})
+
+			} else {
+				log.Printf("error retrying outbox event: %v", err)
+				c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to retry outbox event"})
+			}
+
+			return
+		}
+
+		c.JSON(http.StatusOK, gin.H{"message": "event scheduled for delivery", "id": id})
+	}
+}
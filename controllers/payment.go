@@ -0,0 +1,423 @@
+package controllers
+
+import (
+	"context"
+	"ec-platform/database"
+	"ec-platform/models"
+	"ec-platform/payments"
+	"errors"
+	"io"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+)
+
+var errNoIntent = errors.New("payment has no provider intent")
+
+// PaymentTokenHeader - заголовок с одноразовым токеном карты. В URL токен не передается:
+// адрес запроса целиком попадает в журнал доступа
+const PaymentTokenHeader = "X-Payment-Token"
+
+// читает способ оплаты из query параметров (по умолчанию - наличные при получении)
+// и токен карты из заголовка X-Payment-Token
+func (app *Application) paymentParams(c *gin.Context) (method string, token string, ok bool) {
+	if _, exists := c.GetQuery("payment_token"); exists {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "payment token must be sent in the " + PaymentTokenHeader + " header"})
+		return "", "", false
+	}
+
+	method = c.DefaultQuery("payment_method", models.PaymentProviderCOD)
+
+	if _, err := app.Payments.Get(method); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "unknown payment method"})
+		return "", "", false
+	}
+
+	return method, c.GetHeader(PaymentTokenHeader), true
+}
+
+// создает платеж по заказу у провайдера и, если провайдер заблокировал средства, списывает их.
+// Каждая попытка сохраняется в payments; заказ становится paid только после подтвержденного списания
+func (app *Application) payOrder(ctx context.Context, userID string, orderID uuid.UUID, method string, token string) (*models.PaymentAttempt, error) {
+	provider, err := app.Payments.Get(method)
+
+	if err != nil {
+		return nil, err
+	}
+
+	payment, err := app.PaymentStore.CreatePayment(ctx, userID, orderID, provider.Name())
+
+	if err != nil {
+		return nil, err
+	}
+
+	intent, err := provider.CreateIntent(ctx, payments.IntentRequest{OrderID: orderID, Amount: payment.Amount, Currency: payment.Currency, Token: token})
+
+	if err != nil {
+		return app.failPayment(ctx, payment, err)
+	}
+
+	if err := app.PaymentStore.UpdatePaymentIntent(ctx, payment.Payment_ID, intent.ID, intent.Status); err != nil {
+		// Заказ отменили, пока провайдер создавал платеж - блокировку средств снимаем
+		if err == database.ErrOrderNotPayable {
+			if _, voidErr := provider.Void(ctx, intent.ID); voidErr != nil {
+				log.Printf("error voiding payment %s of cancelled order: %v", payment.Payment_ID, voidErr)
+			}
+		}
+
+		return nil, err
+	}
+
+	payment.Intent_ID = &intent.ID
+	payment.Status = intent.Status
+
+	if intent.Status != payments.StatusRequiresCapture {
+		return payment, nil
+	}
+
+	if _, err := provider.Capture(ctx, intent.ID, payment.Amount); err != nil {
+		return app.failPayment(ctx, payment, err)
+	}
+
+	if err := app.PaymentStore.CapturePayment(ctx, payment.Payment_ID, "payments:"+provider.Name()); err != nil {
+		return nil, err
+	}
+
+	payment.Status = models.PaymentStatusCaptured
+
+	return payment, nil
+}
+
+// сохраняет отказ провайдера в попытке оплаты
+func (app *Application) failPayment(ctx context.Context, payment *models.PaymentAttempt, reason error) (*models.PaymentAttempt, error) {
+	if err := app.PaymentStore.FailPayment(ctx, payment.Payment_ID, reason.Error()); err != nil {
+		log.Printf("error saving failed payment: %v", err)
+	}
+
+	message := reason.Error()
+	payment.Status = models.PaymentStatusFailed
+	payment.Error = &message
+
+	return payment, reason
+}
+
+// RefundPayment - возврат по платежу через его провайдера (при отмене и возврате заказа,
+// а также в задаче повтора неотправленных возвратов)
+func (app *Application) RefundPayment() database.RefundFunc {
+	return func(ctx context.Context, payment models.PaymentAttempt, amount models.Money) error {
+		provider, err := app.Payments.Get(payment.Provider)
+
+		if err != nil {
+			return err
+		}
+
+		if payment.Intent_ID == nil {
+			return errNoIntent
+		}
+
+		_, err = provider.Refund(ctx, *payment.Intent_ID, amount)
+
+		return err
+	}
+}
+
+// VoidPayment - отмена еще не списанного платежа у его провайдера (при отмене заказа)
+func (app *Application) VoidPayment() database.VoidFunc {
+	return func(ctx context.Context, payment models.PaymentAttempt) error {
+		provider, err := app.Payments.Get(payment.Provider)
+
+		if err != nil {
+			return err
+		}
+
+		if payment.Intent_ID == nil {
+			return errNoIntent
+		}
+
+		_, err = provider.Void(ctx, *payment.Intent_ID)
+
+		return err
+	}
+}
+
+// отвечает на результат оплаты нового заказа; сумма - в валюте заказа.
+// Заказ к этому моменту уже сохранен, поэтому ответ никогда не 5xx: иначе middleware идемпотентности
+// освободит ключ, и повтор запроса создаст второй заказ. Оплату можно повторить через /orders/:id/pay
+func (app *Application) orderPlacedResponse(c *gin.Context, orderID uuid.UUID, totalPrice models.CurrencyAmount, payment *models.PaymentAttempt, err error) {
+	if err != nil && payment == nil {
+		log.Printf("error paying order %s: %v", orderID, err)
+		c.JSON(http.StatusAccepted, gin.H{
+			"message":     "order placed, payment pending",
+			"order_id":    orderID,
+			"total_price": totalPrice.Amount,
+			"currency":    totalPrice.Currency,
+		})
+
+		return
+	}
+
+	if err != nil {
+		c.JSON(http.StatusPaymentRequired, gin.H{
+			"error":       "payment declined",
+			"order_id":    orderID,
+			"total_price": totalPrice.Amount,
+			"currency":    totalPrice.Currency,
+			"payment":     payment,
+		})
+
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"message":     "order placed successfully",
+		"order_id":    orderID,
+		"total_price": totalPrice.Amount,
+		"currency":    totalPrice.Currency,
+		"payment":     payment,
+	})
+}
+
+// повторная оплата заказа, ожидающего оплаты (например, после отказа по карте)
+func (app *Application) PayOrder() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		// Получаем email пользователя из контекста (установлен middleware)
+		email, exists := c.Get("email")
+
+		if !exists {
+			log.Println("user email not found in context")
+			c.JSON(http.StatusUnauthorized, gin.H{"error": "unauthorized"})
+			return
+		}
+
+		// Парсим UUID заказа
+		orderID, err := uuid.Parse(c.Param("id"))
+
+		if err != nil {
+			log.Printf("invalid order ID format: %v", err)
+			c.JSON(http.StatusBadRequest, gin.H{"error": "invalid order ID format"})
+			return
+		}
+
+		method, token, ok := app.paymentParams(c)
+
+		if !ok {
+			return
+		}
+
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		defer cancel()
+
+		// Получаем user_id по email
+		var userID string
+
+		err = app.DB.QueryRow(ctx, "SELECT user_id FROM users WHERE email = $1", email).Scan(&userID)
+
+		if err != nil {
+			log.Printf("error finding user: %v", err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to find user"})
+			return
+		}
+
+		payment, err := app.payOrder(ctx, userID, orderID, method, token)
+
+		switch {
+		case err == database.ErrOrderNotFound:
+			c.JSON(http.StatusNotFound, gin.H{"error": "order not found"})
+
+		case err == database.ErrOrderNotPayable:
+			c.JSON(http.StatusConflict, gin.H{"error": "order is not awaiting payment"})
+
+		case err == database.ErrPaymentInProgress:
+			c.JSON(http.StatusConflict, gin.H{"error": "order already has an active payment"})
+
+		case err != nil && payment != nil:
+			c.JSON(http.StatusPaymentRequired, gin.H{"error": "payment declined", "payment": payment})
+
+		case err != nil:
+			log.Printf("error paying order: %v", err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to pay order"})
+
+		default:
+			c.JSON(http.StatusOK, gin.H{"message": "payment processed", "payment": payment})
+		}
+	}
+}
+
+// подтверждение списания сотрудником (например, курьер получил наличные)
+func (app *Application) CapturePayment() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		email, exists := c.Get("email")
+
+		if !exists {
+			log.Println("user email not found in context")
+			c.JSON(http.StatusUnauthorized, gin.H{"error": "unauthorized"})
+			return
+		}
+
+		// Парсим UUID платежа
+		paymentID, err := uuid.Parse(c.Param("id"))
+
+		if err != nil {
+			log.Printf("invalid payment ID format: %v", err)
+			c.JSON(http.StatusBadRequest, gin.H{"error": "invalid payment ID format"})
+			return
+		}
+
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		defer cancel()
+
+		payment, err := database.GetPayment(ctx, app.DB, paymentID)
+
+		if err != nil {
+			if err == database.ErrPaymentNotFound {
+				c.JSON(http.StatusNotFound, gin.H{"error": "payment not found"})
+
+			} else {
+				log.Printf("error fetching payment: %v", err)
+				c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to fetch payment"})
+			}
+
+			return
+		}
+
+		if payment.Status != models.PaymentStatusPending && payment.Status != models.PaymentStatusRequiresCapture {
+			c.JSON(http.StatusConflict, gin.H{"error": "payment can't be captured", "status": payment.Status})
+			return
+		}
+
+		provider, err := app.Payments.Get(payment.Provider)
+
+		if err != nil || payment.Intent_ID == nil {
+			log.Printf("payment %s can't be captured: provider %s", paymentID, payment.Provider)
+			c.JSON(http.StatusConflict, gin.H{"error": "payment can't be captured"})
+			return
+		}
+
+		if _, err := provider.Capture(ctx, *payment.Intent_ID, payment.Amount); err != nil {
+			log.Printf("error capturing payment: %v", err)
+			c.JSON(http.StatusBadGateway, gin.H{"error": "payment provider declined capture"})
+			return
+		}
+
+		if err := database.CapturePayment(ctx, app.DB, paymentID, email.(string), app.RefundPayment()); err != nil {
+			log.Printf("error saving captured payment: %v", err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to capture payment"})
+			return
+		}
+
+		c.JSON(http.StatusOK, gin.H{"message": "payment captured", "payment_id": paymentID})
+	}
+}
+
+// максимальный размер тела webhook
+const maxWebhookBodySize = 1 << 20
+
+// прием webhook платежного провайдера: проверка подписи, дедупликация по event_id, применение к заказу
+func (app *Application) PaymentWebhook() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		provider, err := app.Payments.Get(c.Param("provider"))
+
+		if err != nil {
+			c.JSON(http.StatusNotFound, gin.H{"error": "unknown payment provider"})
+			return
+		}
+
+		payload, err := io.ReadAll(io.LimitReader(c.Request.Body, maxWebhookBodySize))
+
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "invalid request body"})
+			return
+		}
+
+		event, err := provider.ParseWebhook(payload, c.Request.Header)
+
+		if err != nil {
+			switch err {
+			case payments.ErrInvalidSignature, payments.ErrSignatureExpired:
+				log.Printf("rejected %s webhook: %v", provider.Name(), err)
+				c.JSON(http.StatusUnauthorized, gin.H{"error": err.Error()})
+
+			case payments.ErrWebhooksNotSupported:
+				c.JSON(http.StatusNotFound, gin.H{"error": "payment provider does not send webhooks"})
+
+			default:
+				c.JSON(http.StatusBadRequest, gin.H{"error": "invalid webhook event"})
+			}
+
+			return
+		}
+
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		defer cancel()
+
+		id, duplicate, err := app.PaymentStore.StorePaymentEvent(ctx, provider.Name(), event, payload)
+
+		if err != nil {
+			log.Printf("error storing payment event: %v", err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to store event"})
+			return
+		}
+
+		// Повторная доставка уже полученного события
+		if duplicate {
+			c.JSON(http.StatusOK, gin.H{"status": "duplicate"})
+			return
+		}
+
+		status, err := app.PaymentStore.ApplyPaymentEvent(ctx, id)
+
+		if err != nil {
+			// событие сохранено в received - его применит повтор (ReplayPaymentEvents выбирает и такие события)
+			log.Printf("error applying payment event %d: %v", id, err)
+			c.JSON(http.StatusOK, gin.H{"status": models.PaymentEventReceived})
+			return
+		}
+
+		// Событие применено - пробуем отложенные события того же платежа (пришедшие раньше него)
+		if status == models.PaymentEventProcessed && event.IntentID != "" {
+			if _, _, err := app.PaymentStore.ReplayPaymentEvents(ctx, provider.Name(), event.IntentID); err != nil {
+				log.Printf("error replaying payment events: %v", err)
+			}
+		}
+
+		c.JSON(http.StatusOK, gin.H{"status": status})
+	}
+}
+
+func (app *Application) GetPaymentEvents() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+
+		events, err := database.GetPaymentEvents(ctx, app.DB, c.Query("status"), 100)
+
+		if err != nil {
+			log.Printf("error fetching payment events: %v", err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to fetch payment events"})
+			return
+		}
+
+		c.JSON(http.StatusOK, gin.H{"events": events})
+	}
+}
+
+// повторная обработка отложенных событий провайдеров
+func (app *Application) ReplayPaymentEvents() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+		defer cancel()
+
+		processed, deferred, err := database.ReplayPaymentEvents(ctx, app.DB, c.Query("provider"), c.Query("intent_id"), app.RefundPayment())
+
+		if err != nil {
+			log.Printf("error replaying payment events: %v", err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to replay payment events"})
+			return
+		}
+
+		c.JSON(http.StatusOK, gin.H{"processed": processed, "deferred": deferred})
+	}
+}
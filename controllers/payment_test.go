@@ -0,0 +1,550 @@
+package controllers
+
+import (
+	"bytes"
+	"context"
+	"ec-platform/database"
+	"ec-platform/models"
+	"ec-platform/payments"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+)
+
+var errStoreDown = errors.New("store is down")
+
+// попытки оплаты и события провайдеров в памяти вместо таблиц payments и payment_events
+type memoryPaymentStore struct {
+	payments   map[uuid.UUID]*models.PaymentAttempt
+	createErr  error
+	captureErr error
+	cancelled  bool     // заказ отменили, пока провайдер создавал платеж
+	captured   []string // actor каждого подтвержденного списания
+
+	events  []*memoryPaymentEvent // id события - индекс + 1
+	applied int                   // число вызовов ApplyPaymentEvent
+}
+
+type memoryPaymentEvent struct {
+	provider string
+	event    payments.Event
+	status   string
+}
+
+func newMemoryPaymentStore() *memoryPaymentStore {
+	return &memoryPaymentStore{payments: make(map[uuid.UUID]*models.PaymentAttempt)}
+}
+
+func (s *memoryPaymentStore) CreatePayment(ctx context.Context, userID string, orderID uuid.UUID, provider string) (*models.PaymentAttempt, error) {
+	if s.createErr != nil {
+		return nil, s.createErr
+	}
+
+	payment := &models.PaymentAttempt{
+		Payment_ID: uuid.New(),
+		Order_ID:   orderID,
+		Provider:   provider,
+		Status:     models.PaymentStatusCreated,
+		Amount:     150000,
+		Currency:   "RUB",
+	}
+
+	stored := *payment
+	s.payments[payment.Payment_ID] = &stored
+
+	return payment, nil
+}
+
+func (s *memoryPaymentStore) UpdatePaymentIntent(ctx context.Context, paymentID uuid.UUID, intentID string, status string) error {
+	payment, ok := s.payments[paymentID]
+
+	if !ok {
+		return database.ErrPaymentNotFound
+	}
+
+	payment.Intent_ID = &intentID
+
+	// Как и database.UpdatePaymentIntent: отмена заказа уже пометила платеж failed
+	if s.cancelled {
+		payment.Status = models.PaymentStatusFailed
+		return database.ErrOrderNotPayable
+	}
+
+	payment.Status = status
+
+	return nil
+}
+
+func (s *memoryPaymentStore) FailPayment(ctx context.Context, paymentID uuid.UUID, reason string) error {
+	payment, ok := s.payments[paymentID]
+
+	if !ok {
+		return database.ErrPaymentNotFound
+	}
+
+	payment.Status = models.PaymentStatusFailed
+	payment.Error = &reason
+
+	return nil
+}
+
+func (s *memoryPaymentStore) CapturePayment(ctx context.Context, paymentID uuid.UUID, actor string) error {
+	if s.captureErr != nil {
+		return s.captureErr
+	}
+
+	payment, ok := s.payments[paymentID]
+
+	if !ok {
+		return database.ErrPaymentNotFound
+	}
+
+	payment.Status = models.PaymentStatusCaptured
+	s.captured = append(s.captured, actor)
+
+	return nil
+}
+
+func (s *memoryPaymentStore) StorePaymentEvent(ctx context.Context, provider string, event *payments.Event, payload []byte) (int64, bool, error) {
+	for _, stored := range s.events {
+		if stored.provider == provider && stored.event.ID == event.ID {
+			return 0, true, nil
+		}
+	}
+
+	s.events = append(s.events, &memoryPaymentEvent{provider: provider, event: *event, status: models.PaymentEventReceived})
+
+	return int64(len(s.events)), false, nil
+}
+
+// применяет событие по тем же правилам, что и database.ApplyPaymentEvent: событие по неизвестному
+// платежу или возврат раньше списания откладываются
+func (s *memoryPaymentStore) ApplyPaymentEvent(ctx context.Context, id int64) (string, error) {
+	s.applied++
+	stored := s.events[id-1]
+
+	if stored.status == models.PaymentEventProcessed {
+		return stored.status, nil
+	}
+
+	var payment *models.PaymentAttempt
+
+	for _, candidate := range s.payments {
+		if candidate.Provider == stored.provider && candidate.Intent_ID != nil && *candidate.Intent_ID == stored.event.IntentID {
+			payment = candidate
+		}
+	}
+
+	stored.status = models.PaymentEventDeferred
+
+	switch {
+	case payment == nil:
+
+	case stored.event.Type == payments.EventPaymentCaptured:
+		// Повторное списание уже списанного или возвращенного платежа ничего не меняет
+		if payment.Status != models.PaymentStatusCaptured && payment.Status != models.PaymentStatusRefunded {
+			payment.Status = models.PaymentStatusCaptured
+			s.captured = append(s.captured, "webhook:"+stored.provider)
+		}
+
+		stored.status = models.PaymentEventProcessed
+
+	case stored.event.Type == payments.EventPaymentRefunded && payment.Status == models.PaymentStatusCaptured:
+		payment.Status = models.PaymentStatusRefunded
+		payment.Refunded_Amount = stored.event.Amount
+		stored.status = models.PaymentEventProcessed
+	}
+
+	return stored.status, nil
+}
+
+func (s *memoryPaymentStore) ReplayPaymentEvents(ctx context.Context, provider string, intentID string) (int, int, error) {
+	var processed, deferred int
+
+	for i, stored := range s.events {
+		if stored.status == models.PaymentEventProcessed || stored.provider != provider || stored.event.IntentID != intentID {
+			continue
+		}
+
+		status, err := s.ApplyPaymentEvent(ctx, int64(i+1))
+
+		if err != nil {
+			return processed, deferred, err
+		}
+
+		if status == models.PaymentEventProcessed {
+			processed++
+		} else {
+			deferred++
+		}
+	}
+
+	return processed, deferred, nil
+}
+
+func newPaymentTestApp(store *memoryPaymentStore) *Application {
+	return &Application{
+		Payments:     payments.NewRegistry(payments.NewCOD(), payments.NewFakeGateway("secret")),
+		PaymentStore: store,
+	}
+}
+
+func TestPayOrder(t *testing.T) {
+	tests := []struct {
+		name         string
+		method       string
+		token        string
+		createErr    error
+		captureErr   error
+		wantErr      error
+		wantPayment  bool   // payOrder возвращает попытку оплаты
+		wantStatus   string // статус попытки в ответе и в хранилище
+		wantCaptured bool
+	}{
+		{name: "card approved and captured", method: "fake", token: payments.FakeTokenSuccess, wantPayment: true, wantStatus: models.PaymentStatusCaptured, wantCaptured: true},
+		{name: "card declined", method: "fake", token: payments.FakeTokenDeclined, wantErr: payments.ErrDeclined, wantPayment: true, wantStatus: models.PaymentStatusFailed},
+		{name: "capture declined", method: "fake", token: payments.FakeTokenCaptureDeclined, wantErr: payments.ErrDeclined, wantPayment: true, wantStatus: models.PaymentStatusFailed},
+		{name: "cash on delivery waits for payment", method: models.PaymentProviderCOD, wantPayment: true, wantStatus: models.PaymentStatusPending},
+		{name: "unknown method", method: "bitcoin", wantErr: payments.ErrUnknownProvider},
+		{name: "order not payable", method: "fake", token: payments.FakeTokenSuccess, createErr: database.ErrOrderNotPayable, wantErr: database.ErrOrderNotPayable},
+		{name: "payment already active", method: "fake", token: payments.FakeTokenSuccess, createErr: database.ErrPaymentInProgress, wantErr: database.ErrPaymentInProgress},
+		{name: "capture not saved", method: "fake", token: payments.FakeTokenSuccess, captureErr: errStoreDown, wantErr: errStoreDown},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			store := newMemoryPaymentStore()
+			store.createErr = tt.createErr
+			store.captureErr = tt.captureErr
+
+			app := newPaymentTestApp(store)
+
+			payment, err := app.payOrder(context.Background(), "user-1", uuid.New(), tt.method, tt.token)
+
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("payOrder() error = %v, want %v", err, tt.wantErr)
+			}
+
+			if (payment != nil) != tt.wantPayment {
+				t.Fatalf("payOrder() payment = %+v, want payment: %v", payment, tt.wantPayment)
+			}
+
+			if payment == nil {
+				return
+			}
+
+			if payment.Status != tt.wantStatus {
+				t.Errorf("payOrder() status = %s, want %s", payment.Status, tt.wantStatus)
+			}
+
+			if stored := store.payments[payment.Payment_ID]; stored.Status != tt.wantStatus {
+				t.Errorf("stored status = %s, want %s", stored.Status, tt.wantStatus)
+			}
+
+			if tt.wantStatus == models.PaymentStatusFailed && (payment.Error == nil || *payment.Error != tt.wantErr.Error()) {
+				t.Errorf("payOrder() error message = %v, want %q", payment.Error, tt.wantErr)
+			}
+
+			if captured := len(store.captured) > 0; captured != tt.wantCaptured {
+				t.Errorf("captured = %v, want %v", captured, tt.wantCaptured)
+			}
+
+			if tt.wantCaptured && store.captured[0] != "payments:fake" {
+				t.Errorf("capture actor = %s, want payments:fake", store.captured[0])
+			}
+		})
+	}
+}
+
+func TestPaymentParams(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	tests := []struct {
+		name       string
+		url        string
+		header     string
+		wantOK     bool
+		wantMethod string
+		wantToken  string
+	}{
+		{name: "cash on delivery by default", url: "/cartcheckout", wantOK: true, wantMethod: models.PaymentProviderCOD},
+		{name: "card token from header", url: "/cartcheckout?payment_method=fake", header: payments.FakeTokenSuccess, wantOK: true, wantMethod: "fake", wantToken: payments.FakeTokenSuccess},
+		{name: "token in url is rejected", url: "/cartcheckout?payment_method=fake&payment_token=tok_success"},
+		{name: "unknown method", url: "/cartcheckout?payment_method=bitcoin"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			recorder := httptest.NewRecorder()
+			c, _ := gin.CreateTestContext(recorder)
+
+			c.Request = httptest.NewRequest(http.MethodGet, tt.url, nil)
+
+			if tt.header != "" {
+				c.Request.Header.Set(PaymentTokenHeader, tt.header)
+			}
+
+			method, token, ok := newPaymentTestApp(newMemoryPaymentStore()).paymentParams(c)
+
+			if ok != tt.wantOK || method != tt.wantMethod || token != tt.wantToken {
+				t.Fatalf("paymentParams() = %q, %q, %v, want %q, %q, %v", method, token, ok, tt.wantMethod, tt.wantToken, tt.wantOK)
+			}
+
+			if !ok && recorder.Code != http.StatusBadRequest {
+				t.Errorf("status = %d, want 400", recorder.Code)
+			}
+		})
+	}
+}
+
+func TestPayOrderVoidsIntentOfCancelledOrder(t *testing.T) {
+	ctx := context.Background()
+	store := newMemoryPaymentStore()
+	store.cancelled = true
+
+	app := newPaymentTestApp(store)
+
+	if _, err := app.payOrder(ctx, "user-1", uuid.New(), "fake", payments.FakeTokenSuccess); !errors.Is(err, database.ErrOrderNotPayable) {
+		t.Fatalf("payOrder() error = %v, want %v", err, database.ErrOrderNotPayable)
+	}
+
+	if len(store.captured) != 0 {
+		t.Errorf("payment of cancelled order was captured by %v", store.captured)
+	}
+
+	gateway, _ := app.Payments.Get("fake")
+
+	// Блокировка снята - списать средства по платежу у шлюза больше нельзя
+	if _, err := gateway.Capture(ctx, "fake_pi_000001", 150000); !errors.Is(err, payments.ErrDeclined) {
+		t.Errorf("gateway Capture() after cancel error = %v, want %v", err, payments.ErrDeclined)
+	}
+}
+
+func TestOrderPlacedResponse(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	failed := &models.PaymentAttempt{Status: models.PaymentStatusFailed}
+	captured := &models.PaymentAttempt{Status: models.PaymentStatusCaptured}
+
+	tests := []struct {
+		name       string
+		payment    *models.PaymentAttempt
+		err        error
+		wantStatus int
+	}{
+		{"paid", captured, nil, http.StatusOK},
+		{"declined", failed, payments.ErrDeclined, http.StatusPaymentRequired},
+		// заказ уже создан: 5xx освободил бы ключ идемпотентности и повтор создал бы второй заказ
+		{"payment failed to start", nil, errStoreDown, http.StatusAccepted},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			recorder := httptest.NewRecorder()
+			c, _ := gin.CreateTestContext(recorder)
+
+			orderID := uuid.New()
+			app := newPaymentTestApp(newMemoryPaymentStore())
+
+			app.orderPlacedResponse(c, orderID, models.CurrencyAmount{Amount: 150000, Currency: "RUB"}, tt.payment, tt.err)
+
+			if recorder.Code != tt.wantStatus {
+				t.Fatalf("status = %d, want %d", recorder.Code, tt.wantStatus)
+			}
+
+			var body struct {
+				Order_ID uuid.UUID `json:"order_id"`
+			}
+
+			if err := json.Unmarshal(recorder.Body.Bytes(), &body); err != nil {
+				t.Fatalf("invalid response body: %v", err)
+			}
+
+			if body.Order_ID != orderID {
+				t.Errorf("order_id = %s, want %s", body.Order_ID, orderID)
+			}
+		})
+	}
+}
+
+// добавляет в хранилище платеж фейкового шлюза, ожидающий списания
+func seedFakePayment(store *memoryPaymentStore, intentID string) *models.PaymentAttempt {
+	payment := &models.PaymentAttempt{
+		Payment_ID: uuid.New(),
+		Order_ID:   uuid.New(),
+		Provider:   "fake",
+		Intent_ID:  &intentID,
+		Status:     models.PaymentStatusRequiresCapture,
+		Amount:     150000,
+		Currency:   "RUB",
+	}
+
+	store.payments[payment.Payment_ID] = payment
+
+	return payment
+}
+
+// отправляет webhook фейкового шлюза в PaymentWebhook и возвращает статус ответа и поле status
+func postPaymentWebhook(t *testing.T, app *Application, payload []byte, header http.Header) (int, string) {
+	t.Helper()
+	gin.SetMode(gin.TestMode)
+
+	router := gin.New()
+	router.POST("/payments/webhook/:provider", app.PaymentWebhook())
+
+	request := httptest.NewRequest(http.MethodPost, "/payments/webhook/fake", bytes.NewReader(payload))
+	request.Header = header
+
+	recorder := httptest.NewRecorder()
+	router.ServeHTTP(recorder, request)
+
+	var body struct {
+		Status string `json:"status"`
+	}
+
+	if err := json.Unmarshal(recorder.Body.Bytes(), &body); err != nil {
+		t.Fatalf("invalid response body: %v", err)
+	}
+
+	return recorder.Code, body.Status
+}
+
+func TestPaymentWebhookDuplicateDelivery(t *testing.T) {
+	store := newMemoryPaymentStore()
+	payment := seedFakePayment(store, "fake_pi_000001")
+	app := newPaymentTestApp(store)
+
+	// Шлюз с тем же секретом, что и зарегистрированный в app
+	payload, header, err := payments.NewFakeGateway("secret").Webhook(payments.EventPaymentCaptured, "fake_pi_000001", 150000)
+
+	if err != nil {
+		t.Fatalf("Webhook() error = %v", err)
+	}
+
+	if code, status := postPaymentWebhook(t, app, payload, header); code != http.StatusOK || status != models.PaymentEventProcessed {
+		t.Fatalf("first delivery = %d %q, want 200 %q", code, status, models.PaymentEventProcessed)
+	}
+
+	// Провайдер не получил ответ и доставляет то же событие повторно
+	if code, status := postPaymentWebhook(t, app, payload, header); code != http.StatusOK || status != "duplicate" {
+		t.Fatalf("second delivery = %d %q, want 200 \"duplicate\"", code, status)
+	}
+
+	if store.applied != 1 {
+		t.Errorf("event applied %d times, want 1", store.applied)
+	}
+
+	if len(store.events) != 1 {
+		t.Errorf("stored %d events, want 1", len(store.events))
+	}
+
+	if payment.Status != models.PaymentStatusCaptured {
+		t.Errorf("payment status = %s, want %s", payment.Status, models.PaymentStatusCaptured)
+	}
+}
+
+func TestPaymentWebhookOutOfOrderEventIsReplayed(t *testing.T) {
+	store := newMemoryPaymentStore()
+	payment := seedFakePayment(store, "fake_pi_000001")
+	app := newPaymentTestApp(store)
+	gateway := payments.NewFakeGateway("secret")
+
+	refunded, refundedHeader, err := gateway.Webhook(payments.EventPaymentRefunded, "fake_pi_000001", 150000)
+
+	if err != nil {
+		t.Fatalf("Webhook() error = %v", err)
+	}
+
+	captured, capturedHeader, err := gateway.Webhook(payments.EventPaymentCaptured, "fake_pi_000001", 150000)
+
+	if err != nil {
+		t.Fatalf("Webhook() error = %v", err)
+	}
+
+	// Возврат пришел раньше списания - откладывается
+	if code, status := postPaymentWebhook(t, app, refunded, refundedHeader); code != http.StatusOK || status != models.PaymentEventDeferred {
+		t.Fatalf("refund delivery = %d %q, want 200 %q", code, status, models.PaymentEventDeferred)
+	}
+
+	if payment.Status != models.PaymentStatusRequiresCapture {
+		t.Fatalf("payment status after deferred refund = %s, want %s", payment.Status, models.PaymentStatusRequiresCapture)
+	}
+
+	// Списание применяется и повторяет отложенный возврат того же платежа
+	if code, status := postPaymentWebhook(t, app, captured, capturedHeader); code != http.StatusOK || status != models.PaymentEventProcessed {
+		t.Fatalf("capture delivery = %d %q, want 200 %q", code, status, models.PaymentEventProcessed)
+	}
+
+	if store.events[0].status != models.PaymentEventProcessed {
+		t.Errorf("deferred refund status = %s, want %s", store.events[0].status, models.PaymentEventProcessed)
+	}
+
+	if payment.Status != models.PaymentStatusRefunded || payment.Refunded_Amount != 150000 {
+		t.Errorf("payment = %s refunded %d, want %s refunded 150000", payment.Status, payment.Refunded_Amount, models.PaymentStatusRefunded)
+	}
+}
+
+func TestPaymentWebhookLateCaptureOfRefundedPayment(t *testing.T) {
+	store := newMemoryPaymentStore()
+	payment := seedFakePayment(store, "fake_pi_000001")
+	app := newPaymentTestApp(store)
+	gateway := payments.NewFakeGateway("secret")
+
+	for _, eventType := range []string{payments.EventPaymentCaptured, payments.EventPaymentRefunded} {
+		payload, header, err := gateway.Webhook(eventType, "fake_pi_000001", 150000)
+
+		if err != nil {
+			t.Fatalf("Webhook() error = %v", err)
+		}
+
+		if code, status := postPaymentWebhook(t, app, payload, header); code != http.StatusOK || status != models.PaymentEventProcessed {
+			t.Fatalf("%s delivery = %d %q, want 200 %q", eventType, code, status, models.PaymentEventProcessed)
+		}
+	}
+
+	// Провайдер повторяет списание под новым event_id - дедупликация его не отсекает
+	late, lateHeader, err := gateway.Webhook(payments.EventPaymentCaptured, "fake_pi_000001", 150000)
+
+	if err != nil {
+		t.Fatalf("Webhook() error = %v", err)
+	}
+
+	if code, status := postPaymentWebhook(t, app, late, lateHeader); code != http.StatusOK || status != models.PaymentEventProcessed {
+		t.Fatalf("late capture delivery = %d %q, want 200 %q", code, status, models.PaymentEventProcessed)
+	}
+
+	if payment.Status != models.PaymentStatusRefunded {
+		t.Errorf("payment status after late capture = %s, want %s", payment.Status, models.PaymentStatusRefunded)
+	}
+
+	if len(store.captured) != 1 {
+		t.Errorf("payment captured %d times, want 1", len(store.captured))
+	}
+}
+
+func TestPaymentWebhookRejectsTamperedPayload(t *testing.T) {
+	store := newMemoryPaymentStore()
+	seedFakePayment(store, "fake_pi_000001")
+	app := newPaymentTestApp(store)
+
+	payload, header, err := payments.NewFakeGateway("secret").Webhook(payments.EventPaymentCaptured, "fake_pi_000001", 100)
+
+	if err != nil {
+		t.Fatalf("Webhook() error = %v", err)
+	}
+
+	tampered := bytes.Replace(payload, []byte(`"amount":100`), []byte(`"amount":999`), 1)
+
+	if code, _ := postPaymentWebhook(t, app, tampered, header); code != http.StatusUnauthorized {
+		t.Fatalf("tampered delivery = %d, want 401", code)
+	}
+
+	if len(store.events) != 0 {
+		t.Errorf("stored %d events, want 0", len(store.events))
+	}
+}
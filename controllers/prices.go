@@ -0,0 +1,231 @@
+package controllers
+
+import (
+	"context"
+	"ec-platform/currency"
+	"ec-platform/database"
+	"ec-platform/models"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+)
+
+// сколько последних изменений цены отдает история
+const priceHistoryLimit = 200
+
+// тело запроса смены базовой цены
+type productPriceRequest struct {
+	Price *models.Money `json:"price" validate:"required"`
+}
+
+// SetProductPrice меняет базовую цену товара {price}; изменение попадает в историю цен
+func (app *Application) SetProductPrice() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		email, exists := c.Get("email")
+
+		if !exists {
+			log.Println("user email not found in context")
+			c.JSON(http.StatusUnauthorized, gin.H{"error": "unauthorized"})
+			return
+		}
+
+		productID, err := uuid.Parse(c.Param("id"))
+
+		if err != nil {
+			log.Printf("invalid product ID format: %v", err)
+			c.JSON(http.StatusBadRequest, gin.H{"error": "invalid product ID format"})
+			return
+		}
+
+		var request productPriceRequest
+
+		if err := c.BindJSON(&request); err != nil {
+			log.Printf("invalid request body: %v", err)
+			c.JSON(http.StatusBadRequest, gin.H{"error": "invalid request body"})
+			return
+		}
+
+		if validationErr := validate.Struct(request); validationErr != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Validation failed: " + validationErr.Error()})
+			return
+		}
+
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+
+		if err := database.SetProductPrice(ctx, app.DB, productID, *request.Price, email.(string)); err != nil {
+			if err == database.ErrRecordNotFound {
+				c.JSON(http.StatusNotFound, gin.H{"error": "product not found"})
+
+			} else {
+				log.Printf("error setting product price: %v", err)
+				c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to set product price"})
+			}
+
+			return
+		}
+
+		product, err := database.GetProduct(ctx, app.DB, productID, currency.Identity(app.BaseCurrency))
+
+		if err != nil {
+			log.Printf("error fetching product: %v", err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to fetch product"})
+			return
+		}
+
+		c.JSON(http.StatusOK, gin.H{"product": product})
+	}
+}
+
+// GetPriceHistory - изменения базовой цены товара, новые сверху
+func (app *Application) GetPriceHistory() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		productID, err := uuid.Parse(c.Param("id"))
+
+		if err != nil {
+			log.Printf("invalid product ID format: %v", err)
+			c.JSON(http.StatusBadRequest, gin.H{"error": "invalid product ID format"})
+			return
+		}
+
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+
+		history, err := database.GetPriceHistory(ctx, app.DB, productID, priceHistoryLimit)
+
+		if err != nil {
+			log.Printf("error fetching price history: %v", err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to fetch price history"})
+			return
+		}
+
+		c.JSON(http.StatusOK, gin.H{"history": history})
+	}
+}
+
+// GetPriceSchedules - запланированные цены товара со статусами
+func (app *Application) GetPriceSchedules() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		productID, err := uuid.Parse(c.Param("id"))
+
+		if err != nil {
+			log.Printf("invalid product ID format: %v", err)
+			c.JSON(http.StatusBadRequest, gin.H{"error": "invalid product ID format"})
+			return
+		}
+
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+
+		schedules, err := database.GetPriceSchedules(ctx, app.DB, productID)
+
+		if err != nil {
+			log.Printf("error fetching price schedules: %v", err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to fetch price schedules"})
+			return
+		}
+
+		c.JSON(http.StatusOK, gin.H{"schedules": schedules})
+	}
+}
+
+// CreatePriceSchedule планирует цену {price, starts_at, ends_at}: с ends_at - распродажа
+// (базовая цена не меняется), без - плановое изменение базовой цены
+func (app *Application) CreatePriceSchedule() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		email, exists := c.Get("email")
+
+		if !exists {
+			log.Println("user email not found in context")
+			c.JSON(http.StatusUnauthorized, gin.H{"error": "unauthorized"})
+			return
+		}
+
+		productID, err := uuid.Parse(c.Param("id"))
+
+		if err != nil {
+			log.Printf("invalid product ID format: %v", err)
+			c.JSON(http.StatusBadRequest, gin.H{"error": "invalid product ID format"})
+			return
+		}
+
+		var schedule models.PriceSchedule
+
+		if err := c.BindJSON(&schedule); err != nil {
+			log.Printf("invalid request body: %v", err)
+			c.JSON(http.StatusBadRequest, gin.H{"error": "invalid request body"})
+			return
+		}
+
+		if validationErr := validate.Struct(schedule); validationErr != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Validation failed: " + validationErr.Error()})
+			return
+		}
+
+		schedule.Product_ID = productID
+		schedule.Created_By = email.(string)
+
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+
+		if err := database.CreatePriceSchedule(ctx, app.DB, &schedule); err != nil {
+			switch err {
+			case database.ErrRecordNotFound:
+				c.JSON(http.StatusNotFound, gin.H{"error": "product not found"})
+
+			case database.ErrPriceScheduleInPast:
+				c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+
+			case database.ErrPriceScheduleOverlap:
+				c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+
+			default:
+				log.Printf("error creating price schedule: %v", err)
+				c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to create price schedule"})
+			}
+
+			return
+		}
+
+		c.JSON(http.StatusCreated, gin.H{"schedule": schedule})
+	}
+}
+
+// CancelPriceSchedule отменяет запланированную или идущую цену
+func (app *Application) CancelPriceSchedule() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		scheduleID, err := uuid.Parse(c.Param("id"))
+
+		if err != nil {
+			log.Printf("invalid schedule ID format: %v", err)
+			c.JSON(http.StatusBadRequest, gin.H{"error": "invalid schedule ID format"})
+			return
+		}
+
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+
+		schedule, err := database.CancelPriceSchedule(ctx, app.DB, scheduleID)
+
+		if err != nil {
+			switch err {
+			case database.ErrPriceScheduleNotFound:
+				c.JSON(http.StatusNotFound, gin.H{"error": "price schedule not found"})
+
+			case database.ErrPriceScheduleFinished:
+				c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+
+			default:
+				log.Printf("error cancelling price schedule: %v", err)
+				c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to cancel price schedule"})
+			}
+
+			return
+		}
+
+		c.JSON(http.StatusOK, gin.H{"schedule": schedule})
+	}
+}
@@ -0,0 +1,359 @@
+package controllers
+
+import (
+	"bytes"
+	"context"
+	"ec-platform/database"
+	"ec-platform/images"
+	"ec-platform/models"
+	"ec-platform/storage"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"mime/multipart"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+)
+
+// Ограничения загрузки изображений товаров по умолчанию
+const (
+	DefaultMaxImageBytes    = 5 << 20
+	DefaultMaxProductImages = 10
+)
+
+// файлы хранилища неизменяемы (новая загрузка - новый ключ), поэтому кешируются надолго
+const imageCacheControl = "public, max-age=31536000, immutable"
+
+// тело запроса порядка галереи
+type imageOrderRequest struct {
+	Image_IDs []uuid.UUID `json:"image_ids" validate:"required,min=1"`
+}
+
+// загруженный файл, прошедший проверку
+type uploadedImage struct {
+	data  []byte
+	image *images.Image
+}
+
+// UploadProductImages загружает изображения товара (multipart, поле images - один или несколько файлов).
+// Формат определяется по содержимому файла; к каждому изображению строится миниатюра
+func (app *Application) UploadProductImages() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		productID, err := uuid.Parse(c.Param("id"))
+
+		if err != nil {
+			log.Printf("invalid product ID format: %v", err)
+			c.JSON(http.StatusBadRequest, gin.H{"error": "invalid product ID format"})
+			return
+		}
+
+		// Запрос целиком не больше, чем максимум файлов максимального размера (плюс поля формы)
+		c.Request.Body = http.MaxBytesReader(c.Writer, c.Request.Body, app.MaxImageBytes*int64(max(app.MaxProductImages, 1))+1<<20)
+
+		form, err := c.MultipartForm()
+
+		if err != nil {
+			var maxBytesErr *http.MaxBytesError
+
+			if errors.As(err, &maxBytesErr) {
+				c.JSON(http.StatusRequestEntityTooLarge, gin.H{"error": "request is too large"})
+
+			} else {
+				log.Printf("invalid multipart form: %v", err)
+				c.JSON(http.StatusBadRequest, gin.H{"error": "expected multipart/form-data with images field"})
+			}
+
+			return
+		}
+
+		files := form.File["images"]
+
+		if len(files) == 0 {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "at least one file in images field is required"})
+			return
+		}
+
+		// Сначала проверяем все файлы, чтобы не сохранить часть загрузки
+		uploads := make([]uploadedImage, 0, len(files))
+
+		for _, file := range files {
+			upload, err := app.readUploadedImage(file)
+
+			if err != nil {
+				switch err {
+				case errImageFileTooLarge:
+					c.JSON(http.StatusRequestEntityTooLarge, gin.H{"error": fmt.Sprintf("%s: file is larger than %d bytes", file.Filename, app.MaxImageBytes)})
+
+				case images.ErrUnsupportedImage:
+					c.JSON(http.StatusUnsupportedMediaType, gin.H{"error": file.Filename + ": " + err.Error()})
+
+				case images.ErrImageTooLarge:
+					c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("%s: image is larger than %dx%d", file.Filename, images.MaxDimension, images.MaxDimension)})
+
+				default:
+					log.Printf("error reading uploaded image: %v", err)
+					c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to read uploaded image"})
+				}
+
+				return
+			}
+
+			uploads = append(uploads, upload)
+		}
+
+		ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+		defer cancel()
+
+		saved := make([]models.ProductImage, 0, len(uploads))
+
+		for _, upload := range uploads {
+			image, err := app.saveProductImage(ctx, productID, upload)
+
+			if err != nil {
+				switch err {
+				case database.ErrRecordNotFound:
+					c.JSON(http.StatusNotFound, gin.H{"error": "product not found"})
+
+				case database.ErrProductImageLimit:
+					c.JSON(http.StatusConflict, gin.H{"error": "product image limit reached", "limit": app.MaxProductImages, "images": saved})
+
+				default:
+					log.Printf("error saving product image: %v", err)
+					c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to save product image", "images": saved})
+				}
+
+				return
+			}
+
+			saved = append(saved, *image)
+		}
+
+		c.JSON(http.StatusCreated, gin.H{"images": saved})
+	}
+}
+
+var errImageFileTooLarge = errors.New("image file is too large")
+
+// читает файл формы (не больше MaxImageBytes) и проверяет изображение
+func (app *Application) readUploadedImage(file *multipart.FileHeader) (uploadedImage, error) {
+	if file.Size > app.MaxImageBytes {
+		return uploadedImage{}, errImageFileTooLarge
+	}
+
+	reader, err := file.Open()
+
+	if err != nil {
+		return uploadedImage{}, err
+	}
+
+	defer reader.Close()
+
+	data, err := io.ReadAll(io.LimitReader(reader, app.MaxImageBytes+1))
+
+	if err != nil {
+		return uploadedImage{}, err
+	}
+
+	if int64(len(data)) > app.MaxImageBytes {
+		return uploadedImage{}, errImageFileTooLarge
+	}
+
+	image, err := images.Process(data)
+
+	if err != nil {
+		return uploadedImage{}, err
+	}
+
+	return uploadedImage{data: data, image: image}, nil
+}
+
+// кладет изображение и миниатюру в хранилище и добавляет их в галерею товара;
+// если запись в БД не удалась, файлы удаляются
+func (app *Application) saveProductImage(ctx context.Context, productID uuid.UUID, upload uploadedImage) (*models.ProductImage, error) {
+	imageID := uuid.New()
+	prefix := "products/" + productID.String() + "/" + imageID.String()
+
+	image := &models.ProductImage{
+		Image_ID:      imageID,
+		Product_ID:    productID,
+		Storage_Key:   prefix + upload.image.Ext,
+		Thumbnail_Key: prefix + "_thumb" + upload.image.ThumbnailExt,
+		Content_Type:  upload.image.ContentType,
+		Width:         upload.image.Width,
+		Height:        upload.image.Height,
+		Size:          int64(len(upload.data)),
+	}
+
+	if err := app.Images.Put(ctx, image.Storage_Key, bytes.NewReader(upload.data), image.Content_Type); err != nil {
+		return nil, err
+	}
+
+	err := app.Images.Put(ctx, image.Thumbnail_Key, bytes.NewReader(upload.image.Thumbnail), upload.image.ThumbnailContentType)
+
+	if err == nil {
+		err = database.AddProductImage(ctx, app.DB, image, app.MaxProductImages)
+	}
+
+	if err != nil {
+		app.deleteImageFiles(ctx, *image)
+		return nil, err
+	}
+
+	return image, nil
+}
+
+func (app *Application) deleteImageFiles(ctx context.Context, image models.ProductImage) {
+	for _, key := range []string{image.Storage_Key, image.Thumbnail_Key} {
+		if err := app.Images.Delete(ctx, key); err != nil {
+			log.Printf("error deleting image file %s: %v", key, err)
+		}
+	}
+}
+
+// GetProductImages - галерея товара по порядку (без авторизации)
+func (app *Application) GetProductImages() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		productID, err := uuid.Parse(c.Param("id"))
+
+		if err != nil {
+			log.Printf("invalid product ID format: %v", err)
+			c.JSON(http.StatusBadRequest, gin.H{"error": "invalid product ID format"})
+			return
+		}
+
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+
+		productImages, err := database.GetProductImages(ctx, app.DB, productID)
+
+		if err != nil {
+			log.Printf("error fetching product images: %v", err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to fetch product images"})
+			return
+		}
+
+		c.JSON(http.StatusOK, gin.H{"images": productImages})
+	}
+}
+
+// ReorderProductImages задает порядок галереи {image_ids: [...]}; первое изображение - основное
+func (app *Application) ReorderProductImages() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		productID, err := uuid.Parse(c.Param("id"))
+
+		if err != nil {
+			log.Printf("invalid product ID format: %v", err)
+			c.JSON(http.StatusBadRequest, gin.H{"error": "invalid product ID format"})
+			return
+		}
+
+		var request imageOrderRequest
+
+		if err := c.BindJSON(&request); err != nil {
+			log.Printf("invalid request body: %v", err)
+			c.JSON(http.StatusBadRequest, gin.H{"error": "invalid request body"})
+			return
+		}
+
+		if validationErr := validate.Struct(request); validationErr != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Validation failed: " + validationErr.Error()})
+			return
+		}
+
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+
+		productImages, err := database.ReorderProductImages(ctx, app.DB, productID, request.Image_IDs)
+
+		if err != nil {
+			if err == database.ErrInvalidImageOrder {
+				c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+
+			} else {
+				log.Printf("error reordering product images: %v", err)
+				c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to reorder product images"})
+			}
+
+			return
+		}
+
+		c.JSON(http.StatusOK, gin.H{"images": productImages})
+	}
+}
+
+func (app *Application) DeleteProductImage() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		productID, err := uuid.Parse(c.Param("id"))
+
+		if err != nil {
+			log.Printf("invalid product ID format: %v", err)
+			c.JSON(http.StatusBadRequest, gin.H{"error": "invalid product ID format"})
+			return
+		}
+
+		imageID, err := uuid.Parse(c.Param("image_id"))
+
+		if err != nil {
+			log.Printf("invalid image ID format: %v", err)
+			c.JSON(http.StatusBadRequest, gin.H{"error": "invalid image ID format"})
+			return
+		}
+
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+
+		image, err := database.DeleteProductImage(ctx, app.DB, productID, imageID)
+
+		if err != nil {
+			if err == database.ErrProductImageNotFound {
+				c.JSON(http.StatusNotFound, gin.H{"error": "product image not found"})
+
+			} else {
+				log.Printf("error deleting product image: %v", err)
+				c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to delete product image"})
+			}
+
+			return
+		}
+
+		app.deleteImageFiles(ctx, *image)
+
+		c.JSON(http.StatusOK, gin.H{"message": "product image deleted successfully"})
+	}
+}
+
+// ServeImage отдает файл хранилища (GET /images/*key) с заголовками долгого кеширования;
+// поддерживает If-Modified-Since и Range
+func (app *Application) ServeImage() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		key := strings.TrimPrefix(c.Param("key"), "/")
+
+		blob, err := app.Images.Open(c.Request.Context(), key)
+
+		if err != nil {
+			if err == storage.ErrBlobNotFound || err == storage.ErrInvalidKey {
+				c.JSON(http.StatusNotFound, gin.H{"error": "image not found"})
+
+			} else {
+				log.Printf("error opening image %s: %v", key, err)
+				c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to read image"})
+			}
+
+			return
+		}
+
+		defer blob.Close()
+
+		c.Header("Content-Type", blob.ContentType)
+		c.Header("Cache-Control", imageCacheControl)
+		c.Header("ETag", fmt.Sprintf(`"%x-%x"`, blob.ModTime.UnixNano(), blob.Size))
+		c.Header("X-Content-Type-Options", "nosniff")
+
+		http.ServeContent(c.Writer, c.Request, key, blob.ModTime, blob)
+	}
+}
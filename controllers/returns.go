@@ -0,0 +1,278 @@
+package controllers
+
+import (
+	"context"
+	"ec-platform/database"
+	"ec-platform/models"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+)
+
+// тело запроса заявки на возврат
+type returnRequest struct {
+	Reason string              `json:"reason" validate:"required,max=1000"`
+	Items  []models.ReturnItem `json:"items" validate:"required,min=1,dive"`
+}
+
+// тело запроса решения по заявке
+type returnDecisionRequest struct {
+	Amount *models.Money `json:"amount"`
+	Note   string        `json:"note" validate:"max=1000"`
+}
+
+func (app *Application) CreateReturn() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		// Получаем email пользователя из контекста (установлен middleware)
+		email, exists := c.Get("email")
+
+		if !exists {
+			log.Println("user email not found in context")
+			c.JSON(http.StatusUnauthorized, gin.H{"error": "unauthorized"})
+			return
+		}
+
+		// Парсим UUID заказа
+		orderID, err := uuid.Parse(c.Param("id"))
+
+		if err != nil {
+			log.Printf("invalid order ID format: %v", err)
+			c.JSON(http.StatusBadRequest, gin.H{"error": "invalid order ID format"})
+			return
+		}
+
+		var request returnRequest
+
+		if err := c.BindJSON(&request); err != nil {
+			log.Printf("invalid request body: %v", err)
+			c.JSON(http.StatusBadRequest, gin.H{"error": "invalid request body"})
+			return
+		}
+
+		if validationErr := validate.Struct(request); validationErr != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Validation failed: " + validationErr.Error()})
+			return
+		}
+
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+
+		// Получаем user_id по email
+		var userID string
+
+		err = app.DB.QueryRow(ctx, "SELECT user_id FROM users WHERE email = $1", email).Scan(&userID)
+
+		if err != nil {
+			log.Printf("error finding user: %v", err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to find user"})
+			return
+		}
+
+		// Вызываем функцию из database слоя
+		ret, err := database.CreateReturn(ctx, app.DB, userID, orderID, request.Reason, request.Items)
+
+		if err != nil {
+			switch err {
+			case database.ErrOrderNotFound:
+				c.JSON(http.StatusNotFound, gin.H{"error": "order not found"})
+
+			case database.ErrOrderNotReturnable:
+				c.JSON(http.StatusConflict, gin.H{"error": "only delivered orders can be returned"})
+
+			case database.ErrInvalidReturnItems:
+				c.JSON(http.StatusBadRequest, gin.H{"error": "return items do not belong to the order"})
+
+			case database.ErrReturnQuantityExceeded:
+				c.JSON(http.StatusBadRequest, gin.H{"error": "return quantity exceeds purchased quantity"})
+
+			default:
+				log.Printf("error creating return: %v", err)
+				c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to create return request"})
+			}
+
+			return
+		}
+
+		c.JSON(http.StatusCreated, ret)
+	}
+}
+
+func (app *Application) GetReturns() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		// Получаем email пользователя из контекста (установлен middleware)
+		email, exists := c.Get("email")
+
+		if !exists {
+			log.Println("user email not found in context")
+			c.JSON(http.StatusUnauthorized, gin.H{"error": "unauthorized"})
+			return
+		}
+
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+
+		// Получаем user_id по email
+		var userID string
+
+		err := app.DB.QueryRow(ctx, "SELECT user_id FROM users WHERE email = $1", email).Scan(&userID)
+
+		if err != nil {
+			log.Printf("error finding user: %v", err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to find user"})
+			return
+		}
+
+		returns, err := database.GetReturns(ctx, app.DB, userID, c.Query("status"))
+
+		if err != nil {
+			log.Printf("error fetching returns: %v", err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to fetch returns"})
+			return
+		}
+
+		c.JSON(http.StatusOK, gin.H{"returns": returns})
+	}
+}
+
+func (app *Application) AdminGetReturns() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+
+		returns, err := database.GetReturns(ctx, app.DB, "", c.Query("status"))
+
+		if err != nil {
+			log.Printf("error fetching returns: %v", err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to fetch returns"})
+			return
+		}
+
+		c.JSON(http.StatusOK, gin.H{"returns": returns})
+	}
+}
+
+func (app *Application) ApproveReturn() gin.HandlerFunc {
+	return app.decideReturn(true)
+}
+
+func (app *Application) RejectReturn() gin.HandlerFunc {
+	return app.decideReturn(false)
+}
+
+// одобрение (с необязательной частичной суммой) или отклонение заявки сотрудником
+func (app *Application) decideReturn(approve bool) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		email, exists := c.Get("email")
+
+		if !exists {
+			log.Println("user email not found in context")
+			c.JSON(http.StatusUnauthorized, gin.H{"error": "unauthorized"})
+			return
+		}
+
+		// Парсим UUID заявки
+		returnID, err := uuid.Parse(c.Param("id"))
+
+		if err != nil {
+			log.Printf("invalid return ID format: %v", err)
+			c.JSON(http.StatusBadRequest, gin.H{"error": "invalid return ID format"})
+			return
+		}
+
+		var request returnDecisionRequest
+
+		if c.Request.ContentLength > 0 {
+			if err := c.BindJSON(&request); err != nil {
+				log.Printf("invalid request body: %v", err)
+				c.JSON(http.StatusBadRequest, gin.H{"error": "invalid request body"})
+				return
+			}
+		}
+
+		if validationErr := validate.Struct(request); validationErr != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Validation failed: " + validationErr.Error()})
+			return
+		}
+
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+
+		if approve {
+			err = database.ApproveReturn(ctx, app.DB, returnID, request.Amount, email.(string), request.Note)
+		} else {
+			err = database.RejectReturn(ctx, app.DB, returnID, email.(string), request.Note)
+		}
+
+		if err != nil {
+			switch err {
+			case database.ErrReturnNotFound:
+				c.JSON(http.StatusNotFound, gin.H{"error": "return request not found"})
+
+			case database.ErrInvalidReturnStatus:
+				c.JSON(http.StatusConflict, gin.H{"error": "return request was already decided"})
+
+			case database.ErrInvalidReturnAmount:
+				c.JSON(http.StatusBadRequest, gin.H{"error": "approved amount exceeds requested amount"})
+
+			default:
+				log.Printf("error deciding return: %v", err)
+				c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to update return request"})
+			}
+
+			return
+		}
+
+		c.JSON(http.StatusOK, gin.H{"message": "return request updated", "return_id": returnID})
+	}
+}
+
+// получение товара на склад: остатки возвращаются, одобренная сумма возвращается покупателю
+func (app *Application) ReceiveReturn() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		email, exists := c.Get("email")
+
+		if !exists {
+			log.Println("user email not found in context")
+			c.JSON(http.StatusUnauthorized, gin.H{"error": "unauthorized"})
+			return
+		}
+
+		// Парсим UUID заявки
+		returnID, err := uuid.Parse(c.Param("id"))
+
+		if err != nil {
+			log.Printf("invalid return ID format: %v", err)
+			c.JSON(http.StatusBadRequest, gin.H{"error": "invalid return ID format"})
+			return
+		}
+
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		defer cancel()
+
+		ret, err := database.ReceiveReturn(ctx, app.DB, returnID, email.(string), app.RefundPayment())
+
+		if err != nil {
+			switch err {
+			case database.ErrReturnNotFound:
+				c.JSON(http.StatusNotFound, gin.H{"error": "return request not found"})
+
+			case database.ErrInvalidReturnStatus:
+				c.JSON(http.StatusConflict, gin.H{"error": "return request is not approved"})
+
+			case database.ErrRefundExceedsPaid:
+				c.JSON(http.StatusConflict, gin.H{"error": "refund amount exceeds paid amount"})
+
+			default:
+				log.Printf("error receiving return: %v", err)
+				c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to receive return"})
+			}
+
+			return
+		}
+
+		c.JSON(http.StatusOK, ret)
+	}
+}
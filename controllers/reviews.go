@@ -0,0 +1,502 @@
+package controllers
+
+import (
+	"context"
+	"ec-platform/database"
+	"ec-platform/models"
+	"log"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+)
+
+// Пагинация отзывов
+const (
+	defaultReviewsPageSize = 20
+	maxReviewsPageSize     = 100
+)
+
+// тело запроса решения модератора
+type reviewModerationRequest struct {
+	Note string `json:"note" validate:"max=1000"`
+}
+
+// GetProduct - карточка товара со сводкой оценок (GET /products/:id, без авторизации)
+func (app *Application) GetProduct() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		productID, err := uuid.Parse(c.Param("id"))
+
+		if err != nil {
+			log.Printf("invalid product ID format: %v", err)
+			c.JSON(http.StatusBadRequest, gin.H{"error": "invalid product ID format"})
+			return
+		}
+
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+
+		rate, ok := app.requestRate(ctx, c)
+
+		if !ok {
+			return
+		}
+
+		product, err := database.GetProduct(ctx, app.DB, productID, rate)
+
+		if err != nil {
+			if err == database.ErrRecordNotFound {
+				c.JSON(http.StatusNotFound, gin.H{"error": "product not found"})
+
+			} else {
+				log.Printf("error fetching product: %v", err)
+				c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to fetch product"})
+			}
+
+			return
+		}
+
+		summary, err := database.GetRatingSummary(ctx, app.DB, product)
+
+		if err != nil {
+			log.Printf("error fetching rating summary: %v", err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to fetch product"})
+			return
+		}
+
+		productImages, err := database.GetProductImages(ctx, app.DB, productID)
+
+		if err != nil {
+			log.Printf("error fetching product images: %v", err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to fetch product"})
+			return
+		}
+
+		c.JSON(http.StatusOK, gin.H{
+			"product":        product,
+			"images":         productImages,
+			"rating_summary": summary,
+		})
+	}
+}
+
+// GetProductReviews - одобренные отзывы товара (?sort=recent|helpful&page=&limit=, без авторизации)
+func (app *Application) GetProductReviews() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		productID, err := uuid.Parse(c.Param("id"))
+
+		if err != nil {
+			log.Printf("invalid product ID format: %v", err)
+			c.JSON(http.StatusBadRequest, gin.H{"error": "invalid product ID format"})
+			return
+		}
+
+		// Параметры пагинации
+		page, err := strconv.Atoi(c.DefaultQuery("page", "1"))
+
+		if err != nil || page < 1 {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "invalid page"})
+			return
+		}
+
+		limit, err := strconv.Atoi(c.DefaultQuery("limit", strconv.Itoa(defaultReviewsPageSize)))
+
+		if err != nil || limit < 1 || limit > maxReviewsPageSize {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "invalid limit"})
+			return
+		}
+
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+
+		reviews, total, err := database.GetProductReviews(ctx, app.DB, productID, c.DefaultQuery("sort", database.ReviewSortRecent), limit, (page-1)*limit)
+
+		if err != nil {
+			if err == database.ErrInvalidReviewSorting {
+				c.JSON(http.StatusBadRequest, gin.H{"error": "sort must be recent or helpful"})
+
+			} else {
+				log.Printf("error fetching reviews: %v", err)
+				c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to fetch reviews"})
+			}
+
+			return
+		}
+
+		c.JSON(http.StatusOK, gin.H{
+			"reviews": reviews,
+			"page":    page,
+			"limit":   limit,
+			"total":   total,
+		})
+	}
+}
+
+// CreateReview - отзыв покупателя, получившего товар (POST /products/:id/reviews)
+func (app *Application) CreateReview() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		// Получаем email пользователя из контекста (установлен middleware)
+		email, exists := c.Get("email")
+
+		if !exists {
+			log.Println("user email not found in context")
+			c.JSON(http.StatusUnauthorized, gin.H{"error": "unauthorized"})
+			return
+		}
+
+		productID, err := uuid.Parse(c.Param("id"))
+
+		if err != nil {
+			log.Printf("invalid product ID format: %v", err)
+			c.JSON(http.StatusBadRequest, gin.H{"error": "invalid product ID format"})
+			return
+		}
+
+		var review models.Review
+
+		if err := c.BindJSON(&review); err != nil {
+			log.Printf("invalid request body: %v", err)
+			c.JSON(http.StatusBadRequest, gin.H{"error": "invalid request body"})
+			return
+		}
+
+		if validationErr := validate.Struct(review); validationErr != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Validation failed: " + validationErr.Error()})
+			return
+		}
+
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+
+		// Получаем user_id по email
+		var userID string
+
+		err = app.DB.QueryRow(ctx, "SELECT user_id FROM users WHERE email = $1", email).Scan(&userID)
+
+		if err != nil {
+			log.Printf("error finding user: %v", err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to find user"})
+			return
+		}
+
+		// Вызываем функцию из database слоя
+		created, err := database.CreateReview(ctx, app.DB, userID, productID, &review)
+
+		if err != nil {
+			switch err {
+			case database.ErrRecordNotFound:
+				c.JSON(http.StatusNotFound, gin.H{"error": "product not found"})
+
+			case database.ErrNotVerifiedPurchase:
+				c.JSON(http.StatusForbidden, gin.H{"error": "only customers who received the product can review it"})
+
+			case database.ErrReviewExists:
+				c.JSON(http.StatusConflict, gin.H{"error": "you have already reviewed this product"})
+
+			default:
+				log.Printf("error creating review: %v", err)
+				c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to create review"})
+			}
+
+			return
+		}
+
+		c.JSON(http.StatusCreated, created)
+	}
+}
+
+// UpdateReview изменяет свой отзыв; отзыв снова уходит на модерацию
+func (app *Application) UpdateReview() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		// Получаем email пользователя из контекста (установлен middleware)
+		email, exists := c.Get("email")
+
+		if !exists {
+			log.Println("user email not found in context")
+			c.JSON(http.StatusUnauthorized, gin.H{"error": "unauthorized"})
+			return
+		}
+
+		reviewID, err := uuid.Parse(c.Param("id"))
+
+		if err != nil {
+			log.Printf("invalid review ID format: %v", err)
+			c.JSON(http.StatusBadRequest, gin.H{"error": "invalid review ID format"})
+			return
+		}
+
+		var review models.Review
+
+		if err := c.BindJSON(&review); err != nil {
+			log.Printf("invalid request body: %v", err)
+			c.JSON(http.StatusBadRequest, gin.H{"error": "invalid request body"})
+			return
+		}
+
+		if validationErr := validate.Struct(review); validationErr != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Validation failed: " + validationErr.Error()})
+			return
+		}
+
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+
+		// Получаем user_id по email
+		var userID string
+
+		err = app.DB.QueryRow(ctx, "SELECT user_id FROM users WHERE email = $1", email).Scan(&userID)
+
+		if err != nil {
+			log.Printf("error finding user: %v", err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to find user"})
+			return
+		}
+
+		// Вызываем функцию из database слоя
+		updated, err := database.UpdateReview(ctx, app.DB, userID, reviewID, &review)
+
+		if err != nil {
+			if err == database.ErrReviewNotFound {
+				c.JSON(http.StatusNotFound, gin.H{"error": "review not found"})
+
+			} else {
+				log.Printf("error updating review: %v", err)
+				c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to update review"})
+			}
+
+			return
+		}
+
+		c.JSON(http.StatusOK, updated)
+	}
+}
+
+func (app *Application) DeleteReview() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		// Получаем email пользователя из контекста (установлен middleware)
+		email, exists := c.Get("email")
+
+		if !exists {
+			log.Println("user email not found in context")
+			c.JSON(http.StatusUnauthorized, gin.H{"error": "unauthorized"})
+			return
+		}
+
+		reviewID, err := uuid.Parse(c.Param("id"))
+
+		if err != nil {
+			log.Printf("invalid review ID format: %v", err)
+			c.JSON(http.StatusBadRequest, gin.H{"error": "invalid review ID format"})
+			return
+		}
+
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+
+		// Получаем user_id по email
+		var userID string
+
+		err = app.DB.QueryRow(ctx, "SELECT user_id FROM users WHERE email = $1", email).Scan(&userID)
+
+		if err != nil {
+			log.Printf("error finding user: %v", err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to find user"})
+			return
+		}
+
+		// Вызываем функцию из database слоя
+		err = database.DeleteReview(ctx, app.DB, userID, reviewID)
+
+		if err != nil {
+			if err == database.ErrReviewNotFound {
+				c.JSON(http.StatusNotFound, gin.H{"error": "review not found"})
+
+			} else {
+				log.Printf("error deleting review: %v", err)
+				c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to delete review"})
+			}
+
+			return
+		}
+
+		c.JSON(http.StatusOK, gin.H{"message": "review deleted successfully"})
+	}
+}
+
+func (app *Application) VoteReviewHelpful() gin.HandlerFunc {
+	return app.voteReview(true)
+}
+
+func (app *Application) UnvoteReviewHelpful() gin.HandlerFunc {
+	return app.voteReview(false)
+}
+
+// отметка «отзыв полезен» (POST) или ее снятие (DELETE /reviews/:id/helpful)
+func (app *Application) voteReview(helpful bool) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		// Получаем email пользователя из контекста (установлен middleware)
+		email, exists := c.Get("email")
+
+		if !exists {
+			log.Println("user email not found in context")
+			c.JSON(http.StatusUnauthorized, gin.H{"error": "unauthorized"})
+			return
+		}
+
+		reviewID, err := uuid.Parse(c.Param("id"))
+
+		if err != nil {
+			log.Printf("invalid review ID format: %v", err)
+			c.JSON(http.StatusBadRequest, gin.H{"error": "invalid review ID format"})
+			return
+		}
+
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+
+		// Получаем user_id по email
+		var userID string
+
+		err = app.DB.QueryRow(ctx, "SELECT user_id FROM users WHERE email = $1", email).Scan(&userID)
+
+		if err != nil {
+			log.Printf("error finding user: %v", err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to find user"})
+			return
+		}
+
+		// Вызываем функцию из database слоя
+		count, err := database.VoteReview(ctx, app.DB, userID, reviewID, helpful)
+
+		if err != nil {
+			switch err {
+			case database.ErrReviewNotFound:
+				c.JSON(http.StatusNotFound, gin.H{"error": "review not found"})
+
+			case database.ErrOwnReviewVote:
+				c.JSON(http.StatusForbidden, gin.H{"error": "can't vote for own review"})
+
+			default:
+				log.Printf("error voting for review: %v", err)
+				c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to vote for review"})
+			}
+
+			return
+		}
+
+		c.JSON(http.StatusOK, gin.H{"review_id": reviewID, "helpful_count": count})
+	}
+}
+
+// AdminGetReviews - отзывы для модерации (?status=pending|approved|rejected&page=&limit=)
+func (app *Application) AdminGetReviews() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		// Параметры пагинации
+		page, err := strconv.Atoi(c.DefaultQuery("page", "1"))
+
+		if err != nil || page < 1 {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "invalid page"})
+			return
+		}
+
+		limit, err := strconv.Atoi(c.DefaultQuery("limit", strconv.Itoa(defaultReviewsPageSize)))
+
+		if err != nil || limit < 1 || limit > maxReviewsPageSize {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "invalid limit"})
+			return
+		}
+
+		status := c.Query("status")
+
+		switch status {
+		case "", models.ReviewStatusPending, models.ReviewStatusApproved, models.ReviewStatusRejected:
+
+		default:
+			c.JSON(http.StatusBadRequest, gin.H{"error": "unknown review status"})
+			return
+		}
+
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+
+		reviews, total, err := database.AdminGetReviews(ctx, app.DB, status, limit, (page-1)*limit)
+
+		if err != nil {
+			log.Printf("error fetching reviews: %v", err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to fetch reviews"})
+			return
+		}
+
+		c.JSON(http.StatusOK, gin.H{
+			"reviews": reviews,
+			"page":    page,
+			"limit":   limit,
+			"total":   total,
+		})
+	}
+}
+
+func (app *Application) ApproveReview() gin.HandlerFunc {
+	return app.moderateReview(models.ReviewStatusApproved)
+}
+
+func (app *Application) RejectReview() gin.HandlerFunc {
+	return app.moderateReview(models.ReviewStatusRejected)
+}
+
+// решение модератора по отзыву; оценка товара пересчитывается сразу
+func (app *Application) moderateReview(status string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		email, exists := c.Get("email")
+
+		if !exists {
+			log.Println("user email not found in context")
+			c.JSON(http.StatusUnauthorized, gin.H{"error": "unauthorized"})
+			return
+		}
+
+		reviewID, err := uuid.Parse(c.Param("id"))
+
+		if err != nil {
+			log.Printf("invalid review ID format: %v", err)
+			c.JSON(http.StatusBadRequest, gin.H{"error": "invalid review ID format"})
+			return
+		}
+
+		var request reviewModerationRequest
+
+		if c.Request.ContentLength > 0 {
+			if err := c.BindJSON(&request); err != nil {
+				log.Printf("invalid request body: %v", err)
+				c.JSON(http.StatusBadRequest, gin.H{"error": "invalid request body"})
+				return
+			}
+		}
+
+		if validationErr := validate.Struct(request); validationErr != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Validation failed: " + validationErr.Error()})
+			return
+		}
+
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+
+		review, err := database.ModerateReview(ctx, app.DB, reviewID, status, email.(string), request.Note)
+
+		if err != nil {
+			if err == database.ErrReviewNotFound {
+				c.JSON(http.StatusNotFound, gin.H{"error": "review not found"})
+
+			} else {
+				log.Printf("error moderating review: %v", err)
+				c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to moderate review"})
+			}
+
+			return
+		}
+
+		c.JSON(http.StatusOK, review)
+	}
+}
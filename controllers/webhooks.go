@@ -0,0 +1,222 @@
+package controllers
+
+import (
+	"context"
+	"ec-platform/database"
+	"ec-platform/events"
+	"ec-platform/models"
+	"ec-platform/webhooks"
+	"log"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+// создание подписки партнера; секрет генерируется, если не передан, и возвращается только здесь
+func (app *Application) CreateWebhookSubscription() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var subscription models.WebhookSubscription
+
+		if err := c.BindJSON(&subscription); err != nil {
+			log.Printf("invalid request body: %v", err)
+			c.JSON(http.StatusBadRequest, gin.H{"error": "invalid request body"})
+			return
+		}
+
+		if validationErr := validate.Struct(subscription); validationErr != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Validation failed: " + validationErr.Error()})
+			return
+		}
+
+		for _, eventType := range subscription.Event_Types {
+			if !events.IsKnownType(eventType) {
+				c.JSON(http.StatusBadRequest, gin.H{"error": "unknown event type: " + eventType})
+				return
+			}
+		}
+
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+
+		// Адрес подписки не должен вести во внутреннюю сеть (SSRF)
+		if err := webhooks.ValidateURL(ctx, subscription.URL); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+
+		if subscription.Secret == "" {
+			secret, err := webhooks.GenerateSecret()
+
+			if err != nil {
+				log.Printf("error generating webhook secret: %v", err)
+				c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to create subscription"})
+				return
+			}
+
+			subscription.Secret = secret
+		}
+
+		if err := database.CreateWebhookSubscription(ctx, app.DB, &subscription); err != nil {
+			log.Printf("error creating webhook subscription: %v", err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to create subscription"})
+			return
+		}
+
+		c.JSON(http.StatusCreated, subscription)
+	}
+}
+
+func (app *Application) GetWebhookSubscriptions() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+
+		subscriptions, err := database.GetWebhookSubscriptions(ctx, app.DB)
+
+		if err != nil {
+			log.Printf("error fetching webhook subscriptions: %v", err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to fetch subscriptions"})
+			return
+		}
+
+		// Секреты в списке не показываем
+		for i := range subscriptions {
+			subscriptions[i].Secret = ""
+		}
+
+		c.JSON(http.StatusOK, gin.H{"subscriptions": subscriptions})
+	}
+}
+
+func (app *Application) DeleteWebhookSubscription() gin.HandlerFunc {
+	return app.updateWebhookSubscription(database.DeleteWebhookSubscription, "subscription deleted")
+}
+
+// возобновление подписки, приостановленной после серии неудачных доставок
+func (app *Application) ResumeWebhookSubscription() gin.HandlerFunc {
+	return app.updateWebhookSubscription(database.ResumeWebhookSubscription, "subscription resumed")
+}
+
+func (app *Application) updateWebhookSubscription(update func(context.Context, *pgxpool.Pool, uuid.UUID) error, message string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		// Парсим UUID подписки
+		subscriptionID, err := uuid.Parse(c.Param("id"))
+
+		if err != nil {
+			log.Printf("invalid subscription ID format: %v", err)
+			c.JSON(http.StatusBadRequest, gin.H{"error": "invalid subscription ID format"})
+			return
+		}
+
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+
+		if err := update(ctx, app.DB, subscriptionID); err != nil {
+			if err == database.ErrWebhookSubscriptionNotFound {
+				c.JSON(http.StatusNotFound, gin.H{"error": "subscription not found"})
+
+			} else {
+				log.Printf("error updating webhook subscription: %v", err)
+				c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to update subscription"})
+			}
+
+			return
+		}
+
+		c.JSON(http.StatusOK, gin.H{"message": message, "subscription_id": subscriptionID})
+	}
+}
+
+func (app *Application) GetWebhookDeliveries() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var subscriptionID *uuid.UUID
+
+		if value := c.Query("subscription_id"); value != "" {
+			parsed, err := uuid.Parse(value)
+
+			if err != nil {
+				c.JSON(http.StatusBadRequest, gin.H{"error": "invalid subscription ID format"})
+				return
+			}
+
+			subscriptionID = &parsed
+		}
+
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+
+		deliveries, err := database.GetWebhookDeliveries(ctx, app.DB, subscriptionID, c.Query("status"), 100)
+
+		if err != nil {
+			log.Printf("error fetching webhook deliveries: %v", err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to fetch deliveries"})
+			return
+		}
+
+		c.JSON(http.StatusOK, gin.H{"deliveries": deliveries})
+	}
+}
+
+// доставка с журналом попыток и кодами ответов
+func (app *Application) GetWebhookDelivery() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		deliveryID, err := strconv.ParseInt(c.Param("id"), 10, 64)
+
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "invalid delivery ID"})
+			return
+		}
+
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+
+		delivery, err := database.GetWebhookDelivery(ctx, app.DB, deliveryID)
+
+		if err != nil {
+			if err == database.ErrWebhookDeliveryNotFound {
+				c.JSON(http.StatusNotFound, gin.H{"error": "delivery not found"})
+
+			} else {
+				log.Printf("error fetching webhook delivery: %v", err)
+				c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to fetch delivery"})
+			}
+
+			return
+		}
+
+		c.JSON(http.StatusOK, delivery)
+	}
+}
+
+// повторная отправка доставки
+func (app *Application) ReplayWebhookDelivery() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		deliveryID, err := strconv.ParseInt(c.Param("id"), 10, 64)
+
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "invalid delivery ID"})
+			return
+		}
+
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+
+		if err := database.ReplayWebhookDelivery(ctx, app.DB, deliveryID); err != nil {
+			if err == database.ErrWebhookDeliveryNotFound {
+				c.JSON(http.StatusNotFound, gin.H{"error": "delivery not found"})
+
+			} else {
+				log.Printf("error replaying webhook delivery: %v", err)
+				c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to replay delivery"})
+			}
+
+			return
+		}
+
+		c.JSON(http.StatusOK, gin.H{"message": "delivery scheduled", "id": deliveryID})
+	}
+}
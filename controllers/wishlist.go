@@ -0,0 +1,494 @@
+package controllers
+
+import (
+	"context"
+	"ec-platform/database"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+)
+
+// тело запроса создания списка желаний
+type wishlistRequest struct {
+	Name   string `json:"name" validate:"required,max=100"`
+	Shared bool   `json:"shared"`
+}
+
+// тело запроса изменения списка: не заданные поля не меняются
+type wishlistUpdateRequest struct {
+	Name   *string `json:"name" validate:"omitempty,min=1,max=100"`
+	Shared *bool   `json:"shared"`
+}
+
+// id списка из пути: "default" - список по умолчанию (uuid.Nil)
+func parseWishlistID(c *gin.Context) (uuid.UUID, bool) {
+	if c.Param("id") == "default" {
+		return uuid.Nil, true
+	}
+
+	wishlistID, err := uuid.Parse(c.Param("id"))
+
+	if err != nil {
+		log.Printf("invalid wishlist ID format: %v", err)
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid wishlist ID format"})
+		return uuid.Nil, false
+	}
+
+	return wishlistID, true
+}
+
+func (app *Application) GetWishlists() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		// Получаем email пользователя из контекста (установлен middleware)
+		email, exists := c.Get("email")
+
+		if !exists {
+			log.Println("user email not found in context")
+			c.JSON(http.StatusUnauthorized, gin.H{"error": "unauthorized"})
+			return
+		}
+
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+
+		// Получаем user_id по email
+		var userID string
+
+		err := app.DB.QueryRow(ctx, "SELECT user_id FROM users WHERE email = $1", email).Scan(&userID)
+
+		if err != nil {
+			log.Printf("error finding user: %v", err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to find user"})
+			return
+		}
+
+		// Вызываем функцию из database слоя
+		wishlists, err := database.GetWishlists(ctx, app.DB, userID)
+
+		if err != nil {
+			log.Printf("error fetching wishlists: %v", err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to fetch wishlists"})
+			return
+		}
+
+		c.JSON(http.StatusOK, wishlists)
+	}
+}
+
+func (app *Application) CreateWishlist() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		// Получаем email пользователя из контекста (установлен middleware)
+		email, exists := c.Get("email")
+
+		if !exists {
+			log.Println("user email not found in context")
+			c.JSON(http.StatusUnauthorized, gin.H{"error": "unauthorized"})
+			return
+		}
+
+		var request wishlistRequest
+
+		if err := c.BindJSON(&request); err != nil {
+			log.Printf("invalid request body: %v", err)
+			c.JSON(http.StatusBadRequest, gin.H{"error": "invalid request body"})
+			return
+		}
+
+		if validationErr := validate.Struct(request); validationErr != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Validation failed: " + validationErr.Error()})
+			return
+		}
+
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+
+		// Получаем user_id по email
+		var userID string
+
+		err := app.DB.QueryRow(ctx, "SELECT user_id FROM users WHERE email = $1", email).Scan(&userID)
+
+		if err != nil {
+			log.Printf("error finding user: %v", err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to find user"})
+			return
+		}
+
+		// Вызываем функцию из database слоя
+		wishlist, err := database.CreateWishlist(ctx, app.DB, userID, request.Name, request.Shared)
+
+		if err != nil {
+			if err == database.ErrWishlistExists {
+				c.JSON(http.StatusConflict, gin.H{"error": "wishlist with this name already exists"})
+
+			} else {
+				log.Printf("error creating wishlist: %v", err)
+				c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to create wishlist"})
+			}
+
+			return
+		}
+
+		c.JSON(http.StatusCreated, wishlist)
+	}
+}
+
+// GetWishlist возвращает список с товарами (GET /wishlists/:id, :id = default - список по умолчанию)
+func (app *Application) GetWishlist() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		// Получаем email пользователя из контекста (установлен middleware)
+		email, exists := c.Get("email")
+
+		if !exists {
+			log.Println("user email not found in context")
+			c.JSON(http.StatusUnauthorized, gin.H{"error": "unauthorized"})
+			return
+		}
+
+		wishlistID, ok := parseWishlistID(c)
+
+		if !ok {
+			return
+		}
+
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+
+		// Получаем user_id по email
+		var userID string
+
+		err := app.DB.QueryRow(ctx, "SELECT user_id FROM users WHERE email = $1", email).Scan(&userID)
+
+		if err != nil {
+			log.Printf("error finding user: %v", err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to find user"})
+			return
+		}
+
+		// Вызываем функцию из database слоя
+		wishlist, err := database.GetWishlist(ctx, app.DB, userID, wishlistID)
+
+		if err != nil {
+			if err == database.ErrWishlistNotFound {
+				c.JSON(http.StatusNotFound, gin.H{"error": "wishlist not found"})
+
+			} else {
+				log.Printf("error fetching wishlist: %v", err)
+				c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to fetch wishlist"})
+			}
+
+			return
+		}
+
+		c.JSON(http.StatusOK, wishlist)
+	}
+}
+
+// UpdateWishlist переименовывает список и открывает / закрывает публичную ссылку
+func (app *Application) UpdateWishlist() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		// Получаем email пользователя из контекста (установлен middleware)
+		email, exists := c.Get("email")
+
+		if !exists {
+			log.Println("user email not found in context")
+			c.JSON(http.StatusUnauthorized, gin.H{"error": "unauthorized"})
+			return
+		}
+
+		wishlistID, err := uuid.Parse(c.Param("id"))
+
+		if err != nil {
+			log.Printf("invalid wishlist ID format: %v", err)
+			c.JSON(http.StatusBadRequest, gin.H{"error": "invalid wishlist ID format"})
+			return
+		}
+
+		var request wishlistUpdateRequest
+
+		if err := c.BindJSON(&request); err != nil {
+			log.Printf("invalid request body: %v", err)
+			c.JSON(http.StatusBadRequest, gin.H{"error": "invalid request body"})
+			return
+		}
+
+		if validationErr := validate.Struct(request); validationErr != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Validation failed: " + validationErr.Error()})
+			return
+		}
+
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+
+		// Получаем user_id по email
+		var userID string
+
+		err = app.DB.QueryRow(ctx, "SELECT user_id FROM users WHERE email = $1", email).Scan(&userID)
+
+		if err != nil {
+			log.Printf("error finding user: %v", err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to find user"})
+			return
+		}
+
+		// Вызываем функцию из database слоя
+		wishlist, err := database.UpdateWishlist(ctx, app.DB, userID, wishlistID, request.Name, request.Shared)
+
+		if err != nil {
+			switch err {
+			case database.ErrWishlistNotFound:
+				c.JSON(http.StatusNotFound, gin.H{"error": "wishlist not found"})
+
+			case database.ErrWishlistExists:
+				c.JSON(http.StatusConflict, gin.H{"error": "wishlist with this name already exists"})
+
+			default:
+				log.Printf("error updating wishlist: %v", err)
+				c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to update wishlist"})
+			}
+
+			return
+		}
+
+		c.JSON(http.StatusOK, wishlist)
+	}
+}
+
+func (app *Application) DeleteWishlist() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		// Получаем email пользователя из контекста (установлен middleware)
+		email, exists := c.Get("email")
+
+		if !exists {
+			log.Println("user email not found in context")
+			c.JSON(http.StatusUnauthorized, gin.H{"error": "unauthorized"})
+			return
+		}
+
+		wishlistID, err := uuid.Parse(c.Param("id"))
+
+		if err != nil {
+			log.Printf("invalid wishlist ID format: %v", err)
+			c.JSON(http.StatusBadRequest, gin.H{"error": "invalid wishlist ID format"})
+			return
+		}
+
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+
+		// Получаем user_id по email
+		var userID string
+
+		err = app.DB.QueryRow(ctx, "SELECT user_id FROM users WHERE email = $1", email).Scan(&userID)
+
+		if err != nil {
+			log.Printf("error finding user: %v", err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to find user"})
+			return
+		}
+
+		// Вызываем функцию из database слоя
+		err = database.DeleteWishlist(ctx, app.DB, userID, wishlistID)
+
+		if err != nil {
+			switch err {
+			case database.ErrWishlistNotFound:
+				c.JSON(http.StatusNotFound, gin.H{"error": "wishlist not found"})
+
+			case database.ErrDefaultWishlist:
+				c.JSON(http.StatusConflict, gin.H{"error": "default wishlist can't be deleted"})
+
+			default:
+				log.Printf("error deleting wishlist: %v", err)
+				c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to delete wishlist"})
+			}
+
+			return
+		}
+
+		c.JSON(http.StatusOK, gin.H{"message": "wishlist deleted successfully"})
+	}
+}
+
+// AddWishlistItem добавляет товар в список (POST /wishlists/:id/items/:product_id)
+func (app *Application) AddWishlistItem() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		app.wishlistItemAction(c, "product added to wishlist", func(ctx context.Context, userID string, wishlistID uuid.UUID, productID uuid.UUID) error {
+			_, err := database.AddWishlistItem(ctx, app.DB, userID, wishlistID, productID)
+			return err
+		})
+	}
+}
+
+func (app *Application) RemoveWishlistItem() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		app.wishlistItemAction(c, "product removed from wishlist", func(ctx context.Context, userID string, wishlistID uuid.UUID, productID uuid.UUID) error {
+			return database.RemoveWishlistItem(ctx, app.DB, userID, wishlistID, productID)
+		})
+	}
+}
+
+// MoveWishlistItemToCart переносит товар из списка в корзину
+func (app *Application) MoveWishlistItemToCart() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		app.wishlistItemAction(c, "product moved to cart", func(ctx context.Context, userID string, wishlistID uuid.UUID, productID uuid.UUID) error {
+			return database.MoveWishlistItemToCart(ctx, app.DB, userID, wishlistID, productID)
+		})
+	}
+}
+
+// общая часть операций с товаром списка: разбор :id и :product_id, поиск пользователя, ответ
+func (app *Application) wishlistItemAction(c *gin.Context, message string, action func(ctx context.Context, userID string, wishlistID uuid.UUID, productID uuid.UUID) error) {
+	// Получаем email пользователя из контекста (установлен middleware)
+	email, exists := c.Get("email")
+
+	if !exists {
+		log.Println("user email not found in context")
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "unauthorized"})
+		return
+	}
+
+	wishlistID, ok := parseWishlistID(c)
+
+	if !ok {
+		return
+	}
+
+	// Парсим UUID продукта
+	productID, err := uuid.Parse(c.Param("product_id"))
+
+	if err != nil {
+		log.Printf("invalid product ID format: %v", err)
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid product ID format"})
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	// Получаем user_id по email
+	var userID string
+
+	err = app.DB.QueryRow(ctx, "SELECT user_id FROM users WHERE email = $1", email).Scan(&userID)
+
+	if err != nil {
+		log.Printf("error finding user: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to find user"})
+		return
+	}
+
+	// Вызываем функцию из database слоя
+	err = action(ctx, userID, wishlistID, productID)
+
+	if err != nil {
+		switch err {
+		case database.ErrWishlistNotFound:
+			c.JSON(http.StatusNotFound, gin.H{"error": "wishlist not found"})
+
+		case database.ErrWishlistItemNotFound:
+			c.JSON(http.StatusNotFound, gin.H{"error": "product is not in the wishlist"})
+
+		case database.ErrRecordNotFound:
+			c.JSON(http.StatusNotFound, gin.H{"error": "product not found"})
+
+		default:
+			log.Printf("error updating wishlist item: %v", err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to update wishlist"})
+		}
+
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": message, "product_id": productID})
+}
+
+// SaveForLater откладывает товар из корзины в список по умолчанию (POST /cart/save-for-later?id=)
+func (app *Application) SaveForLater() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		productQueryID := c.Query("id")
+
+		if productQueryID == "" {
+			log.Println("product ID is empty")
+			c.JSON(http.StatusBadRequest, gin.H{"error": "product ID is required"})
+			return
+		}
+
+		// Получаем email пользователя из контекста (установлен middleware)
+		email, exists := c.Get("email")
+
+		if !exists {
+			log.Println("user email not found in context")
+			c.JSON(http.StatusUnauthorized, gin.H{"error": "unauthorized"})
+			return
+		}
+
+		// Парсим UUID продукта
+		productID, err := uuid.Parse(productQueryID)
+
+		if err != nil {
+			log.Printf("invalid product ID format: %v", err)
+			c.JSON(http.StatusBadRequest, gin.H{"error": "invalid product ID format"})
+			return
+		}
+
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+
+		// Получаем user_id по email
+		var userID string
+
+		err = app.DB.QueryRow(ctx, "SELECT user_id FROM users WHERE email = $1", email).Scan(&userID)
+
+		if err != nil {
+			log.Printf("error finding user: %v", err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to find user"})
+			return
+		}
+
+		// Вызываем функцию из database слоя
+		wishlistID, err := database.SaveForLater(ctx, app.DB, userID, productID)
+
+		if err != nil {
+			if err == database.ErrRecordNotFound {
+				c.JSON(http.StatusNotFound, gin.H{"error": "product is not in the cart"})
+
+			} else {
+				log.Printf("error saving product for later: %v", err)
+				c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to save product for later"})
+			}
+
+			return
+		}
+
+		c.JSON(http.StatusOK, gin.H{"message": "product saved for later", "product_id": productID, "wishlist_id": wishlistID})
+	}
+}
+
+// GetSharedWishlist - открытый список по публичной ссылке, без авторизации
+func (app *Application) GetSharedWishlist() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+
+		wishlist, err := database.GetSharedWishlist(ctx, app.DB, c.Param("token"))
+
+		if err != nil {
+			if err == database.ErrWishlistNotFound {
+				c.JSON(http.StatusNotFound, gin.H{"error": "wishlist not found"})
+
+			} else {
+				log.Printf("error fetching shared wishlist: %v", err)
+				c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to fetch wishlist"})
+			}
+
+			return
+		}
+
+		c.JSON(http.StatusOK, gin.H{
+			"name":  wishlist.Name,
+			"items": wishlist.Items,
+		})
+	}
+}
@@ -0,0 +1,113 @@
+package currency
+
+import (
+	"ec-platform/models"
+	"errors"
+	"math/big"
+	"regexp"
+	"strings"
+)
+
+// базовая валюта по умолчанию: в ней хранятся цены товаров, расписаний и тарифы доставки
+const DefaultBase = "RUB"
+
+var (
+	ErrUnknownCurrency = errors.New("unknown currency code")
+	ErrInvalidRate     = errors.New("rate must be a positive decimal with at most 10 fraction digits")
+)
+
+// число знаков дробной части (минорных единиц) по ISO 4217 для поддерживаемых валют
+var minorUnits = map[string]int{
+	"AED": 2, "AMD": 2, "AUD": 2, "AZN": 2, "BYN": 2, "CAD": 2, "CHF": 2, "CNY": 2,
+	"CZK": 2, "EUR": 2, "GBP": 2, "GEL": 2, "HKD": 2, "INR": 2, "JPY": 0, "KGS": 2,
+	"KRW": 0, "KZT": 2, "NOK": 2, "PLN": 2, "RUB": 2, "SEK": 2, "TRY": 2, "UAH": 2,
+	"USD": 2, "UZS": 2,
+}
+
+var ratePattern = regexp.MustCompile(`^[0-9]{1,10}(\.[0-9]{1,10})?$`)
+
+// Normalize приводит код валюты к верхнему регистру и проверяет, что валюта поддерживается
+func Normalize(code string) (string, error) {
+	code = strings.ToUpper(strings.TrimSpace(code))
+
+	if _, ok := minorUnits[code]; !ok {
+		return "", ErrUnknownCurrency
+	}
+
+	return code, nil
+}
+
+// MinorUnits - знаков после запятой у валюты (RUB - 2: цена 150000 = 1500.00)
+func MinorUnits(code string) int {
+	return minorUnits[code]
+}
+
+// ParseRate проверяет курс - сколько единиц валюты дают за одну единицу базовой
+func ParseRate(rate string) (*big.Rat, error) {
+	if !ratePattern.MatchString(rate) {
+		return nil, ErrInvalidRate
+	}
+
+	value, ok := new(big.Rat).SetString(rate)
+
+	if !ok || value.Sign() <= 0 {
+		return nil, ErrInvalidRate
+	}
+
+	return value, nil
+}
+
+// Rate - курс пересчета цен из базовой валюты в Currency. Value - десятичная строка (как в БД),
+// Scale - разница знаков дробной части валюты и базовой: суммы хранятся в минорных единицах
+type Rate struct {
+	Currency string
+	Value    string
+	Scale    int
+}
+
+// Identity - курс базовой валюты к самой себе
+func Identity(base string) Rate {
+	return Rate{Currency: base, Value: "1", Scale: 0}
+}
+
+// NewRate - курс валюты code к базовой base
+func NewRate(base string, code string, value string) Rate {
+	return Rate{Currency: code, Value: value, Scale: MinorUnits(code) - MinorUnits(base)}
+}
+
+// Convert пересчитывает сумму базовой валюты по курсу с округлением до целой минорной единицы,
+// половина - вверх. Так же округляет SQL-функция product_price_in
+func (r Rate) Convert(amount models.Money) (models.Money, error) {
+	value, ok := new(big.Rat).SetString(r.Value)
+
+	if !ok {
+		return 0, ErrInvalidRate
+	}
+
+	result := new(big.Rat).Mul(new(big.Rat).SetInt64(int64(amount)), value)
+	scale := new(big.Int).Exp(big.NewInt(10), big.NewInt(int64(abs(r.Scale))), nil)
+
+	if r.Scale >= 0 {
+		result.Mul(result, new(big.Rat).SetInt(scale))
+	} else {
+		result.Quo(result, new(big.Rat).SetInt(scale))
+	}
+
+	// floor(x + 1/2) для неотрицательного x
+	result.Add(result, big.NewRat(1, 2))
+	converted := new(big.Int).Quo(result.Num(), result.Denom())
+
+	if !converted.IsInt64() {
+		return 0, models.ErrMoneyOverflow
+	}
+
+	return models.Money(converted.Int64()), nil
+}
+
+func abs(n int) int {
+	if n < 0 {
+		return -n
+	}
+
+	return n
+}
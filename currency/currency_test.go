@@ -0,0 +1,118 @@
+package currency
+
+import (
+	"ec-platform/models"
+	"errors"
+	"testing"
+)
+
+func TestParseRate(t *testing.T) {
+	tests := []struct {
+		rate    string
+		wantErr bool
+	}{
+		{"1", false},
+		{"0.0123", false},
+		{"92.5", false},
+		{"1234567890.0123456789", false},
+		{"0", true},
+		{"0.0000000000", true},
+		{"-1", true},
+		{"1e3", true},
+		{"1.", true},
+		{".5", true},
+		{"1,5", true},
+		{"12345678901", true},
+		{"0.12345678901", true},
+		{"", true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.rate, func(t *testing.T) {
+			value, err := ParseRate(tt.rate)
+
+			if tt.wantErr {
+				if !errors.Is(err, ErrInvalidRate) {
+					t.Errorf("ParseRate(%q) error = %v, want %v", tt.rate, err, ErrInvalidRate)
+				}
+
+				return
+			}
+
+			if err != nil || value.Sign() <= 0 {
+				t.Errorf("ParseRate(%q) = %v, %v, want a positive rate", tt.rate, value, err)
+			}
+		})
+	}
+}
+
+func TestNewRateScale(t *testing.T) {
+	tests := []struct {
+		base, code string
+		want       int
+	}{
+		{"RUB", "USD", 0},
+		{"RUB", "JPY", -2},
+		{"RUB", "KRW", -2},
+		{"JPY", "RUB", 2},
+		{"JPY", "KRW", 0},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.base+"->"+tt.code, func(t *testing.T) {
+			if got := NewRate(tt.base, tt.code, "1").Scale; got != tt.want {
+				t.Errorf("NewRate(%s, %s).Scale = %d, want %d", tt.base, tt.code, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestRateConvert(t *testing.T) {
+	tests := []struct {
+		name    string
+		rate    Rate
+		amount  models.Money
+		want    models.Money
+		wantErr error
+	}{
+		{"identity", Identity("RUB"), 150000, 150000, nil},
+		{"same minor units", NewRate("RUB", "USD", "0.0123"), 150000, 1845, nil},
+		{"same minor units below half", NewRate("RUB", "USD", "0.0123"), 40, 0, nil},
+		{"same minor units half", NewRate("RUB", "EUR", "0.0125"), 40, 1, nil},
+		{"zero amount", NewRate("RUB", "USD", "0.0123"), 0, 0, nil},
+
+		// RUB -> JPY/KRW: у иены и воны нет минорных единиц, копейки делятся на 100
+		{"rub to jpy", NewRate("RUB", "JPY", "1.6"), 150000, 2400, nil},
+		{"rub to krw", NewRate("RUB", "KRW", "15.5"), 150000, 23250, nil},
+		{"rub to jpy below half", NewRate("RUB", "JPY", "1"), 149, 1, nil},
+		{"rub to jpy half", NewRate("RUB", "JPY", "1"), 150, 2, nil},
+		{"rub to jpy above half", NewRate("RUB", "JPY", "1"), 151, 2, nil},
+		{"rub to jpy less than one yen", NewRate("RUB", "JPY", "1"), 49, 0, nil},
+
+		// JPY -> RUB: иены умножаются на 100, чтобы получить копейки
+		{"jpy to rub", NewRate("JPY", "RUB", "0.6125"), 1000, 61250, nil},
+		{"jpy to rub below half", NewRate("JPY", "RUB", "0.00499"), 1, 0, nil},
+		{"jpy to rub half", NewRate("JPY", "RUB", "0.005"), 1, 1, nil},
+
+		{"max without scale", Identity("RUB"), models.MaxMoney, models.MaxMoney, nil},
+		{"overflow by rate", NewRate("RUB", "USD", "2"), models.MaxMoney, 0, models.ErrMoneyOverflow},
+		{"overflow by scale", NewRate("JPY", "RUB", "1"), models.MaxMoney/100 + 1, 0, models.ErrMoneyOverflow},
+		{"max after rounding", NewRate("RUB", "USD", "1.5"), models.MaxMoney / 3 * 2, models.MaxMoney - 1, nil},
+		{"overflow by rounding half", NewRate("RUB", "USD", "1.5"), models.MaxMoney/3*2 + 1, 0, models.ErrMoneyOverflow},
+		{"invalid rate", Rate{Currency: "USD", Value: "abc"}, 150000, 0, ErrInvalidRate},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := tt.rate.Convert(tt.amount)
+
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("Convert(%d) error = %v, want %v", tt.amount, err, tt.wantErr)
+			}
+
+			if got != tt.want {
+				t.Errorf("Convert(%d) = %d, want %d", tt.amount, got, tt.want)
+			}
+		})
+	}
+}
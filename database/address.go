@@ -3,28 +3,120 @@ package database
 import (
 	"context"
 	"ec-platform/models"
+	"ec-platform/postal"
 	"errors"
 	"time"
 
 	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
 	"github.com/jackc/pgx/v5/pgxpool"
 )
 
 var (
-	ErrAddressNotFound = errors.New("address not found")
-	ErrUnauthorized    = errors.New("address does not belong to user")
+	ErrAddressNotFound     = errors.New("address not found")
+	ErrUnauthorized        = errors.New("address does not belong to user")
+	ErrInvalidAddressType  = errors.New("unknown address type")
+	ErrAddressTypeMismatch = errors.New("address has a different type")
+	ErrAddressLimit        = errors.New("address limit reached")
+	ErrInvalidDefaultKind  = errors.New("unknown default address kind")
 )
 
-// добавляет новый адрес для пользователя
-func AddAddress(ctx context.Context, db *pgxpool.Pool, userID string, address *models.Address) (uuid.UUID, error) {
+// колонки адреса в порядке сканирования scanAddress
+const addressColumns = `
+	address_id, house, street, city, pincode, state, country, address_type, is_default_shipping, is_default_billing
+`
+
+func scanAddress(row pgx.Row, address *models.Address) error {
+	return row.Scan(
+		&address.Addres_ID,
+		&address.House,
+		&address.Street,
+		&address.City,
+		&address.Pincode,
+		&address.State,
+		&address.Country,
+		&address.Address_Type,
+		&address.Default_Shipping,
+		&address.Default_Billing,
+	)
+}
+
+// проверяет, что тип адреса известен
+func IsValidAddressType(addressType string) bool {
+	switch addressType {
+	case models.AddressTypeHome, models.AddressTypeWork, models.AddressTypeOther:
+		return true
+	}
+
+	return false
+}
+
+// колонка флага адреса по умолчанию для вида kind
+func defaultAddressColumn(kind string) (string, error) {
+	switch kind {
+	case models.DefaultAddressShipping:
+		return "is_default_shipping", nil
+
+	case models.DefaultAddressBilling:
+		return "is_default_billing", nil
+	}
+
+	return "", ErrInvalidDefaultKind
+}
+
+// добавляет новый адрес для пользователя. Тип по умолчанию - other; у пользователя не больше limit
+// адресов (0 - без ограничения). Первый адрес становится адресом доставки и платежным по умолчанию
+func AddAddress(ctx context.Context, db *pgxpool.Pool, userID string, address *models.Address, limit int) (uuid.UUID, error) {
+	// Адрес нормализуется и проверяется по правилам страны; ошибка - postal.FieldErrors
+	if err := postal.NormalizeAndValidate(address); err != nil {
+		return uuid.Nil, err
+	}
+
+	addressType := models.AddressTypeOther
+
+	if address.Address_Type != nil {
+		addressType = *address.Address_Type
+	}
+
+	if !IsValidAddressType(addressType) {
+		return uuid.Nil, ErrInvalidAddressType
+	}
+
+	tx, err := db.Begin(ctx)
+
+	if err != nil {
+		return uuid.Nil, err
+	}
+
+	defer tx.Rollback(ctx)
+
+	// Блокируем пользователя, чтобы параллельные запросы не обошли ограничение
+	_, err = tx.Exec(ctx, "SELECT 1 FROM users WHERE user_id = $1 FOR UPDATE", userID)
+
+	if err != nil {
+		return uuid.Nil, err
+	}
+
+	var count int
+
+	err = tx.QueryRow(ctx, "SELECT COUNT(*) FROM addresses WHERE user_id = $1", userID).Scan(&count)
+
+	if err != nil {
+		return uuid.Nil, err
+	}
+
+	if limit > 0 && count >= limit {
+		return uuid.Nil, ErrAddressLimit
+	}
+
 	addressID := uuid.New()
 
 	query := `
-		INSERT INTO addresses (address_id, user_id, house, street, city, pincode, state, created_at, updated_at)
-		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9)
+		INSERT INTO addresses (address_id, user_id, house, street, city, pincode, state, country, address_type, created_at, updated_at)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11)
 	`
 
-	_, err := db.Exec(ctx, query,
+	_, err = tx.Exec(ctx, query,
 		addressID,
 		userID,
 		address.House,
@@ -32,6 +124,8 @@ func AddAddress(ctx context.Context, db *pgxpool.Pool, userID string, address *m
 		address.City,
 		address.Pincode,
 		address.State,
+		address.Country,
+		addressType,
 		time.Now().UTC(),
 		time.Now().UTC(),
 	)
@@ -40,23 +134,86 @@ func AddAddress(ctx context.Context, db *pgxpool.Pool, userID string, address *m
 		return uuid.Nil, err
 	}
 
+	if address.Default_Shipping || count == 0 {
+		if err := setDefaultAddress(ctx, tx, userID, addressID, models.DefaultAddressShipping); err != nil {
+			return uuid.Nil, err
+		}
+	}
+
+	if address.Default_Billing || count == 0 {
+		if err := setDefaultAddress(ctx, tx, userID, addressID, models.DefaultAddressBilling); err != nil {
+			return uuid.Nil, err
+		}
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		return uuid.Nil, err
+	}
+
 	return addressID, nil
 }
 
-// UpdateAddress обновляет адрес пользователя
-func UpdateAddress(ctx context.Context, db *pgxpool.Pool, userID string, addressID uuid.UUID, address *models.Address) error {
+// UpdateAddress обновляет адрес пользователя (нормализуется и проверяется, как в AddAddress).
+// Непустой expectedType - редактируется только адрес этого типа (ErrAddressTypeMismatch для другого).
+// Тип меняется, если задан в address, флаги по умолчанию - только если выставлены
+// (снять их можно, назначив другой адрес)
+func UpdateAddress(ctx context.Context, db *pgxpool.Pool, userID string, addressID uuid.UUID, expectedType string, address *models.Address) error {
+	if err := postal.NormalizeAndValidate(address); err != nil {
+		return err
+	}
+
+	if address.Address_Type != nil && !IsValidAddressType(*address.Address_Type) {
+		return ErrInvalidAddressType
+	}
+
+	if expectedType != "" && address.Address_Type != nil && *address.Address_Type != expectedType {
+		return ErrAddressTypeMismatch
+	}
+
+	tx, err := db.Begin(ctx)
+
+	if err != nil {
+		return err
+	}
+
+	defer tx.Rollback(ctx)
+
+	var currentType string
+
+	err = tx.QueryRow(ctx,
+		"SELECT address_type FROM addresses WHERE address_id = $1 AND user_id = $2 FOR UPDATE",
+		addressID, userID).Scan(&currentType)
+
+	if err == pgx.ErrNoRows {
+		return ErrAddressNotFound
+	}
+
+	if err != nil {
+		return err
+	}
+
+	if expectedType != "" && currentType != expectedType {
+		return ErrAddressTypeMismatch
+	}
+
+	if address.Address_Type != nil {
+		currentType = *address.Address_Type
+	}
+
 	query := `
 		UPDATE addresses
-		SET house = $1, street = $2, city = $3, pincode = $4, state = $5, updated_at = $6
-		WHERE address_id = $7 AND user_id = $8
+		SET house = $1, street = $2, city = $3, pincode = $4, state = $5, country = $6, address_type = $7, updated_at = $8
+		WHERE address_id = $9 AND user_id = $10
 	`
 
-	result, err := db.Exec(ctx, query,
+	_, err = tx.Exec(ctx, query,
 		address.House,
 		address.Street,
 		address.City,
 		address.Pincode,
 		address.State,
+		address.Country,
+		currentType,
 		time.Now().UTC(),
 		addressID,
 		userID,
@@ -66,31 +223,149 @@ func UpdateAddress(ctx context.Context, db *pgxpool.Pool, userID string, address
 		return err
 	}
 
-	rowsAffected := result.RowsAffected()
+	if address.Default_Shipping {
+		if err := setDefaultAddress(ctx, tx, userID, addressID, models.DefaultAddressShipping); err != nil {
+			return err
+		}
+	}
 
-	if rowsAffected == 0 {
-		return ErrAddressNotFound
+	if address.Default_Billing {
+		if err := setDefaultAddress(ctx, tx, userID, addressID, models.DefaultAddressBilling); err != nil {
+			return err
+		}
 	}
 
-	return nil
+	return tx.Commit(ctx)
 }
 
-// удаляет адрес пользователя по address_id
+// удаляет адрес пользователя по address_id. Если он был адресом по умолчанию,
+// по умолчанию становится самый новый из оставшихся
 func DeleteAddress(ctx context.Context, db *pgxpool.Pool, userID string, addressID uuid.UUID) error {
+	tx, err := db.Begin(ctx)
+
+	if err != nil {
+		return err
+	}
+
+	defer tx.Rollback(ctx)
+
 	// Проверяем, что адрес принадлежит пользователю, и удаляем его
-	result, err := db.Exec(ctx,
-		"DELETE FROM addresses WHERE address_id = $1 AND user_id = $2",
-		addressID, userID)
+	var wasShipping, wasBilling bool
+
+	err = tx.QueryRow(ctx,
+		"DELETE FROM addresses WHERE address_id = $1 AND user_id = $2 RETURNING is_default_shipping, is_default_billing",
+		addressID, userID).Scan(&wasShipping, &wasBilling)
+
+	if err == pgx.ErrNoRows {
+		return ErrAddressNotFound
+	}
+
+	if err != nil {
+		return err
+	}
+
+	if wasShipping || wasBilling {
+		var nextID uuid.UUID
+
+		err = tx.QueryRow(ctx,
+			"SELECT address_id FROM addresses WHERE user_id = $1 ORDER BY created_at DESC LIMIT 1",
+			userID).Scan(&nextID)
+
+		if err != nil && err != pgx.ErrNoRows {
+			return err
+		}
+
+		if err == nil {
+			if wasShipping {
+				if err := setDefaultAddress(ctx, tx, userID, nextID, models.DefaultAddressShipping); err != nil {
+					return err
+				}
+			}
+
+			if wasBilling {
+				if err := setDefaultAddress(ctx, tx, userID, nextID, models.DefaultAddressBilling); err != nil {
+					return err
+				}
+			}
+		}
+	}
+
+	return tx.Commit(ctx)
+}
+
+// возвращает адресную книгу пользователя: сначала адреса по умолчанию, затем новые сверху
+func GetAddresses(ctx context.Context, db *pgxpool.Pool, userID string) ([]models.Address, error) {
+	rows, err := db.Query(ctx, "SELECT "+addressColumns+` FROM addresses
+		WHERE user_id = $1
+		ORDER BY is_default_shipping DESC, is_default_billing DESC, created_at DESC`, userID)
+
+	if err != nil {
+		return nil, err
+	}
+
+	defer rows.Close()
+
+	addresses := make([]models.Address, 0)
+
+	for rows.Next() {
+		var address models.Address
+
+		if err := scanAddress(rows, &address); err != nil {
+			return nil, err
+		}
+
+		addresses = append(addresses, address)
+	}
+
+	return addresses, rows.Err()
+}
+
+// назначает адрес адресом по умолчанию вида kind (shipping или billing)
+func SetDefaultAddress(ctx context.Context, db *pgxpool.Pool, userID string, addressID uuid.UUID, kind string) error {
+	tx, err := db.Begin(ctx)
 
 	if err != nil {
 		return err
 	}
 
-	rowsAffected := result.RowsAffected()
+	defer tx.Rollback(ctx)
+
+	if err := setDefaultAddress(ctx, tx, userID, addressID, kind); err != nil {
+		return err
+	}
+
+	return tx.Commit(ctx)
+}
+
+// снимает флаг с прежнего адреса по умолчанию и ставит его адресу addressID
+func setDefaultAddress(ctx context.Context, tx pgx.Tx, userID string, addressID uuid.UUID, kind string) error {
+	column, err := defaultAddressColumn(kind)
 
-	if rowsAffected == 0 {
+	if err != nil {
+		return err
+	}
+
+	var exists bool
+
+	err = tx.QueryRow(ctx,
+		"SELECT EXISTS(SELECT 1 FROM addresses WHERE address_id = $1 AND user_id = $2)",
+		addressID, userID).Scan(&exists)
+
+	if err != nil {
+		return err
+	}
+
+	if !exists {
 		return ErrAddressNotFound
 	}
 
-	return nil
+	_, err = tx.Exec(ctx, "UPDATE addresses SET "+column+" = FALSE WHERE user_id = $1 AND "+column+" AND address_id <> $2", userID, addressID)
+
+	if err != nil {
+		return err
+	}
+
+	_, err = tx.Exec(ctx, "UPDATE addresses SET "+column+" = TRUE WHERE address_id = $1", addressID)
+
+	return err
 }
@@ -2,12 +2,14 @@ package database
 
 import (
 	"context"
+	"ec-platform/currency"
 	"ec-platform/models"
 	"errors"
 	"log"
 	"time"
 
 	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
 	"github.com/jackc/pgx/v5/pgxpool"
 )
 
@@ -19,22 +21,27 @@ var (
 	ErrCantRemoveItemCart = errors.New("can't remove this item from the cart")
 	ErrCantGetItem        = errors.New("can't get the item from the cart")
 	ErrCantBuyCartItem    = errors.New("cannot update the purchase")
+	ErrOutOfStock         = errors.New("product is out of stock")
 )
 
 // добавляет продукт в корзину пользователя или увеличивает количество
 func AddProductToCart(ctx context.Context, db *pgxpool.Pool, userID string, productID uuid.UUID) error {
-	// проверяем существование продукта
-	var productExists bool
+	// проверяем существование продукта; товар в архиве не продается
+	var archived bool
 
-	err := db.QueryRow(ctx, "SELECT EXISTS(SELECT 1 FROM products WHERE product_id = $1)", productID).Scan(&productExists)
+	err := db.QueryRow(ctx, "SELECT archived_at IS NOT NULL FROM products WHERE product_id = $1", productID).Scan(&archived)
+
+	if err == pgx.ErrNoRows {
+		return ErrRecordNotFound
+	}
 
 	if err != nil {
 		log.Printf("error checking product existence: %v", err)
 		return err
 	}
 
-	if !productExists {
-		return ErrRecordNotFound
+	if archived {
+		return ErrProductArchived
 	}
 
 	// проверяем, есть ли уже этот продукт в корзине
@@ -55,10 +62,11 @@ func AddProductToCart(ctx context.Context, db *pgxpool.Pool, userID string, prod
 			time.Now().UTC(), userID, productID)
 
 	} else {
-		// добавляем новый товар в корзину
-		_, err = db.Exec(ctx,
-			"INSERT INTO cart (id, user_id, product_id, quantity, created_at, updated_at) VALUES ($1, $2, $3, $4, $5, $6)",
-			uuid.New(), userID, productID, 1, time.Now().UTC(), time.Now().UTC())
+		// добавляем новый товар в корзину со снимком действующей цены
+		_, err = db.Exec(ctx, `
+			INSERT INTO cart (id, user_id, product_id, quantity, price_snapshot, created_at, updated_at)
+			SELECT $1, $2, $3, $4, price, $5, $5 FROM product_price_at($3, $5)
+		`, uuid.New(), userID, productID, 1, time.Now().UTC())
 	}
 
 	if err != nil {
@@ -87,23 +95,26 @@ func RemoveCartItem(ctx context.Context, db *pgxpool.Pool, userID string, produc
 	return nil
 }
 
-// получить все товары из корзины пользователя с деталями
-func GetCartItems(ctx context.Context, db *pgxpool.Pool, userID string) ([]models.CartItem, error) {
+// получить все товары из корзины пользователя с деталями и действующими ценами в валюте курса rate
+func GetCartItems(ctx context.Context, db *pgxpool.Pool, userID string, rate currency.Rate) ([]models.CartItem, error) {
 	query := `
 		SELECT
 			p.product_id,
 			p.product_name,
-			p.price,
+			pp.price,
+			pp.compare_at_price,
+			c.price_snapshot,
 			p.rating,
 			p.image,
 			c.quantity
 		FROM cart c
 		JOIN products p ON c.product_id = p.product_id
+		JOIN LATERAL product_price_in(p.product_id, $2, $3, $4, $5) pp ON TRUE
 		WHERE c.user_id = $1
 		ORDER BY c.created_at DESC
 	`
 
-	rows, err := db.Query(ctx, query, userID)
+	rows, err := db.Query(ctx, query, userID, time.Now().UTC(), rate.Currency, rate.Value, rate.Scale)
 
 	if err != nil {
 		return nil, err
@@ -116,7 +127,7 @@ func GetCartItems(ctx context.Context, db *pgxpool.Pool, userID string) ([]model
 	for rows.Next() {
 		var item models.CartItem
 
-		err := rows.Scan(&item.ProductID, &item.ProductName, &item.Price, &item.Rating, &item.Image, &item.Quantity)
+		err := rows.Scan(&item.ProductID, &item.ProductName, &item.Price, &item.CompareAtPrice, &item.PriceSnapshot, &item.Rating, &item.Image, &item.Quantity)
 
 		if err != nil {
 			return nil, err
@@ -128,76 +139,125 @@ func GetCartItems(ctx context.Context, db *pgxpool.Pool, userID string) ([]model
 	return cartItems, nil
 }
 
-// выполняет покупку всех товаров из корзины пользователя
-func BuyItemFromCart(ctx context.Context, db *pgxpool.Pool, userID string) (orderID uuid.UUID, totalPrice uint64, err error) {
+// стоимость товаров корзины; models.ErrMoneyOverflow - сумма не помещается в BIGINT
+func CartTotal(items []models.CartItem) (models.Money, error) {
+	var total models.Money
+
+	for _, item := range items {
+		var err error
+
+		if total, err = total.AddMul(item.Price, item.Quantity); err != nil {
+			return 0, err
+		}
+	}
+
+	return total, nil
+}
+
+// выполняет покупку всех товаров из корзины пользователя с доставкой по адресу пользователя.
+// Суммы заказа - в валюте params.Rate
+func BuyItemFromCart(ctx context.Context, db *pgxpool.Pool, userID string, params CheckoutParams) (orderID uuid.UUID, totalPrice models.CurrencyAmount, err error) {
 	// Начинаем транзакцию
 	tx, err := db.Begin(ctx)
 
 	if err != nil {
-		return uuid.Nil, 0, err
+		return uuid.Nil, models.CurrencyAmount{}, err
 	}
 
 	defer tx.Rollback(ctx)
 
-	// Получаем все товары из корзины с их ценами
-	query := `
-		SELECT c.product_id, p.price, c.quantity
-		FROM cart c
-		JOIN products p ON c.product_id = p.product_id
-		WHERE c.user_id = $1
-	`
+	// Проверяем адрес доставки до чтения корзины
+	address, err := snapshotAddress(ctx, tx, userID, params.AddressID)
 
-	rows, err := tx.Query(ctx, query, userID)
+	if err != nil {
+		return uuid.Nil, models.CurrencyAmount{}, err
+	}
+
+	// Корзина проверяется так же, как POST /cart/validate: неподтвержденный рост цены,
+	// нехватка остатка или товар в архиве останавливают оформление
+	lines, err := getCartLines(ctx, tx, userID, time.Now().UTC(), params.Rate)
 
 	if err != nil {
-		return uuid.Nil, 0, err
+		return uuid.Nil, models.CurrencyAmount{}, err
 	}
 
-	defer rows.Close()
+	if len(lines) == 0 {
+		return uuid.Nil, models.CurrencyAmount{}, ErrCantGetItem
+	}
 
 	var orderItems []models.OrderItem
-	var total uint64
-
-	for rows.Next() {
-		var item models.OrderItem
+	var warnings []models.CartWarning
+	var total, baseTotal models.Money
+	var weight int64
+
+	for _, line := range lines {
+		warnings = append(warnings, cartLineWarnings(line, params.BaseCurrency)...)
+
+		item := models.OrderItem{
+			ProductID:   line.item.ProductID,
+			ProductName: line.item.ProductName,
+			Image:       line.item.Image,
+			Price:       line.item.Price,
+			Quantity:    line.item.Quantity,
+		}
 
-		err := rows.Scan(&item.ProductID, &item.Price, &item.Quantity)
+		if total, err = total.AddMul(item.Price, item.Quantity); err != nil {
+			return uuid.Nil, models.CurrencyAmount{}, err
+		}
 
-		if err != nil {
-			return uuid.Nil, 0, err
+		if baseTotal, err = baseTotal.AddMul(line.basePrice, item.Quantity); err != nil {
+			return uuid.Nil, models.CurrencyAmount{}, err
 		}
 
-		total += item.Price * uint64(item.Quantity)
+		weight += line.weight * int64(item.Quantity)
 
 		orderItems = append(orderItems, item)
 	}
 
-	if len(orderItems) == 0 {
-		return uuid.Nil, 0, ErrCantGetItem
+	if blocking := blockingCartWarnings(warnings); len(blocking) > 0 {
+		return uuid.Nil, models.CurrencyAmount{}, blocking
+	}
+
+	// Считаем стоимость доставки (тарифы - в базовой валюте)
+	baseShipping, err := quoteShipping(params, address, weight)
+
+	if err != nil {
+		return uuid.Nil, models.CurrencyAmount{}, err
+	}
+
+	shippingCost, err := params.Rate.Convert(baseShipping)
+
+	if err != nil {
+		return uuid.Nil, models.CurrencyAmount{}, err
+	}
+
+	if total, err = total.Add(shippingCost); err != nil {
+		return uuid.Nil, models.CurrencyAmount{}, err
+	}
+
+	if baseTotal, err = baseTotal.Add(baseShipping); err != nil {
+		return uuid.Nil, models.CurrencyAmount{}, err
 	}
 
 	// Создаем заказ
 	orderID = uuid.New()
 
-	orderQuery := `
-		INSERT INTO orders (order_id, user_id, total_price, ordered_at, status)
-		VALUES ($1, $2, $3, $4, $5)
-	`
-
-	_, err = tx.Exec(ctx, orderQuery, orderID, userID, total, time.Now().UTC(), "pending")
+	err = insertOrder(ctx, tx, orderID, userID, total, baseTotal, params, address, shippingCost)
 
 	if err != nil {
-		return uuid.Nil, 0, ErrCantBuyCartItem
+		return uuid.Nil, models.CurrencyAmount{}, ErrCantBuyCartItem
 	}
 
-	// Добавляем товары в order_items
+	// Добавляем товары в order_items и резервируем остаток
 	for _, item := range orderItems {
-		_, err = tx.Exec(ctx,
-			"INSERT INTO order_items (id, order_id, product_id, quantity, price) VALUES ($1, $2, $3, $4, $5)",
-			uuid.New(), orderID, item.ProductID, item.Quantity, item.Price)
+		if err = reserveStock(ctx, tx, item.ProductID, item.Quantity); err != nil {
+			return uuid.Nil, models.CurrencyAmount{}, err
+		}
+
+		err = insertOrderItem(ctx, tx, orderID, item)
 
 		if err != nil {
-			return uuid.Nil, 0, ErrCantBuyCartItem
+			return uuid.Nil, models.CurrencyAmount{}, ErrCantBuyCartItem
 		}
 	}
 
@@ -205,67 +265,116 @@ func BuyItemFromCart(ctx context.Context, db *pgxpool.Pool, userID string) (orde
 	_, err = tx.Exec(ctx, "DELETE FROM cart WHERE user_id = $1", userID)
 
 	if err != nil {
-		return uuid.Nil, 0, ErrCantBuyCartItem
+		return uuid.Nil, models.CurrencyAmount{}, ErrCantBuyCartItem
+	}
+
+	// Корзина оформлена: напоминания больше не нужны, заказ засчитывается письму
+	if err = closeCartReminders(ctx, tx, userID, orderID); err != nil {
+		return uuid.Nil, models.CurrencyAmount{}, err
 	}
 
 	// Коммитим транзакцию
 	err = tx.Commit(ctx)
 
 	if err != nil {
-		return uuid.Nil, 0, ErrCantBuyCartItem
+		return uuid.Nil, models.CurrencyAmount{}, ErrCantBuyCartItem
 	}
 
-	return orderID, total, nil
+	return orderID, models.CurrencyAmount{Amount: total, Currency: params.Rate.Currency}, nil
 }
 
-// выполняет покупку одного товара
-func InstantBuyer(ctx context.Context, db *pgxpool.Pool, userID string, productID uuid.UUID) (orderID uuid.UUID, totalPrice uint64, err error) {
+// выполняет покупку одного товара с доставкой по адресу пользователя; суммы - в валюте params.Rate
+func InstantBuyer(ctx context.Context, db *pgxpool.Pool, userID string, productID uuid.UUID, params CheckoutParams) (orderID uuid.UUID, totalPrice models.CurrencyAmount, err error) {
 	// Начинаем транзакцию
 	tx, err := db.Begin(ctx)
 
 	if err != nil {
-		return uuid.Nil, 0, err
+		return uuid.Nil, models.CurrencyAmount{}, err
 	}
 
 	defer tx.Rollback(ctx)
 
-	// Получаем информацию о продукте
-	var price uint64
+	// Проверяем адрес доставки
+	address, err := snapshotAddress(ctx, tx, userID, params.AddressID)
+
+	if err != nil {
+		return uuid.Nil, models.CurrencyAmount{}, err
+	}
+
+	// Получаем информацию о продукте: цену в валюте оплаты и в базовой
+	item := models.OrderItem{ProductID: productID, Quantity: 1}
+	var basePrice models.Money
+	var weight int64
+	var archived bool
+
+	err = tx.QueryRow(ctx, `
+		SELECT p.product_name, p.image, pp.price, pb.price, p.weight_grams, p.archived_at IS NOT NULL
+		FROM products p
+		JOIN LATERAL product_price_at(p.product_id, $2) pb ON TRUE
+		JOIN LATERAL product_price_in(p.product_id, $2, $3, $4, $5) pp ON TRUE
+		WHERE p.product_id = $1
+	`, productID, time.Now().UTC(), params.Rate.Currency, params.Rate.Value, params.Rate.Scale).Scan(
+		&item.ProductName, &item.Image, &item.Price, &basePrice, &weight, &archived)
+
+	if err != nil {
+		return uuid.Nil, models.CurrencyAmount{}, ErrRecordNotFound
+	}
+
+	if archived {
+		return uuid.Nil, models.CurrencyAmount{}, ErrProductArchived
+	}
 
-	err = tx.QueryRow(ctx, "SELECT price FROM products WHERE product_id = $1", productID).Scan(&price)
+	// Считаем стоимость доставки (тарифы - в базовой валюте)
+	baseShipping, err := quoteShipping(params, address, weight)
 
 	if err != nil {
-		return uuid.Nil, 0, ErrRecordNotFound
+		return uuid.Nil, models.CurrencyAmount{}, err
+	}
+
+	shippingCost, err := params.Rate.Convert(baseShipping)
+
+	if err != nil {
+		return uuid.Nil, models.CurrencyAmount{}, err
+	}
+
+	total, err := item.Price.Add(shippingCost)
+
+	if err != nil {
+		return uuid.Nil, models.CurrencyAmount{}, err
+	}
+
+	baseTotal, err := basePrice.Add(baseShipping)
+
+	if err != nil {
+		return uuid.Nil, models.CurrencyAmount{}, err
 	}
 
 	// Создаем заказ
 	orderID = uuid.New()
 
-	orderQuery := `
-		INSERT INTO orders (order_id, user_id, total_price, ordered_at, status)
-		VALUES ($1, $2, $3, $4, $5)
-	`
-	_, err = tx.Exec(ctx, orderQuery, orderID, userID, price, time.Now().UTC(), "pending")
+	err = insertOrder(ctx, tx, orderID, userID, total, baseTotal, params, address, shippingCost)
 
 	if err != nil {
-		return uuid.Nil, 0, ErrCantBuyCartItem
+		return uuid.Nil, models.CurrencyAmount{}, ErrCantBuyCartItem
+	}
+
+	// Резервируем остаток и добавляем товар в order_items
+	if err = reserveStock(ctx, tx, productID, item.Quantity); err != nil {
+		return uuid.Nil, models.CurrencyAmount{}, err
 	}
 
-	// Добавляем товар в order_items
-	_, err = tx.Exec(ctx,
-		"INSERT INTO order_items (id, order_id, product_id, quantity, price) VALUES ($1, $2, $3, $4, $5)",
-		uuid.New(), orderID, productID, 1, price)
+	err = insertOrderItem(ctx, tx, orderID, item)
 
 	if err != nil {
-		return uuid.Nil, 0, ErrCantBuyCartItem
+		return uuid.Nil, models.CurrencyAmount{}, ErrCantBuyCartItem
 	}
 
 	// Коммитим транзакцию
 	err = tx.Commit(ctx)
 
 	if err != nil {
-		return uuid.Nil, 0, ErrCantBuyCartItem
+		return uuid.Nil, models.CurrencyAmount{}, ErrCantBuyCartItem
 	}
 
-	return orderID, price, nil
+	return orderID, models.CurrencyAmount{Amount: total, Currency: params.Rate.Currency}, nil
 }
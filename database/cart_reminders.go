@@ -0,0 +1,324 @@
+package database
+
+import (
+	"context"
+	"crypto/rand"
+	"ec-platform/models"
+	"encoding/hex"
+	"errors"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+var (
+	ErrCartReminderNotFound = errors.New("cart reminder not found")
+	ErrCartReminderExpired  = errors.New("cart restore link has expired")
+)
+
+// Параметры кампании напоминаний
+const (
+	// заказ засчитывается как возврат корзины, если оформлен в этот срок после письма
+	cartRecoveryWindow = 7 * 24 * time.Hour
+	// сколько действует ссылка восстановления корзины
+	cartRestoreTTL = 30 * 24 * time.Hour
+)
+
+// колонки напоминания в порядке сканирования scanCartReminder
+const cartReminderColumns = `
+	reminder_id, user_id, token, cart_updated_at, items, cart_value, status,
+	created_at, sent_at, restored_at, order_id, converted_at
+`
+
+func scanCartReminder(row pgx.Row, reminder *models.CartReminder) error {
+	return row.Scan(
+		&reminder.Reminder_ID,
+		&reminder.User_ID,
+		&reminder.Token,
+		&reminder.Cart_Updated_At,
+		&reminder.Items,
+		&reminder.Cart_Value,
+		&reminder.Status,
+		&reminder.Created_At,
+		&reminder.Sent_At,
+		&reminder.Restored_At,
+		&reminder.Order_ID,
+		&reminder.Converted_At,
+	)
+}
+
+// создает до limit напоминаний о корзинах, не менявшихся дольше idle (но не дольше maxAge),
+// и в той же транзакции ставит задачи jobType с данными payload(напоминание).
+// Напоминание не создается повторно для того же состояния корзины и чаще раза в cooldown.
+// Возвращает количество созданных напоминаний
+func CreateCartReminders(ctx context.Context, db *pgxpool.Pool, idle time.Duration, maxAge time.Duration, cooldown time.Duration, limit int, jobType string, payload func(reminder models.CartReminder) interface{}) (int, error) {
+	tx, err := db.Begin(ctx)
+
+	if err != nil {
+		return 0, err
+	}
+
+	defer tx.Rollback(ctx)
+
+	now := time.Now().UTC()
+
+	rows, err := tx.Query(ctx, `
+		WITH carts AS (
+			SELECT
+				c.user_id,
+				MAX(c.updated_at) AS updated_at,
+				jsonb_agg(jsonb_build_object('product_id', c.product_id, 'quantity', c.quantity) ORDER BY c.created_at) AS items,
+				SUM(pp.price * c.quantity)::BIGINT AS cart_value
+			FROM cart c
+			JOIN LATERAL product_price_at(c.product_id, $5) pp ON TRUE
+			GROUP BY c.user_id
+		)
+		SELECT user_id, updated_at, items, cart_value
+		FROM carts
+		WHERE updated_at < $1 AND updated_at > $2
+			AND NOT EXISTS (
+				SELECT 1 FROM cart_reminders r
+				WHERE r.user_id = carts.user_id
+					AND (r.cart_updated_at = carts.updated_at OR r.created_at > $3)
+			)
+		ORDER BY updated_at
+		LIMIT $4
+	`, now.Add(-idle), now.Add(-maxAge), now.Add(-cooldown), limit, now)
+
+	if err != nil {
+		return 0, err
+	}
+
+	var reminders []models.CartReminder
+
+	for rows.Next() {
+		var reminder models.CartReminder
+
+		if err := rows.Scan(&reminder.User_ID, &reminder.Cart_Updated_At, &reminder.Items, &reminder.Cart_Value); err != nil {
+			rows.Close()
+			return 0, err
+		}
+
+		reminders = append(reminders, reminder)
+	}
+
+	rows.Close()
+
+	if err := rows.Err(); err != nil {
+		return 0, err
+	}
+
+	created := 0
+
+	for _, reminder := range reminders {
+		reminder.Reminder_ID = uuid.New()
+		reminder.Status = models.CartReminderStatusPending
+		reminder.Created_At = now
+
+		if reminder.Token, err = generateToken(); err != nil {
+			return 0, err
+		}
+
+		result, err := tx.Exec(ctx, `
+			INSERT INTO cart_reminders (reminder_id, user_id, token, cart_updated_at, items, cart_value, status, created_at)
+			VALUES ($1, $2, $3, $4, $5, $6, $7, $8)
+			ON CONFLICT (user_id, cart_updated_at) DO NOTHING
+		`, reminder.Reminder_ID, reminder.User_ID, reminder.Token, reminder.Cart_Updated_At,
+			reminder.Items, reminder.Cart_Value, reminder.Status, reminder.Created_At)
+
+		if err != nil {
+			return 0, err
+		}
+
+		if result.RowsAffected() == 0 {
+			continue
+		}
+
+		_, err = enqueueJob(ctx, tx, jobType, payload(reminder), now, "cart_reminder:"+reminder.Reminder_ID.String())
+
+		if err != nil {
+			return 0, err
+		}
+
+		created++
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		return 0, err
+	}
+
+	return created, nil
+}
+
+// возвращает напоминание по id
+func GetCartReminder(ctx context.Context, db *pgxpool.Pool, reminderID uuid.UUID) (*models.CartReminder, error) {
+	var reminder models.CartReminder
+
+	err := scanCartReminder(db.QueryRow(ctx, "SELECT "+cartReminderColumns+" FROM cart_reminders WHERE reminder_id = $1", reminderID), &reminder)
+
+	if err == pgx.ErrNoRows {
+		return nil, ErrCartReminderNotFound
+	}
+
+	if err != nil {
+		return nil, err
+	}
+
+	return &reminder, nil
+}
+
+// помечает напоминание отправленным или отмененным (только из pending)
+func CompleteCartReminder(ctx context.Context, db *pgxpool.Pool, reminderID uuid.UUID, status string) error {
+	var sentAt *time.Time
+
+	if status == models.CartReminderStatusSent {
+		now := time.Now().UTC()
+		sentAt = &now
+	}
+
+	_, err := db.Exec(ctx,
+		"UPDATE cart_reminders SET status = $1, sent_at = $2 WHERE reminder_id = $3 AND status = $4",
+		status, sentAt, reminderID, models.CartReminderStatusPending)
+
+	return err
+}
+
+// восстанавливает корзину из снимка напоминания по токену ссылки из письма: товары снимка
+// возвращаются в корзину (количество - не меньше, чем в снимке), удаленные из каталога и архивные пропускаются.
+// Возвращает напоминание с отметкой restored_at
+func RestoreCart(ctx context.Context, db *pgxpool.Pool, token string) (*models.CartReminder, error) {
+	tx, err := db.Begin(ctx)
+
+	if err != nil {
+		return nil, err
+	}
+
+	defer tx.Rollback(ctx)
+
+	var reminder models.CartReminder
+
+	err = scanCartReminder(tx.QueryRow(ctx, "SELECT "+cartReminderColumns+" FROM cart_reminders WHERE token = $1 FOR UPDATE", token), &reminder)
+
+	if err == pgx.ErrNoRows {
+		return nil, ErrCartReminderNotFound
+	}
+
+	if err != nil {
+		return nil, err
+	}
+
+	now := time.Now().UTC()
+
+	if now.Sub(reminder.Created_At) > cartRestoreTTL {
+		return nil, ErrCartReminderExpired
+	}
+
+	for _, item := range reminder.Items {
+		_, err := tx.Exec(ctx, `
+			INSERT INTO cart (id, user_id, product_id, quantity, price_snapshot, created_at, updated_at)
+			SELECT $1, $2, $3, $4, pp.price, $5, $5
+			FROM products p, product_price_at(p.product_id, $5) pp
+			WHERE p.product_id = $3 AND p.archived_at IS NULL
+			ON CONFLICT (user_id, product_id) DO UPDATE
+				SET quantity = GREATEST(cart.quantity, EXCLUDED.quantity), updated_at = EXCLUDED.updated_at
+		`, uuid.New(), reminder.User_ID, item.Product_ID, item.Quantity, now)
+
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	if reminder.Restored_At == nil {
+		reminder.Restored_At = &now
+
+		_, err = tx.Exec(ctx, "UPDATE cart_reminders SET restored_at = $1 WHERE reminder_id = $2", now, reminder.Reminder_ID)
+
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		return nil, err
+	}
+
+	return &reminder, nil
+}
+
+// вызывается при оформлении заказа из корзины: неотправленные напоминания отменяются,
+// заказ засчитывается последнему отправленному напоминанию в пределах cartRecoveryWindow
+func closeCartReminders(ctx context.Context, tx pgx.Tx, userID string, orderID uuid.UUID) error {
+	now := time.Now().UTC()
+
+	_, err := tx.Exec(ctx,
+		"UPDATE cart_reminders SET status = $1 WHERE user_id = $2 AND status = $3",
+		models.CartReminderStatusCancelled, userID, models.CartReminderStatusPending)
+
+	if err != nil {
+		return err
+	}
+
+	_, err = tx.Exec(ctx, `
+		UPDATE cart_reminders SET order_id = $1, converted_at = $2
+		WHERE reminder_id = (
+			SELECT reminder_id FROM cart_reminders
+			WHERE user_id = $3 AND status = $4 AND converted_at IS NULL AND sent_at > $5
+			ORDER BY sent_at DESC
+			LIMIT 1
+		)
+	`, orderID, now, userID, models.CartReminderStatusSent, now.Add(-cartRecoveryWindow))
+
+	return err
+}
+
+// считает отчет по напоминаниям, созданным в [from, to). Выручка - заказы из отправленных
+// напоминаний, кроме отмененных и возвращенных, в базовой валюте
+func GetCartRecoveryReport(ctx context.Context, db *pgxpool.Pool, from time.Time, to time.Time) (*models.CartRecoveryReport, error) {
+	report := models.CartRecoveryReport{From: from, To: to}
+
+	err := db.QueryRow(ctx, `
+		SELECT
+			COUNT(*),
+			COUNT(*) FILTER (WHERE r.status = $3),
+			COUNT(*) FILTER (WHERE r.status = $4),
+			COUNT(r.restored_at),
+			COUNT(r.converted_at),
+			COALESCE(SUM(r.cart_value), 0)::BIGINT,
+			COALESCE(SUM(o.base_total_price) FILTER (WHERE o.status NOT IN ($5, $6)), 0)::BIGINT
+		FROM cart_reminders r
+		LEFT JOIN orders o ON o.order_id = r.order_id
+		WHERE r.created_at >= $1 AND r.created_at < $2
+	`, from, to, models.CartReminderStatusSent, models.CartReminderStatusCancelled,
+		models.OrderStatusCancelled, models.OrderStatusRefunded).Scan(
+		&report.Reminders,
+		&report.Sent,
+		&report.Cancelled,
+		&report.Restored,
+		&report.Converted,
+		&report.Abandoned_Value,
+		&report.Recovered_Revenue,
+	)
+
+	if err != nil {
+		return nil, err
+	}
+
+	if report.Sent > 0 {
+		report.Conversion_Rate = float64(report.Converted) / float64(report.Sent)
+	}
+
+	return &report, nil
+}
+
+// случайный токен для ссылок из писем
+func generateToken() (string, error) {
+	buf := make([]byte, 32)
+
+	if _, err := rand.Read(buf); err != nil {
+		return "", err
+	}
+
+	return hex.EncodeToString(buf), nil
+}
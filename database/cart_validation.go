@@ -0,0 +1,204 @@
+package database
+
+import (
+	"context"
+	"ec-platform/currency"
+	"ec-platform/models"
+	"fmt"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+// CartWarnings - корзина изменилась с момента добавления товаров: рост цены, нехватка остатка
+// или товар в архиве. Оформление заказа возвращает эту ошибку со всеми блокирующими предупреждениями
+type CartWarnings []models.CartWarning
+
+func (w CartWarnings) Error() string {
+	return fmt.Sprintf("cart needs review: %d unresolved warnings", len(w))
+}
+
+// строка корзины с действующей ценой и данными для проверки. item.Price - цена в валюте
+// покупателя, basePrice - в базовой (с ней сравнивается снимок цены)
+type cartLine struct {
+	item      models.CartItem
+	basePrice models.Money
+	weight    int64
+	stock     *int
+	archived  bool
+}
+
+// читает строки корзины под блокировкой: проверка и оформление видят одни и те же снимки цен.
+// Цены пересчитываются в валюту курса rate
+func getCartLines(ctx context.Context, tx pgx.Tx, userID string, now time.Time, rate currency.Rate) ([]cartLine, error) {
+	rows, err := tx.Query(ctx, `
+		SELECT
+			p.product_id,
+			p.product_name,
+			pp.price,
+			pp.compare_at_price,
+			pb.price,
+			c.price_snapshot,
+			p.rating,
+			p.image,
+			c.quantity,
+			p.weight_grams,
+			p.stock,
+			p.archived_at IS NOT NULL
+		FROM cart c
+		JOIN products p ON c.product_id = p.product_id
+		JOIN LATERAL product_price_at(p.product_id, $2) pb ON TRUE
+		JOIN LATERAL product_price_in(p.product_id, $2, $3, $4, $5) pp ON TRUE
+		WHERE c.user_id = $1
+		ORDER BY c.created_at DESC
+		FOR UPDATE OF c
+	`, userID, now, rate.Currency, rate.Value, rate.Scale)
+
+	if err != nil {
+		return nil, err
+	}
+
+	defer rows.Close()
+
+	var lines []cartLine
+
+	for rows.Next() {
+		var line cartLine
+
+		err := rows.Scan(&line.item.ProductID, &line.item.ProductName, &line.item.Price, &line.item.CompareAtPrice,
+			&line.basePrice, &line.item.PriceSnapshot, &line.item.Rating, &line.item.Image, &line.item.Quantity, &line.weight, &line.stock, &line.archived)
+
+		if err != nil {
+			return nil, err
+		}
+
+		lines = append(lines, line)
+	}
+
+	return lines, rows.Err()
+}
+
+// предупреждения по строке корзины; снижение цены - единственное неблокирующее.
+// Цены в предупреждениях - в базовой валюте base, как и снимок
+func cartLineWarnings(line cartLine, base string) []models.CartWarning {
+	var warnings []models.CartWarning
+
+	warning := func(warningType string) models.CartWarning {
+		return models.CartWarning{Type: warningType, Product_ID: line.item.ProductID, Product_Name: line.item.ProductName}
+	}
+
+	if line.archived {
+		// Товар в архиве не продается: о цене и остатке предупреждать незачем
+		return append(warnings, warning(models.CartWarningArchived))
+	}
+
+	if line.basePrice != line.item.PriceSnapshot {
+		warningType := models.CartWarningPriceIncreased
+
+		if line.basePrice < line.item.PriceSnapshot {
+			warningType = models.CartWarningPriceDecreased
+		}
+
+		priceWarning := warning(warningType)
+		oldPrice, newPrice := line.item.PriceSnapshot, line.basePrice
+		priceWarning.Old_Price = &oldPrice
+		priceWarning.New_Price = &newPrice
+		priceWarning.Currency = base
+
+		warnings = append(warnings, priceWarning)
+	}
+
+	if line.stock != nil && *line.stock < line.item.Quantity {
+		stockWarning := warning(models.CartWarningOutOfStock)
+		available := *line.stock
+		stockWarning.Available = &available
+
+		warnings = append(warnings, stockWarning)
+	}
+
+	return warnings
+}
+
+// только предупреждения, без исправления которых заказ не оформляется
+func blockingCartWarnings(warnings []models.CartWarning) CartWarnings {
+	var blocking CartWarnings
+
+	for _, warning := range warnings {
+		if warning.Type != models.CartWarningPriceDecreased {
+			blocking = append(blocking, warning)
+		}
+	}
+
+	return blocking
+}
+
+// проверяет корзину пользователя перед оформлением. Подтверждения acks (цены в базовой валюте base)
+// принимают новую цену строки, только если она все еще действует (иначе покупатель подтвердил бы цену,
+// которую не видел). Снижение цены принимается сразу и показывается один раз. Возвращает строки корзины
+// с ценами в валюте rate, все предупреждения и можно ли оформлять заказ; ErrCantGetItem - корзина пуста
+func ValidateCart(ctx context.Context, db *pgxpool.Pool, userID string, acks []models.CartPriceAck, base string, rate currency.Rate) ([]models.CartItem, []models.CartWarning, bool, error) {
+	tx, err := db.Begin(ctx)
+
+	if err != nil {
+		return nil, nil, false, err
+	}
+
+	defer tx.Rollback(ctx)
+
+	now := time.Now().UTC()
+
+	lines, err := getCartLines(ctx, tx, userID, now, rate)
+
+	if err != nil {
+		return nil, nil, false, err
+	}
+
+	if len(lines) == 0 {
+		return nil, nil, false, ErrCantGetItem
+	}
+
+	acknowledged := make(map[uuid.UUID]models.Money, len(acks))
+
+	for _, ack := range acks {
+		acknowledged[ack.Product_ID] = *ack.Price
+	}
+
+	items := make([]models.CartItem, 0, len(lines))
+	warnings := make([]models.CartWarning, 0)
+
+	for _, line := range lines {
+		price, snapshot := line.basePrice, line.item.PriceSnapshot
+
+		if ackPrice, ok := acknowledged[line.item.ProductID]; ok && ackPrice == price && price > line.item.PriceSnapshot {
+			line.item.PriceSnapshot = price
+		}
+
+		lineWarnings := cartLineWarnings(line, base)
+		warnings = append(warnings, lineWarnings...)
+
+		// Новая цена ниже снимка - покупателю выгодно, снимок сдвигается без подтверждения
+		if price < line.item.PriceSnapshot {
+			line.item.PriceSnapshot = price
+		}
+
+		if line.item.PriceSnapshot != snapshot {
+			_, err := tx.Exec(ctx,
+				"UPDATE cart SET price_snapshot = $1 WHERE user_id = $2 AND product_id = $3",
+				line.item.PriceSnapshot, userID, line.item.ProductID)
+
+			if err != nil {
+				return nil, nil, false, err
+			}
+		}
+
+		items = append(items, line.item)
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		return nil, nil, false, err
+	}
+
+	return items, warnings, len(blockingCartWarnings(warnings)) == 0, nil
+}
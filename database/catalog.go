@@ -0,0 +1,271 @@
+package database
+
+import (
+	"context"
+	"ec-platform/models"
+	"errors"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+var (
+	ErrCatalogImportNotFound = errors.New("catalog import not found")
+)
+
+// колонки импорта в порядке сканирования scanCatalogImport
+const catalogImportColumns = `
+	import_id, format, dry_run, status, storage_key, total_rows, processed_rows, created_count, updated_count,
+	error_count, errors, failure, created_by, created_at, started_at, finished_at
+`
+
+func scanCatalogImport(row pgx.Row, catalogImport *models.CatalogImport) error {
+	return row.Scan(
+		&catalogImport.Import_ID,
+		&catalogImport.Format,
+		&catalogImport.Dry_Run,
+		&catalogImport.Status,
+		&catalogImport.Storage_Key,
+		&catalogImport.Total_Rows,
+		&catalogImport.Processed_Rows,
+		&catalogImport.Created_Count,
+		&catalogImport.Updated_Count,
+		&catalogImport.Error_Count,
+		&catalogImport.Errors,
+		&catalogImport.Failure,
+		&catalogImport.Created_By,
+		&catalogImport.Created_At,
+		&catalogImport.Started_At,
+		&catalogImport.Finished_At,
+	)
+}
+
+// создает импорт и в той же транзакции ставит задачу его обработки
+func CreateCatalogImport(ctx context.Context, db *pgxpool.Pool, catalogImport *models.CatalogImport, jobType string, payload interface{}) error {
+	tx, err := db.Begin(ctx)
+
+	if err != nil {
+		return err
+	}
+
+	defer tx.Rollback(ctx)
+
+	catalogImport.Status = models.CatalogImportStatusQueued
+	catalogImport.Created_At = time.Now().UTC()
+
+	_, err = tx.Exec(ctx, `
+		INSERT INTO catalog_imports (import_id, format, dry_run, status, storage_key, created_by, created_at)
+		VALUES ($1, $2, $3, $4, $5, $6, $7)
+	`, catalogImport.Import_ID, catalogImport.Format, catalogImport.Dry_Run, catalogImport.Status,
+		catalogImport.Storage_Key, catalogImport.Created_By, catalogImport.Created_At)
+
+	if err != nil {
+		return err
+	}
+
+	_, err = enqueueJob(ctx, tx, jobType, payload, time.Now(), jobType+":"+catalogImport.Import_ID.String())
+
+	if err != nil {
+		return err
+	}
+
+	return tx.Commit(ctx)
+}
+
+func GetCatalogImport(ctx context.Context, db *pgxpool.Pool, importID uuid.UUID) (*models.CatalogImport, error) {
+	var catalogImport models.CatalogImport
+
+	err := scanCatalogImport(db.QueryRow(ctx, "SELECT "+catalogImportColumns+" FROM catalog_imports WHERE import_id = $1", importID), &catalogImport)
+
+	if err == pgx.ErrNoRows {
+		return nil, ErrCatalogImportNotFound
+	}
+
+	if err != nil {
+		return nil, err
+	}
+
+	return &catalogImport, nil
+}
+
+// последние импорты, новые сверху (без списка ошибок - он есть в карточке импорта)
+func GetCatalogImports(ctx context.Context, db *pgxpool.Pool, limit int) ([]models.CatalogImport, error) {
+	rows, err := db.Query(ctx, "SELECT "+catalogImportColumns+" FROM catalog_imports ORDER BY created_at DESC LIMIT $1", limit)
+
+	if err != nil {
+		return nil, err
+	}
+
+	defer rows.Close()
+
+	imports := make([]models.CatalogImport, 0)
+
+	for rows.Next() {
+		var catalogImport models.CatalogImport
+
+		if err := scanCatalogImport(rows, &catalogImport); err != nil {
+			return nil, err
+		}
+
+		catalogImport.Errors = nil
+		imports = append(imports, catalogImport)
+	}
+
+	return imports, rows.Err()
+}
+
+// переводит импорт в running и сбрасывает счетчики (повторная попытка задачи начинает файл заново)
+func StartCatalogImport(ctx context.Context, db *pgxpool.Pool, importID uuid.UUID, totalRows int) error {
+	_, err := db.Exec(ctx, `
+		UPDATE catalog_imports SET
+			status = $2, total_rows = $3, processed_rows = 0, created_count = 0, updated_count = 0,
+			error_count = 0, errors = '[]', failure = NULL, started_at = $4
+		WHERE import_id = $1
+	`, importID, models.CatalogImportStatusRunning, totalRows, time.Now().UTC())
+
+	return err
+}
+
+// сохраняет прогресс импорта: счетчики и накопленные ошибки строк
+func SaveCatalogImportProgress(ctx context.Context, db *pgxpool.Pool, catalogImport *models.CatalogImport) error {
+	_, err := db.Exec(ctx, `
+		UPDATE catalog_imports SET
+			processed_rows = $2, created_count = $3, updated_count = $4, error_count = $5, errors = $6
+		WHERE import_id = $1
+	`, catalogImport.Import_ID, catalogImport.Processed_Rows, catalogImport.Created_Count,
+		catalogImport.Updated_Count, catalogImport.Error_Count, importErrors(catalogImport))
+
+	return err
+}
+
+// завершает импорт со статусом catalogImport.Status (succeeded или failed) и итоговыми счетчиками
+func FinishCatalogImport(ctx context.Context, db *pgxpool.Pool, catalogImport *models.CatalogImport) error {
+	now := time.Now().UTC()
+	catalogImport.Finished_At = &now
+
+	_, err := db.Exec(ctx, `
+		UPDATE catalog_imports SET
+			status = $2, processed_rows = $3, created_count = $4, updated_count = $5, error_count = $6,
+			errors = $7, failure = $8, finished_at = $9
+		WHERE import_id = $1
+	`, catalogImport.Import_ID, catalogImport.Status, catalogImport.Processed_Rows, catalogImport.Created_Count,
+		catalogImport.Updated_Count, catalogImport.Error_Count, importErrors(catalogImport), catalogImport.Failure, now)
+
+	return err
+}
+
+// пустой список пишется как [], а не null
+func importErrors(catalogImport *models.CatalogImport) []models.CatalogImportError {
+	if catalogImport.Errors == nil {
+		return []models.CatalogImportError{}
+	}
+
+	return catalogImport.Errors
+}
+
+// создает или обновляет товары по артикулу в одной транзакции; возвращает число созданных и измененных.
+// Пустые остаток, вес и изображение строки не меняют значения существующего товара.
+// Новые цены пишутся в историю цен от имени changedBy
+func UpsertCatalogRows(ctx context.Context, db *pgxpool.Pool, catalogRows []models.CatalogRow, changedBy string) (int, int, error) {
+	tx, err := db.Begin(ctx)
+
+	if err != nil {
+		return 0, 0, err
+	}
+
+	defer tx.Rollback(ctx)
+
+	now := time.Now().UTC()
+	created, updated := 0, 0
+
+	for _, row := range catalogRows {
+		price := row.Price
+
+		// Текущая цена под блокировкой - для истории; нет строки - товар будет создан
+		var oldPrice *models.Money
+
+		err := tx.QueryRow(ctx, "SELECT price FROM products WHERE sku = $1 FOR UPDATE", row.SKU).Scan(&oldPrice)
+
+		if err != nil && err != pgx.ErrNoRows {
+			return 0, 0, err
+		}
+
+		var productID uuid.UUID
+
+		err = tx.QueryRow(ctx, `
+			INSERT INTO products (product_id, sku, product_name, price, stock, weight_grams, image, created_at, updated_at)
+			VALUES ($1, $2, $3, $4, $5, COALESCE($6, 0), $7, $8, $8)
+			ON CONFLICT (sku) DO UPDATE SET
+				product_name = EXCLUDED.product_name,
+				price = EXCLUDED.price,
+				stock = COALESCE($5, products.stock),
+				weight_grams = COALESCE($6, products.weight_grams),
+				image = COALESCE($7, products.image),
+				updated_at = EXCLUDED.updated_at
+			RETURNING product_id
+		`, uuid.New(), row.SKU, row.Product_Name, price, row.Stock, row.Weight, row.Image, now).Scan(&productID)
+
+		if err != nil {
+			return 0, 0, err
+		}
+
+		if oldPrice == nil {
+			created++
+		} else {
+			updated++
+		}
+
+		if oldPrice == nil || *oldPrice != price {
+			if err := recordPriceChange(ctx, tx, productID, oldPrice, price, models.PriceSourceImport, changedBy); err != nil {
+				return 0, 0, err
+			}
+		}
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		return 0, 0, err
+	}
+
+	return created, updated, nil
+}
+
+// сколько из артикулов уже есть в каталоге (для пробного импорта)
+func CountExistingSKUs(ctx context.Context, db *pgxpool.Pool, skus []string) (int, error) {
+	var count int
+
+	err := db.QueryRow(ctx, "SELECT COUNT(*) FROM products WHERE sku = ANY($1)", skus).Scan(&count)
+
+	return count, err
+}
+
+// передает fn товары каталога по одному в порядке артикулов, не загружая каталог в память целиком.
+// Товары без артикула идут последними с пустым sku
+func ExportCatalog(ctx context.Context, db *pgxpool.Pool, fn func(row models.CatalogRow) error) error {
+	rows, err := db.Query(ctx, `
+		SELECT COALESCE(sku, ''), product_name, price, stock, weight_grams, image
+		FROM products
+		ORDER BY sku NULLS LAST, product_name
+	`)
+
+	if err != nil {
+		return err
+	}
+
+	defer rows.Close()
+
+	for rows.Next() {
+		var row models.CatalogRow
+
+		if err := rows.Scan(&row.SKU, &row.Product_Name, &row.Price, &row.Stock, &row.Weight, &row.Image); err != nil {
+			return err
+		}
+
+		if err := fn(row); err != nil {
+			return err
+		}
+	}
+
+	return rows.Err()
+}
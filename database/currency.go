@@ -0,0 +1,159 @@
+package database
+
+import (
+	"context"
+	"ec-platform/currency"
+	"ec-platform/models"
+	"errors"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+var (
+	ErrCurrencyNotSupported  = errors.New("no exchange rate for this currency")
+	ErrExchangeRateNotFound  = errors.New("exchange rate not found")
+	ErrCurrencyPriceNotFound = errors.New("product has no price in this currency")
+)
+
+// курсы всех валют, кроме базовой, по коду
+func GetExchangeRates(ctx context.Context, db *pgxpool.Pool) ([]models.ExchangeRate, error) {
+	rows, err := db.Query(ctx, "SELECT currency, rate::TEXT, updated_by, updated_at FROM exchange_rates ORDER BY currency")
+
+	if err != nil {
+		return nil, err
+	}
+
+	defer rows.Close()
+
+	rates := make([]models.ExchangeRate, 0)
+
+	for rows.Next() {
+		var rate models.ExchangeRate
+
+		if err := rows.Scan(&rate.Currency, &rate.Rate, &rate.Updated_By, &rate.Updated_At); err != nil {
+			return nil, err
+		}
+
+		rate.Minor_Units = currency.MinorUnits(rate.Currency)
+		rates = append(rates, rate)
+	}
+
+	return rates, rows.Err()
+}
+
+// создает или меняет курс валюты; rate.Rate должен быть проверен currency.ParseRate
+func SetExchangeRate(ctx context.Context, db *pgxpool.Pool, rate *models.ExchangeRate) error {
+	rate.Updated_At = time.Now().UTC()
+	rate.Minor_Units = currency.MinorUnits(rate.Currency)
+
+	_, err := db.Exec(ctx, `
+		INSERT INTO exchange_rates (currency, rate, updated_by, updated_at) VALUES ($1, $2, $3, $4)
+		ON CONFLICT (currency) DO UPDATE SET rate = EXCLUDED.rate, updated_by = EXCLUDED.updated_by, updated_at = EXCLUDED.updated_at
+	`, rate.Currency, rate.Rate, rate.Updated_By, rate.Updated_At)
+
+	return err
+}
+
+// удаляет курс: цены в этой валюте больше не показываются и заказы в ней не оформляются
+func DeleteExchangeRate(ctx context.Context, db *pgxpool.Pool, code string) error {
+	result, err := db.Exec(ctx, "DELETE FROM exchange_rates WHERE currency = $1", code)
+
+	if err != nil {
+		return err
+	}
+
+	if result.RowsAffected() == 0 {
+		return ErrExchangeRateNotFound
+	}
+
+	return nil
+}
+
+// курс пересчета из базовой валюты base в code. Для базовой валюты - единичный курс;
+// ErrCurrencyNotSupported - курс валюты не задан
+func GetRate(ctx context.Context, db *pgxpool.Pool, base string, code string) (currency.Rate, error) {
+	if code == base {
+		return currency.Identity(base), nil
+	}
+
+	var value string
+
+	err := db.QueryRow(ctx, "SELECT rate::TEXT FROM exchange_rates WHERE currency = $1", code).Scan(&value)
+
+	if err == pgx.ErrNoRows {
+		return currency.Rate{}, ErrCurrencyNotSupported
+	}
+
+	if err != nil {
+		return currency.Rate{}, err
+	}
+
+	return currency.NewRate(base, code, value), nil
+}
+
+// цены товара, заданные вручную в других валютах
+func GetProductCurrencyPrices(ctx context.Context, db *pgxpool.Pool, productID uuid.UUID) ([]models.CurrencyAmount, error) {
+	rows, err := db.Query(ctx,
+		"SELECT price, currency FROM product_currency_prices WHERE product_id = $1 ORDER BY currency",
+		productID)
+
+	if err != nil {
+		return nil, err
+	}
+
+	defer rows.Close()
+
+	prices := make([]models.CurrencyAmount, 0)
+
+	for rows.Next() {
+		var price models.CurrencyAmount
+
+		if err := rows.Scan(&price.Amount, &price.Currency); err != nil {
+			return nil, err
+		}
+
+		prices = append(prices, price)
+	}
+
+	return prices, rows.Err()
+}
+
+// задает цену товара в валюте вместо пересчета по курсу; ErrRecordNotFound - товара нет
+func SetProductCurrencyPrice(ctx context.Context, db *pgxpool.Pool, productID uuid.UUID, price models.CurrencyAmount, changedBy string) error {
+	result, err := db.Exec(ctx, `
+		INSERT INTO product_currency_prices (product_id, currency, price, updated_by, updated_at)
+		SELECT product_id, $2, $3, $4, $5 FROM products WHERE product_id = $1
+		ON CONFLICT (product_id, currency) DO UPDATE
+			SET price = EXCLUDED.price, updated_by = EXCLUDED.updated_by, updated_at = EXCLUDED.updated_at
+	`, productID, price.Currency, price.Amount, changedBy, time.Now().UTC())
+
+	if err != nil {
+		return err
+	}
+
+	if result.RowsAffected() == 0 {
+		return ErrRecordNotFound
+	}
+
+	return nil
+}
+
+// убирает ручную цену: цена в валюте снова пересчитывается по курсу
+func DeleteProductCurrencyPrice(ctx context.Context, db *pgxpool.Pool, productID uuid.UUID, code string) error {
+	result, err := db.Exec(ctx,
+		"DELETE FROM product_currency_prices WHERE product_id = $1 AND currency = $2",
+		productID, code)
+
+	if err != nil {
+		return err
+	}
+
+	if result.RowsAffected() == 0 {
+		return ErrCurrencyPriceNotFound
+	}
+
+	return nil
+}
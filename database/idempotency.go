@@ -0,0 +1,110 @@
+package database
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+var (
+	ErrIdempotencyKeyReused     = errors.New("idempotency key was already used with a different request")
+	ErrIdempotencyKeyInProgress = errors.New("request with this idempotency key is still in progress")
+)
+
+// IdempotentResponse - сохраненный ответ на запрос с ключом идемпотентности
+type IdempotentResponse struct {
+	StatusCode int
+	Body       []byte
+}
+
+// резервирует ключ идемпотентности. Возвращает nil, если ключ новый и запрос нужно выполнить,
+// или сохраненный ответ, если запрос с этим ключом уже был выполнен в пределах retention.
+// Резерв без ответа старше lockTimeout считается брошенным (сбой процесса, паника, деплой до освобождения
+// ключа) и переходит к повтору того же запроса
+func ReserveIdempotencyKey(ctx context.Context, db *pgxpool.Pool, scope string, key string, fingerprint string, retention time.Duration, lockTimeout time.Duration) (*IdempotentResponse, error) {
+	now := time.Now().UTC()
+
+	// Просроченный ключ можно использовать заново
+	_, err := db.Exec(ctx,
+		"DELETE FROM idempotency_keys WHERE scope = $1 AND idempotency_key = $2 AND created_at < $3",
+		scope, key, now.Add(-retention))
+
+	if err != nil {
+		return nil, err
+	}
+
+	result, err := db.Exec(ctx, `
+		INSERT INTO idempotency_keys (scope, idempotency_key, fingerprint, created_at)
+		VALUES ($1, $2, $3, $4)
+		ON CONFLICT (scope, idempotency_key) DO UPDATE SET created_at = EXCLUDED.created_at
+		WHERE idempotency_keys.status_code IS NULL
+			AND idempotency_keys.fingerprint = EXCLUDED.fingerprint
+			AND idempotency_keys.created_at < $5
+	`, scope, key, fingerprint, now, now.Add(-lockTimeout))
+
+	if err != nil {
+		return nil, err
+	}
+
+	if result.RowsAffected() == 1 {
+		return nil, nil
+	}
+
+	// Ключ уже есть: сравниваем запрос и отдаем сохраненный ответ
+	var storedFingerprint string
+	var statusCode *int
+	var body []byte
+
+	err = db.QueryRow(ctx,
+		"SELECT fingerprint, status_code, response_body FROM idempotency_keys WHERE scope = $1 AND idempotency_key = $2",
+		scope, key).Scan(&storedFingerprint, &statusCode, &body)
+
+	if err != nil {
+		return nil, err
+	}
+
+	if storedFingerprint != fingerprint {
+		return nil, ErrIdempotencyKeyReused
+	}
+
+	if statusCode == nil {
+		return nil, ErrIdempotencyKeyInProgress
+	}
+
+	return &IdempotentResponse{StatusCode: *statusCode, Body: body}, nil
+}
+
+// сохраняет ответ на запрос с ключом идемпотентности для повторов
+func SaveIdempotentResponse(ctx context.Context, db *pgxpool.Pool, scope string, key string, response IdempotentResponse) error {
+	_, err := db.Exec(ctx, `
+		UPDATE idempotency_keys
+		SET status_code = $1, response_body = $2, completed_at = $3
+		WHERE scope = $4 AND idempotency_key = $5
+	`, response.StatusCode, response.Body, time.Now().UTC(), scope, key)
+
+	return err
+}
+
+// освобождает ключ идемпотентности, если запрос завершился ошибкой сервера и его можно повторить
+func ReleaseIdempotencyKey(ctx context.Context, db *pgxpool.Pool, scope string, key string) error {
+	_, err := db.Exec(ctx,
+		"DELETE FROM idempotency_keys WHERE scope = $1 AND idempotency_key = $2 AND status_code IS NULL",
+		scope, key)
+
+	return err
+}
+
+// удаляет ключи идемпотентности старше retention, возвращает количество удаленных
+func PurgeIdempotencyKeys(ctx context.Context, db *pgxpool.Pool, retention time.Duration) (int64, error) {
+	result, err := db.Exec(ctx,
+		"DELETE FROM idempotency_keys WHERE created_at < $1",
+		time.Now().UTC().Add(-retention))
+
+	if err != nil {
+		return 0, err
+	}
+
+	return result.RowsAffected(), nil
+}
@@ -0,0 +1,440 @@
+package database
+
+import (
+	"context"
+	"ec-platform/models"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+var (
+	ErrInvoiceNotFound = errors.New("invoice not found")
+)
+
+// префиксы номеров документов
+var invoiceNumberPrefixes = map[string]string{
+	models.InvoiceKindInvoice:    "INV",
+	models.InvoiceKindCreditNote: "CN",
+}
+
+// колонки документа в порядке сканирования scanInvoice
+const invoiceColumns = `
+	invoice_id, kind, number, order_id, invoice_ref, payment_id, issued_at,
+	subtotal, tax_total, total, currency, seller_name, seller_tax_id, seller_address,
+	buyer_name, buyer_email, buyer_house, buyer_street, buyer_city, buyer_pincode, buyer_state
+`
+
+func scanInvoice(row pgx.Row, invoice *models.Invoice) error {
+	return row.Scan(
+		&invoice.Invoice_ID,
+		&invoice.Kind,
+		&invoice.Number,
+		&invoice.Order_ID,
+		&invoice.Invoice_Ref,
+		&invoice.Payment_ID,
+		&invoice.Issued_At,
+		&invoice.Subtotal,
+		&invoice.Tax_Total,
+		&invoice.Total,
+		&invoice.Currency,
+		&invoice.Seller_Name,
+		&invoice.Seller_Tax_ID,
+		&invoice.Seller_Address,
+		&invoice.Buyer_Name,
+		&invoice.Buyer_Email,
+		&invoice.Buyer_Address.House,
+		&invoice.Buyer_Address.Street,
+		&invoice.Buyer_Address.City,
+		&invoice.Buyer_Address.Pincode,
+		&invoice.Buyer_Address.State,
+	)
+}
+
+// следующий номер документа вида kind за год без пропусков.
+// Строка счетчика блокируется до конца транзакции, откат транзакции откатывает и номер
+func nextDocumentNumber(ctx context.Context, tx pgx.Tx, kind string, year int) (int, error) {
+	var number int
+
+	err := tx.QueryRow(ctx, `
+		INSERT INTO document_sequences (kind, year, last_number) VALUES ($1, $2, 1)
+		ON CONFLICT (kind, year) DO UPDATE SET last_number = document_sequences.last_number + 1
+		RETURNING last_number
+	`, kind, year).Scan(&number)
+
+	return number, err
+}
+
+// выделяет из суммы с налогом налог по ставке rateBP (в базисных пунктах), с округлением половины вверх
+func taxFromGross(gross models.Money, rateBP int) (models.Money, error) {
+	rate := uint64(rateBP)
+	return gross.MulRatio(rate, 10000+rate)
+}
+
+// строка документа с разложением суммы на net и налог
+func newInvoiceLine(position int, description string, quantity int, unitPrice models.Money, rateBP int) (models.InvoiceLine, error) {
+	total, err := unitPrice.Mul(quantity)
+
+	if err != nil {
+		return models.InvoiceLine{}, err
+	}
+
+	// Налог - доля суммы меньше единицы, net не уходит ниже нуля
+	tax, err := taxFromGross(total, rateBP)
+
+	if err != nil {
+		return models.InvoiceLine{}, err
+	}
+
+	net, err := total.Sub(tax)
+
+	if err != nil {
+		return models.InvoiceLine{}, err
+	}
+
+	return models.InvoiceLine{
+		Position:    position,
+		Description: description,
+		Quantity:    quantity,
+		Unit_Price:  unitPrice,
+		Tax_Rate_BP: rateBP,
+		Net:         net,
+		Tax:         tax,
+		Total:       total,
+	}, nil
+}
+
+// сохраняет документ с номером из годового счетчика и его строки
+func insertInvoice(ctx context.Context, tx pgx.Tx, invoice *models.Invoice, userID string) error {
+	year := invoice.Issued_At.Year()
+
+	sequence, err := nextDocumentNumber(ctx, tx, invoice.Kind, year)
+
+	if err != nil {
+		return err
+	}
+
+	invoice.Number = fmt.Sprintf("%s-%d-%06d", invoiceNumberPrefixes[invoice.Kind], year, sequence)
+
+	for _, line := range invoice.Lines {
+		if invoice.Total, err = invoice.Total.Add(line.Total); err != nil {
+			return err
+		}
+
+		if invoice.Subtotal, err = invoice.Subtotal.Add(line.Net); err != nil {
+			return err
+		}
+
+		if invoice.Tax_Total, err = invoice.Tax_Total.Add(line.Tax); err != nil {
+			return err
+		}
+	}
+
+	_, err = tx.Exec(ctx, `
+		INSERT INTO invoices (invoice_id, kind, number, year, sequence, order_id, user_id, invoice_ref, payment_id, issued_at,
+			subtotal, tax_total, total, currency, seller_name, seller_tax_id, seller_address,
+			buyer_name, buyer_email, buyer_house, buyer_street, buyer_city, buyer_pincode, buyer_state)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, $13, $14, $15, $16, $17, $18, $19, $20, $21, $22, $23, $24)
+	`, invoice.Invoice_ID, invoice.Kind, invoice.Number, year, sequence, invoice.Order_ID, userID, invoice.Invoice_Ref, invoice.Payment_ID,
+		invoice.Issued_At, invoice.Subtotal, invoice.Tax_Total, invoice.Total, invoice.Currency,
+		invoice.Seller_Name, invoice.Seller_Tax_ID, invoice.Seller_Address, invoice.Buyer_Name, invoice.Buyer_Email,
+		invoice.Buyer_Address.House, invoice.Buyer_Address.Street, invoice.Buyer_Address.City,
+		invoice.Buyer_Address.Pincode, invoice.Buyer_Address.State)
+
+	if err != nil {
+		return err
+	}
+
+	for _, line := range invoice.Lines {
+		_, err = tx.Exec(ctx, `
+			INSERT INTO invoice_lines (invoice_id, position, description, quantity, unit_price, tax_rate_bp, net, tax, total)
+			VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9)
+		`, invoice.Invoice_ID, line.Position, line.Description, line.Quantity, line.Unit_Price, line.Tax_Rate_BP,
+			line.Net, line.Tax, line.Total)
+
+		if err != nil {
+			return err
+		}
+	}
+
+	return enqueueEvent(ctx, tx, models.EventInvoiceIssued, invoice.Invoice_ID, models.InvoiceEvent{
+		Invoice_ID: invoice.Invoice_ID,
+		Kind:       invoice.Kind,
+		Number:     invoice.Number,
+		Order_ID:   invoice.Order_ID,
+		User_ID:    userID,
+		Total:      invoice.Total,
+		Currency:   invoice.Currency,
+	})
+}
+
+// выставляет счет по заказу внутри транзакции: позиции заказа и доставка, реквизиты продавца
+// из seller_profile, покупатель, адрес и валюта - из заказа. Если счет уже выставлен, возвращает его
+func issueInvoice(ctx context.Context, tx pgx.Tx, orderID uuid.UUID) (*models.Invoice, error) {
+	var existing models.Invoice
+
+	err := scanInvoice(tx.QueryRow(ctx, "SELECT "+invoiceColumns+" FROM invoices WHERE order_id = $1 AND kind = $2",
+		orderID, models.InvoiceKindInvoice), &existing)
+
+	if err == nil {
+		return &existing, nil
+	}
+
+	if err != pgx.ErrNoRows {
+		return nil, err
+	}
+
+	invoice := models.Invoice{
+		Invoice_ID: uuid.New(),
+		Kind:       models.InvoiceKindInvoice,
+		Order_ID:   orderID,
+		Issued_At:  time.Now().UTC(),
+	}
+
+	var rateBP int
+
+	err = tx.QueryRow(ctx, "SELECT name, tax_id, address, tax_rate_bp FROM seller_profile").
+		Scan(&invoice.Seller_Name, &invoice.Seller_Tax_ID, &invoice.Seller_Address, &rateBP)
+
+	if err != nil {
+		return nil, err
+	}
+
+	var userID string
+	var shippingMethod *string
+	var shippingCost models.Money
+
+	err = tx.QueryRow(ctx, `
+		SELECT o.user_id, u.first_name || ' ' || u.last_name, u.email,
+			o.ship_house, o.ship_street, o.ship_city, o.ship_pincode, o.ship_state,
+			o.shipping_method, o.shipping_cost, o.currency
+		FROM orders o
+		JOIN users u ON u.user_id = o.user_id
+		WHERE o.order_id = $1
+	`, orderID).Scan(&userID, &invoice.Buyer_Name, &invoice.Buyer_Email,
+		&invoice.Buyer_Address.House, &invoice.Buyer_Address.Street, &invoice.Buyer_Address.City,
+		&invoice.Buyer_Address.Pincode, &invoice.Buyer_Address.State, &shippingMethod, &shippingCost, &invoice.Currency)
+
+	if err == pgx.ErrNoRows {
+		return nil, ErrOrderNotFound
+	}
+
+	if err != nil {
+		return nil, err
+	}
+
+	rows, err := tx.Query(ctx, `
+		SELECT COALESCE(oi.product_name, p.product_name, ''), oi.quantity, oi.price
+		FROM order_items oi
+		LEFT JOIN products p ON p.product_id = oi.product_id
+		WHERE oi.order_id = $1
+		ORDER BY oi.id
+	`, orderID)
+
+	if err != nil {
+		return nil, err
+	}
+
+	for rows.Next() {
+		var name string
+		var quantity int
+		var price models.Money
+
+		if err := rows.Scan(&name, &quantity, &price); err != nil {
+			rows.Close()
+			return nil, err
+		}
+
+		line, err := newInvoiceLine(len(invoice.Lines)+1, name, quantity, price, rateBP)
+
+		if err != nil {
+			rows.Close()
+			return nil, err
+		}
+
+		invoice.Lines = append(invoice.Lines, line)
+	}
+
+	rows.Close()
+
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	if shippingCost > 0 {
+		description := "Shipping"
+
+		if shippingMethod != nil {
+			description += " (" + *shippingMethod + ")"
+		}
+
+		line, err := newInvoiceLine(len(invoice.Lines)+1, description, 1, shippingCost, rateBP)
+
+		if err != nil {
+			return nil, err
+		}
+
+		invoice.Lines = append(invoice.Lines, line)
+	}
+
+	if err := insertInvoice(ctx, tx, &invoice, userID); err != nil {
+		return nil, err
+	}
+
+	return &invoice, nil
+}
+
+// выставляет корректировочный счет на сумму возврата по платежу. Реквизиты сторон
+// и ставка налога берутся из исходного счета (он выставляется, если его еще нет)
+func issueCreditNote(ctx context.Context, tx pgx.Tx, payment models.PaymentAttempt, amount models.Money) (*models.Invoice, error) {
+	original, err := issueInvoice(ctx, tx, payment.Order_ID)
+
+	if err != nil {
+		return nil, err
+	}
+
+	var userID string
+	var rateBP int
+
+	err = tx.QueryRow(ctx, `
+		SELECT i.user_id, COALESCE((SELECT tax_rate_bp FROM invoice_lines WHERE invoice_id = i.invoice_id ORDER BY position LIMIT 1), 0)
+		FROM invoices i
+		WHERE i.invoice_id = $1
+	`, original.Invoice_ID).Scan(&userID, &rateBP)
+
+	if err != nil {
+		return nil, err
+	}
+
+	line, err := newInvoiceLine(1, "Refund for invoice "+original.Number, 1, amount, rateBP)
+
+	if err != nil {
+		return nil, err
+	}
+
+	creditNote := models.Invoice{
+		Invoice_ID:     uuid.New(),
+		Kind:           models.InvoiceKindCreditNote,
+		Order_ID:       payment.Order_ID,
+		Invoice_Ref:    &original.Invoice_ID,
+		Payment_ID:     &payment.Payment_ID,
+		Issued_At:      time.Now().UTC(),
+		Currency:       original.Currency,
+		Seller_Name:    original.Seller_Name,
+		Seller_Tax_ID:  original.Seller_Tax_ID,
+		Seller_Address: original.Seller_Address,
+		Buyer_Name:     original.Buyer_Name,
+		Buyer_Email:    original.Buyer_Email,
+		Buyer_Address:  original.Buyer_Address,
+		Lines:          []models.InvoiceLine{line},
+	}
+
+	if err := insertInvoice(ctx, tx, &creditNote, userID); err != nil {
+		return nil, err
+	}
+
+	return &creditNote, nil
+}
+
+// возвращает документ со строками. Пустой userID - документ любого пользователя
+func GetInvoice(ctx context.Context, db *pgxpool.Pool, userID string, invoiceID uuid.UUID) (*models.Invoice, error) {
+	var invoice models.Invoice
+
+	err := scanInvoice(db.QueryRow(ctx, "SELECT "+invoiceColumns+" FROM invoices WHERE invoice_id = $1 AND ($2 = '' OR user_id = $2)",
+		invoiceID, userID), &invoice)
+
+	if err == pgx.ErrNoRows {
+		return nil, ErrInvoiceNotFound
+	}
+
+	if err != nil {
+		return nil, err
+	}
+
+	rows, err := db.Query(ctx, `
+		SELECT position, description, quantity, unit_price, tax_rate_bp, net, tax, total
+		FROM invoice_lines
+		WHERE invoice_id = $1
+		ORDER BY position
+	`, invoiceID)
+
+	if err != nil {
+		return nil, err
+	}
+
+	defer rows.Close()
+
+	invoice.Lines = make([]models.InvoiceLine, 0)
+
+	for rows.Next() {
+		var line models.InvoiceLine
+
+		err := rows.Scan(&line.Position, &line.Description, &line.Quantity, &line.Unit_Price, &line.Tax_Rate_BP,
+			&line.Net, &line.Tax, &line.Total)
+
+		if err != nil {
+			return nil, err
+		}
+
+		invoice.Lines = append(invoice.Lines, line)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return &invoice, nil
+}
+
+// возвращает документы заказа пользователя (без строк) в порядке выставления
+func GetOrderInvoices(ctx context.Context, db *pgxpool.Pool, userID string, orderID uuid.UUID) ([]models.Invoice, error) {
+	var exists bool
+
+	err := db.QueryRow(ctx, "SELECT EXISTS(SELECT 1 FROM orders WHERE order_id = $1 AND user_id = $2)", orderID, userID).Scan(&exists)
+
+	if err != nil {
+		return nil, err
+	}
+
+	if !exists {
+		return nil, ErrOrderNotFound
+	}
+
+	return queryInvoices(ctx, db, "SELECT "+invoiceColumns+" FROM invoices WHERE order_id = $1 ORDER BY issued_at, number", orderID)
+}
+
+// возвращает документы за год (0 - за все годы) указанного вида (пустой - любого) в порядке номеров
+func GetInvoices(ctx context.Context, db *pgxpool.Pool, year int, kind string, limit int) ([]models.Invoice, error) {
+	return queryInvoices(ctx, db, "SELECT "+invoiceColumns+` FROM invoices
+		WHERE ($1 = 0 OR year = $1) AND ($2 = '' OR kind = $2)
+		ORDER BY year DESC, kind, sequence DESC
+		LIMIT $3`, year, kind, limit)
+}
+
+func queryInvoices(ctx context.Context, db *pgxpool.Pool, query string, args ...interface{}) ([]models.Invoice, error) {
+	rows, err := db.Query(ctx, query, args...)
+
+	if err != nil {
+		return nil, err
+	}
+
+	defer rows.Close()
+
+	invoices := make([]models.Invoice, 0)
+
+	for rows.Next() {
+		var invoice models.Invoice
+
+		if err := scanInvoice(rows, &invoice); err != nil {
+			return nil, err
+		}
+
+		invoices = append(invoices, invoice)
+	}
+
+	return invoices, rows.Err()
+}
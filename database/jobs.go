@@ -0,0 +1,210 @@
+package database
+
+import (
+	"context"
+	"ec-platform/models"
+	"encoding/json"
+	"errors"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+var (
+	ErrJobNotFound = errors.New("job not found")
+)
+
+// колонки задачи в порядке сканирования scanJob
+const jobColumns = `
+	id, type, payload, status, attempts, unique_key, run_at, locked_at, last_error, created_at, finished_at
+`
+
+func scanJob(row pgx.Row, job *models.Job) error {
+	return row.Scan(
+		&job.ID,
+		&job.Type,
+		&job.Payload,
+		&job.Status,
+		&job.Attempts,
+		&job.Unique_Key,
+		&job.Run_At,
+		&job.Locked_At,
+		&job.Last_Error,
+		&job.Created_At,
+		&job.Finished_At,
+	)
+}
+
+// ставит задачу в очередь на время runAt. Непустой uniqueKey - задача с таким ключом может стоять
+// в очереди (или выполняться) только одна: повторная постановка ничего не делает и возвращает 0
+func EnqueueJob(ctx context.Context, db *pgxpool.Pool, jobType string, payload interface{}, runAt time.Time, uniqueKey string) (int64, error) {
+	return enqueueJob(ctx, db, jobType, payload, runAt, uniqueKey)
+}
+
+// пул или транзакция: задача, поставленная в транзакции, появится в очереди только после коммита
+type jobQuerier interface {
+	QueryRow(ctx context.Context, sql string, args ...interface{}) pgx.Row
+}
+
+func enqueueJob(ctx context.Context, db jobQuerier, jobType string, payload interface{}, runAt time.Time, uniqueKey string) (int64, error) {
+	data, err := json.Marshal(payload)
+
+	if err != nil {
+		return 0, err
+	}
+
+	var key *string
+
+	if uniqueKey != "" {
+		key = &uniqueKey
+	}
+
+	var id int64
+
+	err = db.QueryRow(ctx, `
+		INSERT INTO jobs (type, payload, unique_key, run_at, created_at)
+		VALUES ($1, $2, $3, $4, $5)
+		ON CONFLICT (unique_key) WHERE status IN ('queued', 'running') DO NOTHING
+		RETURNING id
+	`, jobType, data, key, runAt.UTC(), time.Now().UTC()).Scan(&id)
+
+	if err == pgx.ErrNoRows {
+		return 0, nil
+	}
+
+	if err != nil {
+		return 0, err
+	}
+
+	return id, nil
+}
+
+// забирает до limit готовых задач типа jobType и помечает их running.
+// Задачи, зависшие в running дольше lease (воркер упал), забираются повторно
+func ClaimJobs(ctx context.Context, db *pgxpool.Pool, jobType string, limit int, lease time.Duration) ([]models.Job, error) {
+	now := time.Now().UTC()
+
+	rows, err := db.Query(ctx, `
+		UPDATE jobs SET status = $1, attempts = attempts + 1, locked_at = $2
+		WHERE id IN (
+			SELECT id FROM jobs
+			WHERE type = $3 AND (
+				(status = $4 AND run_at <= $2) OR
+				(status = $1 AND locked_at < $5)
+			)
+			ORDER BY run_at, id
+			LIMIT $6
+			FOR UPDATE SKIP LOCKED
+		)
+		RETURNING `+jobColumns,
+		models.JobStatusRunning, now, jobType, models.JobStatusQueued, now.Add(-lease), limit)
+
+	if err != nil {
+		return nil, err
+	}
+
+	defer rows.Close()
+
+	var jobs []models.Job
+
+	for rows.Next() {
+		var job models.Job
+
+		if err := scanJob(rows, &job); err != nil {
+			return nil, err
+		}
+
+		jobs = append(jobs, job)
+	}
+
+	return jobs, rows.Err()
+}
+
+// помечает задачу выполненной
+func CompleteJob(ctx context.Context, db *pgxpool.Pool, jobID int64) error {
+	now := time.Now().UTC()
+
+	_, err := db.Exec(ctx,
+		"UPDATE jobs SET status = $1, last_error = NULL, finished_at = $2 WHERE id = $3",
+		models.JobStatusSucceeded, now, jobID)
+
+	return err
+}
+
+// возвращает задачу в очередь через retryIn или, если попытки исчерпаны, переводит в dead
+func FailJob(ctx context.Context, db *pgxpool.Pool, job models.Job, reason string, maxAttempts int, retryIn time.Duration) error {
+	now := time.Now().UTC()
+
+	if job.Attempts >= maxAttempts {
+		_, err := db.Exec(ctx,
+			"UPDATE jobs SET status = $1, last_error = $2, finished_at = $3 WHERE id = $4",
+			models.JobStatusDead, reason, now, job.ID)
+
+		return err
+	}
+
+	_, err := db.Exec(ctx,
+		"UPDATE jobs SET status = $1, last_error = $2, run_at = $3, locked_at = NULL WHERE id = $4",
+		models.JobStatusQueued, reason, now.Add(retryIn), job.ID)
+
+	return err
+}
+
+// возвращает задачи в указанном статусе и типе (пустые - любые), новые сверху
+func GetJobs(ctx context.Context, db *pgxpool.Pool, status string, jobType string, limit int) ([]models.Job, error) {
+	rows, err := db.Query(ctx, "SELECT "+jobColumns+` FROM jobs
+		WHERE ($1 = '' OR status = $1) AND ($2 = '' OR type = $2)
+		ORDER BY id DESC
+		LIMIT $3`, status, jobType, limit)
+
+	if err != nil {
+		return nil, err
+	}
+
+	defer rows.Close()
+
+	jobs := make([]models.Job, 0)
+
+	for rows.Next() {
+		var job models.Job
+
+		if err := scanJob(rows, &job); err != nil {
+			return nil, err
+		}
+
+		jobs = append(jobs, job)
+	}
+
+	return jobs, rows.Err()
+}
+
+// возвращает задачу из dead в очередь с новым счетчиком попыток
+func RetryJob(ctx context.Context, db *pgxpool.Pool, jobID int64) error {
+	result, err := db.Exec(ctx,
+		"UPDATE jobs SET status = $1, attempts = 0, run_at = $2, locked_at = NULL, finished_at = NULL WHERE id = $3 AND status = $4",
+		models.JobStatusQueued, time.Now().UTC(), jobID, models.JobStatusDead)
+
+	if err != nil {
+		return err
+	}
+
+	if result.RowsAffected() == 0 {
+		return ErrJobNotFound
+	}
+
+	return nil
+}
+
+// удаляет выполненные задачи старше retention (dead остаются для разбора)
+func PurgeFinishedJobs(ctx context.Context, db *pgxpool.Pool, retention time.Duration) (int64, error) {
+	result, err := db.Exec(ctx,
+		"DELETE FROM jobs WHERE status = $1 AND finished_at < $2",
+		models.JobStatusSucceeded, time.Now().UTC().Add(-retention))
+
+	if err != nil {
+		return 0, err
+	}
+
+	return result.RowsAffected(), nil
+}
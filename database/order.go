@@ -0,0 +1,305 @@
+package database
+
+import (
+	"context"
+	"ec-platform/models"
+	"errors"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+var (
+	ErrOrderNotFound       = errors.New("order not found")
+	ErrOrderNotCancellable = errors.New("order can't be cancelled after shipment")
+)
+
+// RefundFunc возвращает сумму по платежу через платежного провайдера. Вызывается после коммита
+// транзакции отмены или возврата: ошибка оставляет возврат в pending до повтора (RetryRefunds)
+type RefundFunc func(ctx context.Context, payment models.PaymentAttempt, amount models.Money) error
+
+// VoidFunc снимает у провайдера блокировку средств по платежу отмененного заказа. Вызывается после
+// коммита отмены; при ошибке блокировка истекает сама, а позднее списание возвращается (capturePayment)
+type VoidFunc func(ctx context.Context, payment models.PaymentAttempt) error
+
+// колонки заказа в порядке сканирования scanOrder
+const orderColumns = `
+	o.order_id, o.total_price, o.ordered_at, o.status,
+	o.address_id, o.shipping_method, o.shipping_cost, o.currency, o.exchange_rate::TEXT,
+	o.ship_house, o.ship_street, o.ship_city, o.ship_pincode, o.ship_state, o.ship_country
+`
+
+// сканирует строку заказа, выбранную с orderColumns
+func scanOrder(row pgx.Row, order *models.Order) error {
+	return row.Scan(
+		&order.Order_ID,
+		&order.Price,
+		&order.Ordered_At,
+		&order.Status,
+		&order.Address_ID,
+		&order.Shipping_Method,
+		&order.Shipping_Cost,
+		&order.Currency,
+		&order.Exchange_Rate,
+		&order.Shipping_Address.House,
+		&order.Shipping_Address.Street,
+		&order.Shipping_Address.City,
+		&order.Shipping_Address.Pincode,
+		&order.Shipping_Address.State,
+		&order.Shipping_Address.Country,
+	)
+}
+
+// возвращает страницу заказов пользователя (новые сверху) и общее количество заказов.
+// Пустой status - заказы в любом статусе
+func GetOrders(ctx context.Context, db *pgxpool.Pool, userID string, status string, limit int, offset int) ([]models.Order, int, error) {
+	var total int
+
+	err := db.QueryRow(ctx,
+		"SELECT COUNT(*) FROM orders WHERE user_id = $1 AND ($2 = '' OR status = $2)",
+		userID, status).Scan(&total)
+
+	if err != nil {
+		return nil, 0, err
+	}
+
+	query := `
+		SELECT ` + orderColumns + `
+		FROM orders o
+		WHERE o.user_id = $1 AND ($2 = '' OR o.status = $2)
+		ORDER BY o.ordered_at DESC, o.order_id
+		LIMIT $3 OFFSET $4
+	`
+
+	rows, err := db.Query(ctx, query, userID, status, limit, offset)
+
+	if err != nil {
+		return nil, 0, err
+	}
+
+	defer rows.Close()
+
+	orders := make([]models.Order, 0)
+
+	for rows.Next() {
+		var order models.Order
+
+		if err := scanOrder(rows, &order); err != nil {
+			return nil, 0, err
+		}
+
+		orders = append(orders, order)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, 0, err
+	}
+
+	return orders, total, nil
+}
+
+// возвращает заказ пользователя вместе с позициями. Чужой заказ не находится (ErrOrderNotFound)
+func GetOrder(ctx context.Context, db *pgxpool.Pool, userID string, orderID uuid.UUID) (*models.Order, error) {
+	var order models.Order
+
+	query := `SELECT ` + orderColumns + ` FROM orders o WHERE o.order_id = $1 AND o.user_id = $2`
+
+	err := scanOrder(db.QueryRow(ctx, query, orderID, userID), &order)
+
+	if err == pgx.ErrNoRows {
+		return nil, ErrOrderNotFound
+	}
+
+	if err != nil {
+		return nil, err
+	}
+
+	// Позиции заказа со снимком товара (для старых заказов - текущие данные товара)
+	itemsQuery := `
+		SELECT
+			oi.id,
+			oi.product_id,
+			COALESCE(oi.product_name, p.product_name),
+			COALESCE(oi.image, p.image),
+			oi.price,
+			oi.quantity
+		FROM order_items oi
+		LEFT JOIN products p ON oi.product_id = p.product_id
+		WHERE oi.order_id = $1
+		ORDER BY COALESCE(oi.product_name, p.product_name)
+	`
+
+	rows, err := db.Query(ctx, itemsQuery, orderID)
+
+	if err != nil {
+		return nil, err
+	}
+
+	defer rows.Close()
+
+	order.Items = make([]models.OrderItem, 0)
+
+	for rows.Next() {
+		var item models.OrderItem
+
+		err := rows.Scan(&item.ID, &item.ProductID, &item.ProductName, &item.Image, &item.Price, &item.Quantity)
+
+		if err != nil {
+			return nil, err
+		}
+
+		order.Items = append(order.Items, item)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	// Попытки оплаты заказа
+	order.Payments, err = GetOrderPayments(ctx, db, orderID)
+
+	if err != nil {
+		return nil, err
+	}
+
+	return &order, nil
+}
+
+// создает запись заказа со снимком адреса доставки. total и shippingCost - в валюте оплаты params.Rate,
+// baseTotal - та же сумма в базовой валюте
+func insertOrder(ctx context.Context, tx pgx.Tx, orderID uuid.UUID, userID string, total models.Money, baseTotal models.Money, params CheckoutParams, address *models.Address, shippingCost models.Money) error {
+	orderQuery := `
+		INSERT INTO orders (
+			order_id, user_id, total_price, base_total_price, ordered_at, status,
+			address_id, shipping_method, shipping_cost, currency, exchange_rate,
+			ship_house, ship_street, ship_city, ship_pincode, ship_state, ship_country
+		)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, $13, $14, $15, $16, $17)
+	`
+
+	_, err := tx.Exec(ctx, orderQuery,
+		orderID, userID, total, baseTotal, time.Now().UTC(), models.OrderStatusPending,
+		address.Addres_ID, params.ShippingMethod, shippingCost, params.Rate.Currency, params.Rate.Value,
+		address.House, address.Street, address.City, address.Pincode, address.State, address.Country,
+	)
+
+	if err != nil {
+		return err
+	}
+
+	// Первая запись истории статусов - создание заказа покупателем
+	return recordOrderStatus(ctx, tx, orderID, nil, models.OrderStatusPending, userID, "")
+}
+
+// добавляет позицию заказа со снимком названия и картинки товара
+func insertOrderItem(ctx context.Context, tx pgx.Tx, orderID uuid.UUID, item models.OrderItem) error {
+	_, err := tx.Exec(ctx,
+		"INSERT INTO order_items (id, order_id, product_id, product_name, image, quantity, price) VALUES ($1, $2, $3, $4, $5, $6, $7)",
+		uuid.New(), orderID, item.ProductID, item.ProductName, item.Image, item.Quantity, item.Price)
+
+	return err
+}
+
+// отменяет заказ пользователя до отправки: возвращает остатки на склад, оплату (refund),
+// отменяет еще не списанные платежи (void) и записывает отмену в историю статусов - все в одной транзакции
+func CancelOrder(ctx context.Context, db *pgxpool.Pool, userID string, orderID uuid.UUID, reason string, refund RefundFunc, void VoidFunc) error {
+	tx, err := db.Begin(ctx)
+
+	if err != nil {
+		return err
+	}
+
+	defer tx.Rollback(ctx)
+
+	// Проверяем принадлежность заказа и блокируем его
+	var status string
+
+	err = tx.QueryRow(ctx,
+		"SELECT status FROM orders WHERE order_id = $1 AND user_id = $2 FOR UPDATE",
+		orderID, userID).Scan(&status)
+
+	if err == pgx.ErrNoRows {
+		return ErrOrderNotFound
+	}
+
+	if err != nil {
+		return err
+	}
+
+	if !CanTransitionOrder(status, models.OrderStatusCancelled) {
+		return ErrOrderNotCancellable
+	}
+
+	// Возвращаем остатки на склад
+	if err := releaseOrderStock(ctx, tx, orderID); err != nil {
+		return err
+	}
+
+	// Возвращаем оплату: возвраты сохраняются в транзакции, провайдеру уходят после коммита
+	var refunds []models.Refund
+
+	if refund != nil {
+		if refunds, err = refundOrderPayments(ctx, tx, orderID, userID); err != nil {
+			return err
+		}
+	}
+
+	// Не списанные платежи больше нельзя списать
+	voided, err := voidOrderPayments(ctx, tx, orderID)
+
+	if err != nil {
+		return err
+	}
+
+	// Переход в cancelled записывается в историю статусов с причиной отмены
+	if _, err := transitionOrderStatus(ctx, tx, orderID, models.OrderStatusCancelled, userID, reason); err != nil {
+		return err
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		return err
+	}
+
+	settleRefunds(ctx, db, refunds, refund)
+	settleVoids(ctx, voided, void)
+
+	return nil
+}
+
+// возвращает на склад остатки всех позиций отменяемого заказа
+func releaseOrderStock(ctx context.Context, tx pgx.Tx, orderID uuid.UUID) error {
+	rows, err := tx.Query(ctx, "SELECT product_id, quantity FROM order_items WHERE order_id = $1", orderID)
+
+	if err != nil {
+		return err
+	}
+
+	var items []models.OrderItem
+
+	for rows.Next() {
+		var item models.OrderItem
+
+		if err := rows.Scan(&item.ProductID, &item.Quantity); err != nil {
+			rows.Close()
+			return err
+		}
+
+		items = append(items, item)
+	}
+
+	rows.Close()
+
+	if err := rows.Err(); err != nil {
+		return err
+	}
+
+	for _, item := range items {
+		if err := releaseStock(ctx, tx, item.ProductID, item.Quantity); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
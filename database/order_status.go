@@ -0,0 +1,251 @@
+package database
+
+import (
+	"context"
+	"ec-platform/models"
+	"errors"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+// канал LISTEN/NOTIFY, в который пишется order_id при каждом переходе статуса
+const OrderStatusChannel = "order_status"
+
+var (
+	ErrInvalidOrderStatus = errors.New("unknown order status")
+	ErrInvalidTransition  = errors.New("order status transition is not allowed")
+)
+
+// допустимые переходы статусов заказа; cancelled и refunded - конечные статусы.
+// pending -> packed возможен только для оплаты наличными при получении (см. checkPaymentGuards)
+var orderTransitions = map[string][]string{
+	models.OrderStatusPending:   {models.OrderStatusPaid, models.OrderStatusPacked, models.OrderStatusCancelled},
+	models.OrderStatusPaid:      {models.OrderStatusPacked, models.OrderStatusCancelled, models.OrderStatusRefunded},
+	models.OrderStatusPacked:    {models.OrderStatusShipped, models.OrderStatusCancelled, models.OrderStatusRefunded},
+	models.OrderStatusShipped:   {models.OrderStatusDelivered},
+	models.OrderStatusDelivered: {models.OrderStatusRefunded},
+	models.OrderStatusCancelled: {},
+	models.OrderStatusRefunded:  {},
+}
+
+// проверяет, что статус заказа известен
+func IsValidOrderStatus(status string) bool {
+	_, ok := orderTransitions[status]
+	return ok
+}
+
+// проверяет, разрешен ли переход из статуса from в статус to
+func CanTransitionOrder(from string, to string) bool {
+	for _, allowed := range orderTransitions[from] {
+		if allowed == to {
+			return true
+		}
+	}
+
+	return false
+}
+
+// переводит заказ в новый статус и записывает переход в историю.
+// Отмена, как и отмена покупателем, возвращает остатки на склад и списанные платежи через refund
+// (после коммита, см. settleRefunds), а не списанные отменяет через void; при переходе в refunded
+// списанные платежи также возвращаются
+func TransitionOrderStatus(ctx context.Context, db *pgxpool.Pool, orderID uuid.UUID, to string, actor string, note string, refund RefundFunc, void VoidFunc) error {
+	tx, err := db.Begin(ctx)
+
+	if err != nil {
+		return err
+	}
+
+	defer tx.Rollback(ctx)
+
+	if _, err := transitionOrderStatus(ctx, tx, orderID, to, actor, note); err != nil {
+		return err
+	}
+
+	var voided []models.PaymentAttempt
+
+	if to == models.OrderStatusCancelled {
+		if err := releaseOrderStock(ctx, tx, orderID); err != nil {
+			return err
+		}
+
+		if voided, err = voidOrderPayments(ctx, tx, orderID); err != nil {
+			return err
+		}
+	}
+
+	var refunds []models.Refund
+
+	if (to == models.OrderStatusCancelled || to == models.OrderStatusRefunded) && refund != nil {
+		if refunds, err = refundOrderPayments(ctx, tx, orderID, actor); err != nil {
+			return err
+		}
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		return err
+	}
+
+	settleRefunds(ctx, db, refunds, refund)
+	settleVoids(ctx, voided, void)
+
+	return nil
+}
+
+// переводит заказ в новый статус внутри транзакции, возвращает предыдущий статус
+func transitionOrderStatus(ctx context.Context, tx pgx.Tx, orderID uuid.UUID, to string, actor string, note string) (string, error) {
+	if !IsValidOrderStatus(to) {
+		return "", ErrInvalidOrderStatus
+	}
+
+	// Блокируем заказ, чтобы параллельные переходы не обошли проверку
+	var from string
+
+	err := tx.QueryRow(ctx, "SELECT status FROM orders WHERE order_id = $1 FOR UPDATE", orderID).Scan(&from)
+
+	if err == pgx.ErrNoRows {
+		return "", ErrOrderNotFound
+	}
+
+	if err != nil {
+		return "", err
+	}
+
+	if !CanTransitionOrder(from, to) {
+		return from, ErrInvalidTransition
+	}
+
+	if err := checkPaymentGuards(ctx, tx, orderID, from, to); err != nil {
+		return from, err
+	}
+
+	_, err = tx.Exec(ctx, "UPDATE orders SET status = $1 WHERE order_id = $2", to, orderID)
+
+	if err != nil {
+		return from, err
+	}
+
+	if err := recordOrderStatus(ctx, tx, orderID, &from, to, actor, note); err != nil {
+		return from, err
+	}
+
+	return from, nil
+}
+
+// добавляет запись в историю статусов заказа и события перехода в outbox
+func recordOrderStatus(ctx context.Context, tx pgx.Tx, orderID uuid.UUID, from *string, to string, actor string, note string) error {
+	var noteValue *string
+
+	if note != "" {
+		noteValue = &note
+	}
+
+	_, err := tx.Exec(ctx,
+		"INSERT INTO order_status_history (order_id, from_status, to_status, actor, note, changed_at) VALUES ($1, $2, $3, $4, $5, $6)",
+		orderID, from, to, actor, noteValue, time.Now().UTC())
+
+	if err != nil {
+		return err
+	}
+
+	// Уведомление уходит слушателям только после коммита транзакции
+	_, err = tx.Exec(ctx, "SELECT pg_notify($1, $2)", OrderStatusChannel, orderID.String())
+
+	if err != nil {
+		return err
+	}
+
+	return enqueueOrderEvents(ctx, tx, orderID, from, to, actor, note)
+}
+
+// возвращает историю переходов статуса заказа в хронологическом порядке
+func GetOrderStatusHistory(ctx context.Context, db *pgxpool.Pool, orderID uuid.UUID) ([]models.OrderStatusChange, error) {
+	var orderExists bool
+
+	err := db.QueryRow(ctx, "SELECT EXISTS(SELECT 1 FROM orders WHERE order_id = $1)", orderID).Scan(&orderExists)
+
+	if err != nil {
+		return nil, err
+	}
+
+	if !orderExists {
+		return nil, ErrOrderNotFound
+	}
+
+	return GetOrderStatusChangesSince(ctx, db, orderID, 0)
+}
+
+// возвращает переходы статуса заказа с id больше afterID в хронологическом порядке
+func GetOrderStatusChangesSince(ctx context.Context, db *pgxpool.Pool, orderID uuid.UUID, afterID int64) ([]models.OrderStatusChange, error) {
+	rows, err := db.Query(ctx, `
+		SELECT id, order_id, from_status, to_status, actor, note, changed_at
+		FROM order_status_history
+		WHERE order_id = $1 AND id > $2
+		ORDER BY id
+	`, orderID, afterID)
+
+	if err != nil {
+		return nil, err
+	}
+
+	defer rows.Close()
+
+	history := make([]models.OrderStatusChange, 0)
+
+	for rows.Next() {
+		var change models.OrderStatusChange
+
+		err := rows.Scan(&change.ID, &change.OrderID, &change.FromStatus, &change.ToStatus, &change.Actor, &change.Note, &change.Changed_At)
+
+		if err != nil {
+			return nil, err
+		}
+
+		history = append(history, change)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return history, nil
+}
+
+// слушает переходы статусов заказов на отдельном соединении (вне пула) и вызывает notify
+// с order_id для каждого. Возвращает ошибку при обрыве соединения или nil при отмене ctx
+func ListenOrderStatus(ctx context.Context, db *pgxpool.Pool, notify func(orderID uuid.UUID)) error {
+	conn, err := pgx.ConnectConfig(ctx, db.Config().ConnConfig)
+
+	if err != nil {
+		return err
+	}
+
+	defer conn.Close(context.Background())
+
+	if _, err := conn.Exec(ctx, "LISTEN "+OrderStatusChannel); err != nil {
+		return err
+	}
+
+	for {
+		notification, err := conn.WaitForNotification(ctx)
+
+		if err != nil {
+			if ctx.Err() != nil {
+				return nil
+			}
+
+			return err
+		}
+
+		orderID, err := uuid.Parse(notification.Payload)
+
+		if err != nil {
+			continue
+		}
+
+		notify(orderID)
+	}
+}
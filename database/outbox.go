@@ -0,0 +1,209 @@
+package database
+
+import (
+	"context"
+	"ec-platform/models"
+	"encoding/json"
+	"errors"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+var (
+	ErrOutboxEventNotFound = errors.New("outbox event not found")
+)
+
+// OutboxHandler обрабатывает событие outbox. Ошибка - событие будет доставлено повторно
+type OutboxHandler func(ctx context.Context, event models.OutboxEvent) error
+
+// колонки события в порядке сканирования scanOutboxEvent
+const outboxColumns = `
+	id, event_type, aggregate_id, payload, status, attempts, last_error, next_attempt_at, created_at, delivered_at
+`
+
+func scanOutboxEvent(row pgx.Row, event *models.OutboxEvent) error {
+	return row.Scan(
+		&event.ID,
+		&event.Event_Type,
+		&event.Aggregate_ID,
+		&event.Payload,
+		&event.Status,
+		&event.Attempts,
+		&event.Last_Error,
+		&event.Next_Attempt_At,
+		&event.Created_At,
+		&event.Delivered_At,
+	)
+}
+
+// записывает доменное событие в outbox в транзакции изменения данных:
+// событие публикуется тогда и только тогда, когда транзакция зафиксирована
+func enqueueEvent(ctx context.Context, tx pgx.Tx, eventType string, aggregateID uuid.UUID, payload interface{}) error {
+	data, err := json.Marshal(payload)
+
+	if err != nil {
+		return err
+	}
+
+	_, err = tx.Exec(ctx,
+		"INSERT INTO outbox (event_type, aggregate_id, payload, created_at, next_attempt_at) VALUES ($1, $2, $3, $4, $4)",
+		eventType, aggregateID, data, time.Now().UTC())
+
+	return err
+}
+
+// события переходов статуса заказа: order.placed при создании, order.status_changed при каждом
+// переходе и дополнительно order.cancelled при отмене
+func enqueueOrderEvents(ctx context.Context, tx pgx.Tx, orderID uuid.UUID, from *string, to string, actor string, note string) error {
+	event := models.OrderEvent{
+		Order_ID:    orderID,
+		Status:      to,
+		From_Status: from,
+		Actor:       actor,
+		Note:        note,
+	}
+
+	err := tx.QueryRow(ctx, "SELECT user_id, total_price, currency FROM orders WHERE order_id = $1", orderID).Scan(&event.User_ID, &event.Total, &event.Currency)
+
+	if err != nil {
+		return err
+	}
+
+	if from == nil {
+		return enqueueEvent(ctx, tx, models.EventOrderPlaced, orderID, event)
+	}
+
+	if err := enqueueEvent(ctx, tx, models.EventOrderStatusChanged, orderID, event); err != nil {
+		return err
+	}
+
+	if to == models.OrderStatusCancelled {
+		return enqueueEvent(ctx, tx, models.EventOrderCancelled, orderID, event)
+	}
+
+	return nil
+}
+
+// выбирает до batch готовых к доставке событий (FOR UPDATE SKIP LOCKED - несколько
+// dispatcher'ов не получат одно событие) и передает их handle. Успешно обработанные
+// помечаются delivered, остальные переносятся на backoff(попытка) или, после maxAttempts, - failed.
+// Возвращает количество выбранных событий
+func DispatchOutbox(ctx context.Context, db *pgxpool.Pool, batch int, maxAttempts int, backoff func(attempt int) time.Duration, handle OutboxHandler) (int, error) {
+	tx, err := db.Begin(ctx)
+
+	if err != nil {
+		return 0, err
+	}
+
+	defer tx.Rollback(ctx)
+
+	rows, err := tx.Query(ctx, "SELECT "+outboxColumns+` FROM outbox
+		WHERE status = $1 AND next_attempt_at <= $2
+		ORDER BY id
+		LIMIT $3
+		FOR UPDATE SKIP LOCKED`, models.OutboxStatusPending, time.Now().UTC(), batch)
+
+	if err != nil {
+		return 0, err
+	}
+
+	var events []models.OutboxEvent
+
+	for rows.Next() {
+		var event models.OutboxEvent
+
+		if err := scanOutboxEvent(rows, &event); err != nil {
+			rows.Close()
+			return 0, err
+		}
+
+		events = append(events, event)
+	}
+
+	rows.Close()
+
+	if err := rows.Err(); err != nil {
+		return 0, err
+	}
+
+	for _, event := range events {
+		handleErr := handle(ctx, event)
+		now := time.Now().UTC()
+
+		if handleErr == nil {
+			_, err = tx.Exec(ctx,
+				"UPDATE outbox SET status = $1, attempts = attempts + 1, last_error = NULL, delivered_at = $2 WHERE id = $3",
+				models.OutboxStatusDelivered, now, event.ID)
+
+		} else {
+			attempts := event.Attempts + 1
+			status := models.OutboxStatusPending
+
+			if attempts >= maxAttempts {
+				status = models.OutboxStatusFailed
+			}
+
+			_, err = tx.Exec(ctx,
+				"UPDATE outbox SET status = $1, attempts = $2, last_error = $3, next_attempt_at = $4 WHERE id = $5",
+				status, attempts, handleErr.Error(), now.Add(backoff(attempts)), event.ID)
+		}
+
+		if err != nil {
+			return 0, err
+		}
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		return 0, err
+	}
+
+	return len(events), nil
+}
+
+// возвращает события outbox в указанном статусе (пустой - в любом), новые сверху
+func GetOutboxEvents(ctx context.Context, db *pgxpool.Pool, status string, limit int) ([]models.OutboxEvent, error) {
+	rows, err := db.Query(ctx, "SELECT "+outboxColumns+` FROM outbox
+		WHERE $1 = '' OR status = $1
+		ORDER BY id DESC
+		LIMIT $2`, status, limit)
+
+	if err != nil {
+		return nil, err
+	}
+
+	defer rows.Close()
+
+	events := make([]models.OutboxEvent, 0)
+
+	for rows.Next() {
+		var event models.OutboxEvent
+
+		if err := scanOutboxEvent(rows, &event); err != nil {
+			return nil, err
+		}
+
+		events = append(events, event)
+	}
+
+	return events, rows.Err()
+}
+
+// возвращает событие в очередь доставки (например, failed после исправления обработчика)
+func RetryOutboxEvent(ctx context.Context, db *pgxpool.Pool, id int64) error {
+	result, err := db.Exec(ctx,
+		"UPDATE outbox SET status = $1, attempts = 0, next_attempt_at = $2 WHERE id = $3",
+		models.OutboxStatusPending, time.Now().UTC(), id)
+
+	if err != nil {
+		return err
+	}
+
+	if result.RowsAffected() == 0 {
+		return ErrOutboxEventNotFound
+	}
+
+	return nil
+}
@@ -0,0 +1,620 @@
+package database
+
+import (
+	"context"
+	"ec-platform/models"
+	"errors"
+	"log"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+var (
+	ErrPaymentNotFound    = errors.New("payment not found")
+	ErrPaymentNotCaptured = errors.New("order has no captured payment")
+	ErrPaymentRequired    = errors.New("order must be paid or cash on delivery")
+	ErrOrderNotPayable    = errors.New("order is not awaiting payment")
+	ErrRefundExceedsPaid  = errors.New("refund amount exceeds paid amount")
+	ErrPaymentInProgress  = errors.New("order already has an active payment")
+)
+
+// причина, с которой не списанные платежи отмененного заказа помечаются failed
+const paymentVoidedReason = "order cancelled"
+
+// статусы платежа, при которых новая попытка оплаты того же заказа запрещена
+var activePaymentStatuses = []string{
+	models.PaymentStatusCreated,
+	models.PaymentStatusPending,
+	models.PaymentStatusRequiresCapture,
+	models.PaymentStatusCaptured,
+}
+
+// колонки платежа в порядке сканирования scanPayment
+const paymentColumns = `
+	payment_id, order_id, provider, intent_id, status, amount, currency, refunded_amount, error, created_at, updated_at
+`
+
+func scanPayment(row pgx.Row, payment *models.PaymentAttempt) error {
+	return row.Scan(
+		&payment.Payment_ID,
+		&payment.Order_ID,
+		&payment.Provider,
+		&payment.Intent_ID,
+		&payment.Status,
+		&payment.Amount,
+		&payment.Currency,
+		&payment.Refunded_Amount,
+		&payment.Error,
+		&payment.Created_At,
+		&payment.Updated_At,
+	)
+}
+
+// записывает новую попытку оплаты заказа пользователя до обращения к провайдеру.
+// Сумма и валюта берутся из заказа; оплатить можно только заказ в статусе pending без активного платежа.
+// Заказ блокируется, чтобы параллельные запросы не создали две попытки оплаты
+func CreatePayment(ctx context.Context, db *pgxpool.Pool, userID string, orderID uuid.UUID, provider string) (*models.PaymentAttempt, error) {
+	tx, err := db.Begin(ctx)
+
+	if err != nil {
+		return nil, err
+	}
+
+	defer tx.Rollback(ctx)
+
+	var status, orderCurrency string
+	var total models.Money
+
+	err = tx.QueryRow(ctx,
+		"SELECT status, total_price, currency FROM orders WHERE order_id = $1 AND user_id = $2 FOR UPDATE",
+		orderID, userID).Scan(&status, &total, &orderCurrency)
+
+	if err == pgx.ErrNoRows {
+		return nil, ErrOrderNotFound
+	}
+
+	if err != nil {
+		return nil, err
+	}
+
+	if status != models.OrderStatusPending {
+		return nil, ErrOrderNotPayable
+	}
+
+	var active bool
+
+	err = tx.QueryRow(ctx,
+		"SELECT EXISTS(SELECT 1 FROM payments WHERE order_id = $1 AND status = ANY($2))",
+		orderID, activePaymentStatuses).Scan(&active)
+
+	if err != nil {
+		return nil, err
+	}
+
+	if active {
+		return nil, ErrPaymentInProgress
+	}
+
+	now := time.Now().UTC()
+
+	payment := models.PaymentAttempt{
+		Payment_ID: uuid.New(),
+		Order_ID:   orderID,
+		Provider:   provider,
+		Status:     models.PaymentStatusCreated,
+		Amount:     total,
+		Currency:   orderCurrency,
+		Created_At: now,
+		Updated_At: now,
+	}
+
+	_, err = tx.Exec(ctx, `
+		INSERT INTO payments (payment_id, order_id, provider, status, amount, currency, created_at, updated_at)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8)
+	`, payment.Payment_ID, payment.Order_ID, payment.Provider, payment.Status, payment.Amount, payment.Currency, now, now)
+
+	if isUniqueViolation(err) {
+		return nil, ErrPaymentInProgress
+	}
+
+	if err != nil {
+		return nil, err
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		return nil, err
+	}
+
+	return &payment, nil
+}
+
+// сохраняет идентификатор платежа у провайдера и его статус. Если заказ отменили, пока провайдер
+// создавал платеж, статус остается failed и возвращается ErrOrderNotPayable - платеж нужно отменить у провайдера
+func UpdatePaymentIntent(ctx context.Context, db *pgxpool.Pool, paymentID uuid.UUID, intentID string, status string) error {
+	var saved string
+
+	err := db.QueryRow(ctx, `
+		UPDATE payments SET intent_id = $1, status = CASE WHEN status = $5 THEN $2 ELSE status END, updated_at = $3
+		WHERE payment_id = $4
+		RETURNING status
+	`, intentID, status, time.Now().UTC(), paymentID, models.PaymentStatusCreated).Scan(&saved)
+
+	if err == pgx.ErrNoRows {
+		return ErrPaymentNotFound
+	}
+
+	if err != nil {
+		return err
+	}
+
+	if saved != status {
+		return ErrOrderNotPayable
+	}
+
+	return nil
+}
+
+// помечает попытку оплаты неуспешной
+func FailPayment(ctx context.Context, db *pgxpool.Pool, paymentID uuid.UUID, reason string) error {
+	result, err := db.Exec(ctx,
+		"UPDATE payments SET status = $1, error = $2, updated_at = $3 WHERE payment_id = $4 AND status <> $5",
+		models.PaymentStatusFailed, reason, time.Now().UTC(), paymentID, models.PaymentStatusCaptured)
+
+	if err != nil {
+		return err
+	}
+
+	if result.RowsAffected() == 0 {
+		return ErrPaymentNotFound
+	}
+
+	return nil
+}
+
+// статусы платежа, из которых допустимо списание: в том числе failed - провайдер мог списать
+// средства уже после нашего отказа (поздний webhook)
+var capturablePaymentStatuses = []string{
+	models.PaymentStatusCreated,
+	models.PaymentStatusPending,
+	models.PaymentStatusRequiresCapture,
+	models.PaymentStatusFailed,
+}
+
+// можно ли зафиксировать списание платежа в статусе status
+func isCapturable(status string) bool {
+	for _, capturable := range capturablePaymentStatuses {
+		if capturable == status {
+			return true
+		}
+	}
+
+	return false
+}
+
+// фиксирует подтвержденное списание и переводит ожидающий оплаты заказ в paid.
+// Повторное подтверждение того же платежа ничего не меняет; списание по отмененному
+// или возвращенному заказу сразу возвращается через refund (после коммита)
+func CapturePayment(ctx context.Context, db *pgxpool.Pool, paymentID uuid.UUID, actor string, refund RefundFunc) error {
+	tx, err := db.Begin(ctx)
+
+	if err != nil {
+		return err
+	}
+
+	defer tx.Rollback(ctx)
+
+	payment, orderStatus, err := lockPayment(ctx, tx, paymentID)
+
+	if err != nil {
+		return err
+	}
+
+	refunds, err := capturePayment(ctx, tx, *payment, orderStatus, actor)
+
+	if err != nil {
+		return err
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		return err
+	}
+
+	settleRefunds(ctx, db, refunds, refund)
+
+	return nil
+}
+
+// блокирует заказ платежа, затем сам платеж - в том же порядке, что отмена и смена статуса заказа.
+// Возвращает платеж и статус заказа
+func lockPayment(ctx context.Context, tx pgx.Tx, paymentID uuid.UUID) (*models.PaymentAttempt, string, error) {
+	var orderID uuid.UUID
+
+	err := tx.QueryRow(ctx, "SELECT order_id FROM payments WHERE payment_id = $1", paymentID).Scan(&orderID)
+
+	if err == pgx.ErrNoRows {
+		return nil, "", ErrPaymentNotFound
+	}
+
+	if err != nil {
+		return nil, "", err
+	}
+
+	var orderStatus string
+
+	err = tx.QueryRow(ctx, "SELECT status FROM orders WHERE order_id = $1 FOR UPDATE", orderID).Scan(&orderStatus)
+
+	if err != nil {
+		return nil, "", err
+	}
+
+	var payment models.PaymentAttempt
+
+	err = scanPayment(tx.QueryRow(ctx, "SELECT "+paymentColumns+" FROM payments WHERE payment_id = $1 FOR UPDATE", paymentID), &payment)
+
+	if err != nil {
+		return nil, "", err
+	}
+
+	return &payment, orderStatus, nil
+}
+
+// фиксирует списание внутри транзакции; заказ и платеж уже заблокированы (lockPayment).
+// Уже списанный или возвращенный платеж не меняется. Если заказ отменен или возвращен,
+// счет не выставляется, а вся сумма записывается на возврат - провайдеру он уходит после коммита
+func capturePayment(ctx context.Context, tx pgx.Tx, payment models.PaymentAttempt, orderStatus string, actor string) ([]models.Refund, error) {
+	if !isCapturable(payment.Status) {
+		return nil, nil
+	}
+
+	_, err := tx.Exec(ctx,
+		"UPDATE payments SET status = $1, error = NULL, updated_at = $2 WHERE payment_id = $3",
+		models.PaymentStatusCaptured, time.Now().UTC(), payment.Payment_ID)
+
+	if err != nil {
+		return nil, err
+	}
+
+	payment.Status = models.PaymentStatusCaptured
+	payment.Error = nil
+
+	if orderStatus == models.OrderStatusCancelled || orderStatus == models.OrderStatusRefunded {
+		pending, err := pendingRefunds(ctx, tx, payment.Order_ID)
+
+		if err != nil {
+			return nil, err
+		}
+
+		left, err := refundable(payment, pending)
+
+		if err != nil {
+			return nil, err
+		}
+
+		return requestRefunds(ctx, tx, []models.PaymentAttempt{payment}, pending, left, actor)
+	}
+
+	// Счет выставляется при первом подтвержденном списании по заказу
+	if _, err := issueInvoice(ctx, tx, payment.Order_ID); err != nil {
+		return nil, err
+	}
+
+	// Наличные при получении списываются после отправки - статус такого заказа не меняем
+	if orderStatus == models.OrderStatusPending {
+		if _, err := transitionOrderStatus(ctx, tx, payment.Order_ID, models.OrderStatusPaid, actor, "payment captured"); err != nil {
+			return nil, err
+		}
+	}
+
+	return nil, nil
+}
+
+// возвращает платеж по идентификатору
+func GetPayment(ctx context.Context, db *pgxpool.Pool, paymentID uuid.UUID) (*models.PaymentAttempt, error) {
+	var payment models.PaymentAttempt
+
+	err := scanPayment(db.QueryRow(ctx, "SELECT "+paymentColumns+" FROM payments WHERE payment_id = $1", paymentID), &payment)
+
+	if err == pgx.ErrNoRows {
+		return nil, ErrPaymentNotFound
+	}
+
+	if err != nil {
+		return nil, err
+	}
+
+	return &payment, nil
+}
+
+// возвращает все попытки оплаты заказа в порядке создания
+func GetOrderPayments(ctx context.Context, db *pgxpool.Pool, orderID uuid.UUID) ([]models.PaymentAttempt, error) {
+	rows, err := db.Query(ctx, "SELECT "+paymentColumns+" FROM payments WHERE order_id = $1 ORDER BY created_at", orderID)
+
+	if err != nil {
+		return nil, err
+	}
+
+	defer rows.Close()
+
+	payments := make([]models.PaymentAttempt, 0)
+
+	for rows.Next() {
+		var payment models.PaymentAttempt
+
+		if err := scanPayment(rows, &payment); err != nil {
+			return nil, err
+		}
+
+		payments = append(payments, payment)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return payments, nil
+}
+
+// возвращает списанные платежи заказа с блокировкой строк (для возврата внутри транзакции)
+func lockCapturedPayments(ctx context.Context, tx pgx.Tx, orderID uuid.UUID) ([]models.PaymentAttempt, error) {
+	rows, err := tx.Query(ctx, "SELECT "+paymentColumns+` FROM payments
+		WHERE order_id = $1 AND status IN ($2, $3)
+		ORDER BY created_at
+		FOR UPDATE`, orderID, models.PaymentStatusCaptured, models.PaymentStatusPartiallyRefunded)
+
+	if err != nil {
+		return nil, err
+	}
+
+	defer rows.Close()
+
+	var payments []models.PaymentAttempt
+
+	for rows.Next() {
+		var payment models.PaymentAttempt
+
+		if err := scanPayment(rows, &payment); err != nil {
+			return nil, err
+		}
+
+		payments = append(payments, payment)
+	}
+
+	return payments, rows.Err()
+}
+
+// помечает failed платежи отменяемого заказа, которые еще не списаны (наличные, блокировка средств,
+// оплата в процессе): после этого их не спишут ни сотрудник, ни webhook без возврата.
+// Возвращает платежи, которые нужно отменить у провайдера после коммита (settleVoids)
+func voidOrderPayments(ctx context.Context, tx pgx.Tx, orderID uuid.UUID) ([]models.PaymentAttempt, error) {
+	rows, err := tx.Query(ctx, `
+		UPDATE payments SET status = $1, error = $2, updated_at = $3
+		WHERE order_id = $4 AND status IN ($5, $6, $7)
+		RETURNING `+paymentColumns,
+		models.PaymentStatusFailed, paymentVoidedReason, time.Now().UTC(), orderID,
+		models.PaymentStatusCreated, models.PaymentStatusPending, models.PaymentStatusRequiresCapture)
+
+	if err != nil {
+		return nil, err
+	}
+
+	defer rows.Close()
+
+	var voided []models.PaymentAttempt
+
+	for rows.Next() {
+		var payment models.PaymentAttempt
+
+		if err := scanPayment(rows, &payment); err != nil {
+			return nil, err
+		}
+
+		voided = append(voided, payment)
+	}
+
+	return voided, rows.Err()
+}
+
+// отменяет у провайдера платежи, помеченные voidOrderPayments. Платеж без intent_id еще создается -
+// его отменит сама оплата, получив ErrOrderNotPayable от UpdatePaymentIntent
+func settleVoids(ctx context.Context, voided []models.PaymentAttempt, void VoidFunc) {
+	if void == nil {
+		return
+	}
+
+	for _, payment := range voided {
+		if payment.Intent_ID == nil {
+			continue
+		}
+
+		if err := void(ctx, payment); err != nil {
+			log.Printf("error voiding payment %s: %v", payment.Payment_ID, err)
+		}
+	}
+}
+
+// учитывает возврат по платежу внутри транзакции и выставляет на него корректировочный счет
+func recordRefund(ctx context.Context, tx pgx.Tx, payment models.PaymentAttempt, amount models.Money) error {
+	refunded, err := payment.Refunded_Amount.Add(amount)
+
+	if err != nil {
+		return err
+	}
+
+	status := models.PaymentStatusPartiallyRefunded
+
+	if refunded >= payment.Amount {
+		status = models.PaymentStatusRefunded
+	}
+
+	_, err = tx.Exec(ctx,
+		"UPDATE payments SET refunded_amount = refunded_amount + $1, status = $2, updated_at = $3 WHERE payment_id = $4",
+		amount, status, time.Now().UTC(), payment.Payment_ID)
+
+	if err != nil {
+		return err
+	}
+
+	_, err = issueCreditNote(ctx, tx, payment, amount)
+
+	return err
+}
+
+// записывает возврат остатка всех списанных платежей заказа в pending (см. requestRefunds)
+func refundOrderPayments(ctx context.Context, tx pgx.Tx, orderID uuid.UUID, actor string) ([]models.Refund, error) {
+	payments, err := lockCapturedPayments(ctx, tx, orderID)
+
+	if err != nil {
+		return nil, err
+	}
+
+	pending, err := pendingRefunds(ctx, tx, orderID)
+
+	if err != nil {
+		return nil, err
+	}
+
+	remaining, err := remainingPaid(payments, pending)
+
+	if err != nil {
+		return nil, err
+	}
+
+	return requestRefunds(ctx, tx, payments, pending, remaining, actor)
+}
+
+// частичный возврат суммы amount по списанным платежам заказа (например, по заявке на возврат)
+func refundOrderAmount(ctx context.Context, tx pgx.Tx, orderID uuid.UUID, amount models.Money, actor string) ([]models.Refund, error) {
+	payments, err := lockCapturedPayments(ctx, tx, orderID)
+
+	if err != nil {
+		return nil, err
+	}
+
+	pending, err := pendingRefunds(ctx, tx, orderID)
+
+	if err != nil {
+		return nil, err
+	}
+
+	remaining, err := remainingPaid(payments, pending)
+
+	if err != nil {
+		return nil, err
+	}
+
+	if amount > remaining {
+		return nil, ErrRefundExceedsPaid
+	}
+
+	return requestRefunds(ctx, tx, payments, pending, amount, actor)
+}
+
+// сумма, которую еще можно вернуть по платежу: без учтенных и еще не подтвержденных возвратов
+func refundable(payment models.PaymentAttempt, pending map[uuid.UUID]models.Money) (models.Money, error) {
+	left, err := payment.Amount.Sub(payment.Refunded_Amount)
+
+	if err != nil {
+		return 0, err
+	}
+
+	return left.Sub(pending[payment.Payment_ID])
+}
+
+// сумма, которую еще можно вернуть по платежам
+func remainingPaid(payments []models.PaymentAttempt, pending map[uuid.UUID]models.Money) (models.Money, error) {
+	var remaining models.Money
+
+	for _, payment := range payments {
+		left, err := refundable(payment, pending)
+
+		if err != nil {
+			return 0, err
+		}
+
+		if remaining, err = remaining.Add(left); err != nil {
+			return 0, err
+		}
+	}
+
+	return remaining, nil
+}
+
+// распределяет amount по платежам по порядку их создания и записывает возвраты в pending.
+// Провайдер вызывается только после коммита транзакции (settleRefunds)
+func requestRefunds(ctx context.Context, tx pgx.Tx, payments []models.PaymentAttempt, pending map[uuid.UUID]models.Money, amount models.Money, actor string) ([]models.Refund, error) {
+	var refunds []models.Refund
+
+	for _, payment := range payments {
+		if amount == 0 {
+			break
+		}
+
+		left, err := refundable(payment, pending)
+
+		if err != nil {
+			return nil, err
+		}
+
+		part := min(left, amount)
+
+		if part == 0 {
+			continue
+		}
+
+		refund, err := insertRefund(ctx, tx, payment, part, actor)
+
+		if err != nil {
+			return nil, err
+		}
+
+		refunds = append(refunds, *refund)
+
+		if amount, err = amount.Sub(part); err != nil {
+			return nil, err
+		}
+	}
+
+	return refunds, nil
+}
+
+// дополнительные условия переходов статуса, зависящие от оплаты заказа
+func checkPaymentGuards(ctx context.Context, tx pgx.Tx, orderID uuid.UUID, from string, to string) error {
+	switch {
+	// paid - только после подтвержденного списания
+	case to == models.OrderStatusPaid:
+		var captured bool
+
+		err := tx.QueryRow(ctx,
+			"SELECT EXISTS(SELECT 1 FROM payments WHERE order_id = $1 AND status = $2)",
+			orderID, models.PaymentStatusCaptured).Scan(&captured)
+
+		if err != nil {
+			return err
+		}
+
+		if !captured {
+			return ErrPaymentNotCaptured
+		}
+
+	// неоплаченный заказ собирается только при оплате наличными при получении
+	case from == models.OrderStatusPending && to == models.OrderStatusPacked:
+		var cashOnDelivery bool
+
+		err := tx.QueryRow(ctx,
+			"SELECT EXISTS(SELECT 1 FROM payments WHERE order_id = $1 AND provider = $2 AND status = $3)",
+			orderID, models.PaymentProviderCOD, models.PaymentStatusPending).Scan(&cashOnDelivery)
+
+		if err != nil {
+			return err
+		}
+
+		if !cashOnDelivery {
+			return ErrPaymentRequired
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,339 @@
+package database
+
+import (
+	"context"
+	"ec-platform/models"
+	"ec-platform/payments"
+	"errors"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+var (
+	ErrPaymentEventNotFound = errors.New("payment event not found")
+	ErrUnknownPaymentEvent  = errors.New("unknown payment event type")
+)
+
+// сохраняет входящее событие провайдера. duplicate = true, если событие с таким event_id уже было
+func StorePaymentEvent(ctx context.Context, db *pgxpool.Pool, provider string, event *payments.Event, payload []byte) (id int64, duplicate bool, err error) {
+	var intentID *string
+
+	if event.IntentID != "" {
+		intentID = &event.IntentID
+	}
+
+	err = db.QueryRow(ctx, `
+		INSERT INTO payment_events (provider, event_id, event_type, intent_id, amount, payload, status, received_at)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8)
+		ON CONFLICT (provider, event_id) DO NOTHING
+		RETURNING id
+	`, provider, event.ID, event.Type, intentID, event.Amount, payload, models.PaymentEventReceived, time.Now().UTC()).Scan(&id)
+
+	if err == pgx.ErrNoRows {
+		return 0, true, nil
+	}
+
+	if err != nil {
+		return 0, false, err
+	}
+
+	return id, false, nil
+}
+
+// применяет событие к платежу и заказу. Если применить нельзя (неизвестный тип,
+// платеж еще не записан, возврат раньше списания), событие откладывается (deferred) для повтора.
+// Списание по отмененному заказу возвращается через refund после коммита.
+// Возвращает итоговый статус события
+func ApplyPaymentEvent(ctx context.Context, db *pgxpool.Pool, id int64, refund RefundFunc) (string, error) {
+	tx, err := db.Begin(ctx)
+
+	if err != nil {
+		return "", err
+	}
+
+	defer tx.Rollback(ctx)
+
+	var provider, eventType, status string
+	var intentID *string
+	var amount models.Money
+
+	err = tx.QueryRow(ctx,
+		"SELECT provider, event_type, intent_id, amount, status FROM payment_events WHERE id = $1 FOR UPDATE",
+		id).Scan(&provider, &eventType, &intentID, &amount, &status)
+
+	if err == pgx.ErrNoRows {
+		return "", ErrPaymentEventNotFound
+	}
+
+	if err != nil {
+		return "", err
+	}
+
+	if status == models.PaymentEventProcessed {
+		return status, nil
+	}
+
+	// Изменения события применяются в точке сохранения, чтобы при отказе записать только статус события
+	savepoint, err := tx.Begin(ctx)
+
+	if err != nil {
+		return "", err
+	}
+
+	refunds, applyErr := applyPaymentEvent(ctx, savepoint, provider, eventType, intentID, amount)
+
+	var lastError *string
+
+	if applyErr != nil {
+		if err := savepoint.Rollback(ctx); err != nil {
+			return "", err
+		}
+
+		message := applyErr.Error()
+		lastError = &message
+		status = models.PaymentEventDeferred
+		refunds = nil
+
+	} else {
+		if err := savepoint.Commit(ctx); err != nil {
+			return "", err
+		}
+
+		status = models.PaymentEventProcessed
+	}
+
+	_, err = tx.Exec(ctx, `
+		UPDATE payment_events
+		SET status = $1, attempts = attempts + 1, last_error = $2,
+			processed_at = CASE WHEN $1 = 'processed' THEN $3::timestamp ELSE NULL END
+		WHERE id = $4
+	`, status, lastError, time.Now().UTC(), id)
+
+	if err != nil {
+		return "", err
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		return "", err
+	}
+
+	settleRefunds(ctx, db, refunds, refund)
+
+	return status, nil
+}
+
+func applyPaymentEvent(ctx context.Context, tx pgx.Tx, provider string, eventType string, intentID *string, amount models.Money) ([]models.Refund, error) {
+	switch eventType {
+	case payments.EventPaymentCaptured, payments.EventPaymentFailed, payments.EventPaymentRefunded:
+	default:
+		return nil, ErrUnknownPaymentEvent
+	}
+
+	if intentID == nil {
+		return nil, ErrPaymentNotFound
+	}
+
+	// Событие может прийти раньше, чем платеж сохранен после ответа провайдера
+	var paymentID uuid.UUID
+
+	err := tx.QueryRow(ctx,
+		"SELECT payment_id FROM payments WHERE provider = $1 AND intent_id = $2",
+		provider, *intentID).Scan(&paymentID)
+
+	if err == pgx.ErrNoRows {
+		return nil, ErrPaymentNotFound
+	}
+
+	if err != nil {
+		return nil, err
+	}
+
+	payment, orderStatus, err := lockPayment(ctx, tx, paymentID)
+
+	if err != nil {
+		return nil, err
+	}
+
+	actor := "webhook:" + provider
+
+	// Платеж уже списан (и, возможно, возвращен)
+	settled := payment.Status == models.PaymentStatusCaptured ||
+		payment.Status == models.PaymentStatusPartiallyRefunded ||
+		payment.Status == models.PaymentStatusRefunded
+
+	switch eventType {
+	case payments.EventPaymentCaptured:
+		// Повтор списания с новым event_id (дедупликация его не отсекает) ничего не меняет:
+		// иначе возвращенный платеж снова стал бы captured со вторым счетом
+		if settled {
+			return nil, nil
+		}
+
+		return capturePayment(ctx, tx, *payment, orderStatus, actor)
+
+	case payments.EventPaymentFailed:
+		// Отказ после списания - устаревшее событие, платеж не меняем
+		if settled {
+			return nil, nil
+		}
+
+		_, err := tx.Exec(ctx,
+			"UPDATE payments SET status = $1, error = $2, updated_at = $3 WHERE payment_id = $4",
+			models.PaymentStatusFailed, "declined by provider", time.Now().UTC(), payment.Payment_ID)
+
+		return nil, err
+
+	default:
+		return nil, applyRefundEvent(ctx, tx, *payment, amount, actor)
+	}
+}
+
+// учитывает возврат из события: amount - общая сумма возвратов по платежу,
+// поэтому уже учтенные возвраты (в том числе инициированные нами) не задваиваются
+func applyRefundEvent(ctx context.Context, tx pgx.Tx, payment models.PaymentAttempt, refundedTotal models.Money, actor string) error {
+	if payment.Status != models.PaymentStatusCaptured &&
+		payment.Status != models.PaymentStatusPartiallyRefunded &&
+		payment.Status != models.PaymentStatusRefunded {
+		return ErrPaymentNotCaptured
+	}
+
+	if refundedTotal > payment.Amount {
+		refundedTotal = payment.Amount
+	}
+
+	// Наши возвраты, отправленные провайдеру, но еще не учтенные, уже входят в общую сумму -
+	// их учтет completeRefund
+	pending, err := pendingRefunds(ctx, tx, payment.Order_ID)
+
+	if err != nil {
+		return err
+	}
+
+	recorded, err := payment.Refunded_Amount.Add(pending[payment.Payment_ID])
+
+	if err != nil {
+		return err
+	}
+
+	if refundedTotal > recorded {
+		amount, err := refundedTotal.Sub(recorded)
+
+		if err != nil {
+			return err
+		}
+
+		if err := recordRefund(ctx, tx, payment, amount); err != nil {
+			return err
+		}
+	}
+
+	if refundedTotal < payment.Amount {
+		return nil
+	}
+
+	// Полный возврат переводит заказ в refunded, если это допустимо (отмененный заказ не трогаем)
+	var orderStatus string
+
+	err = tx.QueryRow(ctx, "SELECT status FROM orders WHERE order_id = $1 FOR UPDATE", payment.Order_ID).Scan(&orderStatus)
+
+	if err != nil {
+		return err
+	}
+
+	if !CanTransitionOrder(orderStatus, models.OrderStatusRefunded) {
+		return nil
+	}
+
+	_, err = transitionOrderStatus(ctx, tx, payment.Order_ID, models.OrderStatusRefunded, actor, "refunded by provider")
+
+	return err
+}
+
+// повторно применяет отложенные события и события, которые сохранены, но не применены
+// (ошибка БД или сбой процесса между сохранением и применением). Пустые provider и intentID - все такие события.
+// Возвращает количество обработанных и оставшихся отложенными событий
+func ReplayPaymentEvents(ctx context.Context, db *pgxpool.Pool, provider string, intentID string, refund RefundFunc) (processed int, deferred int, err error) {
+	rows, err := db.Query(ctx, `
+		SELECT id FROM payment_events
+		WHERE status IN ($1, $2) AND ($3 = '' OR provider = $3) AND ($4 = '' OR intent_id = $4)
+		ORDER BY id
+		LIMIT 500
+	`, models.PaymentEventDeferred, models.PaymentEventReceived, provider, intentID)
+
+	if err != nil {
+		return 0, 0, err
+	}
+
+	var ids []int64
+
+	for rows.Next() {
+		var id int64
+
+		if err := rows.Scan(&id); err != nil {
+			rows.Close()
+			return 0, 0, err
+		}
+
+		ids = append(ids, id)
+	}
+
+	rows.Close()
+
+	if err := rows.Err(); err != nil {
+		return 0, 0, err
+	}
+
+	// По порядку получения: списание должно примениться раньше возврата
+	for _, id := range ids {
+		status, err := ApplyPaymentEvent(ctx, db, id, refund)
+
+		if err != nil {
+			return processed, deferred, err
+		}
+
+		if status == models.PaymentEventProcessed {
+			processed++
+		} else {
+			deferred++
+		}
+	}
+
+	return processed, deferred, nil
+}
+
+// возвращает события провайдеров в указанном статусе (пустой - в любом), новые сверху
+func GetPaymentEvents(ctx context.Context, db *pgxpool.Pool, status string, limit int) ([]models.PaymentEvent, error) {
+	rows, err := db.Query(ctx, `
+		SELECT id, provider, event_id, event_type, intent_id, amount, status, attempts, last_error, received_at, processed_at
+		FROM payment_events
+		WHERE $1 = '' OR status = $1
+		ORDER BY id DESC
+		LIMIT $2
+	`, status, limit)
+
+	if err != nil {
+		return nil, err
+	}
+
+	defer rows.Close()
+
+	events := make([]models.PaymentEvent, 0)
+
+	for rows.Next() {
+		var event models.PaymentEvent
+
+		err := rows.Scan(&event.ID, &event.Provider, &event.Event_ID, &event.Event_Type, &event.Intent_ID, &event.Amount,
+			&event.Status, &event.Attempts, &event.Last_Error, &event.Received_At, &event.Processed_At)
+
+		if err != nil {
+			return nil, err
+		}
+
+		events = append(events, event)
+	}
+
+	return events, rows.Err()
+}
@@ -0,0 +1,63 @@
+package database
+
+import (
+	"context"
+	"ec-platform/models"
+	"ec-platform/payments"
+
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+// PaymentStore - попытки оплаты и входящие события провайдеров, с которыми работают проведение
+// платежа и прием webhook. PgPaymentStore хранит их в таблицах payments и payment_events;
+// в тестах подменяется хранилищем в памяти
+type PaymentStore interface {
+	CreatePayment(ctx context.Context, userID string, orderID uuid.UUID, provider string) (*models.PaymentAttempt, error)
+	UpdatePaymentIntent(ctx context.Context, paymentID uuid.UUID, intentID string, status string) error
+	FailPayment(ctx context.Context, paymentID uuid.UUID, reason string) error
+	CapturePayment(ctx context.Context, paymentID uuid.UUID, actor string) error
+
+	StorePaymentEvent(ctx context.Context, provider string, event *payments.Event, payload []byte) (id int64, duplicate bool, err error)
+	ApplyPaymentEvent(ctx context.Context, id int64) (string, error)
+	ReplayPaymentEvents(ctx context.Context, provider string, intentID string) (processed int, deferred int, err error)
+}
+
+// PgPaymentStore - PaymentStore поверх функций пакета для пула соединений.
+// refund возвращает списания по уже отмененным заказам
+type PgPaymentStore struct {
+	db     *pgxpool.Pool
+	refund RefundFunc
+}
+
+func NewPgPaymentStore(db *pgxpool.Pool, refund RefundFunc) *PgPaymentStore {
+	return &PgPaymentStore{db: db, refund: refund}
+}
+
+func (s *PgPaymentStore) CreatePayment(ctx context.Context, userID string, orderID uuid.UUID, provider string) (*models.PaymentAttempt, error) {
+	return CreatePayment(ctx, s.db, userID, orderID, provider)
+}
+
+func (s *PgPaymentStore) UpdatePaymentIntent(ctx context.Context, paymentID uuid.UUID, intentID string, status string) error {
+	return UpdatePaymentIntent(ctx, s.db, paymentID, intentID, status)
+}
+
+func (s *PgPaymentStore) FailPayment(ctx context.Context, paymentID uuid.UUID, reason string) error {
+	return FailPayment(ctx, s.db, paymentID, reason)
+}
+
+func (s *PgPaymentStore) CapturePayment(ctx context.Context, paymentID uuid.UUID, actor string) error {
+	return CapturePayment(ctx, s.db, paymentID, actor, s.refund)
+}
+
+func (s *PgPaymentStore) StorePaymentEvent(ctx context.Context, provider string, event *payments.Event, payload []byte) (int64, bool, error) {
+	return StorePaymentEvent(ctx, s.db, provider, event, payload)
+}
+
+func (s *PgPaymentStore) ApplyPaymentEvent(ctx context.Context, id int64) (string, error) {
+	return ApplyPaymentEvent(ctx, s.db, id, s.refund)
+}
+
+func (s *PgPaymentStore) ReplayPaymentEvents(ctx context.Context, provider string, intentID string) (int, int, error) {
+	return ReplayPaymentEvents(ctx, s.db, provider, intentID, s.refund)
+}
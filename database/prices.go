@@ -0,0 +1,393 @@
+package database
+
+import (
+	"context"
+	"ec-platform/models"
+	"errors"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+var (
+	ErrPriceScheduleNotFound = errors.New("price schedule not found")
+	ErrPriceScheduleOverlap  = errors.New("sale overlaps another sale of this product")
+	ErrPriceScheduleFinished = errors.New("price schedule has already ended, been applied or cancelled")
+	ErrPriceScheduleInPast   = errors.New("sale must end in the future")
+)
+
+// сколько плановых изменений цены переносится в products.price за одну транзакцию
+const applyPricesBatch = 500
+
+// колонки запланированной цены в порядке сканирования scanPriceSchedule
+const priceScheduleColumns = `
+	schedule_id, product_id, price, starts_at, ends_at, created_by, created_at, applied_at, cancelled_at
+`
+
+func scanPriceSchedule(row pgx.Row, schedule *models.PriceSchedule) error {
+	err := row.Scan(
+		&schedule.Schedule_ID,
+		&schedule.Product_ID,
+		&schedule.Price,
+		&schedule.Starts_At,
+		&schedule.Ends_At,
+		&schedule.Created_By,
+		&schedule.Created_At,
+		&schedule.Applied_At,
+		&schedule.Cancelled_At,
+	)
+
+	if err == nil {
+		schedule.Status = priceScheduleStatus(schedule, time.Now().UTC())
+	}
+
+	return err
+}
+
+func priceScheduleStatus(schedule *models.PriceSchedule, now time.Time) string {
+	switch {
+	case schedule.Cancelled_At != nil:
+		return models.PriceScheduleStatusCancelled
+
+	case schedule.Applied_At != nil:
+		return models.PriceScheduleStatusApplied
+
+	case now.Before(*schedule.Starts_At):
+		return models.PriceScheduleStatusScheduled
+
+	case schedule.Ends_At != nil && !now.Before(*schedule.Ends_At):
+		return models.PriceScheduleStatusEnded
+	}
+
+	return models.PriceScheduleStatusActive
+}
+
+// меняет базовую цену товара (изменение пишется в историю)
+func SetProductPrice(ctx context.Context, db *pgxpool.Pool, productID uuid.UUID, price models.Money, changedBy string) error {
+	tx, err := db.Begin(ctx)
+
+	if err != nil {
+		return err
+	}
+
+	defer tx.Rollback(ctx)
+
+	if err := setProductPrice(ctx, tx, productID, price, models.PriceSourceAdmin, changedBy); err != nil {
+		return err
+	}
+
+	return tx.Commit(ctx)
+}
+
+// меняет products.price под блокировкой строки товара; та же цена - ничего не делает
+func setProductPrice(ctx context.Context, tx pgx.Tx, productID uuid.UUID, price models.Money, source string, changedBy string) error {
+	var oldPrice models.Money
+
+	err := tx.QueryRow(ctx, "SELECT price FROM products WHERE product_id = $1 FOR UPDATE", productID).Scan(&oldPrice)
+
+	if err == pgx.ErrNoRows {
+		return ErrRecordNotFound
+	}
+
+	if err != nil {
+		return err
+	}
+
+	if oldPrice == price {
+		return nil
+	}
+
+	_, err = tx.Exec(ctx,
+		"UPDATE products SET price = $1, updated_at = $2 WHERE product_id = $3",
+		price, time.Now().UTC(), productID)
+
+	if err != nil {
+		return err
+	}
+
+	return recordPriceChange(ctx, tx, productID, &oldPrice, price, source, changedBy)
+}
+
+// пишет изменение базовой цены в историю; oldPrice nil - товар только что создан, changedBy "" - неизвестно кем
+func recordPriceChange(ctx context.Context, tx pgx.Tx, productID uuid.UUID, oldPrice *models.Money, newPrice models.Money, source string, changedBy string) error {
+	var by *string
+
+	if changedBy != "" {
+		by = &changedBy
+	}
+
+	_, err := tx.Exec(ctx, `
+		INSERT INTO product_price_history (product_id, old_price, new_price, source, changed_by, changed_at)
+		VALUES ($1, $2, $3, $4, $5, $6)
+	`, productID, oldPrice, newPrice, source, by, time.Now().UTC())
+
+	return err
+}
+
+// история базовой цены товара, новые изменения сверху
+func GetPriceHistory(ctx context.Context, db *pgxpool.Pool, productID uuid.UUID, limit int) ([]models.PriceChange, error) {
+	rows, err := db.Query(ctx, `
+		SELECT id, product_id, old_price, new_price, source, changed_by, changed_at
+		FROM product_price_history
+		WHERE product_id = $1
+		ORDER BY changed_at DESC, id DESC
+		LIMIT $2
+	`, productID, limit)
+
+	if err != nil {
+		return nil, err
+	}
+
+	defer rows.Close()
+
+	history := make([]models.PriceChange, 0)
+
+	for rows.Next() {
+		var change models.PriceChange
+
+		err := rows.Scan(&change.ID, &change.Product_ID, &change.Old_Price, &change.New_Price, &change.Source, &change.Changed_By, &change.Changed_At)
+
+		if err != nil {
+			return nil, err
+		}
+
+		history = append(history, change)
+	}
+
+	return history, rows.Err()
+}
+
+// планирует цену товара. Распродажи (с ends_at) одного товара не должны пересекаться
+func CreatePriceSchedule(ctx context.Context, db *pgxpool.Pool, schedule *models.PriceSchedule) error {
+	now := time.Now().UTC()
+
+	if schedule.Ends_At != nil && !schedule.Ends_At.After(now) {
+		return ErrPriceScheduleInPast
+	}
+
+	tx, err := db.Begin(ctx)
+
+	if err != nil {
+		return err
+	}
+
+	defer tx.Rollback(ctx)
+
+	// Блокируем товар, чтобы параллельные запросы не создали пересекающиеся распродажи
+	var locked uuid.UUID
+
+	err = tx.QueryRow(ctx, "SELECT product_id FROM products WHERE product_id = $1 FOR UPDATE", schedule.Product_ID).Scan(&locked)
+
+	if err == pgx.ErrNoRows {
+		return ErrRecordNotFound
+	}
+
+	if err != nil {
+		return err
+	}
+
+	if schedule.Ends_At != nil {
+		var overlaps bool
+
+		err = tx.QueryRow(ctx, `
+			SELECT EXISTS(
+				SELECT 1 FROM product_price_schedules
+				WHERE product_id = $1 AND cancelled_at IS NULL AND ends_at IS NOT NULL
+					AND starts_at < $3 AND ends_at > $2
+			)
+		`, schedule.Product_ID, schedule.Starts_At.UTC(), schedule.Ends_At.UTC()).Scan(&overlaps)
+
+		if err != nil {
+			return err
+		}
+
+		if overlaps {
+			return ErrPriceScheduleOverlap
+		}
+	}
+
+	schedule.Schedule_ID = uuid.New()
+	schedule.Created_At = now
+
+	startsAt := schedule.Starts_At.UTC()
+	schedule.Starts_At = &startsAt
+
+	if schedule.Ends_At != nil {
+		endsAt := schedule.Ends_At.UTC()
+		schedule.Ends_At = &endsAt
+	}
+
+	_, err = tx.Exec(ctx, `
+		INSERT INTO product_price_schedules (schedule_id, product_id, price, starts_at, ends_at, created_by, created_at)
+		VALUES ($1, $2, $3, $4, $5, $6, $7)
+	`, schedule.Schedule_ID, schedule.Product_ID, schedule.Price, schedule.Starts_At, schedule.Ends_At,
+		schedule.Created_By, schedule.Created_At)
+
+	if err != nil {
+		return err
+	}
+
+	schedule.Status = priceScheduleStatus(schedule, now)
+
+	return tx.Commit(ctx)
+}
+
+// запланированные цены товара (включая завершенные и отмененные), поздние сверху
+func GetPriceSchedules(ctx context.Context, db *pgxpool.Pool, productID uuid.UUID) ([]models.PriceSchedule, error) {
+	rows, err := db.Query(ctx,
+		"SELECT "+priceScheduleColumns+" FROM product_price_schedules WHERE product_id = $1 ORDER BY starts_at DESC",
+		productID)
+
+	if err != nil {
+		return nil, err
+	}
+
+	defer rows.Close()
+
+	schedules := make([]models.PriceSchedule, 0)
+
+	for rows.Next() {
+		var schedule models.PriceSchedule
+
+		if err := scanPriceSchedule(rows, &schedule); err != nil {
+			return nil, err
+		}
+
+		schedules = append(schedules, schedule)
+	}
+
+	return schedules, rows.Err()
+}
+
+// отменяет запланированную цену; идущая распродажа заканчивается сразу
+func CancelPriceSchedule(ctx context.Context, db *pgxpool.Pool, scheduleID uuid.UUID) (*models.PriceSchedule, error) {
+	tx, err := db.Begin(ctx)
+
+	if err != nil {
+		return nil, err
+	}
+
+	defer tx.Rollback(ctx)
+
+	var schedule models.PriceSchedule
+
+	err = scanPriceSchedule(tx.QueryRow(ctx,
+		"SELECT "+priceScheduleColumns+" FROM product_price_schedules WHERE schedule_id = $1 FOR UPDATE",
+		scheduleID), &schedule)
+
+	if err == pgx.ErrNoRows {
+		return nil, ErrPriceScheduleNotFound
+	}
+
+	if err != nil {
+		return nil, err
+	}
+
+	if schedule.Status != models.PriceScheduleStatusScheduled && schedule.Status != models.PriceScheduleStatusActive {
+		return nil, ErrPriceScheduleFinished
+	}
+
+	now := time.Now().UTC()
+
+	_, err = tx.Exec(ctx, "UPDATE product_price_schedules SET cancelled_at = $1 WHERE schedule_id = $2", now, scheduleID)
+
+	if err != nil {
+		return nil, err
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		return nil, err
+	}
+
+	schedule.Cancelled_At = &now
+	schedule.Status = models.PriceScheduleStatusCancelled
+
+	return &schedule, nil
+}
+
+// переносит наступившие плановые изменения (без ends_at) в products.price с записью в историю.
+// До переноса такая цена уже действует через product_price_at, поэтому задержка задачи не видна покупателям
+func ApplyScheduledPrices(ctx context.Context, db *pgxpool.Pool) (int, error) {
+	applied := 0
+
+	for {
+		count, err := applyScheduledPricesBatch(ctx, db)
+
+		if err != nil {
+			return applied, err
+		}
+
+		applied += count
+
+		if count < applyPricesBatch {
+			return applied, nil
+		}
+	}
+}
+
+func applyScheduledPricesBatch(ctx context.Context, db *pgxpool.Pool) (int, error) {
+	tx, err := db.Begin(ctx)
+
+	if err != nil {
+		return 0, err
+	}
+
+	defer tx.Rollback(ctx)
+
+	now := time.Now().UTC()
+
+	// По порядку начала: если у товара наступило несколько изменений, остается последнее
+	rows, err := tx.Query(ctx, `
+		SELECT schedule_id, product_id, price, created_by
+		FROM product_price_schedules
+		WHERE ends_at IS NULL AND applied_at IS NULL AND cancelled_at IS NULL AND starts_at <= $1
+		ORDER BY starts_at
+		LIMIT $2
+		FOR UPDATE SKIP LOCKED
+	`, now, applyPricesBatch)
+
+	if err != nil {
+		return 0, err
+	}
+
+	var schedules []models.PriceSchedule
+
+	for rows.Next() {
+		var schedule models.PriceSchedule
+
+		if err := rows.Scan(&schedule.Schedule_ID, &schedule.Product_ID, &schedule.Price, &schedule.Created_By); err != nil {
+			rows.Close()
+			return 0, err
+		}
+
+		schedules = append(schedules, schedule)
+	}
+
+	rows.Close()
+
+	if err := rows.Err(); err != nil {
+		return 0, err
+	}
+
+	for _, schedule := range schedules {
+		err := setProductPrice(ctx, tx, schedule.Product_ID, *schedule.Price, models.PriceSourceSchedule, schedule.Created_By)
+
+		if err != nil {
+			return 0, err
+		}
+
+		_, err = tx.Exec(ctx, "UPDATE product_price_schedules SET applied_at = $1 WHERE schedule_id = $2", now, schedule.Schedule_ID)
+
+		if err != nil {
+			return 0, err
+		}
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		return 0, err
+	}
+
+	return len(schedules), nil
+}
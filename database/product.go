@@ -2,40 +2,141 @@ package database
 
 import (
 	"context"
+	"ec-platform/currency"
 	"ec-platform/models"
 	"errors"
 	"time"
 
 	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
 	"github.com/jackc/pgx/v5/pgxpool"
 )
 
 var (
-	ErrProductExists = errors.New("product already exists")
+	ErrProductExists   = errors.New("product already exists")
+	ErrProductArchived = errors.New("product is archived")
 )
 
-// AddProduct добавляет новый продукт в каталог
+// AddProduct добавляет новый продукт в каталог; начальная цена попадает в историю цен
 func AddProduct(ctx context.Context, db *pgxpool.Pool, product *models.Product) (uuid.UUID, error) {
 	productID := uuid.New()
 
+	tx, err := db.Begin(ctx)
+
+	if err != nil {
+		return uuid.Nil, err
+	}
+
+	defer tx.Rollback(ctx)
+
 	query := `
-		INSERT INTO products (product_id, product_name, price, rating, image, created_at, updated_at)
-		VALUES ($1, $2, $3, $4, $5, $6, $7)
+		INSERT INTO products (product_id, sku, product_name, price, image, weight_grams, created_at, updated_at)
+		VALUES ($1, $2, $3, $4, $5, COALESCE($6, 0), $7, $8)
 	`
 
-	_, err := db.Exec(ctx, query,
+	_, err = tx.Exec(ctx, query,
 		productID,
+		product.SKU,
 		product.Product_Name,
 		product.Price,
-		product.Rating,
 		product.Image,
+		product.Weight,
 		time.Now().UTC(),
 		time.Now().UTC(),
 	)
 
+	if isUniqueViolation(err) {
+		return uuid.Nil, ErrProductExists
+	}
+
 	if err != nil {
 		return uuid.Nil, err
 	}
 
+	if err := recordPriceChange(ctx, tx, productID, nil, *product.Price, models.PriceSourceAdmin, ""); err != nil {
+		return uuid.Nil, err
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		return uuid.Nil, err
+	}
+
 	return productID, nil
 }
+
+// возвращает товар каталога по id с действующей ценой в валюте курса rate
+func GetProduct(ctx context.Context, db *pgxpool.Pool, productID uuid.UUID, rate currency.Rate) (*models.Product, error) {
+	product := models.Product{Currency: rate.Currency}
+
+	err := db.QueryRow(ctx, `
+		SELECT p.product_id, p.sku, p.product_name, pp.price, pp.compare_at_price, pp.sale_ends_at,
+			p.rating, p.rating_count, p.image, p.weight_grams, p.archived_at
+		FROM products p
+		JOIN LATERAL product_price_in(p.product_id, $2, $3, $4, $5) pp ON TRUE
+		WHERE p.product_id = $1
+	`, productID, time.Now().UTC(), rate.Currency, rate.Value, rate.Scale).Scan(&product.Product_ID, &product.SKU, &product.Product_Name, &product.Price, &product.Compare_At_Price,
+		&product.Sale_Ends_At, &product.Rating, &product.Rating_Count, &product.Image, &product.Weight, &product.Archived_At)
+
+	if err == pgx.ErrNoRows {
+		return nil, ErrRecordNotFound
+	}
+
+	if err != nil {
+		return nil, err
+	}
+
+	return &product, nil
+}
+
+// переносит товар в архив (archived=true) или возвращает в продажу. Товар в архиве остается
+// в корзинах - проверка корзины предупреждает о нем, оформить его нельзя
+func SetProductArchived(ctx context.Context, db *pgxpool.Pool, productID uuid.UUID, archived bool) error {
+	var archivedAt *time.Time
+
+	if archived {
+		now := time.Now().UTC()
+		archivedAt = &now
+	}
+
+	// Повторная архивация сохраняет исходную дату
+	result, err := db.Exec(ctx, `
+		UPDATE products SET archived_at = CASE WHEN $1::TIMESTAMP IS NULL THEN NULL ELSE COALESCE(archived_at, $1) END
+		WHERE product_id = $2
+	`, archivedAt, productID)
+
+	if err != nil {
+		return err
+	}
+
+	if result.RowsAffected() == 0 {
+		return ErrRecordNotFound
+	}
+
+	return nil
+}
+
+// резервирует остаток товара под заказ. Товары без учета остатка (stock IS NULL) не ограничены
+func reserveStock(ctx context.Context, tx pgx.Tx, productID uuid.UUID, quantity int) error {
+	result, err := tx.Exec(ctx,
+		"UPDATE products SET stock = stock - $1, updated_at = $2 WHERE product_id = $3 AND (stock IS NULL OR stock >= $1)",
+		quantity, time.Now().UTC(), productID)
+
+	if err != nil {
+		return err
+	}
+
+	if result.RowsAffected() == 0 {
+		return ErrOutOfStock
+	}
+
+	return nil
+}
+
+// возвращает зарезервированный остаток товара на склад
+func releaseStock(ctx context.Context, tx pgx.Tx, productID uuid.UUID, quantity int) error {
+	_, err := tx.Exec(ctx,
+		"UPDATE products SET stock = stock + $1, updated_at = $2 WHERE product_id = $3 AND stock IS NOT NULL",
+		quantity, time.Now().UTC(), productID)
+
+	return err
+}
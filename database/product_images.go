@@ -0,0 +1,244 @@
+package database
+
+import (
+	"context"
+	"ec-platform/models"
+	"errors"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+var (
+	ErrProductImageNotFound = errors.New("product image not found")
+	ErrProductImageLimit    = errors.New("product image limit reached")
+	ErrInvalidImageOrder    = errors.New("image order must list every product image exactly once")
+)
+
+// по этому пути приложение отдает файлы хранилища изображений
+const ImagesURLPrefix = "/images/"
+
+// колонки изображения в порядке сканирования scanProductImage
+const productImageColumns = `
+	image_id, product_id, position, storage_key, thumbnail_key, content_type, width, height, size_bytes, created_at
+`
+
+func scanProductImage(row pgx.Row, image *models.ProductImage) error {
+	err := row.Scan(
+		&image.Image_ID,
+		&image.Product_ID,
+		&image.Position,
+		&image.Storage_Key,
+		&image.Thumbnail_Key,
+		&image.Content_Type,
+		&image.Width,
+		&image.Height,
+		&image.Size,
+		&image.Created_At,
+	)
+
+	image.URL = ImagesURLPrefix + image.Storage_Key
+	image.Thumbnail_URL = ImagesURLPrefix + image.Thumbnail_Key
+
+	return err
+}
+
+// добавляет изображение в конец галереи товара (не больше limit изображений, 0 - без ограничения).
+// Файлы уже должны лежать в хранилище по ключам image.Storage_Key и image.Thumbnail_Key
+func AddProductImage(ctx context.Context, db *pgxpool.Pool, image *models.ProductImage, limit int) error {
+	tx, err := db.Begin(ctx)
+
+	if err != nil {
+		return err
+	}
+
+	defer tx.Rollback(ctx)
+
+	// Блокируем товар, чтобы параллельные загрузки не заняли одну позицию
+	var locked uuid.UUID
+
+	err = tx.QueryRow(ctx, "SELECT product_id FROM products WHERE product_id = $1 FOR UPDATE", image.Product_ID).Scan(&locked)
+
+	if err == pgx.ErrNoRows {
+		return ErrRecordNotFound
+	}
+
+	if err != nil {
+		return err
+	}
+
+	var count int
+
+	err = tx.QueryRow(ctx, "SELECT COUNT(*) FROM product_images WHERE product_id = $1", image.Product_ID).Scan(&count)
+
+	if err != nil {
+		return err
+	}
+
+	if limit > 0 && count >= limit {
+		return ErrProductImageLimit
+	}
+
+	image.Position = count + 1
+	image.Created_At = time.Now().UTC()
+
+	_, err = tx.Exec(ctx, `
+		INSERT INTO product_images (image_id, product_id, position, storage_key, thumbnail_key, content_type, width, height, size_bytes, created_at)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10)
+	`, image.Image_ID, image.Product_ID, image.Position, image.Storage_Key, image.Thumbnail_Key,
+		image.Content_Type, image.Width, image.Height, image.Size, image.Created_At)
+
+	if err != nil {
+		return err
+	}
+
+	image.URL = ImagesURLPrefix + image.Storage_Key
+	image.Thumbnail_URL = ImagesURLPrefix + image.Thumbnail_Key
+
+	if err := syncProductImage(ctx, tx, image.Product_ID); err != nil {
+		return err
+	}
+
+	return tx.Commit(ctx)
+}
+
+// возвращает изображения товара в порядке галереи
+func GetProductImages(ctx context.Context, db *pgxpool.Pool, productID uuid.UUID) ([]models.ProductImage, error) {
+	rows, err := db.Query(ctx, "SELECT "+productImageColumns+" FROM product_images WHERE product_id = $1 ORDER BY position", productID)
+
+	if err != nil {
+		return nil, err
+	}
+
+	defer rows.Close()
+
+	images := make([]models.ProductImage, 0)
+
+	for rows.Next() {
+		var image models.ProductImage
+
+		if err := scanProductImage(rows, &image); err != nil {
+			return nil, err
+		}
+
+		images = append(images, image)
+	}
+
+	return images, rows.Err()
+}
+
+// удаляет изображение из галереи (следующие сдвигаются) и возвращает его -
+// файлы из хранилища удаляет вызывающий
+func DeleteProductImage(ctx context.Context, db *pgxpool.Pool, productID uuid.UUID, imageID uuid.UUID) (*models.ProductImage, error) {
+	tx, err := db.Begin(ctx)
+
+	if err != nil {
+		return nil, err
+	}
+
+	defer tx.Rollback(ctx)
+
+	var image models.ProductImage
+
+	err = scanProductImage(tx.QueryRow(ctx,
+		"DELETE FROM product_images WHERE image_id = $1 AND product_id = $2 RETURNING "+productImageColumns,
+		imageID, productID), &image)
+
+	if err == pgx.ErrNoRows {
+		return nil, ErrProductImageNotFound
+	}
+
+	if err != nil {
+		return nil, err
+	}
+
+	_, err = tx.Exec(ctx,
+		"UPDATE product_images SET position = position - 1 WHERE product_id = $1 AND position > $2",
+		productID, image.Position)
+
+	if err != nil {
+		return nil, err
+	}
+
+	if err := syncProductImage(ctx, tx, productID); err != nil {
+		return nil, err
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		return nil, err
+	}
+
+	return &image, nil
+}
+
+// переставляет галерею: imageIDs - все изображения товара в новом порядке
+func ReorderProductImages(ctx context.Context, db *pgxpool.Pool, productID uuid.UUID, imageIDs []uuid.UUID) ([]models.ProductImage, error) {
+	seen := make(map[uuid.UUID]bool, len(imageIDs))
+
+	for _, imageID := range imageIDs {
+		if seen[imageID] {
+			return nil, ErrInvalidImageOrder
+		}
+
+		seen[imageID] = true
+	}
+
+	tx, err := db.Begin(ctx)
+
+	if err != nil {
+		return nil, err
+	}
+
+	defer tx.Rollback(ctx)
+
+	var count int
+
+	err = tx.QueryRow(ctx, "SELECT COUNT(*) FROM product_images WHERE product_id = $1", productID).Scan(&count)
+
+	if err != nil {
+		return nil, err
+	}
+
+	if count != len(imageIDs) {
+		return nil, ErrInvalidImageOrder
+	}
+
+	// Уникальность позиций проверяется при коммите, поэтому промежуточные совпадения допустимы
+	for i, imageID := range imageIDs {
+		result, err := tx.Exec(ctx,
+			"UPDATE product_images SET position = $1 WHERE image_id = $2 AND product_id = $3",
+			i+1, imageID, productID)
+
+		if err != nil {
+			return nil, err
+		}
+
+		if result.RowsAffected() == 0 {
+			return nil, ErrInvalidImageOrder
+		}
+	}
+
+	if err := syncProductImage(ctx, tx, productID); err != nil {
+		return nil, err
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		return nil, err
+	}
+
+	return GetProductImages(ctx, db, productID)
+}
+
+// products.image - адрес первого изображения галереи (NULL, если изображений нет)
+func syncProductImage(ctx context.Context, tx pgx.Tx, productID uuid.UUID) error {
+	_, err := tx.Exec(ctx, `
+		UPDATE products SET
+			image = (SELECT $2 || storage_key FROM product_images WHERE product_id = $1 ORDER BY position LIMIT 1),
+			updated_at = $3
+		WHERE product_id = $1
+	`, productID, ImagesURLPrefix, time.Now().UTC())
+
+	return err
+}
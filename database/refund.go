@@ -0,0 +1,254 @@
+package database
+
+import (
+	"context"
+	"ec-platform/models"
+	"log"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+// время, на которое возврат закрепляется за отправителем: пока оно не истекло,
+// задача повтора не отправит тот же возврат провайдеру второй раз
+const refundLease = 5 * time.Minute
+
+// задержка повтора возврата, который не удалось отправить сразу после отмены или возврата товара
+const refundRetryDelay = time.Minute
+
+// колонки возврата в порядке сканирования scanRefund
+const refundColumns = `
+	refund_id, payment_id, order_id, amount, status, attempts, last_error, actor, next_attempt_at, created_at, updated_at
+`
+
+func scanRefund(row pgx.Row, refund *models.Refund) error {
+	return row.Scan(
+		&refund.Refund_ID,
+		&refund.Payment_ID,
+		&refund.Order_ID,
+		&refund.Amount,
+		&refund.Status,
+		&refund.Attempts,
+		&refund.Last_Error,
+		&refund.Actor,
+		&refund.Next_Attempt_At,
+		&refund.Created_At,
+		&refund.Updated_At,
+	)
+}
+
+// записывает возврат по платежу в pending внутри транзакции. Возврат сразу закреплен
+// за вызывающим, который отправит его провайдеру после коммита
+func insertRefund(ctx context.Context, tx pgx.Tx, payment models.PaymentAttempt, amount models.Money, actor string) (*models.Refund, error) {
+	now := time.Now().UTC()
+
+	refund := models.Refund{
+		Refund_ID:       uuid.New(),
+		Payment_ID:      payment.Payment_ID,
+		Order_ID:        payment.Order_ID,
+		Amount:          amount,
+		Status:          models.RefundStatusPending,
+		Actor:           actor,
+		Next_Attempt_At: now.Add(refundLease),
+		Created_At:      now,
+		Updated_At:      now,
+	}
+
+	_, err := tx.Exec(ctx, `
+		INSERT INTO refunds (refund_id, payment_id, order_id, amount, status, actor, next_attempt_at, created_at, updated_at)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9)
+	`, refund.Refund_ID, refund.Payment_ID, refund.Order_ID, refund.Amount, refund.Status, refund.Actor, refund.Next_Attempt_At, now, now)
+
+	if err != nil {
+		return nil, err
+	}
+
+	return &refund, nil
+}
+
+// суммы еще не подтвержденных провайдером возвратов по платежам заказа
+func pendingRefunds(ctx context.Context, tx pgx.Tx, orderID uuid.UUID) (map[uuid.UUID]models.Money, error) {
+	rows, err := tx.Query(ctx,
+		"SELECT payment_id, SUM(amount) FROM refunds WHERE order_id = $1 AND status = $2 GROUP BY payment_id",
+		orderID, models.RefundStatusPending)
+
+	if err != nil {
+		return nil, err
+	}
+
+	defer rows.Close()
+
+	pending := make(map[uuid.UUID]models.Money)
+
+	for rows.Next() {
+		var paymentID uuid.UUID
+		var amount models.Money
+
+		if err := rows.Scan(&paymentID, &amount); err != nil {
+			return nil, err
+		}
+
+		pending[paymentID] = amount
+	}
+
+	return pending, rows.Err()
+}
+
+// отправляет провайдеру возвраты, записанные в только что закоммиченной транзакции.
+// Ошибка провайдера не отменяет операцию: возврат остается в pending и повторяется задачей RetryRefunds
+func settleRefunds(ctx context.Context, db *pgxpool.Pool, refunds []models.Refund, refund RefundFunc) {
+	for _, r := range refunds {
+		if err := sendRefund(ctx, db, r, refund, refundRetryDelay); err != nil {
+			log.Printf("refund %s of payment %s is pending: %v", r.Refund_ID, r.Payment_ID, err)
+		}
+	}
+}
+
+// выбирает до batch возвратов, которые пора повторить, закрепляет их за собой и отправляет провайдеру.
+// Строки блокируются только на время выбора - обращение к провайдеру идет вне транзакции.
+// Возвращает количество выбранных возвратов
+func RetryRefunds(ctx context.Context, db *pgxpool.Pool, batch int, backoff func(attempt int) time.Duration, refund RefundFunc) (int, error) {
+	tx, err := db.Begin(ctx)
+
+	if err != nil {
+		return 0, err
+	}
+
+	defer tx.Rollback(ctx)
+
+	now := time.Now().UTC()
+
+	rows, err := tx.Query(ctx, "SELECT "+refundColumns+` FROM refunds
+		WHERE status = $1 AND next_attempt_at <= $2
+		ORDER BY created_at
+		LIMIT $3
+		FOR UPDATE SKIP LOCKED`, models.RefundStatusPending, now, batch)
+
+	if err != nil {
+		return 0, err
+	}
+
+	var refunds []models.Refund
+	var ids []uuid.UUID
+
+	for rows.Next() {
+		var r models.Refund
+
+		if err := scanRefund(rows, &r); err != nil {
+			rows.Close()
+			return 0, err
+		}
+
+		refunds = append(refunds, r)
+		ids = append(ids, r.Refund_ID)
+	}
+
+	rows.Close()
+
+	if err := rows.Err(); err != nil {
+		return 0, err
+	}
+
+	if len(refunds) == 0 {
+		return 0, nil
+	}
+
+	_, err = tx.Exec(ctx, "UPDATE refunds SET next_attempt_at = $1 WHERE refund_id = ANY($2)", now.Add(refundLease), ids)
+
+	if err != nil {
+		return 0, err
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		return 0, err
+	}
+
+	for _, r := range refunds {
+		if err := sendRefund(ctx, db, r, refund, backoff(r.Attempts+1)); err != nil {
+			log.Printf("refund %s of payment %s failed: %v", r.Refund_ID, r.Payment_ID, err)
+		}
+	}
+
+	return len(refunds), nil
+}
+
+// обращается к провайдеру и учитывает результат; при ошибке возврат повторяется через delay
+func sendRefund(ctx context.Context, db *pgxpool.Pool, r models.Refund, refund RefundFunc, delay time.Duration) error {
+	payment, err := GetPayment(ctx, db, r.Payment_ID)
+
+	if err != nil {
+		return err
+	}
+
+	if err := refund(ctx, *payment, r.Amount); err != nil {
+		_, saveErr := db.Exec(ctx,
+			"UPDATE refunds SET attempts = attempts + 1, last_error = $1, next_attempt_at = $2, updated_at = $3 WHERE refund_id = $4",
+			err.Error(), time.Now().UTC().Add(delay), time.Now().UTC(), r.Refund_ID)
+
+		if saveErr != nil {
+			log.Printf("error saving failed refund %s: %v", r.Refund_ID, saveErr)
+		}
+
+		return err
+	}
+
+	return completeRefund(ctx, db, r.Refund_ID)
+}
+
+// учитывает подтвержденный провайдером возврат в платеже (с корректировочным счетом).
+// Полностью возвращенный заказ переходит в refunded, если это допустимо
+func completeRefund(ctx context.Context, db *pgxpool.Pool, refundID uuid.UUID) error {
+	tx, err := db.Begin(ctx)
+
+	if err != nil {
+		return err
+	}
+
+	defer tx.Rollback(ctx)
+
+	var r models.Refund
+
+	if err := scanRefund(tx.QueryRow(ctx, "SELECT "+refundColumns+" FROM refunds WHERE refund_id = $1 FOR UPDATE", refundID), &r); err != nil {
+		return err
+	}
+
+	// Уже учтен другим отправителем
+	if r.Status != models.RefundStatusPending {
+		return nil
+	}
+
+	var payment models.PaymentAttempt
+
+	if err := scanPayment(tx.QueryRow(ctx, "SELECT "+paymentColumns+" FROM payments WHERE payment_id = $1 FOR UPDATE", r.Payment_ID), &payment); err != nil {
+		return err
+	}
+
+	// Webhook провайдера мог учесть часть возврата раньше нас - сумма платежа не превышается
+	left, err := payment.Amount.Sub(payment.Refunded_Amount)
+
+	if err != nil {
+		return err
+	}
+
+	if amount := min(r.Amount, left); amount > 0 {
+		if err := recordRefund(ctx, tx, payment, amount); err != nil {
+			return err
+		}
+	}
+
+	_, err = tx.Exec(ctx,
+		"UPDATE refunds SET status = $1, attempts = attempts + 1, last_error = NULL, updated_at = $2 WHERE refund_id = $3",
+		models.RefundStatusSucceeded, time.Now().UTC(), refundID)
+
+	if err != nil {
+		return err
+	}
+
+	if err := markOrderRefundedIfFullyRefunded(ctx, tx, r.Order_ID, r.Actor); err != nil {
+		return err
+	}
+
+	return tx.Commit(ctx)
+}
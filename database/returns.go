@@ -0,0 +1,467 @@
+package database
+
+import (
+	"context"
+	"ec-platform/models"
+	"errors"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+var (
+	ErrReturnNotFound         = errors.New("return request not found")
+	ErrOrderNotReturnable     = errors.New("only delivered orders can be returned")
+	ErrInvalidReturnItems     = errors.New("return items do not belong to the order")
+	ErrReturnQuantityExceeded = errors.New("return quantity exceeds purchased quantity")
+	ErrInvalidReturnStatus    = errors.New("return request is not in a suitable status")
+	ErrInvalidReturnAmount    = errors.New("approved amount exceeds requested amount")
+)
+
+// колонки заявки в порядке сканирования scanReturn
+const returnColumns = `
+	return_id, order_id, status, reason, requested_amount, approved_amount, refunded_amount,
+	staff_note, handled_by, created_at, updated_at
+`
+
+func scanReturn(row pgx.Row, ret *models.Return) error {
+	return row.Scan(
+		&ret.Return_ID,
+		&ret.Order_ID,
+		&ret.Status,
+		&ret.Reason,
+		&ret.Requested_Amount,
+		&ret.Approved_Amount,
+		&ret.Refunded_Amount,
+		&ret.Staff_Note,
+		&ret.Handled_By,
+		&ret.Created_At,
+		&ret.Updated_At,
+	)
+}
+
+// создает заявку на возврат позиций доставленного заказа пользователя.
+// Количество по позиции не может превышать купленное с учетом прошлых заявок (кроме отклоненных)
+func CreateReturn(ctx context.Context, db *pgxpool.Pool, userID string, orderID uuid.UUID, reason string, items []models.ReturnItem) (*models.Return, error) {
+	if len(items) == 0 {
+		return nil, ErrInvalidReturnItems
+	}
+
+	tx, err := db.Begin(ctx)
+
+	if err != nil {
+		return nil, err
+	}
+
+	defer tx.Rollback(ctx)
+
+	// Проверяем принадлежность и статус заказа; блокировка заказа упорядочивает параллельные заявки
+	var status string
+
+	err = tx.QueryRow(ctx,
+		"SELECT status FROM orders WHERE order_id = $1 AND user_id = $2 FOR UPDATE",
+		orderID, userID).Scan(&status)
+
+	if err == pgx.ErrNoRows {
+		return nil, ErrOrderNotFound
+	}
+
+	if err != nil {
+		return nil, err
+	}
+
+	if status != models.OrderStatusDelivered {
+		return nil, ErrOrderNotReturnable
+	}
+
+	// Одна позиция заказа может встретиться в запросе несколько раз
+	quantities := make(map[uuid.UUID]int)
+	var itemIDs []uuid.UUID
+
+	for _, item := range items {
+		if item.Quantity <= 0 {
+			return nil, ErrInvalidReturnItems
+		}
+
+		if _, seen := quantities[item.Order_Item_ID]; !seen {
+			itemIDs = append(itemIDs, item.Order_Item_ID)
+		}
+
+		quantities[item.Order_Item_ID] += item.Quantity
+	}
+
+	now := time.Now().UTC()
+
+	ret := models.Return{
+		Return_ID:  uuid.New(),
+		Order_ID:   orderID,
+		Status:     models.ReturnStatusRequested,
+		Reason:     reason,
+		Created_At: now,
+		Updated_At: now,
+		Items:      make([]models.ReturnItem, 0, len(itemIDs)),
+	}
+
+	for _, orderItemID := range itemIDs {
+		item := models.ReturnItem{Order_Item_ID: orderItemID, Quantity: quantities[orderItemID]}
+
+		var purchased, alreadyReturned int
+
+		err := tx.QueryRow(ctx, `
+			SELECT oi.product_id, oi.price, oi.quantity,
+				COALESCE(SUM(ri.quantity) FILTER (WHERE r.status <> $3), 0)
+			FROM order_items oi
+			LEFT JOIN return_items ri ON ri.order_item_id = oi.id
+			LEFT JOIN returns r ON r.return_id = ri.return_id
+			WHERE oi.id = $1 AND oi.order_id = $2
+			GROUP BY oi.id
+		`, orderItemID, orderID, models.ReturnStatusRejected).Scan(&item.Product_ID, &item.Price, &purchased, &alreadyReturned)
+
+		if err == pgx.ErrNoRows {
+			return nil, ErrInvalidReturnItems
+		}
+
+		if err != nil {
+			return nil, err
+		}
+
+		if alreadyReturned+item.Quantity > purchased {
+			return nil, ErrReturnQuantityExceeded
+		}
+
+		if ret.Requested_Amount, err = ret.Requested_Amount.AddMul(item.Price, item.Quantity); err != nil {
+			return nil, err
+		}
+
+		ret.Items = append(ret.Items, item)
+	}
+
+	_, err = tx.Exec(ctx, `
+		INSERT INTO returns (return_id, order_id, user_id, status, reason, requested_amount, created_at, updated_at)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8)
+	`, ret.Return_ID, orderID, userID, ret.Status, reason, ret.Requested_Amount, now, now)
+
+	if err != nil {
+		return nil, err
+	}
+
+	for _, item := range ret.Items {
+		_, err = tx.Exec(ctx,
+			"INSERT INTO return_items (id, return_id, order_item_id, quantity, price) VALUES ($1, $2, $3, $4, $5)",
+			uuid.New(), ret.Return_ID, item.Order_Item_ID, item.Quantity, item.Price)
+
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	err = enqueueEvent(ctx, tx, models.EventReturnRequested, ret.Return_ID, models.ReturnEvent{
+		Return_ID:        ret.Return_ID,
+		Order_ID:         orderID,
+		User_ID:          userID,
+		Requested_Amount: ret.Requested_Amount,
+	})
+
+	if err != nil {
+		return nil, err
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		return nil, err
+	}
+
+	return &ret, nil
+}
+
+// возвращает заявки на возврат (новые сверху). Пустой userID - заявки всех пользователей,
+// пустой status - в любом статусе
+func GetReturns(ctx context.Context, db *pgxpool.Pool, userID string, status string) ([]models.Return, error) {
+	rows, err := db.Query(ctx, "SELECT "+returnColumns+` FROM returns
+		WHERE ($1 = '' OR user_id = $1) AND ($2 = '' OR status = $2)
+		ORDER BY created_at DESC
+		LIMIT 200`, userID, status)
+
+	if err != nil {
+		return nil, err
+	}
+
+	var returns []models.Return
+
+	for rows.Next() {
+		var ret models.Return
+
+		if err := scanReturn(rows, &ret); err != nil {
+			rows.Close()
+			return nil, err
+		}
+
+		returns = append(returns, ret)
+	}
+
+	rows.Close()
+
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	result := make([]models.Return, 0, len(returns))
+
+	for _, ret := range returns {
+		ret.Items, err = getReturnItems(ctx, db, ret.Return_ID)
+
+		if err != nil {
+			return nil, err
+		}
+
+		result = append(result, ret)
+	}
+
+	return result, nil
+}
+
+func getReturnItems(ctx context.Context, db *pgxpool.Pool, returnID uuid.UUID) ([]models.ReturnItem, error) {
+	rows, err := db.Query(ctx, `
+		SELECT ri.order_item_id, oi.product_id, ri.quantity, ri.price
+		FROM return_items ri
+		JOIN order_items oi ON oi.id = ri.order_item_id
+		WHERE ri.return_id = $1
+	`, returnID)
+
+	if err != nil {
+		return nil, err
+	}
+
+	defer rows.Close()
+
+	items := make([]models.ReturnItem, 0)
+
+	for rows.Next() {
+		var item models.ReturnItem
+
+		if err := rows.Scan(&item.Order_Item_ID, &item.Product_ID, &item.Quantity, &item.Price); err != nil {
+			return nil, err
+		}
+
+		items = append(items, item)
+	}
+
+	return items, rows.Err()
+}
+
+// блокирует заявку и проверяет ее статус
+func lockReturn(ctx context.Context, tx pgx.Tx, returnID uuid.UUID, expectedStatus string) (*models.Return, error) {
+	var ret models.Return
+
+	err := scanReturn(tx.QueryRow(ctx, "SELECT "+returnColumns+" FROM returns WHERE return_id = $1 FOR UPDATE", returnID), &ret)
+
+	if err == pgx.ErrNoRows {
+		return nil, ErrReturnNotFound
+	}
+
+	if err != nil {
+		return nil, err
+	}
+
+	if ret.Status != expectedStatus {
+		return nil, ErrInvalidReturnStatus
+	}
+
+	return &ret, nil
+}
+
+// одобряет заявку. amount == nil - к возврату вся запрошенная сумма, иначе частичный возврат
+func ApproveReturn(ctx context.Context, db *pgxpool.Pool, returnID uuid.UUID, amount *models.Money, actor string, note string) error {
+	tx, err := db.Begin(ctx)
+
+	if err != nil {
+		return err
+	}
+
+	defer tx.Rollback(ctx)
+
+	ret, err := lockReturn(ctx, tx, returnID, models.ReturnStatusRequested)
+
+	if err != nil {
+		return err
+	}
+
+	approved := ret.Requested_Amount
+
+	if amount != nil {
+		if *amount > ret.Requested_Amount {
+			return ErrInvalidReturnAmount
+		}
+
+		approved = *amount
+	}
+
+	_, err = tx.Exec(ctx, `
+		UPDATE returns
+		SET status = $1, approved_amount = $2, staff_note = NULLIF($3, ''), handled_by = $4, updated_at = $5
+		WHERE return_id = $6
+	`, models.ReturnStatusApproved, approved, note, actor, time.Now().UTC(), returnID)
+
+	if err != nil {
+		return err
+	}
+
+	return tx.Commit(ctx)
+}
+
+// отклоняет заявку
+func RejectReturn(ctx context.Context, db *pgxpool.Pool, returnID uuid.UUID, actor string, note string) error {
+	tx, err := db.Begin(ctx)
+
+	if err != nil {
+		return err
+	}
+
+	defer tx.Rollback(ctx)
+
+	if _, err := lockReturn(ctx, tx, returnID, models.ReturnStatusRequested); err != nil {
+		return err
+	}
+
+	_, err = tx.Exec(ctx, `
+		UPDATE returns
+		SET status = $1, staff_note = NULLIF($2, ''), handled_by = $3, updated_at = $4
+		WHERE return_id = $5
+	`, models.ReturnStatusRejected, note, actor, time.Now().UTC(), returnID)
+
+	if err != nil {
+		return err
+	}
+
+	return tx.Commit(ctx)
+}
+
+// фиксирует получение товара по одобренной заявке: возвращает остатки на склад и записывает возврат
+// одобренной суммы в одной транзакции, затем отправляет возврат платежному провайдеру.
+// Полностью возвращенный заказ переходит в refunded, когда провайдер подтвердит возврат
+func ReceiveReturn(ctx context.Context, db *pgxpool.Pool, returnID uuid.UUID, actor string, refund RefundFunc) (*models.Return, error) {
+	tx, err := db.Begin(ctx)
+
+	if err != nil {
+		return nil, err
+	}
+
+	defer tx.Rollback(ctx)
+
+	ret, err := lockReturn(ctx, tx, returnID, models.ReturnStatusApproved)
+
+	if err != nil {
+		return nil, err
+	}
+
+	// Возвращаем остатки на склад
+	rows, err := tx.Query(ctx, `
+		SELECT oi.product_id, ri.quantity
+		FROM return_items ri
+		JOIN order_items oi ON oi.id = ri.order_item_id
+		WHERE ri.return_id = $1
+	`, returnID)
+
+	if err != nil {
+		return nil, err
+	}
+
+	var items []models.OrderItem
+
+	for rows.Next() {
+		var item models.OrderItem
+
+		if err := rows.Scan(&item.ProductID, &item.Quantity); err != nil {
+			rows.Close()
+			return nil, err
+		}
+
+		items = append(items, item)
+	}
+
+	rows.Close()
+
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	for _, item := range items {
+		if err := releaseStock(ctx, tx, item.ProductID, item.Quantity); err != nil {
+			return nil, err
+		}
+	}
+
+	ret.Status = models.ReturnStatusReceived
+
+	// Возвращаем одобренную сумму (возможно, частично от оплаченного)
+	var refunds []models.Refund
+
+	if ret.Approved_Amount != nil && *ret.Approved_Amount > 0 {
+		if refunds, err = refundOrderAmount(ctx, tx, ret.Order_ID, *ret.Approved_Amount, actor); err != nil {
+			return nil, err
+		}
+
+		ret.Refunded_Amount = *ret.Approved_Amount
+		ret.Status = models.ReturnStatusRefunded
+	}
+
+	now := time.Now().UTC()
+
+	_, err = tx.Exec(ctx,
+		"UPDATE returns SET status = $1, refunded_amount = $2, handled_by = $3, updated_at = $4 WHERE return_id = $5",
+		ret.Status, ret.Refunded_Amount, actor, now, returnID)
+
+	if err != nil {
+		return nil, err
+	}
+
+	ret.Handled_By = &actor
+	ret.Updated_At = now
+
+	if err := tx.Commit(ctx); err != nil {
+		return nil, err
+	}
+
+	settleRefunds(ctx, db, refunds, refund)
+
+	return ret, nil
+}
+
+// переводит заказ в refunded, если все его платежи возвращены полностью
+func markOrderRefundedIfFullyRefunded(ctx context.Context, tx pgx.Tx, orderID uuid.UUID, actor string) error {
+	var remaining models.Money
+	var refunded bool
+
+	err := tx.QueryRow(ctx, `
+		SELECT
+			COALESCE(SUM(amount - refunded_amount) FILTER (WHERE status IN ($2, $3)), 0),
+			COALESCE(BOOL_OR(status = $4), false)
+		FROM payments
+		WHERE order_id = $1
+	`, orderID, models.PaymentStatusCaptured, models.PaymentStatusPartiallyRefunded, models.PaymentStatusRefunded).Scan(&remaining, &refunded)
+
+	if err != nil {
+		return err
+	}
+
+	if remaining > 0 || !refunded {
+		return nil
+	}
+
+	var status string
+
+	err = tx.QueryRow(ctx, "SELECT status FROM orders WHERE order_id = $1 FOR UPDATE", orderID).Scan(&status)
+
+	if err != nil {
+		return err
+	}
+
+	if !CanTransitionOrder(status, models.OrderStatusRefunded) {
+		return nil
+	}
+
+	_, err = transitionOrderStatus(ctx, tx, orderID, models.OrderStatusRefunded, actor, "all items returned")
+
+	return err
+}
@@ -0,0 +1,445 @@
+package database
+
+import (
+	"context"
+	"ec-platform/models"
+	"errors"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+var (
+	ErrReviewNotFound       = errors.New("review not found")
+	ErrReviewExists         = errors.New("product already reviewed by this user")
+	ErrNotVerifiedPurchase  = errors.New("only customers who received the product can review it")
+	ErrInvalidReviewStatus  = errors.New("unknown review status")
+	ErrOwnReviewVote        = errors.New("can't vote for own review")
+	ErrInvalidReviewSorting = errors.New("unknown review sorting")
+)
+
+// Сортировки отзывов товара
+const (
+	ReviewSortRecent  = "recent"
+	ReviewSortHelpful = "helpful"
+)
+
+// колонки отзыва в порядке сканирования scanReview (FROM reviews r JOIN users u)
+const reviewColumns = `
+	r.review_id, r.product_id, r.user_id, u.first_name || ' ' || LEFT(u.last_name, 1) || '.',
+	r.rating, r.title, r.body, r.status, r.moderation_note, r.moderated_by, r.moderated_at,
+	r.helpful_count, r.created_at, r.updated_at
+`
+
+func scanReview(row pgx.Row, review *models.Review) error {
+	return row.Scan(
+		&review.Review_ID,
+		&review.Product_ID,
+		&review.User_ID,
+		&review.Author,
+		&review.Rating,
+		&review.Title,
+		&review.Body,
+		&review.Status,
+		&review.Moderation_Note,
+		&review.Moderated_By,
+		&review.Moderated_At,
+		&review.Helpful_Count,
+		&review.Created_At,
+		&review.Updated_At,
+	)
+}
+
+// сводка оценок товара: средняя и число - из products, распределение - по одобренным отзывам
+func GetRatingSummary(ctx context.Context, db *pgxpool.Pool, product *models.Product) (*models.RatingSummary, error) {
+	summary := &models.RatingSummary{
+		Average:      product.Rating,
+		Count:        product.Rating_Count,
+		Distribution: map[int]int{1: 0, 2: 0, 3: 0, 4: 0, 5: 0},
+	}
+
+	rows, err := db.Query(ctx,
+		"SELECT rating, COUNT(*) FROM reviews WHERE product_id = $1 AND status = $2 GROUP BY rating",
+		product.Product_ID, models.ReviewStatusApproved)
+
+	if err != nil {
+		return nil, err
+	}
+
+	defer rows.Close()
+
+	for rows.Next() {
+		var rating, count int
+
+		if err := rows.Scan(&rating, &count); err != nil {
+			return nil, err
+		}
+
+		summary.Distribution[rating] = count
+	}
+
+	return summary, rows.Err()
+}
+
+// создает отзыв на модерацию. Отзыв может оставить только пользователь с доставленным
+// заказом, в котором есть этот товар (ErrNotVerifiedPurchase), и только один (ErrReviewExists)
+func CreateReview(ctx context.Context, db *pgxpool.Pool, userID string, productID uuid.UUID, review *models.Review) (*models.Review, error) {
+	var productExists bool
+
+	err := db.QueryRow(ctx, "SELECT EXISTS(SELECT 1 FROM products WHERE product_id = $1)", productID).Scan(&productExists)
+
+	if err != nil {
+		return nil, err
+	}
+
+	if !productExists {
+		return nil, ErrRecordNotFound
+	}
+
+	// Последний доставленный заказ с этим товаром подтверждает покупку
+	var orderID uuid.UUID
+
+	err = db.QueryRow(ctx, `
+		SELECT o.order_id
+		FROM orders o
+		JOIN order_items oi ON oi.order_id = o.order_id
+		WHERE o.user_id = $1 AND oi.product_id = $2 AND o.status = $3
+		ORDER BY o.ordered_at DESC
+		LIMIT 1
+	`, userID, productID, models.OrderStatusDelivered).Scan(&orderID)
+
+	if err == pgx.ErrNoRows {
+		return nil, ErrNotVerifiedPurchase
+	}
+
+	if err != nil {
+		return nil, err
+	}
+
+	reviewID := uuid.New()
+	now := time.Now().UTC()
+
+	_, err = db.Exec(ctx, `
+		INSERT INTO reviews (review_id, product_id, user_id, order_id, rating, title, body, status, created_at, updated_at)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $9)
+	`, reviewID, productID, userID, orderID, review.Rating, review.Title, review.Body, models.ReviewStatusPending, now)
+
+	if isUniqueViolation(err) {
+		return nil, ErrReviewExists
+	}
+
+	if err != nil {
+		return nil, err
+	}
+
+	return getReview(ctx, db, reviewID)
+}
+
+// изменяет отзыв автора; измененный отзыв снова уходит на модерацию
+func UpdateReview(ctx context.Context, db *pgxpool.Pool, userID string, reviewID uuid.UUID, review *models.Review) (*models.Review, error) {
+	tx, err := db.Begin(ctx)
+
+	if err != nil {
+		return nil, err
+	}
+
+	defer tx.Rollback(ctx)
+
+	var productID uuid.UUID
+
+	err = tx.QueryRow(ctx, `
+		UPDATE reviews
+		SET rating = $1, title = $2, body = $3, status = $4,
+			moderation_note = NULL, moderated_by = NULL, moderated_at = NULL, updated_at = $5
+		WHERE review_id = $6 AND user_id = $7
+		RETURNING product_id
+	`, review.Rating, review.Title, review.Body, models.ReviewStatusPending, time.Now().UTC(), reviewID, userID).Scan(&productID)
+
+	if err == pgx.ErrNoRows {
+		return nil, ErrReviewNotFound
+	}
+
+	if err != nil {
+		return nil, err
+	}
+
+	if err := refreshProductRating(ctx, tx, productID); err != nil {
+		return nil, err
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		return nil, err
+	}
+
+	return getReview(ctx, db, reviewID)
+}
+
+// удаляет отзыв автора
+func DeleteReview(ctx context.Context, db *pgxpool.Pool, userID string, reviewID uuid.UUID) error {
+	tx, err := db.Begin(ctx)
+
+	if err != nil {
+		return err
+	}
+
+	defer tx.Rollback(ctx)
+
+	var productID uuid.UUID
+
+	err = tx.QueryRow(ctx,
+		"DELETE FROM reviews WHERE review_id = $1 AND user_id = $2 RETURNING product_id",
+		reviewID, userID).Scan(&productID)
+
+	if err == pgx.ErrNoRows {
+		return ErrReviewNotFound
+	}
+
+	if err != nil {
+		return err
+	}
+
+	if err := refreshProductRating(ctx, tx, productID); err != nil {
+		return err
+	}
+
+	return tx.Commit(ctx)
+}
+
+// одобряет или отклоняет отзыв и пересчитывает оценку товара. Решение можно пересмотреть:
+// одобренный отзыв можно отклонить позже и наоборот
+func ModerateReview(ctx context.Context, db *pgxpool.Pool, reviewID uuid.UUID, status string, moderator string, note string) (*models.Review, error) {
+	if status != models.ReviewStatusApproved && status != models.ReviewStatusRejected {
+		return nil, ErrInvalidReviewStatus
+	}
+
+	tx, err := db.Begin(ctx)
+
+	if err != nil {
+		return nil, err
+	}
+
+	defer tx.Rollback(ctx)
+
+	var moderationNote *string
+
+	if note != "" {
+		moderationNote = &note
+	}
+
+	var productID uuid.UUID
+
+	err = tx.QueryRow(ctx, `
+		UPDATE reviews SET status = $1, moderation_note = $2, moderated_by = $3, moderated_at = $4
+		WHERE review_id = $5
+		RETURNING product_id
+	`, status, moderationNote, moderator, time.Now().UTC(), reviewID).Scan(&productID)
+
+	if err == pgx.ErrNoRows {
+		return nil, ErrReviewNotFound
+	}
+
+	if err != nil {
+		return nil, err
+	}
+
+	if err := refreshProductRating(ctx, tx, productID); err != nil {
+		return nil, err
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		return nil, err
+	}
+
+	return getReview(ctx, db, reviewID)
+}
+
+// одобренные отзывы товара: recent - новые сверху, helpful - самые полезные сверху
+func GetProductReviews(ctx context.Context, db *pgxpool.Pool, productID uuid.UUID, sort string, limit int, offset int) ([]models.Review, int, error) {
+	var orderBy string
+
+	switch sort {
+	case ReviewSortRecent:
+		orderBy = "r.created_at DESC, r.review_id"
+
+	case ReviewSortHelpful:
+		orderBy = "r.helpful_count DESC, r.created_at DESC, r.review_id"
+
+	default:
+		return nil, 0, ErrInvalidReviewSorting
+	}
+
+	var total int
+
+	err := db.QueryRow(ctx,
+		"SELECT COUNT(*) FROM reviews WHERE product_id = $1 AND status = $2",
+		productID, models.ReviewStatusApproved).Scan(&total)
+
+	if err != nil {
+		return nil, 0, err
+	}
+
+	reviews, err := queryReviews(ctx, db, "SELECT "+reviewColumns+`
+		FROM reviews r
+		JOIN users u ON u.user_id = r.user_id
+		WHERE r.product_id = $1 AND r.status = $2
+		ORDER BY `+orderBy+`
+		LIMIT $3 OFFSET $4`, productID, models.ReviewStatusApproved, limit, offset)
+
+	if err != nil {
+		return nil, 0, err
+	}
+
+	return reviews, total, nil
+}
+
+// отзывы для модерации; пустой status - все, старые сверху
+func AdminGetReviews(ctx context.Context, db *pgxpool.Pool, status string, limit int, offset int) ([]models.Review, int, error) {
+	var total int
+
+	err := db.QueryRow(ctx,
+		"SELECT COUNT(*) FROM reviews WHERE ($1 = '' OR status = $1)",
+		status).Scan(&total)
+
+	if err != nil {
+		return nil, 0, err
+	}
+
+	reviews, err := queryReviews(ctx, db, "SELECT "+reviewColumns+`
+		FROM reviews r
+		JOIN users u ON u.user_id = r.user_id
+		WHERE ($1 = '' OR r.status = $1)
+		ORDER BY r.created_at, r.review_id
+		LIMIT $2 OFFSET $3`, status, limit, offset)
+
+	if err != nil {
+		return nil, 0, err
+	}
+
+	return reviews, total, nil
+}
+
+// ставит (helpful = true) или снимает отметку «полезен» с одобренного отзыва.
+// Свой отзыв отметить нельзя. Возвращает новое число отметок
+func VoteReview(ctx context.Context, db *pgxpool.Pool, userID string, reviewID uuid.UUID, helpful bool) (int, error) {
+	tx, err := db.Begin(ctx)
+
+	if err != nil {
+		return 0, err
+	}
+
+	defer tx.Rollback(ctx)
+
+	var authorID string
+	var count int
+
+	// Неодобренные отзывы другим пользователям не видны
+	err = tx.QueryRow(ctx,
+		"SELECT user_id, helpful_count FROM reviews WHERE review_id = $1 AND status = $2 FOR UPDATE",
+		reviewID, models.ReviewStatusApproved).Scan(&authorID, &count)
+
+	if err == pgx.ErrNoRows {
+		return 0, ErrReviewNotFound
+	}
+
+	if err != nil {
+		return 0, err
+	}
+
+	if authorID == userID {
+		return 0, ErrOwnReviewVote
+	}
+
+	var result pgconn.CommandTag
+	delta := 1
+
+	if helpful {
+		result, err = tx.Exec(ctx,
+			"INSERT INTO review_votes (review_id, user_id, created_at) VALUES ($1, $2, $3) ON CONFLICT DO NOTHING",
+			reviewID, userID, time.Now().UTC())
+
+	} else {
+		result, err = tx.Exec(ctx, "DELETE FROM review_votes WHERE review_id = $1 AND user_id = $2", reviewID, userID)
+		delta = -1
+	}
+
+	if err != nil {
+		return 0, err
+	}
+
+	// Повторная отметка или снятие отсутствующей ничего не меняют
+	if result.RowsAffected() == 0 {
+		return count, nil
+	}
+
+	err = tx.QueryRow(ctx,
+		"UPDATE reviews SET helpful_count = helpful_count + $1 WHERE review_id = $2 RETURNING helpful_count",
+		delta, reviewID).Scan(&count)
+
+	if err != nil {
+		return 0, err
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		return 0, err
+	}
+
+	return count, nil
+}
+
+func getReview(ctx context.Context, db *pgxpool.Pool, reviewID uuid.UUID) (*models.Review, error) {
+	var review models.Review
+
+	err := scanReview(db.QueryRow(ctx, "SELECT "+reviewColumns+`
+		FROM reviews r
+		JOIN users u ON u.user_id = r.user_id
+		WHERE r.review_id = $1`, reviewID), &review)
+
+	if err == pgx.ErrNoRows {
+		return nil, ErrReviewNotFound
+	}
+
+	if err != nil {
+		return nil, err
+	}
+
+	return &review, nil
+}
+
+func queryReviews(ctx context.Context, db *pgxpool.Pool, query string, args ...interface{}) ([]models.Review, error) {
+	rows, err := db.Query(ctx, query, args...)
+
+	if err != nil {
+		return nil, err
+	}
+
+	defer rows.Close()
+
+	reviews := make([]models.Review, 0)
+
+	for rows.Next() {
+		var review models.Review
+
+		if err := scanReview(rows, &review); err != nil {
+			return nil, err
+		}
+
+		reviews = append(reviews, review)
+	}
+
+	return reviews, rows.Err()
+}
+
+// пересчитывает среднюю оценку и число одобренных отзывов товара
+func refreshProductRating(ctx context.Context, tx pgx.Tx, productID uuid.UUID) error {
+	_, err := tx.Exec(ctx, `
+		UPDATE products SET
+			rating = (SELECT ROUND(AVG(rating), 2) FROM reviews WHERE product_id = $1 AND status = $2),
+			rating_count = (SELECT COUNT(*) FROM reviews WHERE product_id = $1 AND status = $2)
+		WHERE product_id = $1
+	`, productID, models.ReviewStatusApproved)
+
+	return err
+}
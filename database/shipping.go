@@ -0,0 +1,63 @@
+package database
+
+import (
+	"context"
+	"ec-platform/currency"
+	"ec-platform/models"
+	"ec-platform/shipping"
+
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+)
+
+// CheckoutParams - параметры оформления заказа. Rates - тарифы доставки в базовой валюте BaseCurrency,
+// Rate - курс валюты оплаты: все суммы заказа пересчитываются по нему
+type CheckoutParams struct {
+	AddressID      uuid.UUID
+	ShippingMethod string
+	Rates          shipping.RateTable
+	BaseCurrency   string
+	Rate           currency.Rate
+}
+
+// загружает адрес пользователя для копирования в заказ (проверяет принадлежность, как UpdateAddress)
+func snapshotAddress(ctx context.Context, tx pgx.Tx, userID string, addressID uuid.UUID) (*models.Address, error) {
+	var address models.Address
+
+	// Без явного адреса заказ доставляется на адрес доставки по умолчанию
+	var row pgx.Row
+
+	if addressID == uuid.Nil {
+		row = tx.QueryRow(ctx,
+			"SELECT address_id, house, street, city, pincode, state, country FROM addresses WHERE user_id = $1 AND is_default_shipping",
+			userID)
+
+	} else {
+		row = tx.QueryRow(ctx,
+			"SELECT address_id, house, street, city, pincode, state, country FROM addresses WHERE address_id = $1 AND user_id = $2",
+			addressID, userID)
+	}
+
+	err := row.Scan(&address.Addres_ID, &address.House, &address.Street, &address.City, &address.Pincode, &address.State, &address.Country)
+
+	if err == pgx.ErrNoRows {
+		return nil, ErrAddressNotFound
+	}
+
+	if err != nil {
+		return nil, err
+	}
+
+	return &address, nil
+}
+
+// рассчитывает стоимость доставки для адреса и веса заказа в базовой валюте
+func quoteShipping(params CheckoutParams, address *models.Address, weightGrams int64) (models.Money, error) {
+	region := ""
+
+	if address.State != nil {
+		region = *address.State
+	}
+
+	return params.Rates.Quote(params.ShippingMethod, region, weightGrams)
+}
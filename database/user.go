@@ -0,0 +1,33 @@
+package database
+
+import (
+	"context"
+	"ec-platform/models"
+	"errors"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+var (
+	ErrUserNotFound = errors.New("user not found")
+)
+
+// возвращает контактные данные пользователя для уведомлений: имя, email и язык
+func GetUserContact(ctx context.Context, db *pgxpool.Pool, userID string) (*models.User, error) {
+	var user models.User
+
+	err := db.QueryRow(ctx,
+		"SELECT user_id, first_name, email, locale FROM users WHERE user_id = $1",
+		userID).Scan(&user.User_ID, &user.First_Name, &user.Email, &user.Locale)
+
+	if err == pgx.ErrNoRows {
+		return nil, ErrUserNotFound
+	}
+
+	if err != nil {
+		return nil, err
+	}
+
+	return &user, nil
+}
@@ -0,0 +1,39 @@
+package database
+
+import (
+	"context"
+	"ec-platform/models"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+// WebhookStore - очередь доставок исходящих webhook, с которой работает отправитель.
+// PgWebhookStore хранит ее в таблицах webhook_*; в тестах подменяется хранилищем в памяти
+type WebhookStore interface {
+	CreateWebhookDeliveries(ctx context.Context, outboxEventID int64, eventType string, body []byte) (int64, error)
+	ClaimWebhookDeliveries(ctx context.Context, batch int, lease time.Duration) ([]models.WebhookDelivery, map[uuid.UUID]models.WebhookSubscription, error)
+	RecordWebhookAttempt(ctx context.Context, delivery models.WebhookDelivery, attempt models.WebhookDeliveryAttempt, status string, retryAt time.Time, pauseAfter int) (bool, error)
+}
+
+// PgWebhookStore - WebhookStore поверх функций пакета для пула соединений
+type PgWebhookStore struct {
+	db *pgxpool.Pool
+}
+
+func NewPgWebhookStore(db *pgxpool.Pool) *PgWebhookStore {
+	return &PgWebhookStore{db: db}
+}
+
+func (s *PgWebhookStore) CreateWebhookDeliveries(ctx context.Context, outboxEventID int64, eventType string, body []byte) (int64, error) {
+	return CreateWebhookDeliveries(ctx, s.db, outboxEventID, eventType, body)
+}
+
+func (s *PgWebhookStore) ClaimWebhookDeliveries(ctx context.Context, batch int, lease time.Duration) ([]models.WebhookDelivery, map[uuid.UUID]models.WebhookSubscription, error) {
+	return ClaimWebhookDeliveries(ctx, s.db, batch, lease)
+}
+
+func (s *PgWebhookStore) RecordWebhookAttempt(ctx context.Context, delivery models.WebhookDelivery, attempt models.WebhookDeliveryAttempt, status string, retryAt time.Time, pauseAfter int) (bool, error) {
+	return RecordWebhookAttempt(ctx, s.db, delivery, attempt, status, retryAt, pauseAfter)
+}
@@ -0,0 +1,384 @@
+package database
+
+import (
+	"context"
+	"ec-platform/models"
+	"errors"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+var (
+	ErrWebhookSubscriptionNotFound = errors.New("webhook subscription not found")
+	ErrWebhookDeliveryNotFound     = errors.New("webhook delivery not found")
+)
+
+// колонки подписки в порядке сканирования scanWebhookSubscription
+const webhookSubscriptionColumns = `
+	subscription_id, url, secret, event_types, consecutive_failures, paused_at, created_at, updated_at
+`
+
+func scanWebhookSubscription(row pgx.Row, subscription *models.WebhookSubscription) error {
+	return row.Scan(
+		&subscription.Subscription_ID,
+		&subscription.URL,
+		&subscription.Secret,
+		&subscription.Event_Types,
+		&subscription.Consecutive_Failures,
+		&subscription.Paused_At,
+		&subscription.Created_At,
+		&subscription.Updated_At,
+	)
+}
+
+// колонки доставки в порядке сканирования scanWebhookDelivery
+const webhookDeliveryColumns = `
+	d.id, d.subscription_id, d.outbox_event_id, d.event_type, d.payload, d.status, d.attempts,
+	d.response_code, d.last_error, d.next_attempt_at, d.created_at, d.delivered_at
+`
+
+func scanWebhookDelivery(row pgx.Row, delivery *models.WebhookDelivery, extra ...interface{}) error {
+	dest := []interface{}{
+		&delivery.ID,
+		&delivery.Subscription_ID,
+		&delivery.Outbox_Event_ID,
+		&delivery.Event_Type,
+		&delivery.Payload,
+		&delivery.Status,
+		&delivery.Attempts,
+		&delivery.Response_Code,
+		&delivery.Last_Error,
+		&delivery.Next_Attempt_At,
+		&delivery.Created_At,
+		&delivery.Delivered_At,
+	}
+
+	return row.Scan(append(dest, extra...)...)
+}
+
+// создает подписку; идентификатор и время заполняются здесь
+func CreateWebhookSubscription(ctx context.Context, db *pgxpool.Pool, subscription *models.WebhookSubscription) error {
+	now := time.Now().UTC()
+
+	subscription.Subscription_ID = uuid.New()
+	subscription.Created_At = now
+	subscription.Updated_At = now
+
+	_, err := db.Exec(ctx, `
+		INSERT INTO webhook_subscriptions (subscription_id, url, secret, event_types, created_at, updated_at)
+		VALUES ($1, $2, $3, $4, $5, $6)
+	`, subscription.Subscription_ID, subscription.URL, subscription.Secret, subscription.Event_Types, now, now)
+
+	return err
+}
+
+// возвращает все подписки
+func GetWebhookSubscriptions(ctx context.Context, db *pgxpool.Pool) ([]models.WebhookSubscription, error) {
+	rows, err := db.Query(ctx, "SELECT "+webhookSubscriptionColumns+" FROM webhook_subscriptions ORDER BY created_at")
+
+	if err != nil {
+		return nil, err
+	}
+
+	defer rows.Close()
+
+	subscriptions := make([]models.WebhookSubscription, 0)
+
+	for rows.Next() {
+		var subscription models.WebhookSubscription
+
+		if err := scanWebhookSubscription(rows, &subscription); err != nil {
+			return nil, err
+		}
+
+		subscriptions = append(subscriptions, subscription)
+	}
+
+	return subscriptions, rows.Err()
+}
+
+// удаляет подписку вместе с ее доставками
+func DeleteWebhookSubscription(ctx context.Context, db *pgxpool.Pool, subscriptionID uuid.UUID) error {
+	result, err := db.Exec(ctx, "DELETE FROM webhook_subscriptions WHERE subscription_id = $1", subscriptionID)
+
+	if err != nil {
+		return err
+	}
+
+	if result.RowsAffected() == 0 {
+		return ErrWebhookSubscriptionNotFound
+	}
+
+	return nil
+}
+
+// возобновляет приостановленную подписку: накопившиеся доставки уйдут подписчику
+func ResumeWebhookSubscription(ctx context.Context, db *pgxpool.Pool, subscriptionID uuid.UUID) error {
+	result, err := db.Exec(ctx,
+		"UPDATE webhook_subscriptions SET paused_at = NULL, consecutive_failures = 0, updated_at = $1 WHERE subscription_id = $2",
+		time.Now().UTC(), subscriptionID)
+
+	if err != nil {
+		return err
+	}
+
+	if result.RowsAffected() == 0 {
+		return ErrWebhookSubscriptionNotFound
+	}
+
+	return nil
+}
+
+// создает доставки события всем подпискам на его тип (в том числе приостановленным -
+// они получат событие после возобновления). Повторный вызов для того же события ничего не создает
+func CreateWebhookDeliveries(ctx context.Context, db *pgxpool.Pool, outboxEventID int64, eventType string, body []byte) (int64, error) {
+	result, err := db.Exec(ctx, `
+		INSERT INTO webhook_deliveries (subscription_id, outbox_event_id, event_type, payload, created_at, next_attempt_at)
+		SELECT subscription_id, $1, $2, $3, $4, $4
+		FROM webhook_subscriptions
+		WHERE $2 = ANY(event_types) OR '*' = ANY(event_types)
+		ON CONFLICT (subscription_id, outbox_event_id) DO NOTHING
+	`, outboxEventID, eventType, body, time.Now().UTC())
+
+	if err != nil {
+		return 0, err
+	}
+
+	return result.RowsAffected(), nil
+}
+
+// выбирает до batch готовых доставок активных подписок (FOR UPDATE SKIP LOCKED) и переносит их
+// следующую попытку на lease вперед: отправитель работает с ними после коммита, вне транзакции,
+// и другой отправитель их за это время не выберет. Если отправитель упадет, доставки повторятся после lease
+func ClaimWebhookDeliveries(ctx context.Context, db *pgxpool.Pool, batch int, lease time.Duration) ([]models.WebhookDelivery, map[uuid.UUID]models.WebhookSubscription, error) {
+	tx, err := db.Begin(ctx)
+
+	if err != nil {
+		return nil, nil, err
+	}
+
+	defer tx.Rollback(ctx)
+
+	now := time.Now().UTC()
+
+	rows, err := tx.Query(ctx, "SELECT "+webhookDeliveryColumns+`, s.url, s.secret
+		FROM webhook_deliveries d
+		JOIN webhook_subscriptions s ON s.subscription_id = d.subscription_id
+		WHERE d.status = $1 AND d.next_attempt_at <= $2 AND s.paused_at IS NULL
+		ORDER BY d.id
+		LIMIT $3
+		FOR UPDATE OF d SKIP LOCKED`, models.WebhookDeliveryPending, now, batch)
+
+	if err != nil {
+		return nil, nil, err
+	}
+
+	var deliveries []models.WebhookDelivery
+	var ids []int64
+	subscriptions := make(map[uuid.UUID]models.WebhookSubscription)
+
+	for rows.Next() {
+		var delivery models.WebhookDelivery
+		var subscription models.WebhookSubscription
+
+		if err := scanWebhookDelivery(rows, &delivery, &subscription.URL, &subscription.Secret); err != nil {
+			rows.Close()
+			return nil, nil, err
+		}
+
+		subscription.Subscription_ID = delivery.Subscription_ID
+		subscriptions[delivery.Subscription_ID] = subscription
+		deliveries = append(deliveries, delivery)
+		ids = append(ids, delivery.ID)
+	}
+
+	rows.Close()
+
+	if err := rows.Err(); err != nil {
+		return nil, nil, err
+	}
+
+	if len(deliveries) == 0 {
+		return nil, subscriptions, nil
+	}
+
+	_, err = tx.Exec(ctx, "UPDATE webhook_deliveries SET next_attempt_at = $1 WHERE id = ANY($2)", now.Add(lease), ids)
+
+	if err != nil {
+		return nil, nil, err
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		return nil, nil, err
+	}
+
+	return deliveries, subscriptions, nil
+}
+
+// записывает попытку доставки в журнал и ее итог: status - новый статус доставки (succeeded;
+// pending - повтор в retryAt; failed). Успех обнуляет счетчик неудач подписки, неудача увеличивает его,
+// и после pauseAfter неудач подряд подписка приостанавливается. Возвращает true, если подписка приостановлена
+func RecordWebhookAttempt(ctx context.Context, db *pgxpool.Pool, delivery models.WebhookDelivery, attempt models.WebhookDeliveryAttempt, status string, retryAt time.Time, pauseAfter int) (bool, error) {
+	tx, err := db.Begin(ctx)
+
+	if err != nil {
+		return false, err
+	}
+
+	defer tx.Rollback(ctx)
+
+	_, err = tx.Exec(ctx,
+		"INSERT INTO webhook_delivery_attempts (delivery_id, response_code, error, duration_ms, attempted_at) VALUES ($1, $2, $3, $4, $5)",
+		delivery.ID, attempt.Response_Code, attempt.Error, attempt.Duration_MS, attempt.Attempted_At)
+
+	if err != nil {
+		return false, err
+	}
+
+	now := time.Now().UTC()
+	var pausedAt *time.Time
+
+	if status == models.WebhookDeliverySucceeded {
+		_, err = tx.Exec(ctx, `
+			UPDATE webhook_deliveries
+			SET status = $1, attempts = attempts + 1, response_code = $2, last_error = NULL, delivered_at = $3
+			WHERE id = $4
+		`, status, attempt.Response_Code, now, delivery.ID)
+
+		if err != nil {
+			return false, err
+		}
+
+		_, err = tx.Exec(ctx,
+			"UPDATE webhook_subscriptions SET consecutive_failures = 0 WHERE subscription_id = $1 AND consecutive_failures <> 0",
+			delivery.Subscription_ID)
+
+		if err != nil {
+			return false, err
+		}
+
+	} else {
+		_, err = tx.Exec(ctx, `
+			UPDATE webhook_deliveries
+			SET status = $1, attempts = attempts + 1, response_code = $2, last_error = $3, next_attempt_at = $4
+			WHERE id = $5
+		`, status, attempt.Response_Code, attempt.Error, retryAt, delivery.ID)
+
+		if err != nil {
+			return false, err
+		}
+
+		err = tx.QueryRow(ctx, `
+			UPDATE webhook_subscriptions
+			SET consecutive_failures = consecutive_failures + 1,
+				paused_at = CASE WHEN consecutive_failures + 1 >= $1 THEN $2 ELSE paused_at END,
+				updated_at = $2
+			WHERE subscription_id = $3
+			RETURNING paused_at
+		`, pauseAfter, now, delivery.Subscription_ID).Scan(&pausedAt)
+
+		if err != nil {
+			return false, err
+		}
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		return false, err
+	}
+
+	return pausedAt != nil, nil
+}
+
+// возвращает доставки (новые сверху). subscriptionID == nil - всех подписок, пустой status - в любом статусе
+func GetWebhookDeliveries(ctx context.Context, db *pgxpool.Pool, subscriptionID *uuid.UUID, status string, limit int) ([]models.WebhookDelivery, error) {
+	rows, err := db.Query(ctx, "SELECT "+webhookDeliveryColumns+` FROM webhook_deliveries d
+		WHERE ($1::uuid IS NULL OR d.subscription_id = $1) AND ($2 = '' OR d.status = $2)
+		ORDER BY d.id DESC
+		LIMIT $3`, subscriptionID, status, limit)
+
+	if err != nil {
+		return nil, err
+	}
+
+	defer rows.Close()
+
+	deliveries := make([]models.WebhookDelivery, 0)
+
+	for rows.Next() {
+		var delivery models.WebhookDelivery
+
+		if err := scanWebhookDelivery(rows, &delivery); err != nil {
+			return nil, err
+		}
+
+		deliveries = append(deliveries, delivery)
+	}
+
+	return deliveries, rows.Err()
+}
+
+// возвращает доставку с журналом попыток
+func GetWebhookDelivery(ctx context.Context, db *pgxpool.Pool, deliveryID int64) (*models.WebhookDelivery, error) {
+	var delivery models.WebhookDelivery
+
+	err := scanWebhookDelivery(db.QueryRow(ctx, "SELECT "+webhookDeliveryColumns+" FROM webhook_deliveries d WHERE d.id = $1", deliveryID), &delivery)
+
+	if err == pgx.ErrNoRows {
+		return nil, ErrWebhookDeliveryNotFound
+	}
+
+	if err != nil {
+		return nil, err
+	}
+
+	rows, err := db.Query(ctx, `
+		SELECT id, response_code, error, duration_ms, attempted_at
+		FROM webhook_delivery_attempts
+		WHERE delivery_id = $1
+		ORDER BY id
+	`, deliveryID)
+
+	if err != nil {
+		return nil, err
+	}
+
+	defer rows.Close()
+
+	delivery.Attempt_Log = make([]models.WebhookDeliveryAttempt, 0)
+
+	for rows.Next() {
+		var attempt models.WebhookDeliveryAttempt
+
+		if err := rows.Scan(&attempt.ID, &attempt.Response_Code, &attempt.Error, &attempt.Duration_MS, &attempt.Attempted_At); err != nil {
+			return nil, err
+		}
+
+		delivery.Attempt_Log = append(delivery.Attempt_Log, attempt)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return &delivery, nil
+}
+
+// ставит доставку на повторную отправку (в том числе уже успешную или failed) с новым счетчиком попыток
+func ReplayWebhookDelivery(ctx context.Context, db *pgxpool.Pool, deliveryID int64) error {
+	result, err := db.Exec(ctx,
+		"UPDATE webhook_deliveries SET status = $1, attempts = 0, next_attempt_at = $2 WHERE id = $3",
+		models.WebhookDeliveryPending, time.Now().UTC(), deliveryID)
+
+	if err != nil {
+		return err
+	}
+
+	if result.RowsAffected() == 0 {
+		return ErrWebhookDeliveryNotFound
+	}
+
+	return nil
+}
@@ -0,0 +1,661 @@
+package database
+
+import (
+	"context"
+	"ec-platform/models"
+	"errors"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+var (
+	ErrWishlistNotFound     = errors.New("wishlist not found")
+	ErrWishlistExists       = errors.New("wishlist with this name already exists")
+	ErrDefaultWishlist      = errors.New("default wishlist can't be deleted")
+	ErrWishlistItemNotFound = errors.New("product is not in the wishlist")
+)
+
+// название списка по умолчанию
+const DefaultWishlistName = "Избранное"
+
+// колонки списка в порядке сканирования scanWishlist
+const wishlistColumns = `
+	w.wishlist_id, w.name, w.is_default, w.share_token, w.created_at, w.updated_at,
+	(SELECT COUNT(*) FROM wishlist_items wi WHERE wi.wishlist_id = w.wishlist_id)
+`
+
+func scanWishlist(row pgx.Row, wishlist *models.Wishlist) error {
+	err := row.Scan(
+		&wishlist.Wishlist_ID,
+		&wishlist.Name,
+		&wishlist.Is_Default,
+		&wishlist.Share_Token,
+		&wishlist.Created_At,
+		&wishlist.Updated_At,
+		&wishlist.Items_Count,
+	)
+
+	wishlist.Shared = wishlist.Share_Token != nil
+
+	return err
+}
+
+// возвращает списки пользователя: сначала список по умолчанию (создается при первом обращении)
+func GetWishlists(ctx context.Context, db *pgxpool.Pool, userID string) ([]models.Wishlist, error) {
+	tx, err := db.Begin(ctx)
+
+	if err != nil {
+		return nil, err
+	}
+
+	defer tx.Rollback(ctx)
+
+	if _, err := defaultWishlist(ctx, tx, userID); err != nil {
+		return nil, err
+	}
+
+	rows, err := tx.Query(ctx, "SELECT "+wishlistColumns+` FROM wishlists w
+		WHERE w.user_id = $1
+		ORDER BY w.is_default DESC, w.created_at`, userID)
+
+	if err != nil {
+		return nil, err
+	}
+
+	wishlists := make([]models.Wishlist, 0)
+
+	for rows.Next() {
+		var wishlist models.Wishlist
+
+		if err := scanWishlist(rows, &wishlist); err != nil {
+			rows.Close()
+			return nil, err
+		}
+
+		wishlists = append(wishlists, wishlist)
+	}
+
+	rows.Close()
+
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		return nil, err
+	}
+
+	return wishlists, nil
+}
+
+// создает именованный список; shared - сразу с публичной ссылкой
+func CreateWishlist(ctx context.Context, db *pgxpool.Pool, userID string, name string, shared bool) (*models.Wishlist, error) {
+	tx, err := db.Begin(ctx)
+
+	if err != nil {
+		return nil, err
+	}
+
+	defer tx.Rollback(ctx)
+
+	// Список по умолчанию создаем раньше, чтобы его название не занял именованный список
+	if _, err := defaultWishlist(ctx, tx, userID); err != nil {
+		return nil, err
+	}
+
+	var shareToken *string
+
+	if shared {
+		token, err := generateToken()
+
+		if err != nil {
+			return nil, err
+		}
+
+		shareToken = &token
+	}
+
+	wishlistID := uuid.New()
+	now := time.Now().UTC()
+
+	_, err = tx.Exec(ctx, `
+		INSERT INTO wishlists (wishlist_id, user_id, name, is_default, share_token, created_at, updated_at)
+		VALUES ($1, $2, $3, FALSE, $4, $5, $5)
+	`, wishlistID, userID, name, shareToken, now)
+
+	if isUniqueViolation(err) {
+		return nil, ErrWishlistExists
+	}
+
+	if err != nil {
+		return nil, err
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		return nil, err
+	}
+
+	return &models.Wishlist{
+		Wishlist_ID: wishlistID,
+		Name:        name,
+		Shared:      shared,
+		Share_Token: shareToken,
+		Created_At:  now,
+		Updated_At:  now,
+	}, nil
+}
+
+// переименовывает список и (или) открывает / закрывает публичную ссылку. Повторное открытие
+// выдает новую ссылку - старая перестает работать
+func UpdateWishlist(ctx context.Context, db *pgxpool.Pool, userID string, wishlistID uuid.UUID, name *string, shared *bool) (*models.Wishlist, error) {
+	tx, err := db.Begin(ctx)
+
+	if err != nil {
+		return nil, err
+	}
+
+	defer tx.Rollback(ctx)
+
+	var wishlist models.Wishlist
+
+	err = scanWishlist(tx.QueryRow(ctx, "SELECT "+wishlistColumns+" FROM wishlists w WHERE w.wishlist_id = $1 AND w.user_id = $2 FOR UPDATE",
+		wishlistID, userID), &wishlist)
+
+	if err == pgx.ErrNoRows {
+		return nil, ErrWishlistNotFound
+	}
+
+	if err != nil {
+		return nil, err
+	}
+
+	if name != nil {
+		wishlist.Name = *name
+	}
+
+	if shared != nil && *shared != wishlist.Shared {
+		wishlist.Share_Token = nil
+
+		if *shared {
+			token, err := generateToken()
+
+			if err != nil {
+				return nil, err
+			}
+
+			wishlist.Share_Token = &token
+		}
+
+		wishlist.Shared = *shared
+	}
+
+	wishlist.Updated_At = time.Now().UTC()
+
+	_, err = tx.Exec(ctx,
+		"UPDATE wishlists SET name = $1, share_token = $2, updated_at = $3 WHERE wishlist_id = $4",
+		wishlist.Name, wishlist.Share_Token, wishlist.Updated_At, wishlistID)
+
+	if isUniqueViolation(err) {
+		return nil, ErrWishlistExists
+	}
+
+	if err != nil {
+		return nil, err
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		return nil, err
+	}
+
+	return &wishlist, nil
+}
+
+// удаляет именованный список вместе с товарами; список по умолчанию не удаляется
+func DeleteWishlist(ctx context.Context, db *pgxpool.Pool, userID string, wishlistID uuid.UUID) error {
+	var isDefault bool
+
+	err := db.QueryRow(ctx,
+		"SELECT is_default FROM wishlists WHERE wishlist_id = $1 AND user_id = $2",
+		wishlistID, userID).Scan(&isDefault)
+
+	if err == pgx.ErrNoRows {
+		return ErrWishlistNotFound
+	}
+
+	if err != nil {
+		return err
+	}
+
+	if isDefault {
+		return ErrDefaultWishlist
+	}
+
+	_, err = db.Exec(ctx, "DELETE FROM wishlists WHERE wishlist_id = $1 AND user_id = $2 AND NOT is_default", wishlistID, userID)
+
+	return err
+}
+
+// возвращает список пользователя с товарами; uuid.Nil - список по умолчанию
+func GetWishlist(ctx context.Context, db *pgxpool.Pool, userID string, wishlistID uuid.UUID) (*models.Wishlist, error) {
+	tx, err := db.Begin(ctx)
+
+	if err != nil {
+		return nil, err
+	}
+
+	defer tx.Rollback(ctx)
+
+	wishlistID, err = resolveWishlist(ctx, tx, userID, wishlistID)
+
+	if err != nil {
+		return nil, err
+	}
+
+	var wishlist models.Wishlist
+
+	err = scanWishlist(tx.QueryRow(ctx, "SELECT "+wishlistColumns+" FROM wishlists w WHERE w.wishlist_id = $1", wishlistID), &wishlist)
+
+	if err != nil {
+		return nil, err
+	}
+
+	if wishlist.Items, err = getWishlistItems(ctx, tx, wishlistID); err != nil {
+		return nil, err
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		return nil, err
+	}
+
+	return &wishlist, nil
+}
+
+// возвращает открытый список по публичной ссылке (без авторизации)
+func GetSharedWishlist(ctx context.Context, db *pgxpool.Pool, token string) (*models.Wishlist, error) {
+	tx, err := db.Begin(ctx)
+
+	if err != nil {
+		return nil, err
+	}
+
+	defer tx.Rollback(ctx)
+
+	var wishlist models.Wishlist
+
+	err = scanWishlist(tx.QueryRow(ctx, "SELECT "+wishlistColumns+" FROM wishlists w WHERE w.share_token = $1", token), &wishlist)
+
+	if err == pgx.ErrNoRows {
+		return nil, ErrWishlistNotFound
+	}
+
+	if err != nil {
+		return nil, err
+	}
+
+	if wishlist.Items, err = getWishlistItems(ctx, tx, wishlist.Wishlist_ID); err != nil {
+		return nil, err
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		return nil, err
+	}
+
+	return &wishlist, nil
+}
+
+// добавляет товар в список (uuid.Nil - список по умолчанию) и возвращает id списка.
+// Повторное добавление ничего не меняет
+func AddWishlistItem(ctx context.Context, db *pgxpool.Pool, userID string, wishlistID uuid.UUID, productID uuid.UUID) (uuid.UUID, error) {
+	tx, err := db.Begin(ctx)
+
+	if err != nil {
+		return uuid.Nil, err
+	}
+
+	defer tx.Rollback(ctx)
+
+	wishlistID, err = resolveWishlist(ctx, tx, userID, wishlistID)
+
+	if err != nil {
+		return uuid.Nil, err
+	}
+
+	if err := addWishlistItem(ctx, tx, wishlistID, productID, 1); err != nil {
+		return uuid.Nil, err
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		return uuid.Nil, err
+	}
+
+	return wishlistID, nil
+}
+
+// удаляет товар из списка (uuid.Nil - список по умолчанию)
+func RemoveWishlistItem(ctx context.Context, db *pgxpool.Pool, userID string, wishlistID uuid.UUID, productID uuid.UUID) error {
+	tx, err := db.Begin(ctx)
+
+	if err != nil {
+		return err
+	}
+
+	defer tx.Rollback(ctx)
+
+	wishlistID, err = resolveWishlist(ctx, tx, userID, wishlistID)
+
+	if err != nil {
+		return err
+	}
+
+	if _, err := removeWishlistItem(ctx, tx, wishlistID, productID); err != nil {
+		return err
+	}
+
+	return tx.Commit(ctx)
+}
+
+// переносит товар из списка (uuid.Nil - список по умолчанию) в корзину с тем количеством,
+// с которым он был отложен (к количеству в корзине прибавляется)
+func MoveWishlistItemToCart(ctx context.Context, db *pgxpool.Pool, userID string, wishlistID uuid.UUID, productID uuid.UUID) error {
+	tx, err := db.Begin(ctx)
+
+	if err != nil {
+		return err
+	}
+
+	defer tx.Rollback(ctx)
+
+	wishlistID, err = resolveWishlist(ctx, tx, userID, wishlistID)
+
+	if err != nil {
+		return err
+	}
+
+	quantity, err := removeWishlistItem(ctx, tx, wishlistID, productID)
+
+	if err != nil {
+		return err
+	}
+
+	now := time.Now().UTC()
+
+	_, err = tx.Exec(ctx, `
+		INSERT INTO cart (id, user_id, product_id, quantity, price_snapshot, created_at, updated_at)
+		SELECT $1, $2, $3, $4, price, $5, $5 FROM product_price_at($3, $5)
+		ON CONFLICT (user_id, product_id) DO UPDATE
+			SET quantity = cart.quantity + EXCLUDED.quantity, updated_at = EXCLUDED.updated_at
+	`, uuid.New(), userID, productID, quantity, now)
+
+	if err != nil {
+		return err
+	}
+
+	return tx.Commit(ctx)
+}
+
+// откладывает товар из корзины в список по умолчанию вместе с количеством.
+// Возвращает id списка; ErrRecordNotFound - товара нет в корзине
+func SaveForLater(ctx context.Context, db *pgxpool.Pool, userID string, productID uuid.UUID) (uuid.UUID, error) {
+	tx, err := db.Begin(ctx)
+
+	if err != nil {
+		return uuid.Nil, err
+	}
+
+	defer tx.Rollback(ctx)
+
+	var quantity int
+
+	err = tx.QueryRow(ctx,
+		"DELETE FROM cart WHERE user_id = $1 AND product_id = $2 RETURNING quantity",
+		userID, productID).Scan(&quantity)
+
+	if err == pgx.ErrNoRows {
+		return uuid.Nil, ErrRecordNotFound
+	}
+
+	if err != nil {
+		return uuid.Nil, err
+	}
+
+	wishlistID, err := defaultWishlist(ctx, tx, userID)
+
+	if err != nil {
+		return uuid.Nil, err
+	}
+
+	if err := addWishlistItem(ctx, tx, wishlistID, productID, quantity); err != nil {
+		return uuid.Nil, err
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		return uuid.Nil, err
+	}
+
+	return wishlistID, nil
+}
+
+// находит до limit товаров из списков, подешевевших с последней отметки price_seen, сдвигает
+// отметку на новую цену и в той же транзакции ставит задачи jobType с данными
+// payload(пользователь, снижения) - одну на пользователя. Возвращает количество обработанных товаров
+func CreatePriceDropNotifications(ctx context.Context, db *pgxpool.Pool, limit int, jobType string, payload func(userID string, drops []models.PriceDrop) interface{}) (int, error) {
+	tx, err := db.Begin(ctx)
+
+	if err != nil {
+		return 0, err
+	}
+
+	defer tx.Rollback(ctx)
+
+	rows, err := tx.Query(ctx, `
+		SELECT wi.id, w.user_id, p.product_id, p.product_name, wi.price_seen, pp.price
+		FROM wishlist_items wi
+		JOIN wishlists w ON wi.wishlist_id = w.wishlist_id
+		JOIN products p ON wi.product_id = p.product_id
+		JOIN LATERAL product_price_at(p.product_id, $2) pp ON TRUE
+		WHERE pp.price < wi.price_seen
+		ORDER BY w.user_id, wi.added_at
+		LIMIT $1
+		FOR UPDATE OF wi SKIP LOCKED
+	`, limit, time.Now().UTC())
+
+	if err != nil {
+		return 0, err
+	}
+
+	var itemIDs []uuid.UUID
+	var users []string
+
+	drops := make(map[string][]models.PriceDrop)
+
+	for rows.Next() {
+		var itemID uuid.UUID
+		var userID string
+		var drop models.PriceDrop
+
+		if err := rows.Scan(&itemID, &userID, &drop.Product_ID, &drop.Product_Name, &drop.Old_Price, &drop.New_Price); err != nil {
+			rows.Close()
+			return 0, err
+		}
+
+		itemIDs = append(itemIDs, itemID)
+
+		if _, ok := drops[userID]; !ok {
+			users = append(users, userID)
+		}
+
+		drops[userID] = appendPriceDrop(drops[userID], drop)
+	}
+
+	rows.Close()
+
+	if err := rows.Err(); err != nil {
+		return 0, err
+	}
+
+	if len(itemIDs) == 0 {
+		return 0, nil
+	}
+
+	now := time.Now().UTC()
+
+	_, err = tx.Exec(ctx, `
+		UPDATE wishlist_items wi SET
+			price_seen = (SELECT price FROM product_price_at(wi.product_id, $1)),
+			price_drop_notified_at = $1
+		WHERE wi.id = ANY($2)
+	`, now, itemIDs)
+
+	if err != nil {
+		return 0, err
+	}
+
+	for _, userID := range users {
+		if _, err := enqueueJob(ctx, tx, jobType, payload(userID, drops[userID]), now, ""); err != nil {
+			return 0, err
+		}
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		return 0, err
+	}
+
+	return len(itemIDs), nil
+}
+
+// товар в нескольких списках пользователя попадает в письмо один раз - с наибольшей старой ценой
+func appendPriceDrop(drops []models.PriceDrop, drop models.PriceDrop) []models.PriceDrop {
+	for i := range drops {
+		if drops[i].Product_ID == drop.Product_ID {
+			if drop.Old_Price > drops[i].Old_Price {
+				drops[i].Old_Price = drop.Old_Price
+			}
+
+			return drops
+		}
+	}
+
+	return append(drops, drop)
+}
+
+// id списка по умолчанию; создает его при первом обращении
+func defaultWishlist(ctx context.Context, tx pgx.Tx, userID string) (uuid.UUID, error) {
+	now := time.Now().UTC()
+
+	_, err := tx.Exec(ctx, `
+		INSERT INTO wishlists (wishlist_id, user_id, name, is_default, created_at, updated_at)
+		VALUES ($1, $2, $3, TRUE, $4, $4)
+		ON CONFLICT DO NOTHING
+	`, uuid.New(), userID, DefaultWishlistName, now)
+
+	if err != nil {
+		return uuid.Nil, err
+	}
+
+	var wishlistID uuid.UUID
+
+	err = tx.QueryRow(ctx, "SELECT wishlist_id FROM wishlists WHERE user_id = $1 AND is_default", userID).Scan(&wishlistID)
+
+	return wishlistID, err
+}
+
+// проверяет, что список принадлежит пользователю; uuid.Nil - список по умолчанию
+func resolveWishlist(ctx context.Context, tx pgx.Tx, userID string, wishlistID uuid.UUID) (uuid.UUID, error) {
+	if wishlistID == uuid.Nil {
+		return defaultWishlist(ctx, tx, userID)
+	}
+
+	var exists bool
+
+	err := tx.QueryRow(ctx,
+		"SELECT EXISTS(SELECT 1 FROM wishlists WHERE wishlist_id = $1 AND user_id = $2)",
+		wishlistID, userID).Scan(&exists)
+
+	if err != nil {
+		return uuid.Nil, err
+	}
+
+	if !exists {
+		return uuid.Nil, ErrWishlistNotFound
+	}
+
+	return wishlistID, nil
+}
+
+// добавляет товар в список по текущей цене; если товар уже там - количество не меньше quantity
+func addWishlistItem(ctx context.Context, tx pgx.Tx, wishlistID uuid.UUID, productID uuid.UUID, quantity int) error {
+	result, err := tx.Exec(ctx, `
+		INSERT INTO wishlist_items (id, wishlist_id, product_id, quantity, price_seen, added_at)
+		SELECT $1, $2, $3, $4, price, $5 FROM product_price_at($3, $5)
+		ON CONFLICT (wishlist_id, product_id) DO UPDATE
+			SET quantity = GREATEST(wishlist_items.quantity, EXCLUDED.quantity)
+	`, uuid.New(), wishlistID, productID, quantity, time.Now().UTC())
+
+	if err != nil {
+		return err
+	}
+
+	if result.RowsAffected() == 0 {
+		return ErrRecordNotFound
+	}
+
+	return nil
+}
+
+// удаляет товар из списка и возвращает его количество
+func removeWishlistItem(ctx context.Context, tx pgx.Tx, wishlistID uuid.UUID, productID uuid.UUID) (int, error) {
+	var quantity int
+
+	err := tx.QueryRow(ctx,
+		"DELETE FROM wishlist_items WHERE wishlist_id = $1 AND product_id = $2 RETURNING quantity",
+		wishlistID, productID).Scan(&quantity)
+
+	if err == pgx.ErrNoRows {
+		return 0, ErrWishlistItemNotFound
+	}
+
+	return quantity, err
+}
+
+func getWishlistItems(ctx context.Context, tx pgx.Tx, wishlistID uuid.UUID) ([]models.WishlistItem, error) {
+	rows, err := tx.Query(ctx, `
+		SELECT p.product_id, p.product_name, pp.price, pp.compare_at_price, wi.price_seen, p.rating, p.image, wi.quantity, wi.added_at
+		FROM wishlist_items wi
+		JOIN products p ON wi.product_id = p.product_id
+		JOIN LATERAL product_price_at(p.product_id, $2) pp ON TRUE
+		WHERE wi.wishlist_id = $1
+		ORDER BY wi.added_at DESC
+	`, wishlistID, time.Now().UTC())
+
+	if err != nil {
+		return nil, err
+	}
+
+	defer rows.Close()
+
+	items := make([]models.WishlistItem, 0)
+
+	for rows.Next() {
+		var item models.WishlistItem
+
+		err := rows.Scan(&item.Product_ID, &item.Product_Name, &item.Price, &item.Compare_At_Price, &item.Price_Seen, &item.Rating, &item.Image, &item.Quantity, &item.Added_At)
+
+		if err != nil {
+			return nil, err
+		}
+
+		items = append(items, item)
+	}
+
+	return items, rows.Err()
+}
+
+func isUniqueViolation(err error) bool {
+	var pgErr *pgconn.PgError
+
+	return errors.As(err, &pgErr) && pgErr.Code == "23505"
+}
@@ -0,0 +1,161 @@
+package events
+
+import (
+	"context"
+	"ec-platform/database"
+	"ec-platform/models"
+	"errors"
+	"fmt"
+	"log"
+	"sync"
+	"time"
+
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+// AllEvents - подписка обработчика на события любого типа
+const AllEvents = "*"
+
+// Types - все типы доменных событий
+var Types = []string{
+	models.EventOrderPlaced,
+	models.EventOrderStatusChanged,
+	models.EventOrderCancelled,
+	models.EventReturnRequested,
+	models.EventInvoiceIssued,
+}
+
+// IsKnownType проверяет тип события для подписки (AllEvents - любой тип)
+func IsKnownType(eventType string) bool {
+	if eventType == AllEvents {
+		return true
+	}
+
+	for _, known := range Types {
+		if known == eventType {
+			return true
+		}
+	}
+
+	return false
+}
+
+// Параметры доставки по умолчанию
+const (
+	DefaultInterval    = time.Second
+	DefaultBatchSize   = 50
+	DefaultMaxAttempts = 10
+)
+
+// Handler обрабатывает доменное событие. Доставка at-least-once: при ошибке любого
+// обработчика событие повторяется для всех обработчиков, поэтому они должны быть идемпотентными
+type Handler func(ctx context.Context, event models.OutboxEvent) error
+
+// Dispatcher читает события из outbox и передает их подписанным обработчикам
+type Dispatcher struct {
+	db          *pgxpool.Pool
+	Interval    time.Duration
+	BatchSize   int
+	MaxAttempts int
+
+	mu       sync.RWMutex
+	handlers map[string][]Handler
+}
+
+func NewDispatcher(db *pgxpool.Pool) *Dispatcher {
+	return &Dispatcher{
+		db:          db,
+		Interval:    DefaultInterval,
+		BatchSize:   DefaultBatchSize,
+		MaxAttempts: DefaultMaxAttempts,
+		handlers:    make(map[string][]Handler),
+	}
+}
+
+// Subscribe подписывает обработчик на тип события (или AllEvents)
+func (d *Dispatcher) Subscribe(eventType string, handler Handler) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	d.handlers[eventType] = append(d.handlers[eventType], handler)
+}
+
+// Run доставляет события до отмены ctx. Пока есть готовые события, пачки выбираются без паузы
+func (d *Dispatcher) Run(ctx context.Context) {
+	ticker := time.NewTicker(d.Interval)
+	defer ticker.Stop()
+
+	for {
+		for {
+			count, err := database.DispatchOutbox(ctx, d.db, d.BatchSize, d.MaxAttempts, Backoff, d.handle)
+
+			if err != nil {
+				if ctx.Err() == nil {
+					log.Printf("error dispatching outbox events: %v", err)
+				}
+
+				break
+			}
+
+			if count < d.BatchSize {
+				break
+			}
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+
+		case <-ticker.C:
+		}
+	}
+}
+
+// вызывает все обработчики события; паника обработчика считается ошибкой доставки
+func (d *Dispatcher) handle(ctx context.Context, event models.OutboxEvent) error {
+	d.mu.RLock()
+	handlers := append(append([]Handler(nil), d.handlers[event.Event_Type]...), d.handlers[AllEvents]...)
+	d.mu.RUnlock()
+
+	var errs []error
+
+	for _, handler := range handlers {
+		if err := safeCall(ctx, handler, event); err != nil {
+			errs = append(errs, err)
+		}
+	}
+
+	if err := errors.Join(errs...); err != nil {
+		log.Printf("outbox event %d (%s) failed, attempt %d: %v", event.ID, event.Event_Type, event.Attempts+1, err)
+		return err
+	}
+
+	return nil
+}
+
+func safeCall(ctx context.Context, handler Handler, event models.OutboxEvent) (err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			err = fmt.Errorf("handler panic: %v", r)
+		}
+	}()
+
+	return handler(ctx, event)
+}
+
+// Backoff - задержка перед повтором: 5s, 10s, 20s ... но не больше часа
+func Backoff(attempt int) time.Duration {
+	delay := 5 * time.Second
+
+	for i := 1; i < attempt && delay < time.Hour; i++ {
+		delay *= 2
+	}
+
+	return min(delay, time.Hour)
+}
+
+// LogHandler пишет события в лог (аналитика по умолчанию)
+func LogHandler(ctx context.Context, event models.OutboxEvent) error {
+	log.Printf("event %s %s: %s", event.Event_Type, event.Aggregate_ID, event.Payload)
+	return nil
+}
@@ -0,0 +1,146 @@
+package images
+
+import (
+	"bytes"
+	"errors"
+	"image"
+	"image/color"
+	_ "image/gif"
+	"image/jpeg"
+	"image/png"
+	"net/http"
+)
+
+var (
+	ErrUnsupportedImage = errors.New("unsupported image format, expected JPEG, PNG or GIF")
+	ErrImageTooLarge    = errors.New("image dimensions are too large")
+)
+
+// Ограничения и размер миниатюры
+const (
+	// большая сторона исходного изображения, защищает от "бомб" с огромными размерами
+	MaxDimension = 8000
+	// большая сторона миниатюры
+	ThumbnailSize = 320
+)
+
+// поддерживаемые форматы: тип содержимого -> расширение файла
+var formats = map[string]string{
+	"image/jpeg": ".jpg",
+	"image/png":  ".png",
+	"image/gif":  ".gif",
+}
+
+// Image - проверенное изображение с миниатюрой
+type Image struct {
+	ContentType string
+	Ext         string
+	Width       int
+	Height      int
+
+	Thumbnail            []byte
+	ThumbnailContentType string
+	ThumbnailExt         string
+}
+
+// Process определяет формат по содержимому (а не по имени файла и заголовкам запроса),
+// проверяет размеры и строит миниатюру. JPEG-миниатюры - JPEG, остальные - PNG (с прозрачностью)
+func Process(data []byte) (*Image, error) {
+	contentType := http.DetectContentType(data)
+	ext, ok := formats[contentType]
+
+	if !ok {
+		return nil, ErrUnsupportedImage
+	}
+
+	config, _, err := image.DecodeConfig(bytes.NewReader(data))
+
+	if err != nil {
+		return nil, ErrUnsupportedImage
+	}
+
+	if config.Width > MaxDimension || config.Height > MaxDimension {
+		return nil, ErrImageTooLarge
+	}
+
+	decoded, _, err := image.Decode(bytes.NewReader(data))
+
+	if err != nil {
+		return nil, ErrUnsupportedImage
+	}
+
+	img := &Image{
+		ContentType: contentType,
+		Ext:         ext,
+		Width:       config.Width,
+		Height:      config.Height,
+	}
+
+	var thumbnail bytes.Buffer
+
+	if contentType == "image/jpeg" {
+		err = jpeg.Encode(&thumbnail, Thumbnail(decoded, ThumbnailSize), &jpeg.Options{Quality: 85})
+		img.ThumbnailContentType, img.ThumbnailExt = "image/jpeg", ".jpg"
+
+	} else {
+		err = png.Encode(&thumbnail, Thumbnail(decoded, ThumbnailSize))
+		img.ThumbnailContentType, img.ThumbnailExt = "image/png", ".png"
+	}
+
+	if err != nil {
+		return nil, err
+	}
+
+	img.Thumbnail = thumbnail.Bytes()
+
+	return img, nil
+}
+
+// Thumbnail уменьшает изображение так, чтобы большая сторона была не больше size
+// (пропорции сохраняются, маленькие изображения не увеличиваются). Каждый пиксель
+// миниатюры - среднее по соответствующему прямоугольнику исходного изображения
+func Thumbnail(src image.Image, size int) image.Image {
+	bounds := src.Bounds()
+	width, height := bounds.Dx(), bounds.Dy()
+
+	dstWidth, dstHeight := width, height
+
+	if width > size || height > size {
+		if width >= height {
+			dstWidth, dstHeight = size, max(1, height*size/width)
+		} else {
+			dstWidth, dstHeight = max(1, width*size/height), size
+		}
+	}
+
+	dst := image.NewRGBA(image.Rect(0, 0, dstWidth, dstHeight))
+
+	for y := 0; y < dstHeight; y++ {
+		y0 := bounds.Min.Y + y*height/dstHeight
+		y1 := max(y0+1, bounds.Min.Y+(y+1)*height/dstHeight)
+
+		for x := 0; x < dstWidth; x++ {
+			x0 := bounds.Min.X + x*width/dstWidth
+			x1 := max(x0+1, bounds.Min.X+(x+1)*width/dstWidth)
+
+			var r, g, b, a, n uint64
+
+			for sy := y0; sy < y1; sy++ {
+				for sx := x0; sx < x1; sx++ {
+					cr, cg, cb, ca := src.At(sx, sy).RGBA()
+					r, g, b, a = r+uint64(cr), g+uint64(cg), b+uint64(cb), a+uint64(ca)
+					n++
+				}
+			}
+
+			dst.SetRGBA(x, y, color.RGBA{
+				R: uint8(r / n >> 8),
+				G: uint8(g / n >> 8),
+				B: uint8(b / n >> 8),
+				A: uint8(a / n >> 8),
+			})
+		}
+	}
+
+	return dst
+}
@@ -0,0 +1,120 @@
+package invoices
+
+import (
+	"ec-platform/currency"
+	"ec-platform/models"
+	"fmt"
+	"html/template"
+	"io"
+	"strconv"
+	"strings"
+)
+
+// Title - заголовок документа по его виду
+func Title(invoice *models.Invoice) string {
+	if invoice.Kind == models.InvoiceKindCreditNote {
+		return "Credit note"
+	}
+
+	return "Invoice"
+}
+
+// FormatRate форматирует ставку налога из базисных пунктов: 2000 -> "20%", 1250 -> "12.5%"
+func FormatRate(rateBP int) string {
+	rate := fmt.Sprintf("%d.%02d", rateBP/100, rateBP%100)
+	rate = strings.TrimRight(strings.TrimRight(rate, "0"), ".")
+
+	return rate + "%"
+}
+
+// FormatAmount форматирует сумму в минорных единицах по числу знаков валюты: 150000 RUB -> "1500.00", 1500 JPY -> "1500"
+func FormatAmount(amount models.Money, code string) string {
+	digits := strconv.FormatInt(int64(amount), 10)
+	sign := ""
+
+	if strings.HasPrefix(digits, "-") {
+		sign, digits = "-", digits[1:]
+	}
+
+	units := currency.MinorUnits(code)
+
+	if units == 0 {
+		return sign + digits
+	}
+
+	if len(digits) <= units {
+		digits = strings.Repeat("0", units-len(digits)+1) + digits
+	}
+
+	return sign + digits[:len(digits)-units] + "." + digits[len(digits)-units:]
+}
+
+// FormatAddress собирает адрес покупателя в одну строку, пропуская пустые части
+func FormatAddress(address models.Address) string {
+	var parts []string
+
+	for _, part := range []*string{address.House, address.Street, address.City, address.State, address.Pincode} {
+		if part != nil && *part != "" {
+			parts = append(parts, *part)
+		}
+	}
+
+	return strings.Join(parts, ", ")
+}
+
+var htmlTemplate = template.Must(template.New("invoice").Funcs(template.FuncMap{
+	"title":   Title,
+	"rate":    FormatRate,
+	"amount":  FormatAmount,
+	"address": FormatAddress,
+}).Parse(`<!DOCTYPE html>
+<html>
+<head>
+<meta charset="utf-8">
+<title>{{title .}} {{.Number}}</title>
+<style>
+body { font-family: Helvetica, Arial, sans-serif; font-size: 14px; margin: 40px; color: #222; }
+h1 { font-size: 22px; margin-bottom: 4px; }
+table { border-collapse: collapse; width: 100%; margin-top: 24px; }
+th, td { border-bottom: 1px solid #ddd; padding: 6px 8px; text-align: left; }
+td.num, th.num { text-align: right; }
+.parties { display: flex; gap: 48px; margin-top: 24px; }
+.totals td { border: none; }
+</style>
+</head>
+<body>
+<h1>{{title .}} {{.Number}}</h1>
+<div>Issued: {{.Issued_At.Format "2006-01-02"}}</div>
+<div>Order: {{.Order_ID}}</div>
+<div>Currency: {{.Currency}}</div>
+<div class="parties">
+<div>
+<strong>Seller</strong><br>
+{{.Seller_Name}}<br>
+Tax ID: {{.Seller_Tax_ID}}<br>
+{{.Seller_Address}}
+</div>
+<div>
+<strong>Buyer</strong><br>
+{{.Buyer_Name}}<br>
+{{.Buyer_Email}}<br>
+{{address .Buyer_Address}}
+</div>
+</div>
+<table>
+<tr><th>#</th><th>Description</th><th class="num">Qty</th><th class="num">Unit price</th><th class="num">Tax rate</th><th class="num">Net</th><th class="num">Tax</th><th class="num">Total</th></tr>
+{{range .Lines}}<tr><td>{{.Position}}</td><td>{{.Description}}</td><td class="num">{{.Quantity}}</td><td class="num">{{amount .Unit_Price $.Currency}}</td><td class="num">{{rate .Tax_Rate_BP}}</td><td class="num">{{amount .Net $.Currency}}</td><td class="num">{{amount .Tax $.Currency}}</td><td class="num">{{amount .Total $.Currency}}</td></tr>
+{{end}}</table>
+<table class="totals">
+<tr><td class="num">Subtotal</td><td class="num">{{amount .Subtotal .Currency}}</td></tr>
+<tr><td class="num">Tax</td><td class="num">{{amount .Tax_Total .Currency}}</td></tr>
+<tr><td class="num"><strong>Total</strong></td><td class="num"><strong>{{amount .Total .Currency}}</strong></td></tr>
+</table>
+</body>
+</html>
+`))
+
+// RenderHTML выводит документ в виде HTML-страницы
+func RenderHTML(w io.Writer, invoice *models.Invoice) error {
+	return htmlTemplate.Execute(w, invoice)
+}
@@ -0,0 +1,67 @@
+package invoices
+
+import (
+	"bytes"
+	"ec-platform/models"
+	"strings"
+	"testing"
+)
+
+func TestFormatAmount(t *testing.T) {
+	tests := []struct {
+		amount   models.Money
+		currency string
+		want     string
+	}{
+		{150000, "RUB", "1500.00"},
+		{150050, "USD", "1500.50"},
+		{5, "EUR", "0.05"},
+		{0, "RUB", "0.00"},
+		{-1250, "RUB", "-12.50"},
+		{1500, "JPY", "1500"},
+		{1500, "KRW", "1500"},
+	}
+
+	for _, tt := range tests {
+		if got := FormatAmount(tt.amount, tt.currency); got != tt.want {
+			t.Errorf("FormatAmount(%d, %s) = %q, want %q", tt.amount, tt.currency, got, tt.want)
+		}
+	}
+}
+
+func TestRenderHTMLFormatsAmountsInInvoiceCurrency(t *testing.T) {
+	invoice := &models.Invoice{
+		Kind:      models.InvoiceKindInvoice,
+		Number:    "INV-2026-000001",
+		Subtotal:  100000,
+		Tax_Total: 20000,
+		Total:     120000,
+		Lines: []models.InvoiceLine{
+			{Position: 1, Description: "Phone", Quantity: 2, Unit_Price: 60000, Tax_Rate_BP: 2000, Net: 100000, Tax: 20000, Total: 120000},
+		},
+	}
+
+	tests := []struct {
+		currency string
+		want     []string
+	}{
+		{"RUB", []string{"600.00", "1000.00", "200.00", "1200.00"}},
+		{"JPY", []string{"60000", "100000", "20000", "120000"}},
+	}
+
+	for _, tt := range tests {
+		invoice.Currency = tt.currency
+
+		var out bytes.Buffer
+
+		if err := RenderHTML(&out, invoice); err != nil {
+			t.Fatalf("RenderHTML() error = %v", err)
+		}
+
+		for _, amount := range tt.want {
+			if !strings.Contains(out.String(), ">"+amount+"<") {
+				t.Errorf("%s invoice has no amount %q", tt.currency, amount)
+			}
+		}
+	}
+}
@@ -0,0 +1,294 @@
+package invoices
+
+import (
+	"bytes"
+	"ec-platform/models"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+)
+
+// Размеры страницы A4 и поля в пунктах
+const (
+	pageWidth    = 595.0
+	pageHeight   = 842.0
+	pageMargin   = 50.0
+	lineHeight   = 14.0
+	fontSize     = 10.0
+	titleSize    = 18.0
+	digitWidth   = 0.556 // ширина цифры Helvetica в долях кегля
+	maxLineWidth = 36    // символов описания в строке таблицы
+)
+
+// правые границы числовых колонок таблицы
+var pdfColumns = []struct {
+	title string
+	right float64
+}{
+	{"Qty", 280},
+	{"Unit price", 340},
+	{"Tax rate", 385},
+	{"Net", 435},
+	{"Tax", 485},
+	{"Total", pageWidth - pageMargin},
+}
+
+// pdfWriter собирает страницы документа из текстовых операций PDF.
+// Используются стандартные шрифты Helvetica, поэтому встраивать шрифты не нужно
+type pdfWriter struct {
+	pages []*bytes.Buffer
+	y     float64
+}
+
+func (p *pdfWriter) newPage() {
+	p.pages = append(p.pages, &bytes.Buffer{})
+	p.y = pageHeight - pageMargin
+}
+
+// переносит вывод на новую страницу, если на текущей не хватает места
+func (p *pdfWriter) ensureSpace(height float64) {
+	if len(p.pages) == 0 || p.y-height < pageMargin {
+		p.newPage()
+	}
+}
+
+func (p *pdfWriter) text(x float64, size float64, bold bool, s string) {
+	font := "F1"
+
+	if bold {
+		font = "F2"
+	}
+
+	fmt.Fprintf(p.pages[len(p.pages)-1], "BT /%s %s Tf %s %s Td (%s) Tj ET\n",
+		font, formatFloat(size), formatFloat(x), formatFloat(p.y), pdfString(s))
+}
+
+// выводит число, выровненное по правой границе right (ширина цифр в Helvetica одинакова)
+func (p *pdfWriter) number(right float64, bold bool, s string) {
+	p.text(right-float64(len(s))*digitWidth*fontSize, fontSize, bold, s)
+}
+
+func (p *pdfWriter) line() {
+	fmt.Fprintf(p.pages[len(p.pages)-1], "%s %s m %s %s l S\n",
+		formatFloat(pageMargin), formatFloat(p.y+lineHeight-4), formatFloat(pageWidth-pageMargin), formatFloat(p.y+lineHeight-4))
+}
+
+func (p *pdfWriter) nextLine() {
+	p.y -= lineHeight
+}
+
+// RenderPDF выводит документ в формате PDF
+func RenderPDF(w io.Writer, invoice *models.Invoice) error {
+	p := &pdfWriter{}
+	p.newPage()
+
+	p.text(pageMargin, titleSize, true, Title(invoice)+" "+invoice.Number)
+	p.y -= titleSize + 6
+
+	p.text(pageMargin, fontSize, false, "Issued: "+invoice.Issued_At.Format("2006-01-02"))
+	p.nextLine()
+	p.text(pageMargin, fontSize, false, "Order: "+invoice.Order_ID.String())
+	p.nextLine()
+	p.text(pageMargin, fontSize, false, "Currency: "+invoice.Currency)
+	p.nextLine()
+	p.nextLine()
+
+	seller := []string{invoice.Seller_Name, "Tax ID: " + invoice.Seller_Tax_ID, invoice.Seller_Address}
+	buyer := []string{invoice.Buyer_Name, invoice.Buyer_Email, FormatAddress(invoice.Buyer_Address)}
+
+	p.text(pageMargin, fontSize, true, "Seller")
+	p.text(pageWidth/2, fontSize, true, "Buyer")
+	p.nextLine()
+
+	for i := range seller {
+		p.text(pageMargin, fontSize, false, seller[i])
+		p.text(pageWidth/2, fontSize, false, buyer[i])
+		p.nextLine()
+	}
+
+	p.nextLine()
+	writeTableHeader(p)
+
+	for _, l := range invoice.Lines {
+		description := wrapText(l.Description, maxLineWidth)
+		p.ensureSpace(lineHeight * float64(len(description)))
+
+		if p.y == pageHeight-pageMargin {
+			writeTableHeader(p)
+		}
+
+		values := []string{
+			strconv.Itoa(l.Quantity),
+			FormatAmount(l.Unit_Price, invoice.Currency),
+			FormatRate(l.Tax_Rate_BP),
+			FormatAmount(l.Net, invoice.Currency),
+			FormatAmount(l.Tax, invoice.Currency),
+			FormatAmount(l.Total, invoice.Currency),
+		}
+
+		p.text(pageMargin, fontSize, false, strconv.Itoa(l.Position))
+
+		for i, value := range values {
+			p.number(pdfColumns[i].right, false, value)
+		}
+
+		for _, part := range description {
+			p.text(pageMargin+20, fontSize, false, part)
+			p.nextLine()
+		}
+	}
+
+	p.ensureSpace(lineHeight * 4)
+	p.line()
+	p.nextLine()
+
+	totals := []struct {
+		label string
+		value models.Money
+		bold  bool
+	}{
+		{"Subtotal", invoice.Subtotal, false},
+		{"Tax", invoice.Tax_Total, false},
+		{"Total", invoice.Total, true},
+	}
+
+	for _, total := range totals {
+		p.text(390, fontSize, total.bold, total.label)
+		p.number(pageWidth-pageMargin, total.bold, FormatAmount(total.value, invoice.Currency))
+		p.nextLine()
+	}
+
+	return p.writeTo(w)
+}
+
+func writeTableHeader(p *pdfWriter) {
+	p.text(pageMargin, fontSize, true, "#")
+	p.text(pageMargin+20, fontSize, true, "Description")
+
+	for _, column := range pdfColumns {
+		// заголовки не цифровые - выравниваем приблизительно
+		p.text(column.right-float64(len(column.title))*0.5*fontSize, fontSize, true, column.title)
+	}
+
+	p.nextLine()
+	p.line()
+}
+
+// собирает объекты PDF и таблицу перекрестных ссылок
+func (p *pdfWriter) writeTo(w io.Writer) error {
+	var out bytes.Buffer
+	var offsets []int
+
+	object := func(body string) {
+		offsets = append(offsets, out.Len())
+		fmt.Fprintf(&out, "%d 0 obj\n%s\nendobj\n", len(offsets), body)
+	}
+
+	out.WriteString("%PDF-1.4\n")
+
+	// 1 - каталог, 2 - дерево страниц, 3 и 4 - шрифты, далее пары страница/содержимое
+	kids := make([]string, len(p.pages))
+
+	for i := range p.pages {
+		kids[i] = fmt.Sprintf("%d 0 R", 5+i*2)
+	}
+
+	object("<< /Type /Catalog /Pages 2 0 R >>")
+	object(fmt.Sprintf("<< /Type /Pages /Kids [%s] /Count %d >>", strings.Join(kids, " "), len(p.pages)))
+	object("<< /Type /Font /Subtype /Type1 /BaseFont /Helvetica /Encoding /WinAnsiEncoding >>")
+	object("<< /Type /Font /Subtype /Type1 /BaseFont /Helvetica-Bold /Encoding /WinAnsiEncoding >>")
+
+	for i, page := range p.pages {
+		object(fmt.Sprintf("<< /Type /Page /Parent 2 0 R /MediaBox [0 0 %s %s] /Resources << /Font << /F1 3 0 R /F2 4 0 R >> >> /Contents %d 0 R >>",
+			formatFloat(pageWidth), formatFloat(pageHeight), 6+i*2))
+		object(fmt.Sprintf("<< /Length %d >>\nstream\n%sendstream", page.Len(), page.String()))
+	}
+
+	xref := out.Len()
+
+	fmt.Fprintf(&out, "xref\n0 %d\n0000000000 65535 f \n", len(offsets)+1)
+
+	for _, offset := range offsets {
+		fmt.Fprintf(&out, "%010d 00000 n \n", offset)
+	}
+
+	fmt.Fprintf(&out, "trailer\n<< /Size %d /Root 1 0 R >>\nstartxref\n%d\n%%%%EOF\n", len(offsets)+1, xref)
+
+	_, err := w.Write(out.Bytes())
+
+	return err
+}
+
+func formatFloat(f float64) string {
+	return strconv.FormatFloat(f, 'f', -1, 64)
+}
+
+// разбивает текст на строки не длиннее width символов по пробелам
+func wrapText(s string, width int) []string {
+	var lines []string
+	var current []rune
+
+	for _, word := range strings.Fields(s) {
+		runes := []rune(word)
+
+		if len(current) > 0 && len(current)+1+len(runes) > width {
+			lines = append(lines, string(current))
+			current = nil
+		}
+
+		if len(current) > 0 {
+			current = append(current, ' ')
+		}
+
+		current = append(current, runes...)
+	}
+
+	if len(current) > 0 || len(lines) == 0 {
+		lines = append(lines, string(current))
+	}
+
+	return lines
+}
+
+// кодирует строку в WinAnsi для стандартного шрифта: кириллица транслитерируется,
+// прочие символы вне Latin-1 заменяются на '?', служебные символы PDF экранируются
+func pdfString(s string) string {
+	var b strings.Builder
+
+	for _, r := range s {
+		if latin, ok := cyrillic[r]; ok {
+			b.WriteString(latin)
+			continue
+		}
+
+		switch {
+		case r == '(' || r == ')' || r == '\\':
+			b.WriteByte('\\')
+			b.WriteRune(r)
+
+		case r >= 0x20 && r < 0x7f:
+			b.WriteRune(r)
+
+		case r >= 0xa0 && r <= 0xff:
+			b.WriteString(fmt.Sprintf("\\%03o", r))
+
+		default:
+			b.WriteByte('?')
+		}
+	}
+
+	return b.String()
+}
+
+// транслитерация кириллицы для стандартных шрифтов PDF
+var cyrillic = map[rune]string{
+	'А': "A", 'Б': "B", 'В': "V", 'Г': "G", 'Д': "D", 'Е': "E", 'Ё': "E", 'Ж': "Zh", 'З': "Z", 'И': "I",
+	'Й': "Y", 'К': "K", 'Л': "L", 'М': "M", 'Н': "N", 'О': "O", 'П': "P", 'Р': "R", 'С': "S", 'Т': "T",
+	'У': "U", 'Ф': "F", 'Х': "Kh", 'Ц': "Ts", 'Ч': "Ch", 'Ш': "Sh", 'Щ': "Shch", 'Ъ': "", 'Ы': "Y", 'Ь': "",
+	'Э': "E", 'Ю': "Yu", 'Я': "Ya",
+	'а': "a", 'б': "b", 'в': "v", 'г': "g", 'д': "d", 'е': "e", 'ё': "e", 'ж': "zh", 'з': "z", 'и': "i",
+	'й': "y", 'к': "k", 'л': "l", 'м': "m", 'н': "n", 'о': "o", 'п': "p", 'р': "r", 'с': "s", 'т': "t",
+	'у': "u", 'ф': "f", 'х': "kh", 'ц': "ts", 'ч': "ch", 'ш': "sh", 'щ': "shch", 'ъ': "", 'ы': "y", 'ь': "",
+	'э': "e", 'ю': "yu", 'я': "ya", '№': "No.",
+}
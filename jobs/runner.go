@@ -0,0 +1,231 @@
+package jobs
+
+import (
+	"context"
+	"ec-platform/database"
+	"ec-platform/events"
+	"ec-platform/models"
+	"encoding/json"
+	"fmt"
+	"log"
+	"sync"
+	"time"
+
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+// Параметры по умолчанию
+const (
+	DefaultInterval    = time.Second
+	DefaultConcurrency = 1
+	DefaultMaxAttempts = 5
+	DefaultTimeout     = 5 * time.Minute
+)
+
+// Handler выполняет задачу. Ошибка - задача будет повторена с нарастающей задержкой
+type Handler func(ctx context.Context, job models.Job) error
+
+// Typed оборачивает обработчик с типизированными данными задачи: payload разбирается из JSON в T
+func Typed[T any](handler func(ctx context.Context, payload T) error) Handler {
+	return func(ctx context.Context, job models.Job) error {
+		var payload T
+
+		if err := json.Unmarshal(job.Payload, &payload); err != nil {
+			return fmt.Errorf("invalid %s payload: %w", job.Type, err)
+		}
+
+		return handler(ctx, payload)
+	}
+}
+
+// Options - параметры выполнения задач одного типа
+type Options struct {
+	Concurrency int           // одновременно выполняемых задач в этом процессе
+	MaxAttempts int           // после стольких неудачных попыток задача переходит в dead
+	Timeout     time.Duration // ограничение времени одной попытки
+}
+
+type registration struct {
+	handler Handler
+	options Options
+	running int
+	every   time.Duration
+}
+
+// Runner забирает задачи зарегистрированных типов из очереди и выполняет их
+type Runner struct {
+	db       *pgxpool.Pool
+	Interval time.Duration
+
+	mu    sync.Mutex
+	types map[string]*registration
+	wg    sync.WaitGroup
+}
+
+func NewRunner(db *pgxpool.Pool) *Runner {
+	return &Runner{
+		db:       db,
+		Interval: DefaultInterval,
+		types:    make(map[string]*registration),
+	}
+}
+
+// Register регистрирует обработчик типа задач; нулевые значения options заменяются значениями по умолчанию
+func (r *Runner) Register(jobType string, handler Handler, options Options) {
+	if options.Concurrency <= 0 {
+		options.Concurrency = DefaultConcurrency
+	}
+
+	if options.MaxAttempts <= 0 {
+		options.MaxAttempts = DefaultMaxAttempts
+	}
+
+	if options.Timeout <= 0 {
+		options.Timeout = DefaultTimeout
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.types[jobType] = &registration{handler: handler, options: options}
+}
+
+// Every делает зарегистрированный тип периодическим: в очереди всегда стоит одна задача
+// этого типа, следующая планируется через interval после завершения предыдущей
+func (r *Runner) Every(jobType string, interval time.Duration) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if registration, ok := r.types[jobType]; ok {
+		registration.every = interval
+	}
+}
+
+// Run выполняет задачи до отмены ctx и ждет завершения уже запущенных
+func (r *Runner) Run(ctx context.Context) {
+	ticker := time.NewTicker(r.Interval)
+	defer ticker.Stop()
+
+	for {
+		r.schedulePeriodic(ctx)
+		r.poll(ctx)
+
+		select {
+		case <-ctx.Done():
+			r.wg.Wait()
+			return
+
+		case <-ticker.C:
+		}
+	}
+}
+
+func (r *Runner) schedulePeriodic(ctx context.Context) {
+	r.mu.Lock()
+	periodic := make(map[string]time.Duration)
+
+	for jobType, registration := range r.types {
+		if registration.every > 0 {
+			periodic[jobType] = registration.every
+		}
+	}
+
+	r.mu.Unlock()
+
+	for jobType, interval := range periodic {
+		_, err := database.EnqueueJob(ctx, r.db, jobType, struct{}{}, time.Now().Add(interval), "periodic:"+jobType)
+
+		if err != nil && ctx.Err() == nil {
+			log.Printf("error scheduling periodic job %s: %v", jobType, err)
+		}
+	}
+}
+
+// забирает задачи каждого типа в пределах свободных слотов его concurrency
+func (r *Runner) poll(ctx context.Context) {
+	r.mu.Lock()
+	free := make(map[string]int)
+
+	for jobType, registration := range r.types {
+		if slots := registration.options.Concurrency - registration.running; slots > 0 {
+			free[jobType] = slots
+		}
+	}
+
+	r.mu.Unlock()
+
+	for jobType, slots := range free {
+		r.mu.Lock()
+		registration := r.types[jobType]
+		r.mu.Unlock()
+
+		// Попытка, превысившая timeout в несколько раз, считается зависшей
+		jobs, err := database.ClaimJobs(ctx, r.db, jobType, slots, 2*registration.options.Timeout)
+
+		if err != nil {
+			if ctx.Err() == nil {
+				log.Printf("error claiming %s jobs: %v", jobType, err)
+			}
+
+			continue
+		}
+
+		r.mu.Lock()
+		registration.running += len(jobs)
+		r.mu.Unlock()
+
+		for _, job := range jobs {
+			r.wg.Add(1)
+
+			go r.execute(registration, job)
+		}
+	}
+}
+
+// выполняет попытку задачи и записывает результат. Отмена ctx Run не прерывает начатую попытку
+func (r *Runner) execute(registration *registration, job models.Job) {
+	defer r.wg.Done()
+
+	defer func() {
+		r.mu.Lock()
+		registration.running--
+		r.mu.Unlock()
+	}()
+
+	ctx, cancel := context.WithTimeout(context.Background(), registration.options.Timeout)
+	defer cancel()
+
+	err := safeCall(ctx, registration.handler, job)
+
+	saveCtx, saveCancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer saveCancel()
+
+	if err == nil {
+		if err := database.CompleteJob(saveCtx, r.db, job.ID); err != nil {
+			log.Printf("error completing job %d: %v", job.ID, err)
+		}
+
+		return
+	}
+
+	log.Printf("job %d (%s) failed, attempt %d: %v", job.ID, job.Type, job.Attempts, err)
+
+	if err := database.FailJob(saveCtx, r.db, job, err.Error(), registration.options.MaxAttempts, events.Backoff(job.Attempts)); err != nil {
+		log.Printf("error saving failed job %d: %v", job.ID, err)
+	}
+}
+
+func safeCall(ctx context.Context, handler Handler, job models.Job) (err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			err = fmt.Errorf("job panic: %v", r)
+		}
+	}()
+
+	return handler(ctx, job)
+}
+
+// Enqueue ставит задачу в очередь на немедленное выполнение
+func Enqueue(ctx context.Context, db *pgxpool.Pool, jobType string, payload interface{}) (int64, error) {
+	return database.EnqueueJob(ctx, db, jobType, payload, time.Now(), "")
+}
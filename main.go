@@ -1,16 +1,34 @@
 package main
 
 import (
+	"context"
+	"ec-platform/catalog"
 	"ec-platform/controllers"
+	"ec-platform/currency"
 	"ec-platform/database"
+	"ec-platform/events"
+	"ec-platform/jobs"
 	"ec-platform/middleware"
+	"ec-platform/models"
+	"ec-platform/notifications"
+	"ec-platform/payments"
+	"ec-platform/realtime"
 	"ec-platform/routes"
+	"ec-platform/shipping"
+	"ec-platform/storage"
+	"ec-platform/webhooks"
 	"log"
 	"os"
+	"strconv"
+	"strings"
+	"time"
 
 	"github.com/gin-gonic/gin"
 )
 
+// сколько хранятся ключи идемпотентности
+const idempotencyRetention = 24 * time.Hour
+
 func main() {
 	port := os.Getenv("PORT")
 
@@ -22,11 +40,180 @@ func main() {
 	db := database.DBSet()
 	defer db.Close()
 
+	// Секрет подписи webhook фейкового платежного шлюза
+	webhookSecret := os.Getenv("PAYMENT_WEBHOOK_SECRET")
+
+	if webhookSecret == "" {
+		webhookSecret = "your-webhook-secret-change-this-in-production"
+		log.Println("WARNING: Using default PAYMENT_WEBHOOK_SECRET. Set PAYMENT_WEBHOOK_SECRET environment variable in production!")
+	}
+
 	// Создаем экземпляр приложения
 	app := &controllers.Application{
-		DB: db,
+		DB:       db,
+		Payments: payments.NewRegistry(payments.NewCOD(), payments.NewFakeGateway(webhookSecret)),
+
+		OrderEvents:  realtime.NewHub(db),
+		MaxAddresses: controllers.DefaultMaxAddresses,
+		BaseCurrency: currency.DefaultBase,
+
+		MaxImageBytes:    controllers.DefaultMaxImageBytes,
+		MaxProductImages: controllers.DefaultMaxProductImages,
+	}
+
+	// Возврат списаний по отмененным заказам идет через провайдеров приложения
+	app.PaymentStore = database.NewPgPaymentStore(db, app.RefundPayment())
+
+	if maxAddresses := os.Getenv("MAX_ADDRESSES_PER_USER"); maxAddresses != "" {
+		limit, err := strconv.Atoi(maxAddresses)
+
+		if err != nil || limit < 0 {
+			log.Fatalf("invalid MAX_ADDRESSES_PER_USER %q: expected a non-negative number", maxAddresses)
+		}
+
+		app.MaxAddresses = limit
+	}
+
+	// Валюта цен каталога и тарифов доставки; курсы остальных валют задаются относительно нее
+	if baseCurrency := os.Getenv("BASE_CURRENCY"); baseCurrency != "" {
+		code, err := currency.Normalize(baseCurrency)
+
+		if err != nil {
+			log.Fatalf("invalid BASE_CURRENCY %q: expected a supported ISO 4217 code", baseCurrency)
+		}
+
+		app.BaseCurrency = code
+	}
+
+	// Тарифы доставки по умолчанию - в минорных единицах базовой валюты
+	app.Shipping = shipping.DefaultRates(app.BaseCurrency)
+
+	// Изображения товаров хранятся в локальном каталоге
+	imageDir := os.Getenv("IMAGE_DIR")
+
+	if imageDir == "" {
+		imageDir = "uploads"
+	}
+
+	imageStore, err := storage.NewLocalStore(imageDir)
+
+	if err != nil {
+		log.Fatalf("failed to open image storage %q: %v", imageDir, err)
+	}
+
+	app.Images = imageStore
+
+	// Файлы импорта каталога - отдельный каталог: изображения отдаются публично
+	importDir := os.Getenv("IMPORT_DIR")
+
+	if importDir == "" {
+		importDir = "imports"
+	}
+
+	importStore, err := storage.NewLocalStore(importDir)
+
+	if err != nil {
+		log.Fatalf("failed to open import storage %q: %v", importDir, err)
+	}
+
+	app.Imports = importStore
+
+	if maxImageBytes := os.Getenv("MAX_IMAGE_BYTES"); maxImageBytes != "" {
+		limit, err := strconv.ParseInt(maxImageBytes, 10, 64)
+
+		if err != nil || limit <= 0 {
+			log.Fatalf("invalid MAX_IMAGE_BYTES %q: expected a positive number", maxImageBytes)
+		}
+
+		app.MaxImageBytes = limit
+	}
+
+	if maxProductImages := os.Getenv("MAX_PRODUCT_IMAGES"); maxProductImages != "" {
+		limit, err := strconv.Atoi(maxProductImages)
+
+		if err != nil || limit <= 0 {
+			log.Fatalf("invalid MAX_PRODUCT_IMAGES %q: expected a positive number", maxProductImages)
+		}
+
+		app.MaxProductImages = limit
 	}
 
+	// Переходы статусов заказов, сделанные любым экземпляром, приходят через LISTEN/NOTIFY
+	go app.OrderEvents.Run(context.Background())
+
+	// Доставка доменных событий из outbox обработчикам
+	dispatcher := events.NewDispatcher(db)
+	dispatcher.Subscribe(events.AllEvents, events.LogHandler)
+
+	// Исходящие webhook партнеров: события раскладываются по подпискам и доставляются отдельно
+	webhookSender := webhooks.NewSender(db)
+	dispatcher.Subscribe(events.AllEvents, webhookSender.FanOut)
+
+	// Письма покупателям: события заказа превращаются в задачи отправки
+	notifier := notifications.NewNotifier(db, notifications.MailerFromEnv())
+	notifier.BaseCurrency = app.BaseCurrency
+
+	if appURL := os.Getenv("APP_URL"); appURL != "" {
+		notifier.BaseURL = strings.TrimSuffix(appURL, "/")
+	}
+
+	if idle := os.Getenv("CART_REMINDER_IDLE"); idle != "" {
+		duration, err := time.ParseDuration(idle)
+
+		if err != nil || duration <= 0 {
+			log.Fatalf("invalid CART_REMINDER_IDLE %q: expected a duration like 24h", idle)
+		}
+
+		notifier.CartIdle = duration
+	}
+	dispatcher.Subscribe(models.EventOrderPlaced, notifier.HandleEvent)
+	dispatcher.Subscribe(models.EventOrderStatusChanged, notifier.HandleEvent)
+
+	go dispatcher.Run(context.Background())
+	go webhookSender.Run(context.Background())
+
+	// Фоновые задачи
+	runner := jobs.NewRunner(db)
+
+	runner.Register(models.JobPurgeIdempotencyKeys, func(ctx context.Context, job models.Job) error {
+		_, err := database.PurgeIdempotencyKeys(ctx, db, idempotencyRetention)
+		return err
+	}, jobs.Options{})
+	runner.Every(models.JobPurgeIdempotencyKeys, time.Hour)
+
+	runner.Register(models.JobPurgeFinishedJobs, func(ctx context.Context, job models.Job) error {
+		_, err := database.PurgeFinishedJobs(ctx, db, 7*24*time.Hour)
+		return err
+	}, jobs.Options{})
+	runner.Every(models.JobPurgeFinishedJobs, 24*time.Hour)
+
+	runner.Register(models.JobSendEmail, notifier.Handler(), jobs.Options{Concurrency: 4, Timeout: time.Minute})
+
+	runner.Register(models.JobCartReminders, notifier.RemindAbandonedCarts, jobs.Options{})
+	runner.Every(models.JobCartReminders, 15*time.Minute)
+
+	runner.Register(models.JobWishlistPriceDrops, notifier.NotifyPriceDrops, jobs.Options{})
+	runner.Every(models.JobWishlistPriceDrops, time.Hour)
+
+	runner.Register(models.JobApplyPrices, func(ctx context.Context, job models.Job) error {
+		_, err := database.ApplyScheduledPrices(ctx, db)
+		return err
+	}, jobs.Options{})
+	runner.Every(models.JobApplyPrices, time.Minute)
+
+	// Возвраты, которые провайдер не принял сразу после отмены или возврата товара
+	runner.Register(models.JobRetryRefunds, func(ctx context.Context, job models.Job) error {
+		_, err := database.RetryRefunds(ctx, db, 20, events.Backoff, app.RefundPayment())
+		return err
+	}, jobs.Options{})
+	runner.Every(models.JobRetryRefunds, time.Minute)
+
+	// Импорт каталога: одна задача за раз, большой файл обрабатывается долго
+	importer := catalog.NewImporter(db, importStore)
+	runner.Register(models.JobCatalogImport, importer.Handler(), jobs.Options{Timeout: 30 * time.Minute, MaxAttempts: 3})
+
+	go runner.Run(context.Background())
+
 	router := gin.New()
 	router.Use(gin.Logger())
 
@@ -36,18 +223,134 @@ func main() {
 	// Защищенные роуты (с аутентификацией)
 	router.Use(middleware.Authentication())
 
+	// Повторы запросов, создающих заказы, с тем же Idempotency-Key не создают дубликатов
+	idempotent := middleware.Idempotency(db, idempotencyRetention)
+
 	// Cart
 	router.GET("/addtocart", app.AddToCart())
 	router.GET("/removeitem", app.RemoveItem())
 	router.GET("/listcart", app.GetItemFromCart())
-	router.GET("/cartcheckout", app.BuyFromCart())
-	router.GET("/instantbuy", app.InstantBuy())
+	router.GET("/cartcheckout", idempotent, app.BuyFromCart())
+	router.GET("/instantbuy", idempotent, app.InstantBuy())
+	router.POST("/cart/save-for-later", app.SaveForLater())
+	router.POST("/cart/validate", app.ValidateCart())
+
+	// Orders
+	router.GET("/orders", app.GetOrders())
+	router.GET("/orders/:id", app.GetOrder())
+	router.GET("/orders/:id/events", app.GetOrderEvents())
+	router.POST("/orders/:id/cancel", app.CancelOrder())
+	router.POST("/orders/:id/pay", app.PayOrder())
+
+	// Invoices
+	router.GET("/orders/:id/invoices", app.GetOrderInvoices())
+	router.GET("/invoices/:id", app.GetInvoice())
+
+	// Returns
+	router.POST("/orders/:id/returns", app.CreateReturn())
+	router.GET("/returns", app.GetReturns())
 
 	// Addresses
+	router.GET("/addresses", app.GetAddresses())
+	router.POST("/addresses/validate", app.ValidateAddress())
+	router.PUT("/addresses/:id", app.EditAddress())
+	router.POST("/addresses/:id/default", app.SetDefaultAddress())
 	router.POST("/addaddress", app.AddAdress())
 	router.PUT("/edithomeaddress", app.EditHomeAddress())
 	router.PUT("/editworkaddress", app.EditWorkAddress())
 	router.DELETE("/deleteaddress", app.DeleteAddress())
 
+	// Reviews
+	router.POST("/products/:id/reviews", app.CreateReview())
+	router.PUT("/reviews/:id", app.UpdateReview())
+	router.DELETE("/reviews/:id", app.DeleteReview())
+	router.POST("/reviews/:id/helpful", app.VoteReviewHelpful())
+	router.DELETE("/reviews/:id/helpful", app.UnvoteReviewHelpful())
+
+	// Wishlists (:id = default - список по умолчанию)
+	router.GET("/wishlists", app.GetWishlists())
+	router.POST("/wishlists", app.CreateWishlist())
+	router.GET("/wishlists/:id", app.GetWishlist())
+	router.PUT("/wishlists/:id", app.UpdateWishlist())
+	router.DELETE("/wishlists/:id", app.DeleteWishlist())
+	router.POST("/wishlists/:id/items/:product_id", app.AddWishlistItem())
+	router.DELETE("/wishlists/:id/items/:product_id", app.RemoveWishlistItem())
+	router.POST("/wishlists/:id/items/:product_id/move-to-cart", app.MoveWishlistItemToCart())
+
+	// Admin: роуты /admin/* доступны только пользователям с is_admin
+	admin := router.Group("/admin", middleware.RequireAdmin())
+
+	// Admin - Orders
+	admin.POST("/orders/:id/status", app.UpdateOrderStatus())
+	admin.GET("/orders/:id/history", app.GetOrderStatusHistory())
+	admin.POST("/payments/:id/capture", app.CapturePayment())
+	admin.GET("/payments/events", app.GetPaymentEvents())
+	admin.POST("/payments/events/replay", app.ReplayPaymentEvents())
+
+	// Admin - Outbox
+	admin.GET("/outbox", app.GetOutboxEvents())
+	admin.POST("/outbox/:id/retry", app.RetryOutboxEvent())
+
+	// Admin - Webhooks
+	admin.POST("/webhooks", app.CreateWebhookSubscription())
+	admin.GET("/webhooks", app.GetWebhookSubscriptions())
+	admin.DELETE("/webhooks/:id", app.DeleteWebhookSubscription())
+	admin.POST("/webhooks/:id/resume", app.ResumeWebhookSubscription())
+	admin.GET("/webhooks/deliveries", app.GetWebhookDeliveries())
+	admin.GET("/webhooks/deliveries/:id", app.GetWebhookDelivery())
+	admin.POST("/webhooks/deliveries/:id/replay", app.ReplayWebhookDelivery())
+
+	// Admin - Abandoned carts
+	admin.GET("/carts/recovery", app.GetCartRecoveryReport())
+
+	// Admin - Jobs
+	admin.GET("/jobs", app.GetJobs())
+	admin.POST("/jobs/:id/retry", app.RetryJob())
+
+	// Admin - Returns
+	admin.GET("/returns", app.AdminGetReturns())
+	admin.POST("/returns/:id/approve", app.ApproveReturn())
+	admin.POST("/returns/:id/reject", app.RejectReturn())
+	admin.POST("/returns/:id/receive", app.ReceiveReturn())
+
+	// Admin - Invoices
+	admin.GET("/invoices", app.AdminGetInvoices())
+	admin.GET("/invoices/:id", app.AdminGetInvoice())
+
+	// Admin - Reviews
+	admin.GET("/reviews", app.AdminGetReviews())
+	admin.POST("/reviews/:id/approve", app.ApproveReview())
+	admin.POST("/reviews/:id/reject", app.RejectReview())
+
+	// Admin - Product images
+	admin.POST("/products/:id/images", app.UploadProductImages())
+	admin.PUT("/products/:id/images/order", app.ReorderProductImages())
+	admin.DELETE("/products/:id/images/:image_id", app.DeleteProductImage())
+
+	// Admin - Catalog
+	admin.POST("/catalog/imports", app.ImportCatalog())
+	admin.GET("/catalog/imports", app.GetCatalogImports())
+	admin.GET("/catalog/imports/:id", app.GetCatalogImport())
+	admin.GET("/catalog/export", app.ExportCatalog())
+
+	// Admin - Products
+	admin.POST("/addproduct", app.ProductViewerAdmin())
+	admin.POST("/products/:id/archive", app.ArchiveProduct())
+	admin.DELETE("/products/:id/archive", app.UnarchiveProduct())
+
+	// Admin - Prices
+	admin.PUT("/products/:id/price", app.SetProductPrice())
+	admin.GET("/products/:id/price-history", app.GetPriceHistory())
+	admin.GET("/products/:id/price-schedules", app.GetPriceSchedules())
+	admin.POST("/products/:id/price-schedules", app.CreatePriceSchedule())
+	admin.DELETE("/price-schedules/:id", app.CancelPriceSchedule())
+
+	// Admin - Currencies
+	admin.PUT("/exchange-rates/:currency", app.SetExchangeRate())
+	admin.DELETE("/exchange-rates/:currency", app.DeleteExchangeRate())
+	admin.GET("/products/:id/prices", app.GetProductCurrencyPrices())
+	admin.PUT("/products/:id/prices/:currency", app.SetProductCurrencyPrice())
+	admin.DELETE("/products/:id/prices/:currency", app.DeleteProductCurrencyPrice())
+
 	log.Fatal(router.Run(":" + port))
 }
@@ -0,0 +1,142 @@
+package middleware
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"io"
+	"log"
+	"net/http"
+	"time"
+
+	"ec-platform/database"
+
+	"github.com/gin-gonic/gin"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+// IdempotencyKeyHeader - заголовок с ключом идемпотентности запроса
+const IdempotencyKeyHeader = "Idempotency-Key"
+
+// максимальная длина ключа (размер колонки idempotency_keys.idempotency_key)
+const maxIdempotencyKeyLength = 255
+
+// через сколько ключ без сохраненного ответа снова можно занять: запрос, не освободивший ключ
+// (сбой процесса, паника, деплой), иначе блокировал бы повторы с 409 на весь срок хранения.
+// Значительно больше любого таймаута обработчика, поэтому живой запрос не перехватывается
+const IdempotencyLockTimeout = 5 * time.Minute
+
+// запоминает тело ответа, чтобы сохранить его для повторов
+type responseRecorder struct {
+	gin.ResponseWriter
+	body bytes.Buffer
+}
+
+func (w *responseRecorder) Write(data []byte) (int, error) {
+	w.body.Write(data)
+	return w.ResponseWriter.Write(data)
+}
+
+func (w *responseRecorder) WriteString(s string) (int, error) {
+	w.body.WriteString(s)
+	return w.ResponseWriter.WriteString(s)
+}
+
+// делает запрос идемпотентным по заголовку Idempotency-Key.
+// Повтор с тем же ключом в течение retention получает сохраненный ответ,
+// тот же ключ с другим запросом - 409 Conflict. Без заголовка запрос выполняется как обычно.
+// Должен стоять после Authentication: ключи разделены по пользователям
+func Idempotency(db *pgxpool.Pool, retention time.Duration) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		key := c.GetHeader(IdempotencyKeyHeader)
+
+		if key == "" {
+			c.Next()
+			return
+		}
+
+		if len(key) > maxIdempotencyKeyLength {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Idempotency-Key is too long"})
+			c.Abort()
+			return
+		}
+
+		scope := c.GetString("email")
+
+		if scope == "" {
+			c.JSON(http.StatusUnauthorized, gin.H{"error": "unauthorized"})
+			c.Abort()
+			return
+		}
+
+		// Отпечаток запроса: метод, путь, query и тело
+		body, err := io.ReadAll(c.Request.Body)
+
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "invalid request body"})
+			c.Abort()
+			return
+		}
+
+		c.Request.Body = io.NopCloser(bytes.NewReader(body))
+
+		hash := sha256.New()
+		hash.Write([]byte(c.Request.Method + "\n" + c.Request.URL.Path + "\n" + c.Request.URL.RawQuery + "\n"))
+		hash.Write(body)
+		fingerprint := hex.EncodeToString(hash.Sum(nil))
+
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+
+		stored, err := database.ReserveIdempotencyKey(ctx, db, scope, key, fingerprint, retention, IdempotencyLockTimeout)
+
+		if err != nil {
+			switch err {
+			case database.ErrIdempotencyKeyReused:
+				c.JSON(http.StatusConflict, gin.H{"error": "Idempotency-Key was already used with a different request"})
+
+			case database.ErrIdempotencyKeyInProgress:
+				c.JSON(http.StatusConflict, gin.H{"error": "request with this Idempotency-Key is still in progress"})
+
+			default:
+				log.Printf("error reserving idempotency key: %v", err)
+				c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to process request"})
+			}
+
+			c.Abort()
+			return
+		}
+
+		// Повтор: отдаем сохраненный ответ, обработчик не вызывается
+		if stored != nil {
+			c.Header("Idempotent-Replayed", "true")
+			c.Data(stored.StatusCode, "application/json; charset=utf-8", stored.Body)
+			c.Abort()
+			return
+		}
+
+		recorder := &responseRecorder{ResponseWriter: c.Writer}
+		c.Writer = recorder
+
+		c.Next()
+
+		saveCtx, saveCancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer saveCancel()
+
+		// Ошибку сервера не запоминаем - клиент может повторить запрос с тем же ключом
+		if recorder.Status() >= http.StatusInternalServerError {
+			if err := database.ReleaseIdempotencyKey(saveCtx, db, scope, key); err != nil {
+				log.Printf("error releasing idempotency key: %v", err)
+			}
+
+			return
+		}
+
+		response := database.IdempotentResponse{StatusCode: recorder.Status(), Body: recorder.body.Bytes()}
+
+		if err := database.SaveIdempotentResponse(saveCtx, db, scope, key, response); err != nil {
+			log.Printf("error saving idempotent response: %v", err)
+		}
+	}
+}
@@ -36,6 +36,20 @@ func Authentication() gin.HandlerFunc {
 		c.Set("email", claims.Email)
 		c.Set("first_name", claims.First_Name)
 		c.Set("last_name", claims.Last_Name)
+		c.Set("is_admin", claims.Is_Admin)
+
+		c.Next()
+	}
+}
+
+// пропускает только администраторов; ставится после Authentication
+func RequireAdmin() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if !c.GetBool("is_admin") {
+			c.JSON(http.StatusForbidden, gin.H{"error": "admin role required"})
+			c.Abort()
+			return
+		}
 
 		c.Next()
 	}
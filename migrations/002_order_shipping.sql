@@ -0,0 +1,20 @@
+-- Вес товара для расчета стоимости доставки
+ALTER TABLE products ADD COLUMN IF NOT EXISTS weight_grams INTEGER NOT NULL DEFAULT 0 CHECK (weight_grams >= 0);
+
+-- Адрес и способ доставки заказа.
+-- Адрес копируется в заказ (snapshot), чтобы правка или удаление адреса не меняли оформленные заказы
+ALTER TABLE orders ADD COLUMN IF NOT EXISTS address_id UUID REFERENCES addresses(address_id) ON DELETE SET NULL;
+ALTER TABLE orders ADD COLUMN IF NOT EXISTS shipping_method VARCHAR(30);
+ALTER TABLE orders ADD COLUMN IF NOT EXISTS shipping_cost BIGINT NOT NULL DEFAULT 0 CHECK (shipping_cost >= 0);
+ALTER TABLE orders ADD COLUMN IF NOT EXISTS ship_house VARCHAR(100);
+ALTER TABLE orders ADD COLUMN IF NOT EXISTS ship_street VARCHAR(100);
+ALTER TABLE orders ADD COLUMN IF NOT EXISTS ship_city VARCHAR(100);
+ALTER TABLE orders ADD COLUMN IF NOT EXISTS ship_pincode VARCHAR(20);
+ALTER TABLE orders ADD COLUMN IF NOT EXISTS ship_state VARCHAR(100);
+
+-- Вес тестовых продуктов
+UPDATE products SET weight_grams = 2000 WHERE product_id = '550e8400-e29b-41d4-a716-446655440001';
+UPDATE products SET weight_grams = 200  WHERE product_id = '550e8400-e29b-41d4-a716-446655440002';
+UPDATE products SET weight_grams = 250  WHERE product_id = '550e8400-e29b-41d4-a716-446655440003';
+UPDATE products SET weight_grams = 500  WHERE product_id = '550e8400-e29b-41d4-a716-446655440004';
+UPDATE products SET weight_grams = 50   WHERE product_id = '550e8400-e29b-41d4-a716-446655440005';
@@ -0,0 +1,12 @@
+-- Снимок товара в позиции заказа: название и картинка на момент покупки
+ALTER TABLE order_items ADD COLUMN IF NOT EXISTS product_name VARCHAR(255);
+ALTER TABLE order_items ADD COLUMN IF NOT EXISTS image TEXT;
+
+-- Заполняем снимки для уже оформленных заказов
+UPDATE order_items oi
+SET product_name = p.product_name, image = p.image
+FROM products p
+WHERE oi.product_id = p.product_id AND oi.product_name IS NULL;
+
+-- История заказов пользователя (новые сверху)
+CREATE INDEX IF NOT EXISTS idx_orders_user_ordered_at ON orders(user_id, ordered_at DESC);
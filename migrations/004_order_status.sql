@@ -0,0 +1,24 @@
+-- Допустимые статусы заказа (переходы между ними проверяются в database слое)
+ALTER TABLE orders DROP CONSTRAINT IF EXISTS orders_status_check;
+ALTER TABLE orders ADD CONSTRAINT orders_status_check
+    CHECK (status IN ('pending', 'paid', 'packed', 'shipped', 'delivered', 'cancelled', 'refunded'));
+
+-- История переходов статуса заказа
+CREATE TABLE IF NOT EXISTS order_status_history (
+    id BIGSERIAL PRIMARY KEY,
+    order_id UUID NOT NULL,
+    from_status VARCHAR(20),
+    to_status VARCHAR(20) NOT NULL,
+    actor VARCHAR(255) NOT NULL,
+    note TEXT,
+    changed_at TIMESTAMP NOT NULL DEFAULT NOW(),
+    FOREIGN KEY (order_id) REFERENCES orders(order_id) ON DELETE CASCADE
+);
+
+CREATE INDEX IF NOT EXISTS idx_order_status_history_order_id ON order_status_history(order_id, id);
+
+-- Начальная запись истории для уже оформленных заказов
+INSERT INTO order_status_history (order_id, from_status, to_status, actor, note, changed_at)
+SELECT o.order_id, NULL, o.status, 'system', 'backfill', o.ordered_at
+FROM orders o
+WHERE NOT EXISTS (SELECT 1 FROM order_status_history h WHERE h.order_id = o.order_id);
@@ -0,0 +1,11 @@
+-- Остаток товара на складе. NULL - остаток не отслеживается (товар доступен без ограничений).
+-- Оформление заказа резервирует остаток, отмена заказа возвращает его
+ALTER TABLE products ADD COLUMN IF NOT EXISTS stock INTEGER CHECK (stock >= 0);
+
+UPDATE products SET stock = 10 WHERE stock IS NULL AND product_id IN (
+    '550e8400-e29b-41d4-a716-446655440001',
+    '550e8400-e29b-41d4-a716-446655440002',
+    '550e8400-e29b-41d4-a716-446655440003',
+    '550e8400-e29b-41d4-a716-446655440004',
+    '550e8400-e29b-41d4-a716-446655440005'
+);
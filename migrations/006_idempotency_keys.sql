@@ -0,0 +1,15 @@
+-- Ключи идемпотентности (заголовок Idempotency-Key) для запросов, создающих заказы.
+-- scope - email пользователя, fingerprint - sha256 метода, пути, query и тела запроса.
+-- Пока status_code пустой, запрос с этим ключом еще выполняется
+CREATE TABLE IF NOT EXISTS idempotency_keys (
+    scope VARCHAR(255) NOT NULL,
+    idempotency_key VARCHAR(255) NOT NULL,
+    fingerprint CHAR(64) NOT NULL,
+    status_code INTEGER,
+    response_body BYTEA,
+    created_at TIMESTAMP NOT NULL DEFAULT NOW(),
+    completed_at TIMESTAMP,
+    PRIMARY KEY (scope, idempotency_key)
+);
+
+CREATE INDEX IF NOT EXISTS idx_idempotency_keys_created_at ON idempotency_keys(created_at);
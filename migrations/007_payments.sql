@@ -0,0 +1,18 @@
+-- Попытки оплаты заказов. Заказ переходит в paid только после подтвержденного списания (captured)
+CREATE TABLE IF NOT EXISTS payments (
+    payment_id UUID PRIMARY KEY,
+    order_id UUID NOT NULL,
+    provider VARCHAR(50) NOT NULL,
+    intent_id VARCHAR(255),
+    status VARCHAR(30) NOT NULL DEFAULT 'created'
+        CHECK (status IN ('created', 'pending', 'requires_capture', 'captured', 'failed', 'partially_refunded', 'refunded')),
+    amount BIGINT NOT NULL CHECK (amount >= 0),
+    refunded_amount BIGINT NOT NULL DEFAULT 0 CHECK (refunded_amount >= 0 AND refunded_amount <= amount),
+    error TEXT,
+    created_at TIMESTAMP NOT NULL DEFAULT NOW(),
+    updated_at TIMESTAMP NOT NULL DEFAULT NOW(),
+    FOREIGN KEY (order_id) REFERENCES orders(order_id) ON DELETE CASCADE,
+    UNIQUE (provider, intent_id)
+);
+
+CREATE INDEX IF NOT EXISTS idx_payments_order_id ON payments(order_id);
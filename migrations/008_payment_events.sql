@@ -0,0 +1,21 @@
+-- Входящие события платежных провайдеров (webhook).
+-- Уникальность (provider, event_id) отсекает повторную доставку одного события.
+-- deferred - событие пока нельзя применить (неизвестный тип или пришло раньше платежа), оно ждет повторной обработки
+CREATE TABLE IF NOT EXISTS payment_events (
+    id BIGSERIAL PRIMARY KEY,
+    provider VARCHAR(50) NOT NULL,
+    event_id VARCHAR(255) NOT NULL,
+    event_type VARCHAR(100) NOT NULL,
+    intent_id VARCHAR(255),
+    amount BIGINT NOT NULL DEFAULT 0,
+    payload JSONB NOT NULL,
+    status VARCHAR(20) NOT NULL DEFAULT 'received'
+        CHECK (status IN ('received', 'processed', 'deferred')),
+    attempts INTEGER NOT NULL DEFAULT 0,
+    last_error TEXT,
+    received_at TIMESTAMP NOT NULL DEFAULT NOW(),
+    processed_at TIMESTAMP,
+    UNIQUE (provider, event_id)
+);
+
+CREATE INDEX IF NOT EXISTS idx_payment_events_deferred ON payment_events(provider, intent_id) WHERE status = 'deferred';
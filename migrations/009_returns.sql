@@ -0,0 +1,34 @@
+-- Заявки на возврат товаров (RMA).
+-- requested -> approved | rejected; approved -> received (товар получен, остаток возвращен) -> refunded
+CREATE TABLE IF NOT EXISTS returns (
+    return_id UUID PRIMARY KEY,
+    order_id UUID NOT NULL,
+    user_id VARCHAR(255) NOT NULL,
+    status VARCHAR(20) NOT NULL DEFAULT 'requested'
+        CHECK (status IN ('requested', 'approved', 'rejected', 'received', 'refunded')),
+    reason TEXT NOT NULL,
+    requested_amount BIGINT NOT NULL CHECK (requested_amount >= 0),
+    approved_amount BIGINT CHECK (approved_amount >= 0 AND approved_amount <= requested_amount),
+    refunded_amount BIGINT NOT NULL DEFAULT 0 CHECK (refunded_amount >= 0),
+    staff_note TEXT,
+    handled_by VARCHAR(255),
+    created_at TIMESTAMP NOT NULL DEFAULT NOW(),
+    updated_at TIMESTAMP NOT NULL DEFAULT NOW(),
+    FOREIGN KEY (order_id) REFERENCES orders(order_id) ON DELETE CASCADE,
+    FOREIGN KEY (user_id) REFERENCES users(user_id) ON DELETE CASCADE
+);
+
+-- Позиции заявки: какие позиции заказа и в каком количестве возвращаются
+CREATE TABLE IF NOT EXISTS return_items (
+    id UUID PRIMARY KEY,
+    return_id UUID NOT NULL,
+    order_item_id UUID NOT NULL,
+    quantity INTEGER NOT NULL CHECK (quantity > 0),
+    price BIGINT NOT NULL CHECK (price >= 0),
+    FOREIGN KEY (return_id) REFERENCES returns(return_id) ON DELETE CASCADE,
+    FOREIGN KEY (order_item_id) REFERENCES order_items(id) ON DELETE CASCADE
+);
+
+CREATE INDEX IF NOT EXISTS idx_returns_user_id ON returns(user_id);
+CREATE INDEX IF NOT EXISTS idx_returns_order_id ON returns(order_id);
+CREATE INDEX IF NOT EXISTS idx_return_items_order_item_id ON return_items(order_item_id);
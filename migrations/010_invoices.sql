@@ -0,0 +1,73 @@
+-- Реквизиты продавца и ставка налога. Одна строка; при выставлении документа копируется в него
+CREATE TABLE IF NOT EXISTS seller_profile (
+    id BOOLEAN PRIMARY KEY DEFAULT TRUE CHECK (id),
+    name VARCHAR(255) NOT NULL,
+    tax_id VARCHAR(50) NOT NULL,
+    address TEXT NOT NULL,
+    -- ставка НДС в базисных пунктах (2000 = 20%), цены включают налог
+    tax_rate_bp INTEGER NOT NULL DEFAULT 2000 CHECK (tax_rate_bp >= 0 AND tax_rate_bp <= 10000)
+);
+
+INSERT INTO seller_profile (id, name, tax_id, address, tax_rate_bp) VALUES
+    (TRUE, 'EC Platform LLC', '7700000000', 'Moscow, Tverskaya st. 1', 2000)
+ON CONFLICT (id) DO NOTHING;
+
+-- Нумерация документов без пропусков: отдельный счетчик на вид документа и год.
+-- Счетчик увеличивается в транзакции выставления, поэтому откат не оставляет дыр
+CREATE TABLE IF NOT EXISTS document_sequences (
+    kind VARCHAR(20) NOT NULL,
+    year INTEGER NOT NULL,
+    last_number INTEGER NOT NULL DEFAULT 0,
+    PRIMARY KEY (kind, year)
+);
+
+-- Счета (invoice) и корректировочные счета на возврат (credit_note)
+CREATE TABLE IF NOT EXISTS invoices (
+    invoice_id UUID PRIMARY KEY,
+    kind VARCHAR(20) NOT NULL CHECK (kind IN ('invoice', 'credit_note')),
+    number VARCHAR(50) NOT NULL UNIQUE,
+    year INTEGER NOT NULL,
+    sequence INTEGER NOT NULL,
+    order_id UUID NOT NULL,
+    user_id VARCHAR(255) NOT NULL,
+    -- для credit_note - исходный счет
+    invoice_ref UUID,
+    payment_id UUID,
+    issued_at TIMESTAMP NOT NULL DEFAULT NOW(),
+    subtotal BIGINT NOT NULL,
+    tax_total BIGINT NOT NULL,
+    total BIGINT NOT NULL,
+    seller_name VARCHAR(255) NOT NULL,
+    seller_tax_id VARCHAR(50) NOT NULL,
+    seller_address TEXT NOT NULL,
+    buyer_name VARCHAR(255) NOT NULL,
+    buyer_email VARCHAR(255) NOT NULL,
+    buyer_house VARCHAR(255),
+    buyer_street VARCHAR(255),
+    buyer_city VARCHAR(100),
+    buyer_pincode VARCHAR(20),
+    buyer_state VARCHAR(100),
+    UNIQUE (kind, year, sequence),
+    FOREIGN KEY (order_id) REFERENCES orders(order_id) ON DELETE RESTRICT,
+    FOREIGN KEY (invoice_ref) REFERENCES invoices(invoice_id) ON DELETE RESTRICT
+);
+
+-- Один счет на заказ
+CREATE UNIQUE INDEX IF NOT EXISTS idx_invoices_order_invoice ON invoices(order_id) WHERE kind = 'invoice';
+CREATE INDEX IF NOT EXISTS idx_invoices_order_id ON invoices(order_id);
+
+-- Строки документа. Суммы строки включают налог: net + tax = total
+CREATE TABLE IF NOT EXISTS invoice_lines (
+    id BIGSERIAL PRIMARY KEY,
+    invoice_id UUID NOT NULL,
+    position INTEGER NOT NULL,
+    description VARCHAR(255) NOT NULL,
+    quantity INTEGER NOT NULL CHECK (quantity > 0),
+    unit_price BIGINT NOT NULL,
+    tax_rate_bp INTEGER NOT NULL,
+    net BIGINT NOT NULL,
+    tax BIGINT NOT NULL,
+    total BIGINT NOT NULL,
+    UNIQUE (invoice_id, position),
+    FOREIGN KEY (invoice_id) REFERENCES invoices(invoice_id) ON DELETE CASCADE
+);
@@ -0,0 +1,3 @@
+-- Язык писем пользователя (шаблоны уведомлений на русском и английском)
+ALTER TABLE users ADD COLUMN IF NOT EXISTS locale VARCHAR(5) NOT NULL DEFAULT 'ru'
+    CHECK (locale IN ('ru', 'en'));
@@ -0,0 +1,25 @@
+-- Напоминания о брошенных корзинах. Одно напоминание на состояние корзины (время ее последнего
+-- изменения): пока покупатель не изменит корзину, повторного письма не будет.
+-- pending -> sent; cancelled - покупатель оформил заказ или очистил корзину до отправки письма
+CREATE TABLE IF NOT EXISTS cart_reminders (
+    reminder_id UUID PRIMARY KEY,
+    user_id VARCHAR(255) NOT NULL REFERENCES users(user_id) ON DELETE CASCADE,
+    -- секрет ссылки восстановления корзины из письма
+    token VARCHAR(64) NOT NULL UNIQUE,
+    cart_updated_at TIMESTAMP NOT NULL,
+    -- снимок корзины на момент напоминания: [{product_id, quantity}]
+    items JSONB NOT NULL,
+    cart_value BIGINT NOT NULL CHECK (cart_value >= 0),
+    status VARCHAR(20) NOT NULL DEFAULT 'pending'
+        CHECK (status IN ('pending', 'sent', 'cancelled')),
+    created_at TIMESTAMP NOT NULL DEFAULT NOW(),
+    sent_at TIMESTAMP,
+    restored_at TIMESTAMP,
+    -- заказ, оформленный из корзины после письма (конверсия)
+    order_id UUID REFERENCES orders(order_id) ON DELETE SET NULL,
+    converted_at TIMESTAMP,
+    UNIQUE (user_id, cart_updated_at)
+);
+
+CREATE INDEX IF NOT EXISTS idx_cart_reminders_user_id ON cart_reminders(user_id, created_at);
+CREATE INDEX IF NOT EXISTS idx_cart_reminders_created_at ON cart_reminders(created_at);
@@ -0,0 +1,21 @@
+-- Адресная книга: тип адреса обязателен, у пользователя не более одного адреса доставки
+-- и одного платежного адреса по умолчанию
+UPDATE addresses SET address_type = 'other' WHERE address_type IS NULL;
+
+ALTER TABLE addresses ALTER COLUMN address_type SET DEFAULT 'other';
+ALTER TABLE addresses ALTER COLUMN address_type SET NOT NULL;
+
+ALTER TABLE addresses ADD COLUMN IF NOT EXISTS is_default_shipping BOOLEAN NOT NULL DEFAULT FALSE;
+ALTER TABLE addresses ADD COLUMN IF NOT EXISTS is_default_billing BOOLEAN NOT NULL DEFAULT FALSE;
+
+CREATE UNIQUE INDEX IF NOT EXISTS idx_addresses_default_shipping ON addresses(user_id) WHERE is_default_shipping;
+CREATE UNIQUE INDEX IF NOT EXISTS idx_addresses_default_billing ON addresses(user_id) WHERE is_default_billing;
+
+-- Существующим пользователям - самый новый адрес по умолчанию
+UPDATE addresses SET is_default_shipping = TRUE, is_default_billing = TRUE
+WHERE address_id IN (
+    SELECT DISTINCT ON (user_id) address_id FROM addresses ORDER BY user_id, created_at DESC
+)
+AND NOT EXISTS (
+    SELECT 1 FROM addresses a WHERE a.user_id = addresses.user_id AND (a.is_default_shipping OR a.is_default_billing)
+);
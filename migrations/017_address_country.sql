@@ -0,0 +1,6 @@
+-- Страна адреса (ISO 3166-1 alpha-2): по ней выбираются правила проверки индекса, обязательных
+-- полей и списка регионов. Существующие адреса - российские
+ALTER TABLE addresses ADD COLUMN IF NOT EXISTS country CHAR(2) NOT NULL DEFAULT 'RU';
+
+-- Снимок страны в адресе доставки заказа
+ALTER TABLE orders ADD COLUMN IF NOT EXISTS ship_country CHAR(2);
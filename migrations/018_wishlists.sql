@@ -0,0 +1,31 @@
+-- Списки желаний. У каждого пользователя один список по умолчанию (создается при первом
+-- обращении, в него же откладываются товары из корзины) и любое число именованных списков.
+-- share_token - публичная ссылка на список, NULL - список закрыт
+CREATE TABLE IF NOT EXISTS wishlists (
+    wishlist_id UUID PRIMARY KEY,
+    user_id VARCHAR(255) NOT NULL REFERENCES users(user_id) ON DELETE CASCADE,
+    name VARCHAR(100) NOT NULL,
+    is_default BOOLEAN NOT NULL DEFAULT FALSE,
+    share_token VARCHAR(64) UNIQUE,
+    created_at TIMESTAMP NOT NULL DEFAULT NOW(),
+    updated_at TIMESTAMP NOT NULL DEFAULT NOW(),
+    UNIQUE (user_id, name)
+);
+
+CREATE UNIQUE INDEX IF NOT EXISTS idx_wishlists_default ON wishlists(user_id) WHERE is_default;
+
+-- Товары списков. price_seen - цена, от которой считается снижение: цена при добавлении,
+-- после письма о снижении - новая цена (повторное письмо - только при следующем снижении)
+CREATE TABLE IF NOT EXISTS wishlist_items (
+    id UUID PRIMARY KEY,
+    wishlist_id UUID NOT NULL REFERENCES wishlists(wishlist_id) ON DELETE CASCADE,
+    product_id UUID NOT NULL REFERENCES products(product_id) ON DELETE CASCADE,
+    -- количество, с которым товар был отложен из корзины
+    quantity INTEGER NOT NULL DEFAULT 1 CHECK (quantity > 0),
+    price_seen BIGINT NOT NULL CHECK (price_seen >= 0),
+    added_at TIMESTAMP NOT NULL DEFAULT NOW(),
+    price_drop_notified_at TIMESTAMP,
+    UNIQUE (wishlist_id, product_id)
+);
+
+CREATE INDEX IF NOT EXISTS idx_wishlist_items_product_id ON wishlist_items(product_id);
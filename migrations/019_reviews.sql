@@ -0,0 +1,38 @@
+-- Отзывы покупателей. Оценку товара больше не вводит администратор: products.rating - средняя
+-- оценка одобренных отзывов, rating_count - их число (пересчитываются при модерации)
+ALTER TABLE products DROP CONSTRAINT IF EXISTS products_rating_check;
+ALTER TABLE products ALTER COLUMN rating TYPE NUMERIC(3, 2) USING NULL;
+ALTER TABLE products ADD COLUMN IF NOT EXISTS rating_count INTEGER NOT NULL DEFAULT 0;
+
+-- Отзыв может оставить только покупатель, получивший товар (доставленный заказ), один на товар.
+-- pending -> approved | rejected; изменение отзыва возвращает его на модерацию
+CREATE TABLE IF NOT EXISTS reviews (
+    review_id UUID PRIMARY KEY,
+    product_id UUID NOT NULL REFERENCES products(product_id) ON DELETE CASCADE,
+    user_id VARCHAR(255) NOT NULL REFERENCES users(user_id) ON DELETE CASCADE,
+    -- доставленный заказ, подтверждающий покупку
+    order_id UUID REFERENCES orders(order_id) ON DELETE SET NULL,
+    rating SMALLINT NOT NULL CHECK (rating BETWEEN 1 AND 5),
+    title VARCHAR(200),
+    body TEXT,
+    status VARCHAR(20) NOT NULL DEFAULT 'pending'
+        CHECK (status IN ('pending', 'approved', 'rejected')),
+    moderation_note TEXT,
+    moderated_by VARCHAR(255),
+    moderated_at TIMESTAMP,
+    helpful_count INTEGER NOT NULL DEFAULT 0 CHECK (helpful_count >= 0),
+    created_at TIMESTAMP NOT NULL DEFAULT NOW(),
+    updated_at TIMESTAMP NOT NULL DEFAULT NOW(),
+    UNIQUE (product_id, user_id)
+);
+
+CREATE INDEX IF NOT EXISTS idx_reviews_product_id ON reviews(product_id, status);
+CREATE INDEX IF NOT EXISTS idx_reviews_status ON reviews(status, created_at);
+
+-- Отметки «отзыв полезен»: одна от пользователя
+CREATE TABLE IF NOT EXISTS review_votes (
+    review_id UUID NOT NULL REFERENCES reviews(review_id) ON DELETE CASCADE,
+    user_id VARCHAR(255) NOT NULL REFERENCES users(user_id) ON DELETE CASCADE,
+    created_at TIMESTAMP NOT NULL DEFAULT NOW(),
+    PRIMARY KEY (review_id, user_id)
+);
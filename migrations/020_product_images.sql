@@ -0,0 +1,16 @@
+-- Изображения товаров в хранилище файлов (BlobStore). position - порядок в галерее, с 1;
+-- products.image - адрес первого изображения (для списков товаров и корзины)
+CREATE TABLE IF NOT EXISTS product_images (
+    image_id UUID PRIMARY KEY,
+    product_id UUID NOT NULL REFERENCES products(product_id) ON DELETE CASCADE,
+    position INTEGER NOT NULL CHECK (position > 0),
+    storage_key VARCHAR(255) NOT NULL,
+    thumbnail_key VARCHAR(255) NOT NULL,
+    content_type VARCHAR(50) NOT NULL,
+    width INTEGER NOT NULL,
+    height INTEGER NOT NULL,
+    size_bytes BIGINT NOT NULL,
+    created_at TIMESTAMP NOT NULL DEFAULT NOW(),
+    -- проверяется в конце транзакции, чтобы позиции можно было переставлять
+    CONSTRAINT product_images_position_unique UNIQUE (product_id, position) DEFERRABLE INITIALLY DEFERRED
+);
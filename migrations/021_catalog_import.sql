@@ -0,0 +1,28 @@
+-- Артикул товара: ключ массового импорта каталога (upsert по sku). У старых товаров может отсутствовать
+ALTER TABLE products ADD COLUMN IF NOT EXISTS sku VARCHAR(64) UNIQUE;
+
+-- Импорт каталога из CSV/JSON. Файл лежит в хранилище импортов, строки обрабатывает фоновая задача.
+-- queued -> running -> succeeded | failed (файл не читается целиком: неверный заголовок, синтаксис JSON)
+CREATE TABLE IF NOT EXISTS catalog_imports (
+    import_id UUID PRIMARY KEY,
+    format VARCHAR(10) NOT NULL CHECK (format IN ('csv', 'json')),
+    dry_run BOOLEAN NOT NULL DEFAULT FALSE,
+    status VARCHAR(20) NOT NULL DEFAULT 'queued'
+        CHECK (status IN ('queued', 'running', 'succeeded', 'failed')),
+    storage_key VARCHAR(255) NOT NULL,
+    -- total_rows известно после первого прохода по файлу, processed_rows растет по пачкам
+    total_rows INTEGER NOT NULL DEFAULT 0,
+    processed_rows INTEGER NOT NULL DEFAULT 0,
+    created_count INTEGER NOT NULL DEFAULT 0,
+    updated_count INTEGER NOT NULL DEFAULT 0,
+    error_count INTEGER NOT NULL DEFAULT 0,
+    -- первые ошибки по строкам [{row, sku, field, message}]
+    errors JSONB NOT NULL DEFAULT '[]',
+    failure TEXT,
+    created_by VARCHAR(255) NOT NULL,
+    created_at TIMESTAMP NOT NULL DEFAULT NOW(),
+    started_at TIMESTAMP,
+    finished_at TIMESTAMP
+);
+
+CREATE INDEX IF NOT EXISTS idx_catalog_imports_created ON catalog_imports(created_at DESC);
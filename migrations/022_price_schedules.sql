@@ -0,0 +1,63 @@
+-- История базовой цены товара: каждое изменение products.price. old_price NULL - цена при создании товара
+CREATE TABLE IF NOT EXISTS product_price_history (
+    id BIGSERIAL PRIMARY KEY,
+    product_id UUID NOT NULL REFERENCES products(product_id) ON DELETE CASCADE,
+    old_price BIGINT,
+    new_price BIGINT NOT NULL,
+    source VARCHAR(20) NOT NULL CHECK (source IN ('initial', 'admin', 'import', 'schedule')),
+    changed_by VARCHAR(255),
+    changed_at TIMESTAMP NOT NULL DEFAULT NOW()
+);
+
+CREATE INDEX IF NOT EXISTS idx_product_price_history_product ON product_price_history(product_id, changed_at DESC);
+
+-- Отправная точка истории для уже существующих товаров
+INSERT INTO product_price_history (product_id, old_price, new_price, source, changed_at)
+SELECT product_id, NULL, price, 'initial', created_at FROM products
+WHERE NOT EXISTS (SELECT 1 FROM product_price_history h WHERE h.product_id = products.product_id);
+
+-- Запланированные цены. С ends_at - распродажа: цена действует в окне [starts_at, ends_at), базовая
+-- не меняется. Без ends_at - плановое изменение: с starts_at цена действует сразу, фоновая задача
+-- переносит ее в products.price (applied_at) и пишет в историю
+CREATE TABLE IF NOT EXISTS product_price_schedules (
+    schedule_id UUID PRIMARY KEY,
+    product_id UUID NOT NULL REFERENCES products(product_id) ON DELETE CASCADE,
+    price BIGINT NOT NULL CHECK (price >= 0),
+    starts_at TIMESTAMP NOT NULL,
+    ends_at TIMESTAMP CHECK (ends_at > starts_at),
+    created_by VARCHAR(255) NOT NULL,
+    created_at TIMESTAMP NOT NULL DEFAULT NOW(),
+    applied_at TIMESTAMP,
+    cancelled_at TIMESTAMP
+);
+
+CREATE INDEX IF NOT EXISTS idx_price_schedules_product ON product_price_schedules(product_id, starts_at DESC)
+    WHERE cancelled_at IS NULL;
+CREATE INDEX IF NOT EXISTS idx_price_schedules_due ON product_price_schedules(starts_at)
+    WHERE ends_at IS NULL AND applied_at IS NULL AND cancelled_at IS NULL;
+
+-- Действующая цена товара на момент p_at - единственное место, где она вычисляется (корзина, заказы,
+-- поиск, карточка товара, списки желаний). Идущая распродажа важнее планового изменения (иначе результат
+-- зависел бы от того, успела ли задача перенести изменение в products.price); среди равных побеждает
+-- начавшееся последним; без расписаний - базовая цена. compare_at_price ("было") - базовая цена,
+-- пока идет распродажа дешевле нее
+CREATE OR REPLACE FUNCTION product_price_at(p_product_id UUID, p_at TIMESTAMP)
+RETURNS TABLE (price BIGINT, compare_at_price BIGINT, sale_ends_at TIMESTAMP)
+LANGUAGE sql STABLE AS $$
+    SELECT
+        COALESCE(s.price, p.price),
+        CASE WHEN s.ends_at IS NOT NULL AND s.price < p.price THEN p.price END,
+        s.ends_at
+    FROM products p
+    LEFT JOIN LATERAL (
+        SELECT ps.price, ps.ends_at
+        FROM product_price_schedules ps
+        WHERE ps.product_id = p.product_id
+            AND ps.cancelled_at IS NULL
+            AND ps.starts_at <= p_at
+            AND (ps.ends_at > p_at OR (ps.ends_at IS NULL AND ps.applied_at IS NULL))
+        ORDER BY ps.ends_at IS NOT NULL DESC, ps.starts_at DESC
+        LIMIT 1
+    ) s ON TRUE
+    WHERE p.product_id = p_product_id
+$$;
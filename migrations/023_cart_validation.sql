@@ -0,0 +1,11 @@
+-- Архив товаров: товар в архиве не продается и не попадает в поиск, но остается в заказах и корзинах
+ALTER TABLE products ADD COLUMN IF NOT EXISTS archived_at TIMESTAMP;
+
+-- Цена строки корзины на момент добавления (или последнего подтверждения покупателем).
+-- Рост действующей цены выше нее требует подтверждения перед оформлением заказа
+ALTER TABLE cart ADD COLUMN IF NOT EXISTS price_snapshot BIGINT CHECK (price_snapshot >= 0);
+
+UPDATE cart SET price_snapshot = (SELECT price FROM product_price_at(cart.product_id, (NOW() AT TIME ZONE 'UTC')::TIMESTAMP))
+WHERE price_snapshot IS NULL;
+
+ALTER TABLE cart ALTER COLUMN price_snapshot SET NOT NULL;
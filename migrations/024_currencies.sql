@@ -0,0 +1,54 @@
+-- Курсы валют к базовой валюте магазина (BASE_CURRENCY, по умолчанию RUB):
+-- сколько единиц валюты дают за одну единицу базовой. Базовой валюты в таблице нет
+CREATE TABLE IF NOT EXISTS exchange_rates (
+    currency CHAR(3) PRIMARY KEY,
+    rate NUMERIC NOT NULL CHECK (rate > 0),
+    updated_by VARCHAR(255),
+    updated_at TIMESTAMP NOT NULL DEFAULT NOW()
+);
+
+-- Цена товара в валюте, заданная вручную вместо пересчета по курсу (в минорных единицах валюты)
+CREATE TABLE IF NOT EXISTS product_currency_prices (
+    product_id UUID NOT NULL REFERENCES products(product_id) ON DELETE CASCADE,
+    currency CHAR(3) NOT NULL,
+    price BIGINT NOT NULL CHECK (price >= 0),
+    updated_by VARCHAR(255),
+    updated_at TIMESTAMP NOT NULL DEFAULT NOW(),
+    PRIMARY KEY (product_id, currency)
+);
+
+-- Заказ хранит все суммы в валюте оплаты и курс, по которому они пересчитаны из базовой.
+-- Заказы до миграции оформлены в базовой валюте (RUB, если BASE_CURRENCY не менялась)
+ALTER TABLE orders ADD COLUMN IF NOT EXISTS currency CHAR(3) NOT NULL DEFAULT 'RUB';
+ALTER TABLE orders ADD COLUMN IF NOT EXISTS exchange_rate NUMERIC NOT NULL DEFAULT 1 CHECK (exchange_rate > 0);
+
+-- Сумма заказа в базовой валюте на момент оформления - для отчетов по заказам в разных валютах
+ALTER TABLE orders ADD COLUMN IF NOT EXISTS base_total_price BIGINT CHECK (base_total_price >= 0);
+UPDATE orders SET base_total_price = total_price WHERE base_total_price IS NULL;
+ALTER TABLE orders ALTER COLUMN base_total_price SET NOT NULL;
+
+ALTER TABLE payments ADD COLUMN IF NOT EXISTS currency CHAR(3) NOT NULL DEFAULT 'RUB';
+ALTER TABLE invoices ADD COLUMN IF NOT EXISTS currency CHAR(3) NOT NULL DEFAULT 'RUB';
+
+-- Действующая цена товара в валюте: product_price_at, пересчитанная по курсу p_rate (p_scale - разница
+-- знаков дробной части валюты и базовой) с округлением половины вверх. Ручная цена в валюте заменяет
+-- пересчет базовой; во время распродажи ручная цена становится ценой "было", а цена распродажи
+-- получается из нее с той же скидкой. Для базовой валюты (курс 1, без ручных цен) совпадает с product_price_at
+CREATE OR REPLACE FUNCTION product_price_in(p_product_id UUID, p_at TIMESTAMP, p_currency VARCHAR, p_rate NUMERIC, p_scale INT)
+RETURNS TABLE (price BIGINT, compare_at_price BIGINT, sale_ends_at TIMESTAMP)
+LANGUAGE sql STABLE AS $$
+    SELECT
+        CASE
+            WHEN o.price IS NULL THEN ROUND(b.price * p_rate * POWER(10::NUMERIC, p_scale))::BIGINT
+            WHEN b.compare_at_price IS NULL THEN o.price
+            ELSE ROUND(o.price::NUMERIC * b.price / b.compare_at_price)::BIGINT
+        END,
+        CASE
+            WHEN b.compare_at_price IS NULL THEN NULL
+            WHEN o.price IS NULL THEN ROUND(b.compare_at_price * p_rate * POWER(10::NUMERIC, p_scale))::BIGINT
+            ELSE o.price
+        END,
+        b.sale_ends_at
+    FROM product_price_at(p_product_id, p_at) b
+    LEFT JOIN product_currency_prices o ON o.product_id = p_product_id AND o.currency = p_currency
+$$;
@@ -0,0 +1,3 @@
+-- Роль администратора: только с ней доступны роуты /admin/*. Назначается вручную:
+-- UPDATE users SET is_admin = TRUE WHERE email = '...'; действует со следующего входа
+ALTER TABLE users ADD COLUMN IF NOT EXISTS is_admin BOOLEAN NOT NULL DEFAULT FALSE;
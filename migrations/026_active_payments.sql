@@ -0,0 +1,4 @@
+-- У заказа не больше одной активной попытки оплаты: параллельные запросы оплаты
+-- не могут заблокировать или списать деньги дважды (основная проверка - в CreatePayment)
+CREATE UNIQUE INDEX IF NOT EXISTS idx_payments_active_order ON payments(order_id)
+    WHERE status IN ('created', 'pending', 'requires_capture', 'captured');
@@ -0,0 +1,19 @@
+-- Возвраты денег по платежам. Возврат сначала сохраняется в pending в транзакции отмены или возврата
+-- товара, затем после коммита отправляется провайдеру и только после его ответа учитывается в платеже.
+-- Неудачные обращения к провайдеру повторяются задачей refunds.retry (next_attempt_at)
+CREATE TABLE IF NOT EXISTS refunds (
+    refund_id UUID PRIMARY KEY,
+    payment_id UUID NOT NULL REFERENCES payments(payment_id) ON DELETE CASCADE,
+    order_id UUID NOT NULL REFERENCES orders(order_id) ON DELETE CASCADE,
+    amount BIGINT NOT NULL CHECK (amount > 0),
+    status VARCHAR(20) NOT NULL DEFAULT 'pending' CHECK (status IN ('pending', 'succeeded')),
+    attempts INT NOT NULL DEFAULT 0,
+    last_error TEXT,
+    actor VARCHAR(255) NOT NULL,
+    next_attempt_at TIMESTAMP NOT NULL DEFAULT NOW(),
+    created_at TIMESTAMP NOT NULL DEFAULT NOW(),
+    updated_at TIMESTAMP NOT NULL DEFAULT NOW()
+);
+
+CREATE INDEX IF NOT EXISTS idx_refunds_payment_id ON refunds(payment_id);
+CREATE INDEX IF NOT EXISTS idx_refunds_pending ON refunds(next_attempt_at) WHERE status = 'pending';
@@ -0,0 +1,6 @@
+-- DEFAULT 'RUB' нужен был только для заполнения строк, существовавших до 024. Новые заказы, платежи
+-- и счета всегда записываются с валютой явно: без значения по умолчанию пропущенная валюта - ошибка,
+-- а не молча подставленный RUB при другой BASE_CURRENCY
+ALTER TABLE orders ALTER COLUMN currency DROP DEFAULT;
+ALTER TABLE payments ALTER COLUMN currency DROP DEFAULT;
+ALTER TABLE invoices ALTER COLUMN currency DROP DEFAULT;
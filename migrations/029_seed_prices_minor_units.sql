@@ -0,0 +1,20 @@
+-- Тестовые товары из 001 заведены в рублях, а суммы хранятся в минорных единицах (копейках):
+-- цена 150000 означала 1500.00 вместо 150000.00. Переводим только нетронутые цены из 001 -
+-- измененные сотрудником цены и повторный запуск миграции не затрагиваются
+WITH seed (product_id, price) AS (
+    VALUES
+        ('550e8400-e29b-41d4-a716-446655440001'::UUID, 150000::BIGINT),
+        ('550e8400-e29b-41d4-a716-446655440002'::UUID, 120000::BIGINT),
+        ('550e8400-e29b-41d4-a716-446655440003'::UUID, 35000::BIGINT),
+        ('550e8400-e29b-41d4-a716-446655440004'::UUID, 75000::BIGINT),
+        ('550e8400-e29b-41d4-a716-446655440005'::UUID, 45000::BIGINT)
+),
+moved AS (
+    UPDATE products p SET price = p.price * 100
+    FROM seed
+    WHERE p.product_id = seed.product_id AND p.price = seed.price
+    RETURNING p.product_id, seed.price
+)
+UPDATE product_price_history h SET new_price = h.new_price * 100
+FROM moved
+WHERE h.product_id = moved.product_id AND h.source = 'initial' AND h.old_price IS NULL AND h.new_price = moved.price;
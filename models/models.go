@@ -1,6 +1,7 @@
 package models
 
 import (
+	"encoding/json"
 	"time"
 
 	"github.com/google/uuid"
@@ -15,6 +16,8 @@ type User struct {
 	Password        *string      `json:"password" validate:"required,min=6"`
 	Email           *string      `json:"email" validate:"email,required"`
 	Phone           *string      `json:"phone" validate:"required"`
+	Locale          *string      `json:"locale" validate:"omitempty,oneof=ru en"`
+	Is_Admin        bool         `json:"is_admin"`
 	Token           *string      `json:"token"`
 	Refresh_Token   *string      `json:"refresh_token"`
 	Created_At      time.Time    `json:"created_at"`
@@ -25,57 +28,661 @@ type User struct {
 	Order_Status    []Order      `json:"order_Status"`
 }
 type Product struct {
-	Product_ID   uuid.UUID `json:"product_id" db:"product_id"`
-	Product_Name *string   `json:"product_name" db:"product_name"`
-	Price        *uint64   `json:"price" db:"price"`
-	Rating       *uint8    `json:"rating" db:"rating"`
-	Image        *string   `json:"image" db:"image"`
+	Product_ID       uuid.UUID  `json:"product_id" db:"product_id"`
+	SKU              *string    `json:"sku" db:"sku"`
+	Product_Name     *string    `json:"product_name" db:"product_name"`
+	Price            *Money     `json:"price" db:"price"`
+	Compare_At_Price *Money     `json:"compare_at_price" db:"compare_at_price"`
+	Sale_Ends_At     *time.Time `json:"sale_ends_at,omitempty" db:"sale_ends_at"`
+	Rating           *float64   `json:"rating" db:"rating"`
+	Rating_Count     int        `json:"rating_count" db:"rating_count"`
+	Image            *string    `json:"image" db:"image"`
+	Weight           *uint32    `json:"weight_grams" db:"weight_grams"`
+	Archived_At      *time.Time `json:"archived_at,omitempty" db:"archived_at"`
+	Currency         string     `json:"currency,omitempty"`
 }
 
 type PoductUser struct {
 	Product_ID   uuid.UUID `json:"product_id" db:"product_id"`
 	Product_Name *string   `json:"product_name" db:"product_name"`
-	Price        int       `json:"price" db:"price"`
-	Rating       *uint     `json:"rating" db:"rating"`
+	Price        Money     `json:"price" db:"price"`
+	Rating       *float64  `json:"rating" db:"rating"`
 	Image        *string   `json:"image" db:"image"`
 }
 
-// товар в корзине с деталями
+// товар в корзине с деталями. Price и CompareAtPrice - в валюте покупателя,
+// PriceSnapshot (цена при добавлении) - в базовой валюте
 type CartItem struct {
-	ProductID   uuid.UUID `json:"product_id"`
-	ProductName string    `json:"product_name"`
-	Price       uint64    `json:"price"`
-	Rating      *uint8    `json:"rating"`
-	Image       *string   `json:"image"`
-	Quantity    int       `json:"quantity"`
+	ProductID      uuid.UUID `json:"product_id"`
+	ProductName    string    `json:"product_name"`
+	Price          Money     `json:"price"`
+	CompareAtPrice *Money    `json:"compare_at_price"`
+	PriceSnapshot  Money     `json:"price_snapshot"`
+	Rating         *float64  `json:"rating"`
+	Image          *string   `json:"image"`
+	Quantity       int       `json:"quantity"`
 }
 
 // элемент заказа (для order_items таблицы)
 type OrderItem struct {
-	ProductID uuid.UUID `json:"product_id"`
-	Price     uint64    `json:"price"`
-	Quantity  int       `json:"quantity"`
+	ID          uuid.UUID `json:"id"`
+	ProductID   uuid.UUID `json:"product_id"`
+	ProductName string    `json:"product_name"`
+	Image       *string   `json:"image"`
+	Price       Money     `json:"price"`
+	Quantity    int       `json:"quantity"`
 }
 
 type Address struct {
-	Addres_ID uuid.UUID `json:"address_id" db:"address_id"`
-	House     *string   `json:"house_name" db:"house_name"`
-	Street    *string   `json:"street_name" db:"street_name"`
-	City      *string   `json:"city_name" db:"city_name"`
-	Pincode   *string   `json:"pincode_name" db:"pincode_name"`
-	State     *string   `json:"state_name" db:"state_name"`
+	Addres_ID        uuid.UUID `json:"address_id" db:"address_id"`
+	House            *string   `json:"house_name" db:"house_name"`
+	Street           *string   `json:"street_name" db:"street_name"`
+	City             *string   `json:"city_name" db:"city_name"`
+	Pincode          *string   `json:"pincode_name" db:"pincode_name"`
+	State            *string   `json:"state_name" db:"state_name"`
+	Country          *string   `json:"country" db:"country"`
+	Address_Type     *string   `json:"address_type,omitempty" db:"address_type"`
+	Default_Shipping bool      `json:"default_shipping,omitempty" db:"is_default_shipping"`
+	Default_Billing  bool      `json:"default_billing,omitempty" db:"is_default_billing"`
 }
 
+// типы адреса в адресной книге
+const (
+	AddressTypeHome  = "home"
+	AddressTypeWork  = "work"
+	AddressTypeOther = "other"
+)
+
+// виды адреса по умолчанию
+const (
+	DefaultAddressShipping = "shipping"
+	DefaultAddressBilling  = "billing"
+)
+
 type Order struct {
-	Order_ID       uuid.UUID    `json:"order_id" db:"order_id"`
-	Order_Cart     []PoductUser `json:"order_cart" db:"order_cart"`
-	Ordered_At     time.Time    `json:"ordered_at" db:"ordered_at"`
-	Price          int          `json:"price" db:"price"`
-	Discount       *int         `json:"discount" db:"discount"`
-	Payment_Method Payment      `json:"payment_method" db:"payment_method"`
+	Order_ID         uuid.UUID        `json:"order_id" db:"order_id"`
+	Order_Cart       []PoductUser     `json:"order_cart" db:"order_cart"`
+	Ordered_At       time.Time        `json:"ordered_at" db:"ordered_at"`
+	Price            Money            `json:"price" db:"price"`
+	Status           string           `json:"status" db:"status"`
+	Discount         *Money           `json:"discount" db:"discount"`
+	Payment_Method   Payment          `json:"payment_method" db:"payment_method"`
+	Address_ID       *uuid.UUID       `json:"address_id" db:"address_id"`
+	Shipping_Method  *string          `json:"shipping_method" db:"shipping_method"`
+	Shipping_Cost    Money            `json:"shipping_cost" db:"shipping_cost"`
+	Currency         string           `json:"currency" db:"currency"`
+	Exchange_Rate    string           `json:"exchange_rate" db:"exchange_rate"`
+	Shipping_Address Address          `json:"shipping_address"`
+	Items            []OrderItem      `json:"items,omitempty"`
+	Payments         []PaymentAttempt `json:"payments,omitempty"`
+}
+
+// статусы заказа
+const (
+	OrderStatusPending   = "pending"
+	OrderStatusPaid      = "paid"
+	OrderStatusPacked    = "packed"
+	OrderStatusShipped   = "shipped"
+	OrderStatusDelivered = "delivered"
+	OrderStatusCancelled = "cancelled"
+	OrderStatusRefunded  = "refunded"
+)
+
+// запись истории переходов статуса заказа
+type OrderStatusChange struct {
+	ID         int64     `json:"id"`
+	OrderID    uuid.UUID `json:"order_id"`
+	FromStatus *string   `json:"from_status"`
+	ToStatus   string    `json:"to_status"`
+	Actor      string    `json:"actor"`
+	Note       *string   `json:"note"`
+	Changed_At time.Time `json:"changed_at"`
+}
+
+// статусы попытки оплаты (таблица payments)
+const (
+	PaymentStatusCreated           = "created"
+	PaymentStatusPending           = "pending"
+	PaymentStatusRequiresCapture   = "requires_capture"
+	PaymentStatusCaptured          = "captured"
+	PaymentStatusFailed            = "failed"
+	PaymentStatusPartiallyRefunded = "partially_refunded"
+	PaymentStatusRefunded          = "refunded"
+)
+
+// провайдер оплаты наличными при получении
+const PaymentProviderCOD = "cod"
+
+// попытка оплаты заказа через платежного провайдера
+type PaymentAttempt struct {
+	Payment_ID      uuid.UUID `json:"payment_id"`
+	Order_ID        uuid.UUID `json:"order_id"`
+	Provider        string    `json:"provider"`
+	Intent_ID       *string   `json:"intent_id"`
+	Status          string    `json:"status"`
+	Amount          Money     `json:"amount"`
+	Currency        string    `json:"currency"`
+	Refunded_Amount Money     `json:"refunded_amount"`
+	Error           *string   `json:"error"`
+	Created_At      time.Time `json:"created_at"`
+	Updated_At      time.Time `json:"updated_at"`
+}
+
+// статусы возврата денег по платежу (таблица refunds)
+const (
+	RefundStatusPending   = "pending" // сохранен, провайдер еще не подтвердил возврат
+	RefundStatusSucceeded = "succeeded"
+)
+
+// возврат денег по платежу: сохраняется до обращения к провайдеру и учитывается в платеже после него
+type Refund struct {
+	Refund_ID       uuid.UUID `json:"refund_id"`
+	Payment_ID      uuid.UUID `json:"payment_id"`
+	Order_ID        uuid.UUID `json:"order_id"`
+	Amount          Money     `json:"amount"`
+	Status          string    `json:"status"`
+	Attempts        int       `json:"attempts"`
+	Last_Error      *string   `json:"last_error"`
+	Actor           string    `json:"actor"`
+	Next_Attempt_At time.Time `json:"next_attempt_at"`
+	Created_At      time.Time `json:"created_at"`
+	Updated_At      time.Time `json:"updated_at"`
+}
+
+// статусы входящего события платежного провайдера
+const (
+	PaymentEventReceived  = "received"
+	PaymentEventProcessed = "processed"
+	PaymentEventDeferred  = "deferred"
+)
+
+// входящее событие платежного провайдера (webhook)
+type PaymentEvent struct {
+	ID           int64      `json:"id"`
+	Provider     string     `json:"provider"`
+	Event_ID     string     `json:"event_id"`
+	Event_Type   string     `json:"event_type"`
+	Intent_ID    *string    `json:"intent_id"`
+	Amount       Money      `json:"amount"`
+	Status       string     `json:"status"`
+	Attempts     int        `json:"attempts"`
+	Last_Error   *string    `json:"last_error"`
+	Received_At  time.Time  `json:"received_at"`
+	Processed_At *time.Time `json:"processed_at"`
+}
+
+// статусы заявки на возврат
+const (
+	ReturnStatusRequested = "requested"
+	ReturnStatusApproved  = "approved"
+	ReturnStatusRejected  = "rejected"
+	ReturnStatusReceived  = "received"
+	ReturnStatusRefunded  = "refunded"
+)
+
+// заявка на возврат товаров заказа
+type Return struct {
+	Return_ID        uuid.UUID    `json:"return_id"`
+	Order_ID         uuid.UUID    `json:"order_id"`
+	Status           string       `json:"status"`
+	Reason           string       `json:"reason"`
+	Requested_Amount Money        `json:"requested_amount"`
+	Approved_Amount  *Money       `json:"approved_amount"`
+	Refunded_Amount  Money        `json:"refunded_amount"`
+	Staff_Note       *string      `json:"staff_note"`
+	Handled_By       *string      `json:"handled_by"`
+	Created_At       time.Time    `json:"created_at"`
+	Updated_At       time.Time    `json:"updated_at"`
+	Items            []ReturnItem `json:"items"`
+}
+
+// позиция заявки на возврат
+type ReturnItem struct {
+	Order_Item_ID uuid.UUID `json:"order_item_id" validate:"required"`
+	Product_ID    uuid.UUID `json:"product_id"`
+	Quantity      int       `json:"quantity" validate:"required,min=1"`
+	Price         Money     `json:"price"`
+}
+
+// виды финансовых документов
+const (
+	InvoiceKindInvoice    = "invoice"
+	InvoiceKindCreditNote = "credit_note"
+)
+
+// счет по оплаченному заказу или корректировочный счет на возврат.
+// Реквизиты продавца и покупателя - снимок на момент выставления
+type Invoice struct {
+	Invoice_ID     uuid.UUID     `json:"invoice_id"`
+	Kind           string        `json:"kind"`
+	Number         string        `json:"number"`
+	Order_ID       uuid.UUID     `json:"order_id"`
+	Invoice_Ref    *uuid.UUID    `json:"invoice_ref,omitempty"`
+	Payment_ID     *uuid.UUID    `json:"payment_id,omitempty"`
+	Issued_At      time.Time     `json:"issued_at"`
+	Subtotal       Money         `json:"subtotal"`
+	Tax_Total      Money         `json:"tax_total"`
+	Total          Money         `json:"total"`
+	Currency       string        `json:"currency"`
+	Seller_Name    string        `json:"seller_name"`
+	Seller_Tax_ID  string        `json:"seller_tax_id"`
+	Seller_Address string        `json:"seller_address"`
+	Buyer_Name     string        `json:"buyer_name"`
+	Buyer_Email    string        `json:"buyer_email"`
+	Buyer_Address  Address       `json:"buyer_address"`
+	Lines          []InvoiceLine `json:"lines,omitempty"`
+}
+
+// строка документа; суммы включают налог: Net + Tax = Total
+type InvoiceLine struct {
+	Position    int    `json:"position"`
+	Description string `json:"description"`
+	Quantity    int    `json:"quantity"`
+	Unit_Price  Money  `json:"unit_price"`
+	Tax_Rate_BP int    `json:"tax_rate_bp"`
+	Net         Money  `json:"net"`
+	Tax         Money  `json:"tax"`
+	Total       Money  `json:"total"`
+}
+
+// типы доменных событий (outbox)
+const (
+	EventOrderPlaced        = "order.placed"
+	EventOrderStatusChanged = "order.status_changed"
+	EventOrderCancelled     = "order.cancelled"
+	EventReturnRequested    = "return.requested"
+	EventInvoiceIssued      = "invoice.issued"
+)
+
+// статусы события в outbox
+const (
+	OutboxStatusPending   = "pending"
+	OutboxStatusDelivered = "delivered"
+	OutboxStatusFailed    = "failed"
+)
+
+// доменное событие из outbox
+type OutboxEvent struct {
+	ID              int64           `json:"id"`
+	Event_Type      string          `json:"event_type"`
+	Aggregate_ID    uuid.UUID       `json:"aggregate_id"`
+	Payload         json.RawMessage `json:"payload"`
+	Status          string          `json:"status"`
+	Attempts        int             `json:"attempts"`
+	Last_Error      *string         `json:"last_error"`
+	Next_Attempt_At time.Time       `json:"next_attempt_at"`
+	Created_At      time.Time       `json:"created_at"`
+	Delivered_At    *time.Time      `json:"delivered_at"`
+}
+
+// данные событий заказа (order.placed, order.status_changed, order.cancelled)
+type OrderEvent struct {
+	Order_ID    uuid.UUID `json:"order_id"`
+	User_ID     string    `json:"user_id"`
+	Status      string    `json:"status"`
+	From_Status *string   `json:"from_status"`
+	Total       Money     `json:"total"`
+	Currency    string    `json:"currency"`
+	Actor       string    `json:"actor"`
+	Note        string    `json:"note,omitempty"`
+}
+
+// данные события return.requested
+type ReturnEvent struct {
+	Return_ID        uuid.UUID `json:"return_id"`
+	Order_ID         uuid.UUID `json:"order_id"`
+	User_ID          string    `json:"user_id"`
+	Requested_Amount Money     `json:"requested_amount"`
+}
+
+// данные события invoice.issued (счет или корректировочный счет)
+type InvoiceEvent struct {
+	Invoice_ID uuid.UUID `json:"invoice_id"`
+	Kind       string    `json:"kind"`
+	Number     string    `json:"number"`
+	Order_ID   uuid.UUID `json:"order_id"`
+	User_ID    string    `json:"user_id"`
+	Total      Money     `json:"total"`
+	Currency   string    `json:"currency"`
+}
+
+// подписка партнера на доменные события (исходящий webhook)
+type WebhookSubscription struct {
+	Subscription_ID      uuid.UUID  `json:"subscription_id"`
+	URL                  string     `json:"url" validate:"required,url,max=2000"`
+	Secret               string     `json:"secret,omitempty" validate:"omitempty,min=16,max=255"`
+	Event_Types          []string   `json:"event_types" validate:"required,min=1,dive,required"`
+	Consecutive_Failures int        `json:"consecutive_failures"`
+	Paused_At            *time.Time `json:"paused_at"`
+	Created_At           time.Time  `json:"created_at"`
+	Updated_At           time.Time  `json:"updated_at"`
+}
+
+// статусы доставки webhook
+const (
+	WebhookDeliveryPending   = "pending"
+	WebhookDeliverySucceeded = "succeeded"
+	WebhookDeliveryFailed    = "failed"
+)
+
+// доставка события подписчику
+type WebhookDelivery struct {
+	ID              int64                    `json:"id"`
+	Subscription_ID uuid.UUID                `json:"subscription_id"`
+	Outbox_Event_ID int64                    `json:"outbox_event_id"`
+	Event_Type      string                   `json:"event_type"`
+	Payload         json.RawMessage          `json:"payload"`
+	Status          string                   `json:"status"`
+	Attempts        int                      `json:"attempts"`
+	Response_Code   *int                     `json:"response_code"`
+	Last_Error      *string                  `json:"last_error"`
+	Next_Attempt_At time.Time                `json:"next_attempt_at"`
+	Created_At      time.Time                `json:"created_at"`
+	Delivered_At    *time.Time               `json:"delivered_at"`
+	Attempt_Log     []WebhookDeliveryAttempt `json:"attempt_log,omitempty"`
+}
+
+// попытка доставки webhook
+type WebhookDeliveryAttempt struct {
+	ID            int64     `json:"id"`
+	Response_Code *int      `json:"response_code"`
+	Error         *string   `json:"error"`
+	Duration_MS   int       `json:"duration_ms"`
+	Attempted_At  time.Time `json:"attempted_at"`
+}
+
+// статусы фоновой задачи
+const (
+	JobStatusQueued    = "queued"
+	JobStatusRunning   = "running"
+	JobStatusSucceeded = "succeeded"
+	JobStatusDead      = "dead"
+)
+
+// типы фоновых задач
+const (
+	JobPurgeIdempotencyKeys = "idempotency.purge"
+	JobPurgeFinishedJobs    = "jobs.purge"
+	JobSendEmail            = "email.send"
+	JobCartReminders        = "cart.reminders"
+	JobWishlistPriceDrops   = "wishlist.price_drops"
+	JobCatalogImport        = "catalog.import"
+	JobApplyPrices          = "prices.apply"
+	JobRetryRefunds         = "refunds.retry"
+)
+
+// фоновая задача
+type Job struct {
+	ID          int64           `json:"id"`
+	Type        string          `json:"type"`
+	Payload     json.RawMessage `json:"payload"`
+	Status      string          `json:"status"`
+	Attempts    int             `json:"attempts"`
+	Unique_Key  *string         `json:"unique_key"`
+	Run_At      time.Time       `json:"run_at"`
+	Locked_At   *time.Time      `json:"locked_at"`
+	Last_Error  *string         `json:"last_error"`
+	Created_At  time.Time       `json:"created_at"`
+	Finished_At *time.Time      `json:"finished_at"`
+}
+
+// статусы напоминания о брошенной корзине
+const (
+	CartReminderStatusPending   = "pending"
+	CartReminderStatusSent      = "sent"
+	CartReminderStatusCancelled = "cancelled"
+)
+
+// напоминание о брошенной корзине
+type CartReminder struct {
+	Reminder_ID     uuid.UUID          `json:"reminder_id"`
+	User_ID         string             `json:"user_id"`
+	Token           string             `json:"-"`
+	Cart_Updated_At time.Time          `json:"cart_updated_at"`
+	Items           []CartReminderItem `json:"items"`
+	Cart_Value      Money              `json:"cart_value"`
+	Status          string             `json:"status"`
+	Created_At      time.Time          `json:"created_at"`
+	Sent_At         *time.Time         `json:"sent_at"`
+	Restored_At     *time.Time         `json:"restored_at"`
+	Order_ID        *uuid.UUID         `json:"order_id"`
+	Converted_At    *time.Time         `json:"converted_at"`
+}
+
+// позиция снимка корзины в напоминании
+type CartReminderItem struct {
+	Product_ID uuid.UUID `json:"product_id"`
+	Quantity   int       `json:"quantity"`
+}
+
+// отчет о возврате брошенных корзин за период
+type CartRecoveryReport struct {
+	From              time.Time `json:"from"`
+	To                time.Time `json:"to"`
+	Reminders         int       `json:"reminders"`
+	Sent              int       `json:"sent"`
+	Cancelled         int       `json:"cancelled"`
+	Restored          int       `json:"restored"`
+	Converted         int       `json:"converted"`
+	Conversion_Rate   float64   `json:"conversion_rate"`
+	Abandoned_Value   Money     `json:"abandoned_value"`
+	Recovered_Revenue Money     `json:"recovered_revenue"`
+}
+
+// список желаний
+type Wishlist struct {
+	Wishlist_ID uuid.UUID      `json:"wishlist_id"`
+	Name        string         `json:"name"`
+	Is_Default  bool           `json:"is_default"`
+	Shared      bool           `json:"shared"`
+	Share_Token *string        `json:"share_token,omitempty"`
+	Items_Count int            `json:"items_count"`
+	Items       []WishlistItem `json:"items,omitempty"`
+	Created_At  time.Time      `json:"created_at"`
+	Updated_At  time.Time      `json:"updated_at"`
+}
+
+// товар в списке желаний с текущей ценой
+type WishlistItem struct {
+	Product_ID       uuid.UUID `json:"product_id"`
+	Product_Name     string    `json:"product_name"`
+	Price            Money     `json:"price"`
+	Compare_At_Price *Money    `json:"compare_at_price"`
+	Price_Seen       Money     `json:"price_seen"`
+	Rating           *float64  `json:"rating"`
+	Image            *string   `json:"image"`
+	Quantity         int       `json:"quantity"`
+	Added_At         time.Time `json:"added_at"`
+}
+
+// снижение цены товара из списков желаний пользователя
+type PriceDrop struct {
+	Product_ID   uuid.UUID `json:"product_id"`
+	Product_Name string    `json:"product_name"`
+	Old_Price    Money     `json:"old_price"`
+	New_Price    Money     `json:"new_price"`
+}
+
+// изображение товара; URL - адреса файлов, которые отдает приложение
+type ProductImage struct {
+	Image_ID      uuid.UUID `json:"image_id"`
+	Product_ID    uuid.UUID `json:"product_id"`
+	Position      int       `json:"position"`
+	URL           string    `json:"url"`
+	Thumbnail_URL string    `json:"thumbnail_url"`
+	Content_Type  string    `json:"content_type"`
+	Width         int       `json:"width"`
+	Height        int       `json:"height"`
+	Size          int64     `json:"size_bytes"`
+	Storage_Key   string    `json:"-"`
+	Thumbnail_Key string    `json:"-"`
+	Created_At    time.Time `json:"created_at"`
+}
+
+// статусы модерации отзыва
+const (
+	ReviewStatusPending  = "pending"
+	ReviewStatusApproved = "approved"
+	ReviewStatusRejected = "rejected"
+)
+
+// отзыв покупателя о товаре
+type Review struct {
+	Review_ID       uuid.UUID  `json:"review_id"`
+	Product_ID      uuid.UUID  `json:"product_id"`
+	User_ID         string     `json:"-"`
+	Author          string     `json:"author"`
+	Rating          int        `json:"rating" validate:"required,min=1,max=5"`
+	Title           *string    `json:"title" validate:"omitempty,max=200"`
+	Body            *string    `json:"body" validate:"omitempty,max=5000"`
+	Status          string     `json:"status"`
+	Moderation_Note *string    `json:"moderation_note,omitempty"`
+	Moderated_By    *string    `json:"moderated_by,omitempty"`
+	Moderated_At    *time.Time `json:"moderated_at,omitempty"`
+	Helpful_Count   int        `json:"helpful_count"`
+	Created_At      time.Time  `json:"created_at"`
+	Updated_At      time.Time  `json:"updated_at"`
+}
+
+// сводка оценок товара по одобренным отзывам: распределение - оценка (1..5) -> число отзывов
+type RatingSummary struct {
+	Average      *float64    `json:"average"`
+	Count        int         `json:"count"`
+	Distribution map[int]int `json:"distribution"`
+}
+
+// строка каталога в формате импорта и экспорта (CSV/JSON). При экспорте Stock nil - остаток
+// не учитывается; при импорте пустые Stock, Weight и Image не меняют значения товара
+// (у нового товара - остаток без учета, вес 0, без изображения)
+type CatalogRow struct {
+	SKU          string  `json:"sku"`
+	Product_Name string  `json:"product_name"`
+	Price        Money   `json:"price"`
+	Stock        *int    `json:"stock"`
+	Weight       *int    `json:"weight_grams"`
+	Image        *string `json:"image"`
+}
+
+// статусы импорта каталога
+const (
+	CatalogImportStatusQueued    = "queued"
+	CatalogImportStatusRunning   = "running"
+	CatalogImportStatusSucceeded = "succeeded"
+	CatalogImportStatusFailed    = "failed"
+)
+
+// импорт каталога; при dry_run created/updated - сколько товаров было бы создано и изменено
+type CatalogImport struct {
+	Import_ID      uuid.UUID            `json:"import_id"`
+	Format         string               `json:"format"`
+	Dry_Run        bool                 `json:"dry_run"`
+	Status         string               `json:"status"`
+	Storage_Key    string               `json:"-"`
+	Total_Rows     int                  `json:"total_rows"`
+	Processed_Rows int                  `json:"processed_rows"`
+	Created_Count  int                  `json:"created_count"`
+	Updated_Count  int                  `json:"updated_count"`
+	Error_Count    int                  `json:"error_count"`
+	Errors         []CatalogImportError `json:"errors,omitempty"`
+	Failure        *string              `json:"failure"`
+	Created_By     string               `json:"created_by"`
+	Created_At     time.Time            `json:"created_at"`
+	Started_At     *time.Time           `json:"started_at"`
+	Finished_At    *time.Time           `json:"finished_at"`
+}
+
+// ошибка строки импорта; row - номер строки файла (CSV) или элемента массива (JSON), с 1
+type CatalogImportError struct {
+	Row     int    `json:"row"`
+	SKU     string `json:"sku,omitempty"`
+	Field   string `json:"field,omitempty"`
+	Message string `json:"message"`
+}
+
+// источники изменения базовой цены товара
+const (
+	PriceSourceInitial  = "initial"
+	PriceSourceAdmin    = "admin"
+	PriceSourceImport   = "import"
+	PriceSourceSchedule = "schedule"
+)
+
+// изменение базовой цены товара; Old_Price nil - цена при создании товара
+type PriceChange struct {
+	ID         int64     `json:"id"`
+	Product_ID uuid.UUID `json:"product_id"`
+	Old_Price  *Money    `json:"old_price"`
+	New_Price  Money     `json:"new_price"`
+	Source     string    `json:"source"`
+	Changed_By *string   `json:"changed_by"`
+	Changed_At time.Time `json:"changed_at"`
+}
+
+// состояния запланированной цены (вычисляются на момент запроса)
+const (
+	PriceScheduleStatusScheduled = "scheduled"
+	PriceScheduleStatusActive    = "active"
+	PriceScheduleStatusEnded     = "ended"
+	PriceScheduleStatusApplied   = "applied"
+	PriceScheduleStatusCancelled = "cancelled"
+)
+
+// запланированная цена: с Ends_At - распродажа в окне, без - плановое изменение базовой цены
+type PriceSchedule struct {
+	Schedule_ID  uuid.UUID  `json:"schedule_id"`
+	Product_ID   uuid.UUID  `json:"product_id"`
+	Price        *Money     `json:"price" validate:"required"`
+	Starts_At    *time.Time `json:"starts_at" validate:"required"`
+	Ends_At      *time.Time `json:"ends_at" validate:"omitempty,gtfield=Starts_At"`
+	Status       string     `json:"status"`
+	Created_By   string     `json:"created_by"`
+	Created_At   time.Time  `json:"created_at"`
+	Applied_At   *time.Time `json:"applied_at"`
+	Cancelled_At *time.Time `json:"cancelled_at"`
 }
 
 type Payment struct {
 	Digital bool
 	COD     bool
 }
+
+// типы предупреждений проверки корзины
+const (
+	CartWarningPriceIncreased = "price_increased"
+	CartWarningPriceDecreased = "price_decreased"
+	CartWarningOutOfStock     = "out_of_stock"
+	CartWarningArchived       = "archived"
+)
+
+// предупреждение проверки корзины. Old_Price/New_Price - для изменения цены (в базовой валюте Currency),
+// Available - для нехватки остатка (сколько можно купить)
+type CartWarning struct {
+	Type         string    `json:"type"`
+	Product_ID   uuid.UUID `json:"product_id"`
+	Product_Name string    `json:"product_name"`
+	Old_Price    *Money    `json:"old_price,omitempty"`
+	New_Price    *Money    `json:"new_price,omitempty"`
+	Currency     string    `json:"currency,omitempty"`
+	Available    *int      `json:"available,omitempty"`
+}
+
+// подтверждение покупателем новой цены строки корзины
+type CartPriceAck struct {
+	Product_ID uuid.UUID `json:"product_id" validate:"required"`
+	Price      *Money    `json:"price" validate:"required"`
+}
+
+// сумма с ISO-кодом валюты, в которой она выражена
+type CurrencyAmount struct {
+	Amount   Money  `json:"amount"`
+	Currency string `json:"currency"`
+}
+
+// курс валюты к базовой: сколько единиц Currency дают за одну единицу базовой валюты
+type ExchangeRate struct {
+	Currency    string    `json:"currency"`
+	Rate        string    `json:"rate"`
+	Minor_Units int       `json:"minor_units"`
+	Updated_By  *string   `json:"updated_by"`
+	Updated_At  time.Time `json:"updated_at"`
+}
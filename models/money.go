@@ -0,0 +1,166 @@
+package models
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"math/bits"
+	"strconv"
+
+	"github.com/jackc/pgx/v5/pgtype"
+)
+
+// Money - денежная сумма в минорных единицах валюты (копейках, центах): целое неотрицательное
+// число в пределах BIGINT. Арифметика не переполняется молча и не уходит ниже нуля - вместо этого
+// возвращает ошибку. Дробный результат (доля суммы, налог, пересчет по курсу) округляется
+// до целой минорной единицы, половина - вверх
+type Money int64
+
+// MaxMoney - наибольшая сумма, которая помещается в BIGINT
+const MaxMoney = Money(math.MaxInt64)
+
+var (
+	ErrMoneyOverflow = errors.New("money amount is too large")
+	ErrNegativeMoney = errors.New("money amount must not be negative")
+	ErrZeroRatio     = errors.New("money ratio denominator must be positive")
+)
+
+// Add - сумма m + n
+func (m Money) Add(n Money) (Money, error) {
+	if n > MaxMoney-m {
+		return 0, ErrMoneyOverflow
+	}
+
+	return m + n, nil
+}
+
+// Sub - разность m - n; ErrNegativeMoney, если n больше m
+func (m Money) Sub(n Money) (Money, error) {
+	if n > m {
+		return 0, ErrNegativeMoney
+	}
+
+	return m - n, nil
+}
+
+// Mul - стоимость quantity единиц по цене m
+func (m Money) Mul(quantity int) (Money, error) {
+	if quantity < 0 {
+		return 0, ErrNegativeMoney
+	}
+
+	hi, lo := bits.Mul64(uint64(m), uint64(quantity))
+
+	if hi != 0 || lo > uint64(MaxMoney) {
+		return 0, ErrMoneyOverflow
+	}
+
+	return Money(lo), nil
+}
+
+// AddMul - итог m плюс стоимость quantity единиц по цене price: строка корзины или заказа
+func (m Money) AddMul(price Money, quantity int) (Money, error) {
+	line, err := price.Mul(quantity)
+
+	if err != nil {
+		return 0, err
+	}
+
+	return m.Add(line)
+}
+
+// MulRatio - доля суммы m * num / den, округленная до минорной единицы, половина - вверх.
+// Промежуточное произведение не переполняется; den должен быть больше нуля
+func (m Money) MulRatio(num uint64, den uint64) (Money, error) {
+	if den == 0 {
+		return 0, ErrZeroRatio
+	}
+
+	hi, lo := bits.Mul64(uint64(m), num)
+
+	if hi >= den {
+		return 0, ErrMoneyOverflow
+	}
+
+	quotient, remainder := bits.Div64(hi, lo, den)
+
+	if remainder >= den-remainder {
+		quotient++
+	}
+
+	if quotient > uint64(MaxMoney) {
+		return 0, ErrMoneyOverflow
+	}
+
+	return Money(quotient), nil
+}
+
+// Sum складывает суммы с проверкой переполнения
+func Sum(amounts ...Money) (Money, error) {
+	var total Money
+
+	for _, amount := range amounts {
+		var err error
+
+		if total, err = total.Add(amount); err != nil {
+			return 0, err
+		}
+	}
+
+	return total, nil
+}
+
+// MarshalJSON пишет сумму целым числом минорных единиц
+func (m Money) MarshalJSON() ([]byte, error) {
+	return strconv.AppendInt(nil, int64(m), 10), nil
+}
+
+// UnmarshalJSON принимает только целое неотрицательное число минорных единиц:
+// 1500.5, "1500" и -1 - ошибки, а не округление
+func (m *Money) UnmarshalJSON(data []byte) error {
+	if string(data) == "null" {
+		return nil
+	}
+
+	value, err := strconv.ParseInt(string(data), 10, 64)
+
+	if errors.Is(err, strconv.ErrRange) {
+		if data[0] == '-' {
+			return ErrNegativeMoney
+		}
+
+		return ErrMoneyOverflow
+	}
+
+	if err != nil {
+		return fmt.Errorf("money amount must be an integer number of minor units, got %s", data)
+	}
+
+	if value < 0 {
+		return ErrNegativeMoney
+	}
+
+	*m = Money(value)
+
+	return nil
+}
+
+// ScanInt64 читает сумму из BIGINT или целого NUMERIC; NULL читается только в *Money
+func (m *Money) ScanInt64(value pgtype.Int8) error {
+	if !value.Valid {
+		return errors.New("cannot scan NULL into models.Money")
+	}
+
+	if value.Int64 < 0 {
+		return ErrNegativeMoney
+	}
+
+	*m = Money(value.Int64)
+
+	return nil
+}
+
+// Int64Value передает сумму в запрос как BIGINT
+func (m Money) Int64Value() (pgtype.Int8, error) {
+	return pgtype.Int8{Int64: int64(m), Valid: true}, nil
+}
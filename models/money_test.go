@@ -0,0 +1,129 @@
+package models
+
+import (
+	"encoding/json"
+	"errors"
+	"testing"
+)
+
+func TestMoneyArithmetic(t *testing.T) {
+	tests := []struct {
+		name    string
+		op      func() (Money, error)
+		want    Money
+		wantErr error
+	}{
+		{"add", func() (Money, error) { return Money(150000).Add(50000) }, 200000, nil},
+		{"add up to max", func() (Money, error) { return (MaxMoney - 1).Add(1) }, MaxMoney, nil},
+		{"add overflow", func() (Money, error) { return MaxMoney.Add(1) }, 0, ErrMoneyOverflow},
+		{"add overflow of halves", func() (Money, error) { return (MaxMoney/2 + 1).Add(MaxMoney/2 + 1) }, 0, ErrMoneyOverflow},
+		{"sub", func() (Money, error) { return Money(150000).Sub(50000) }, 100000, nil},
+		{"sub to zero", func() (Money, error) { return Money(150000).Sub(150000) }, 0, nil},
+		{"sub below zero", func() (Money, error) { return Money(1).Sub(2) }, 0, ErrNegativeMoney},
+		{"mul", func() (Money, error) { return Money(150000).Mul(3) }, 450000, nil},
+		{"mul by zero", func() (Money, error) { return MaxMoney.Mul(0) }, 0, nil},
+		{"mul negative quantity", func() (Money, error) { return Money(100).Mul(-1) }, 0, ErrNegativeMoney},
+		{"mul overflow", func() (Money, error) { return (MaxMoney/2 + 1).Mul(2) }, 0, ErrMoneyOverflow},
+		{"mul overflow of 128-bit product", func() (Money, error) { return MaxMoney.Mul(1 << 62) }, 0, ErrMoneyOverflow},
+		{"add mul", func() (Money, error) { return Money(1000).AddMul(250, 4) }, 2000, nil},
+		{"add mul line overflow", func() (Money, error) { return Money(0).AddMul(MaxMoney, 2) }, 0, ErrMoneyOverflow},
+		{"add mul total overflow", func() (Money, error) { return MaxMoney.AddMul(1, 1) }, 0, ErrMoneyOverflow},
+		{"add mul negative quantity", func() (Money, error) { return Money(1000).AddMul(250, -1) }, 0, ErrNegativeMoney},
+		{"sum overflow", func() (Money, error) { return Sum(MaxMoney, 1) }, 0, ErrMoneyOverflow},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := tt.op()
+
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("error = %v, want %v", err, tt.wantErr)
+			}
+
+			if got != tt.want {
+				t.Errorf("got %d, want %d", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestMoneyMulRatio(t *testing.T) {
+	tests := []struct {
+		name    string
+		amount  Money
+		num     uint64
+		den     uint64
+		want    Money
+		wantErr error
+	}{
+		{"exact", 150000, 2000, 10000, 30000, nil},
+		{"below half rounds down", 101, 1, 3, 34, nil},
+		{"half rounds up", 5, 1, 2, 3, nil},
+		{"above half rounds up", 200, 1, 3, 67, nil},
+		{"odd denominator half", 1, 3, 6, 1, nil},
+		{"zero amount", 0, 7, 3, 0, nil},
+		{"large intermediate product", MaxMoney, 3, 4, 6917529027641081855, nil},
+		{"result overflow", MaxMoney, 2, 1, 0, ErrMoneyOverflow},
+		{"zero denominator", 150000, 1, 0, 0, ErrZeroRatio},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := tt.amount.MulRatio(tt.num, tt.den)
+
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("MulRatio(%d, %d) error = %v, want %v", tt.num, tt.den, err, tt.wantErr)
+			}
+
+			if got != tt.want {
+				t.Errorf("MulRatio(%d, %d) = %d, want %d", tt.num, tt.den, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestMoneyUnmarshalJSON(t *testing.T) {
+	tests := []struct {
+		name    string
+		input   string
+		want    Money
+		wantErr bool
+	}{
+		{"integer", `150000`, 150000, false},
+		{"zero", `0`, 0, false},
+		{"max", `9223372036854775807`, MaxMoney, false},
+		{"null keeps value", `null`, 42, false},
+		{"fraction", `1500.5`, 42, true},
+		{"integral fraction", `1500.0`, 42, true},
+		{"exponent", `1e3`, 42, true},
+		{"string", `"1500"`, 42, true},
+		{"negative", `-1`, 42, true},
+		{"above max", `9223372036854775808`, 42, true},
+		{"below min", `-9223372036854775809`, 42, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := Money(42)
+			err := json.Unmarshal([]byte(tt.input), &got)
+
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("Unmarshal(%s) error = %v, want error %v", tt.input, err, tt.wantErr)
+			}
+
+			if got != tt.want {
+				t.Errorf("Unmarshal(%s) = %d, want %d", tt.input, got, tt.want)
+			}
+		})
+	}
+
+	var overflow, negative Money
+
+	if err := overflow.UnmarshalJSON([]byte(`9223372036854775808`)); !errors.Is(err, ErrMoneyOverflow) {
+		t.Errorf("out of range error = %v, want %v", err, ErrMoneyOverflow)
+	}
+
+	if err := negative.UnmarshalJSON([]byte(`-1`)); !errors.Is(err, ErrNegativeMoney) {
+		t.Errorf("negative error = %v, want %v", err, ErrNegativeMoney)
+	}
+}
@@ -0,0 +1,190 @@
+package notifications
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"mime"
+	"mime/quotedprintable"
+	"net/smtp"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// Message - письмо с текстовой и HTML версиями
+type Message struct {
+	To      string
+	Subject string
+	Text    string
+	HTML    string
+}
+
+// Mailer отправляет письма
+type Mailer interface {
+	Send(ctx context.Context, message Message) error
+}
+
+// SMTPMailer отправляет письма через SMTP сервер
+type SMTPMailer struct {
+	Addr string // host:port
+	From string
+	Auth smtp.Auth
+}
+
+func NewSMTPMailer(host string, port string, username string, password string, from string) *SMTPMailer {
+	mailer := &SMTPMailer{Addr: host + ":" + port, From: from}
+
+	if username != "" {
+		mailer.Auth = smtp.PlainAuth("", username, password, host)
+	}
+
+	return mailer
+}
+
+func (m *SMTPMailer) Send(ctx context.Context, message Message) error {
+	data, err := buildMIME(m.From, message)
+
+	if err != nil {
+		return err
+	}
+
+	return smtp.SendMail(m.Addr, m.Auth, m.From, []string{message.To}, data)
+}
+
+// FileMailer складывает письма в каталог в формате .eml (для разработки и тестов)
+type FileMailer struct {
+	Dir  string
+	From string
+}
+
+func NewFileMailer(dir string, from string) *FileMailer {
+	return &FileMailer{Dir: dir, From: from}
+}
+
+func (m *FileMailer) Send(ctx context.Context, message Message) error {
+	data, err := buildMIME(m.From, message)
+
+	if err != nil {
+		return err
+	}
+
+	if err := os.MkdirAll(m.Dir, 0o755); err != nil {
+		return err
+	}
+
+	name := fmt.Sprintf("%s-%s.eml", time.Now().UTC().Format("20060102T150405.000000000"), sanitizeFileName(message.To))
+
+	return os.WriteFile(filepath.Join(m.Dir, name), data, 0o644)
+}
+
+// MailerFromEnv выбирает реализацию по MAIL_DRIVER: smtp или file (по умолчанию)
+func MailerFromEnv() Mailer {
+	from := os.Getenv("MAIL_FROM")
+
+	if from == "" {
+		from = "no-reply@ec-platform.local"
+	}
+
+	if os.Getenv("MAIL_DRIVER") == "smtp" {
+		port := os.Getenv("SMTP_PORT")
+
+		if port == "" {
+			port = "587"
+		}
+
+		return NewSMTPMailer(os.Getenv("SMTP_HOST"), port, os.Getenv("SMTP_USERNAME"), os.Getenv("SMTP_PASSWORD"), from)
+	}
+
+	dir := os.Getenv("MAIL_DIR")
+
+	if dir == "" {
+		dir = "mail"
+	}
+
+	return NewFileMailer(dir, from)
+}
+
+// собирает письмо multipart/alternative (text/plain и text/html в UTF-8)
+func buildMIME(from string, message Message) ([]byte, error) {
+	boundary, err := randomHex(16)
+
+	if err != nil {
+		return nil, err
+	}
+
+	messageID, err := randomHex(16)
+
+	if err != nil {
+		return nil, err
+	}
+
+	domain := "localhost"
+
+	if at := strings.LastIndex(from, "@"); at >= 0 {
+		domain = from[at+1:]
+	}
+
+	var buf bytes.Buffer
+
+	fmt.Fprintf(&buf, "From: %s\r\n", from)
+	fmt.Fprintf(&buf, "To: %s\r\n", message.To)
+	fmt.Fprintf(&buf, "Subject: %s\r\n", mime.QEncoding.Encode("utf-8", message.Subject))
+	fmt.Fprintf(&buf, "Date: %s\r\n", time.Now().UTC().Format(time.RFC1123Z))
+	fmt.Fprintf(&buf, "Message-ID: <%s@%s>\r\n", messageID, domain)
+	buf.WriteString("MIME-Version: 1.0\r\n")
+	fmt.Fprintf(&buf, "Content-Type: multipart/alternative; boundary=%q\r\n\r\n", boundary)
+
+	parts := []struct {
+		contentType string
+		body        string
+	}{
+		{"text/plain", message.Text},
+		{"text/html", message.HTML},
+	}
+
+	for _, part := range parts {
+		fmt.Fprintf(&buf, "--%s\r\n", boundary)
+		fmt.Fprintf(&buf, "Content-Type: %s; charset=utf-8\r\n", part.contentType)
+		buf.WriteString("Content-Transfer-Encoding: quoted-printable\r\n\r\n")
+
+		writer := quotedprintable.NewWriter(&buf)
+
+		if _, err := writer.Write([]byte(part.body)); err != nil {
+			return nil, err
+		}
+
+		if err := writer.Close(); err != nil {
+			return nil, err
+		}
+
+		buf.WriteString("\r\n")
+	}
+
+	fmt.Fprintf(&buf, "--%s--\r\n", boundary)
+
+	return buf.Bytes(), nil
+}
+
+func randomHex(size int) (string, error) {
+	data := make([]byte, size)
+
+	if _, err := rand.Read(data); err != nil {
+		return "", err
+	}
+
+	return hex.EncodeToString(data), nil
+}
+
+func sanitizeFileName(s string) string {
+	return strings.Map(func(r rune) rune {
+		if r == '/' || r == '\\' || r == ':' || r == 0 {
+			return '_'
+		}
+
+		return r
+	}, s)
+}
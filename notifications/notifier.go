@@ -0,0 +1,232 @@
+package notifications
+
+import (
+	"context"
+	"ec-platform/currency"
+	"ec-platform/database"
+	"ec-platform/jobs"
+	"ec-platform/models"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+// EmailJob - данные задачи models.JobSendEmail
+type EmailJob struct {
+	Template    string             `json:"template"`
+	User_ID     string             `json:"user_id"`
+	Order_ID    *uuid.UUID         `json:"order_id,omitempty"`
+	Status      string             `json:"status,omitempty"`
+	Reminder_ID *uuid.UUID         `json:"reminder_id,omitempty"`
+	Price_Drops []models.PriceDrop `json:"price_drops,omitempty"`
+}
+
+// данные, доступные в шаблонах
+type templateData struct {
+	First_Name  string
+	Order       *models.Order
+	Status      string
+	Cart        []models.CartItem
+	Cart_Value  models.Money
+	Currency    string
+	Restore_URL string
+	Price_Drops []models.PriceDrop
+}
+
+// Параметры кампании напоминаний о брошенных корзинах по умолчанию
+const (
+	DefaultCartIdle     = 24 * time.Hour
+	DefaultCartMaxAge   = 7 * 24 * time.Hour
+	DefaultCartCooldown = 72 * time.Hour
+	cartRemindersBatch  = 100
+	priceDropsBatch     = 500
+)
+
+// статусы заказа, о смене на которые пишем покупателю
+var notifiedStatuses = map[string]bool{
+	models.OrderStatusShipped:   true,
+	models.OrderStatusDelivered: true,
+	models.OrderStatusCancelled: true,
+}
+
+// Notifier превращает доменные события в задачи отправки писем и отправляет их
+type Notifier struct {
+	db     *pgxpool.Pool
+	mailer Mailer
+
+	BaseURL      string        // адрес приложения для ссылок в письмах
+	CartIdle     time.Duration // через сколько без изменений корзина считается брошенной
+	BaseCurrency string        // валюта сумм в письмах о корзине
+}
+
+func NewNotifier(db *pgxpool.Pool, mailer Mailer) *Notifier {
+	return &Notifier{
+		db:           db,
+		mailer:       mailer,
+		BaseURL:      "http://localhost:8000",
+		CartIdle:     DefaultCartIdle,
+		BaseCurrency: currency.DefaultBase,
+	}
+}
+
+// HandleEvent - обработчик outbox: ставит в очередь письмо о заказе. Ключ задачи по id события
+// не дает поставить второе письмо, пока первое еще в очереди
+func (n *Notifier) HandleEvent(ctx context.Context, event models.OutboxEvent) error {
+	if event.Event_Type != models.EventOrderPlaced && event.Event_Type != models.EventOrderStatusChanged {
+		return nil
+	}
+
+	var payload models.OrderEvent
+
+	if err := json.Unmarshal(event.Payload, &payload); err != nil {
+		return fmt.Errorf("invalid %s payload: %w", event.Event_Type, err)
+	}
+
+	job := EmailJob{User_ID: payload.User_ID, Order_ID: &payload.Order_ID}
+
+	if event.Event_Type == models.EventOrderPlaced {
+		job.Template = TemplateOrderPlaced
+	} else if notifiedStatuses[payload.Status] {
+		job.Template = TemplateOrderStatus
+		job.Status = payload.Status
+	} else {
+		return nil
+	}
+
+	uniqueKey := fmt.Sprintf("email:%s:%d", job.Template, event.ID)
+
+	_, err := database.EnqueueJob(ctx, n.db, models.JobSendEmail, job, time.Now(), uniqueKey)
+
+	return err
+}
+
+// Handler - обработчик задач models.JobSendEmail
+func (n *Notifier) Handler() jobs.Handler {
+	return jobs.Typed(n.send)
+}
+
+// RemindAbandonedCarts - обработчик периодической задачи models.JobCartReminders: создает
+// напоминания о брошенных корзинах вместе с задачами отправки писем
+func (n *Notifier) RemindAbandonedCarts(ctx context.Context, job models.Job) error {
+	for {
+		created, err := database.CreateCartReminders(ctx, n.db, n.CartIdle, DefaultCartMaxAge, DefaultCartCooldown, cartRemindersBatch, models.JobSendEmail,
+			func(reminder models.CartReminder) interface{} {
+				return EmailJob{Template: TemplateCartReminder, User_ID: reminder.User_ID, Reminder_ID: &reminder.Reminder_ID}
+			})
+
+		if err != nil {
+			return err
+		}
+
+		if created < cartRemindersBatch {
+			return nil
+		}
+	}
+}
+
+// NotifyPriceDrops - обработчик периодической задачи models.JobWishlistPriceDrops: ставит письма
+// о снижении цен на товары из списков желаний
+func (n *Notifier) NotifyPriceDrops(ctx context.Context, job models.Job) error {
+	for {
+		processed, err := database.CreatePriceDropNotifications(ctx, n.db, priceDropsBatch, models.JobSendEmail,
+			func(userID string, drops []models.PriceDrop) interface{} {
+				return EmailJob{Template: TemplatePriceDrop, User_ID: userID, Price_Drops: drops}
+			})
+
+		if err != nil {
+			return err
+		}
+
+		if processed < priceDropsBatch {
+			return nil
+		}
+	}
+}
+
+// собирает письмо на языке пользователя и отправляет его
+func (n *Notifier) send(ctx context.Context, job EmailJob) error {
+	user, err := database.GetUserContact(ctx, n.db, job.User_ID)
+
+	if err != nil {
+		return err
+	}
+
+	data := templateData{Status: job.Status, Price_Drops: job.Price_Drops}
+
+	if user.First_Name != nil {
+		data.First_Name = *user.First_Name
+	}
+
+	if job.Reminder_ID != nil {
+		return n.sendCartReminder(ctx, user, *job.Reminder_ID, data)
+	}
+
+	if job.Order_ID != nil {
+		data.Order, err = database.GetOrder(ctx, n.db, job.User_ID, *job.Order_ID)
+
+		if err != nil {
+			return err
+		}
+	}
+
+	message, err := Render(userLocale(user), job.Template, *user.Email, data)
+
+	if err != nil {
+		return err
+	}
+
+	return n.mailer.Send(ctx, *message)
+}
+
+// отправляет напоминание о корзине, если покупатель еще не оформил ее и не очистил
+func (n *Notifier) sendCartReminder(ctx context.Context, user *models.User, reminderID uuid.UUID, data templateData) error {
+	reminder, err := database.GetCartReminder(ctx, n.db, reminderID)
+
+	if err != nil {
+		return err
+	}
+
+	if reminder.Status != models.CartReminderStatusPending {
+		return nil
+	}
+
+	data.Currency = n.BaseCurrency
+	data.Cart, err = database.GetCartItems(ctx, n.db, user.User_ID, currency.Identity(n.BaseCurrency))
+
+	if err != nil {
+		return err
+	}
+
+	if len(data.Cart) == 0 {
+		return database.CompleteCartReminder(ctx, n.db, reminderID, models.CartReminderStatusCancelled)
+	}
+
+	if data.Cart_Value, err = database.CartTotal(data.Cart); err != nil {
+		return err
+	}
+
+	data.Restore_URL = n.BaseURL + "/cart/restore/" + reminder.Token
+
+	message, err := Render(userLocale(user), TemplateCartReminder, *user.Email, data)
+
+	if err != nil {
+		return err
+	}
+
+	if err := n.mailer.Send(ctx, *message); err != nil {
+		return err
+	}
+
+	return database.CompleteCartReminder(ctx, n.db, reminderID, models.CartReminderStatusSent)
+}
+
+func userLocale(user *models.User) string {
+	if user.Locale != nil {
+		return *user.Locale
+	}
+
+	return DefaultLocale
+}
@@ -0,0 +1,91 @@
+package notifications
+
+import (
+	"bytes"
+	"embed"
+	"errors"
+	htmltemplate "html/template"
+	texttemplate "text/template"
+)
+
+// Языки писем
+const (
+	LocaleRU      = "ru"
+	LocaleEN      = "en"
+	DefaultLocale = LocaleRU
+)
+
+// Шаблоны писем
+const (
+	TemplateWelcome      = "welcome"
+	TemplateOrderPlaced  = "order_placed"
+	TemplateOrderStatus  = "order_status"
+	TemplateCartReminder = "cart_reminder"
+	TemplatePriceDrop    = "price_drop"
+)
+
+var ErrUnknownTemplate = errors.New("unknown email template")
+
+// Каждый шаблон - файл templates/<locale>/<name>.tmpl с блоками subject, text и html
+//
+//go:embed templates
+var templateFiles embed.FS
+
+// разобранный шаблон: subject и text - text/template, html - html/template (с экранированием)
+type emailTemplate struct {
+	text *texttemplate.Template
+	html *htmltemplate.Template
+}
+
+var templates = loadTemplates()
+
+func loadTemplates() map[string]emailTemplate {
+	loaded := make(map[string]emailTemplate)
+
+	for _, locale := range []string{LocaleRU, LocaleEN} {
+		for _, name := range []string{TemplateWelcome, TemplateOrderPlaced, TemplateOrderStatus, TemplateCartReminder, TemplatePriceDrop} {
+			path := "templates/" + locale + "/" + name + ".tmpl"
+
+			loaded[locale+"/"+name] = emailTemplate{
+				text: texttemplate.Must(texttemplate.ParseFS(templateFiles, path)),
+				html: htmltemplate.Must(htmltemplate.ParseFS(templateFiles, path)),
+			}
+		}
+	}
+
+	return loaded
+}
+
+// Render собирает письмо по шаблону на языке locale (неизвестный язык - DefaultLocale)
+func Render(locale string, name string, to string, data interface{}) (*Message, error) {
+	tmpl, ok := templates[locale+"/"+name]
+
+	if !ok {
+		tmpl, ok = templates[DefaultLocale+"/"+name]
+	}
+
+	if !ok {
+		return nil, ErrUnknownTemplate
+	}
+
+	var subject, text, html bytes.Buffer
+
+	if err := tmpl.text.ExecuteTemplate(&subject, "subject", data); err != nil {
+		return nil, err
+	}
+
+	if err := tmpl.text.ExecuteTemplate(&text, "text", data); err != nil {
+		return nil, err
+	}
+
+	if err := tmpl.html.ExecuteTemplate(&html, "html", data); err != nil {
+		return nil, err
+	}
+
+	return &Message{
+		To:      to,
+		Subject: string(bytes.TrimSpace(subject.Bytes())),
+		Text:    text.String(),
+		HTML:    html.String(),
+	}, nil
+}
@@ -0,0 +1,41 @@
+package payments
+
+import (
+	"context"
+	"ec-platform/models"
+	"net/http"
+)
+
+// COD - оплата наличными при получении. Платеж ждет оплаты (pending),
+// списание (Capture) подтверждает сотрудник, получивший деньги
+type COD struct{}
+
+func NewCOD() *COD {
+	return &COD{}
+}
+
+func (p *COD) Name() string {
+	return models.PaymentProviderCOD
+}
+
+func (p *COD) CreateIntent(ctx context.Context, request IntentRequest) (*Intent, error) {
+	return &Intent{ID: "cod_" + request.OrderID.String(), Status: StatusPending}, nil
+}
+
+func (p *COD) Capture(ctx context.Context, intentID string, amount models.Money) (*Intent, error) {
+	return &Intent{ID: intentID, Status: StatusCaptured}, nil
+}
+
+// возврат наличных выполняется вручную, провайдер только фиксирует его
+func (p *COD) Refund(ctx context.Context, intentID string, amount models.Money) (*Intent, error) {
+	return &Intent{ID: intentID, Status: StatusRefunded}, nil
+}
+
+// наличные еще не получены - отменять у провайдера нечего
+func (p *COD) Void(ctx context.Context, intentID string) (*Intent, error) {
+	return &Intent{ID: intentID, Status: StatusFailed}, nil
+}
+
+func (p *COD) ParseWebhook(payload []byte, header http.Header) (*Event, error) {
+	return nil, ErrWebhooksNotSupported
+}
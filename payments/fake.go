@@ -0,0 +1,177 @@
+package payments
+
+import (
+	"context"
+	"ec-platform/models"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// Тестовые токены карт фейкового шлюза
+const (
+	FakeTokenSuccess         = "tok_success"          // оплата проходит
+	FakeTokenDeclined        = "tok_declined"         // отказ при создании платежа
+	FakeTokenCaptureDeclined = "tok_capture_declined" // отказ при списании
+)
+
+// платеж в памяти фейкового шлюза
+type fakeIntent struct {
+	token    string
+	amount   models.Money
+	captured models.Money
+	refunded models.Money
+	voided   bool
+}
+
+// FakeGateway - детерминированный карточный шлюз для локальной разработки и тестов.
+// Результат зависит только от токена карты, идентификаторы платежей идут по порядку.
+// Webhook подписываются секретом шлюза так же, как у реального провайдера
+type FakeGateway struct {
+	mu      sync.Mutex
+	counter int
+	events  int
+	intents map[string]*fakeIntent
+	secret  string
+	now     func() time.Time
+}
+
+func NewFakeGateway(secret string) *FakeGateway {
+	return &FakeGateway{intents: make(map[string]*fakeIntent), secret: secret, now: time.Now}
+}
+
+func (g *FakeGateway) Name() string {
+	return "fake"
+}
+
+func (g *FakeGateway) CreateIntent(ctx context.Context, request IntentRequest) (*Intent, error) {
+	if request.Token == "" || request.Token == FakeTokenDeclined {
+		return nil, ErrDeclined
+	}
+
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	g.counter++
+	id := fmt.Sprintf("fake_pi_%06d", g.counter)
+
+	g.intents[id] = &fakeIntent{token: request.Token, amount: request.Amount}
+
+	return &Intent{ID: id, Status: StatusRequiresCapture}, nil
+}
+
+func (g *FakeGateway) Capture(ctx context.Context, intentID string, amount models.Money) (*Intent, error) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	intent, ok := g.intents[intentID]
+
+	if !ok {
+		return nil, ErrUnknownIntent
+	}
+
+	if intent.voided || intent.token == FakeTokenCaptureDeclined || amount > intent.amount {
+		return nil, ErrDeclined
+	}
+
+	intent.captured = amount
+
+	return &Intent{ID: intentID, Status: StatusCaptured}, nil
+}
+
+func (g *FakeGateway) Refund(ctx context.Context, intentID string, amount models.Money) (*Intent, error) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	intent, ok := g.intents[intentID]
+
+	if !ok {
+		return nil, ErrUnknownIntent
+	}
+
+	if intent.captured == 0 {
+		return nil, ErrNotCaptured
+	}
+
+	left, err := intent.captured.Sub(intent.refunded)
+
+	if err != nil || amount > left {
+		return nil, ErrRefundExceedsCaptured
+	}
+
+	if intent.refunded, err = intent.refunded.Add(amount); err != nil {
+		return nil, err
+	}
+
+	return &Intent{ID: intentID, Status: StatusRefunded}, nil
+}
+
+// после отмены списать средства уже нельзя
+func (g *FakeGateway) Void(ctx context.Context, intentID string) (*Intent, error) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	intent, ok := g.intents[intentID]
+
+	if !ok {
+		return nil, ErrUnknownIntent
+	}
+
+	if intent.captured > 0 {
+		return nil, ErrAlreadyCaptured
+	}
+
+	intent.voided = true
+
+	return &Intent{ID: intentID, Status: StatusFailed}, nil
+}
+
+// проверяет подпись и разбирает событие
+func (g *FakeGateway) ParseWebhook(payload []byte, header http.Header) (*Event, error) {
+	err := VerifySignature(g.secret, header.Get(SignatureHeader), payload, SignatureTolerance, g.now())
+
+	if err != nil {
+		return nil, err
+	}
+
+	var event Event
+
+	if err := json.Unmarshal(payload, &event); err != nil {
+		return nil, err
+	}
+
+	if event.ID == "" || event.Type == "" {
+		return nil, ErrInvalidEvent
+	}
+
+	return &event, nil
+}
+
+// формирует подписанный webhook, как его прислал бы шлюз (для проверки всего потока оплаты).
+// Идентификаторы событий идут по порядку: fake_evt_000001, ...
+func (g *FakeGateway) Webhook(eventType string, intentID string, amount models.Money) (payload []byte, header http.Header, err error) {
+	g.mu.Lock()
+	g.events++
+	event := Event{
+		ID:        fmt.Sprintf("fake_evt_%06d", g.events),
+		Type:      eventType,
+		IntentID:  intentID,
+		Amount:    amount,
+		CreatedAt: g.now().UTC(),
+	}
+	g.mu.Unlock()
+
+	payload, err = json.Marshal(event)
+
+	if err != nil {
+		return nil, nil, err
+	}
+
+	header = http.Header{}
+	header.Set("Content-Type", "application/json")
+	header.Set(SignatureHeader, Sign(g.secret, event.CreatedAt, payload))
+
+	return payload, header, nil
+}
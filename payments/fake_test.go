@@ -0,0 +1,163 @@
+package payments
+
+import (
+	"context"
+	"ec-platform/models"
+	"errors"
+	"testing"
+
+	"github.com/google/uuid"
+)
+
+func TestFakeGatewayCreateIntent(t *testing.T) {
+	tests := []struct {
+		name    string
+		token   string
+		wantErr error
+	}{
+		{"approved", FakeTokenSuccess, nil},
+		{"capture declined later", FakeTokenCaptureDeclined, nil},
+		{"declined", FakeTokenDeclined, ErrDeclined},
+		{"no token", "", ErrDeclined},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			gateway := NewFakeGateway("secret")
+
+			intent, err := gateway.CreateIntent(context.Background(), IntentRequest{OrderID: uuid.New(), Amount: 150000, Currency: "RUB", Token: tt.token})
+
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("CreateIntent() error = %v, want %v", err, tt.wantErr)
+			}
+
+			if tt.wantErr != nil {
+				return
+			}
+
+			if intent.ID != "fake_pi_000001" || intent.Status != StatusRequiresCapture {
+				t.Errorf("CreateIntent() = %+v, want fake_pi_000001 requires_capture", intent)
+			}
+		})
+	}
+}
+
+func TestFakeGatewayCapture(t *testing.T) {
+	tests := []struct {
+		name     string
+		token    string
+		intentID string
+		amount   models.Money
+		wantErr  error
+	}{
+		{"full amount", FakeTokenSuccess, "fake_pi_000001", 150000, nil},
+		{"partial amount", FakeTokenSuccess, "fake_pi_000001", 100000, nil},
+		{"more than authorized", FakeTokenSuccess, "fake_pi_000001", 150001, ErrDeclined},
+		{"declined token", FakeTokenCaptureDeclined, "fake_pi_000001", 150000, ErrDeclined},
+		{"unknown intent", FakeTokenSuccess, "fake_pi_999999", 150000, ErrUnknownIntent},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx := context.Background()
+			gateway := NewFakeGateway("secret")
+
+			if _, err := gateway.CreateIntent(ctx, IntentRequest{OrderID: uuid.New(), Amount: 150000, Token: tt.token}); err != nil {
+				t.Fatalf("CreateIntent() error = %v", err)
+			}
+
+			intent, err := gateway.Capture(ctx, tt.intentID, tt.amount)
+
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("Capture() error = %v, want %v", err, tt.wantErr)
+			}
+
+			if tt.wantErr == nil && intent.Status != StatusCaptured {
+				t.Errorf("Capture() status = %s, want %s", intent.Status, StatusCaptured)
+			}
+		})
+	}
+}
+
+func TestFakeGatewayRefund(t *testing.T) {
+	ctx := context.Background()
+	gateway := NewFakeGateway("secret")
+
+	intent, err := gateway.CreateIntent(ctx, IntentRequest{OrderID: uuid.New(), Amount: 150000, Token: FakeTokenSuccess})
+
+	if err != nil {
+		t.Fatalf("CreateIntent() error = %v", err)
+	}
+
+	if _, err := gateway.Refund(ctx, intent.ID, 1000); !errors.Is(err, ErrNotCaptured) {
+		t.Fatalf("Refund() before capture error = %v, want %v", err, ErrNotCaptured)
+	}
+
+	if _, err := gateway.Capture(ctx, intent.ID, 150000); err != nil {
+		t.Fatalf("Capture() error = %v", err)
+	}
+
+	steps := []struct {
+		name    string
+		amount  models.Money
+		wantErr error
+	}{
+		{"partial", 50000, nil},
+		{"more than left", 100001, ErrRefundExceedsCaptured},
+		{"rest", 100000, nil},
+		{"already refunded", 1, ErrRefundExceedsCaptured},
+	}
+
+	for _, step := range steps {
+		refunded, err := gateway.Refund(ctx, intent.ID, step.amount)
+
+		if !errors.Is(err, step.wantErr) {
+			t.Fatalf("%s: Refund() error = %v, want %v", step.name, err, step.wantErr)
+		}
+
+		if step.wantErr == nil && refunded.Status != StatusRefunded {
+			t.Errorf("%s: Refund() status = %s, want %s", step.name, refunded.Status, StatusRefunded)
+		}
+	}
+
+	if _, err := gateway.Refund(ctx, "fake_pi_999999", 1000); !errors.Is(err, ErrUnknownIntent) {
+		t.Errorf("Refund() of unknown intent error = %v, want %v", err, ErrUnknownIntent)
+	}
+}
+
+func TestFakeGatewayVoid(t *testing.T) {
+	ctx := context.Background()
+	gateway := NewFakeGateway("secret")
+
+	voided, err := gateway.CreateIntent(ctx, IntentRequest{OrderID: uuid.New(), Amount: 150000, Token: FakeTokenSuccess})
+
+	if err != nil {
+		t.Fatalf("CreateIntent() error = %v", err)
+	}
+
+	if intent, err := gateway.Void(ctx, voided.ID); err != nil || intent.Status != StatusFailed {
+		t.Fatalf("Void() = %+v, %v, want %s", intent, err, StatusFailed)
+	}
+
+	if _, err := gateway.Capture(ctx, voided.ID, 150000); !errors.Is(err, ErrDeclined) {
+		t.Errorf("Capture() after void error = %v, want %v", err, ErrDeclined)
+	}
+
+	captured, err := gateway.CreateIntent(ctx, IntentRequest{OrderID: uuid.New(), Amount: 150000, Token: FakeTokenSuccess})
+
+	if err != nil {
+		t.Fatalf("CreateIntent() error = %v", err)
+	}
+
+	if _, err := gateway.Capture(ctx, captured.ID, 150000); err != nil {
+		t.Fatalf("Capture() error = %v", err)
+	}
+
+	if _, err := gateway.Void(ctx, captured.ID); !errors.Is(err, ErrAlreadyCaptured) {
+		t.Errorf("Void() after capture error = %v, want %v", err, ErrAlreadyCaptured)
+	}
+
+	if _, err := gateway.Void(ctx, "fake_pi_999999"); !errors.Is(err, ErrUnknownIntent) {
+		t.Errorf("Void() of unknown intent error = %v, want %v", err, ErrUnknownIntent)
+	}
+}
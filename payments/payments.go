@@ -0,0 +1,114 @@
+package payments
+
+import (
+	"context"
+	"ec-platform/models"
+	"errors"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// Статусы платежа у провайдера
+const (
+	StatusPending         = "pending"          // ждет оплаты (наличные при получении)
+	StatusRequiresCapture = "requires_capture" // средства заблокированы, нужно списание
+	StatusCaptured        = "captured"
+	StatusFailed          = "failed"
+	StatusRefunded        = "refunded"
+)
+
+// Типы событий webhook
+const (
+	EventPaymentCaptured = "payment.captured"
+	EventPaymentFailed   = "payment.failed"
+	EventPaymentRefunded = "payment.refunded" // Amount - общая сумма возвратов по платежу
+)
+
+var (
+	ErrUnknownProvider       = errors.New("unknown payment provider")
+	ErrDeclined              = errors.New("payment declined")
+	ErrUnknownIntent         = errors.New("unknown payment intent")
+	ErrNotCaptured           = errors.New("payment is not captured")
+	ErrRefundExceedsCaptured = errors.New("refund amount exceeds captured amount")
+	ErrAlreadyCaptured       = errors.New("payment is already captured")
+	ErrWebhooksNotSupported  = errors.New("payment provider does not send webhooks")
+	ErrInvalidEvent          = errors.New("invalid webhook event")
+)
+
+// IntentRequest - запрос на создание платежа по заказу
+type IntentRequest struct {
+	OrderID  uuid.UUID
+	Amount   models.Money // в минорных единицах валюты Currency
+	Currency string       // ISO-код валюты заказа
+	Token    string       // одноразовый токен карты от клиента, для наличных не нужен
+}
+
+// Intent - платеж у провайдера
+type Intent struct {
+	ID     string
+	Status string
+}
+
+// Event - событие от провайдера (webhook)
+type Event struct {
+	ID        string       `json:"id"`
+	Type      string       `json:"type"`
+	IntentID  string       `json:"intent_id"`
+	Amount    models.Money `json:"amount"`
+	CreatedAt time.Time    `json:"created_at"`
+}
+
+// PaymentProvider - платежный провайдер (шлюз)
+type PaymentProvider interface {
+	// имя провайдера, под ним платежи хранятся в таблице payments
+	Name() string
+	CreateIntent(ctx context.Context, request IntentRequest) (*Intent, error)
+	Capture(ctx context.Context, intentID string, amount models.Money) (*Intent, error)
+	// возврат может быть частичным
+	Refund(ctx context.Context, intentID string, amount models.Money) (*Intent, error)
+	// снимает блокировку средств по еще не списанному платежу (отмена заказа)
+	Void(ctx context.Context, intentID string) (*Intent, error)
+	ParseWebhook(payload []byte, header http.Header) (*Event, error)
+}
+
+// Registry - набор доступных провайдеров по имени
+type Registry struct {
+	mu        sync.RWMutex
+	providers map[string]PaymentProvider
+}
+
+// создает реестр из списка провайдеров
+func NewRegistry(providers ...PaymentProvider) *Registry {
+	registry := &Registry{providers: make(map[string]PaymentProvider)}
+
+	for _, provider := range providers {
+		registry.Register(provider)
+	}
+
+	return registry
+}
+
+// добавляет провайдера в реестр
+func (r *Registry) Register(provider PaymentProvider) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.providers[provider.Name()] = provider
+}
+
+// возвращает провайдера по имени
+func (r *Registry) Get(name string) (PaymentProvider, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	provider, ok := r.providers[name]
+
+	if !ok {
+		return nil, ErrUnknownProvider
+	}
+
+	return provider, nil
+}
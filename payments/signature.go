@@ -0,0 +1,86 @@
+package payments
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// SignatureHeader - заголовок с подписью webhook: "t=<unix time>,v1=<hex HMAC-SHA256>"
+const SignatureHeader = "X-Signature"
+
+// SignatureTolerance - допустимое расхождение времени подписи и времени получения
+const SignatureTolerance = 5 * time.Minute
+
+var (
+	ErrInvalidSignature = errors.New("invalid webhook signature")
+	ErrSignatureExpired = errors.New("webhook signature timestamp is outside the tolerance")
+)
+
+// подписывает тело webhook: HMAC-SHA256 от "<timestamp>.<payload>"
+func Sign(secret string, timestamp time.Time, payload []byte) string {
+	unix := strconv.FormatInt(timestamp.Unix(), 10)
+
+	return "t=" + unix + ",v1=" + computeSignature(secret, unix, payload)
+}
+
+// проверяет подпись и время webhook. Время защищает от повторной отправки перехваченного запроса
+func VerifySignature(secret string, header string, payload []byte, tolerance time.Duration, now time.Time) error {
+	var unix string
+	var signatures []string
+
+	for _, part := range strings.Split(header, ",") {
+		key, value, found := strings.Cut(strings.TrimSpace(part), "=")
+
+		if !found {
+			continue
+		}
+
+		switch key {
+		case "t":
+			unix = value
+		case "v1":
+			signatures = append(signatures, value)
+		}
+	}
+
+	if unix == "" || len(signatures) == 0 {
+		return ErrInvalidSignature
+	}
+
+	seconds, err := strconv.ParseInt(unix, 10, 64)
+
+	if err != nil {
+		return ErrInvalidSignature
+	}
+
+	signedAt := time.Unix(seconds, 0)
+
+	if now.Sub(signedAt) > tolerance || signedAt.Sub(now) > tolerance {
+		return ErrSignatureExpired
+	}
+
+	expected := computeSignature(secret, unix, payload)
+
+	// Несколько v1 возможны при смене секрета
+	for _, signature := range signatures {
+		if hmac.Equal([]byte(signature), []byte(expected)) {
+			return nil
+		}
+	}
+
+	return ErrInvalidSignature
+}
+
+func computeSignature(secret string, unix string, payload []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(unix))
+	mac.Write([]byte("."))
+	mac.Write(payload)
+
+	return hex.EncodeToString(mac.Sum(nil))
+}
@@ -0,0 +1,81 @@
+package payments
+
+import (
+	"errors"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestVerifySignature(t *testing.T) {
+	payload := []byte(`{"id":"evt_1","type":"payment.captured","intent_id":"pi_1","amount":150000}`)
+	signedAt := time.Date(2026, 10, 19, 12, 0, 0, 0, time.UTC)
+	header := Sign("secret", signedAt, payload)
+	_, signature, _ := strings.Cut(header, ",v1=")
+
+	tests := []struct {
+		name    string
+		secret  string
+		header  string
+		payload []byte
+		now     time.Time
+		wantErr error
+	}{
+		{"valid", "secret", header, payload, signedAt.Add(time.Minute), nil},
+		{"valid at tolerance", "secret", header, payload, signedAt.Add(SignatureTolerance), nil},
+		{"rotated secret", "secret", "t=" + unixOf(signedAt) + ",v1=" + strings.Repeat("0", 64) + ",v1=" + signature, payload, signedAt, nil},
+		{"expired", "secret", header, payload, signedAt.Add(SignatureTolerance + time.Second), ErrSignatureExpired},
+		{"from the future", "secret", header, payload, signedAt.Add(-SignatureTolerance - time.Second), ErrSignatureExpired},
+		{"tampered payload", "secret", header, []byte(strings.Replace(string(payload), "150000", "1", 1)), signedAt, ErrInvalidSignature},
+		{"tampered timestamp", "secret", "t=" + unixOf(signedAt.Add(time.Second)) + ",v1=" + signature, payload, signedAt, ErrInvalidSignature},
+		{"wrong secret", "other", header, payload, signedAt, ErrInvalidSignature},
+		{"empty header", "secret", "", payload, signedAt, ErrInvalidSignature},
+		{"no signature", "secret", "t=" + unixOf(signedAt), payload, signedAt, ErrInvalidSignature},
+		{"no timestamp", "secret", "v1=" + signature, payload, signedAt, ErrInvalidSignature},
+		{"invalid timestamp", "secret", "t=noon,v1=" + signature, payload, signedAt, ErrInvalidSignature},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := VerifySignature(tt.secret, tt.header, tt.payload, SignatureTolerance, tt.now)
+
+			if !errors.Is(err, tt.wantErr) {
+				t.Errorf("VerifySignature() error = %v, want %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestFakeGatewayParseWebhook(t *testing.T) {
+	gateway := NewFakeGateway("secret")
+	signedAt := time.Now()
+	gateway.now = func() time.Time { return signedAt }
+
+	payload, header, err := gateway.Webhook(EventPaymentCaptured, "fake_pi_000001", 150000)
+
+	if err != nil {
+		t.Fatalf("Webhook() error = %v", err)
+	}
+
+	event, err := gateway.ParseWebhook(payload, header)
+
+	if err != nil {
+		t.Fatalf("ParseWebhook() error = %v", err)
+	}
+
+	if event.ID != "fake_evt_000001" || event.Type != EventPaymentCaptured || event.IntentID != "fake_pi_000001" || event.Amount != 150000 {
+		t.Errorf("ParseWebhook() = %+v", event)
+	}
+
+	// Перехваченный запрос, отправленный повторно после истечения допуска
+	gateway.now = func() time.Time { return signedAt.Add(SignatureTolerance + time.Minute) }
+
+	if _, err := gateway.ParseWebhook(payload, header); !errors.Is(err, ErrSignatureExpired) {
+		t.Errorf("ParseWebhook() of replayed request error = %v, want %v", err, ErrSignatureExpired)
+	}
+}
+
+func unixOf(at time.Time) string {
+	return strconv.FormatInt(at.Unix(), 10)
+}
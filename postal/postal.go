@@ -0,0 +1,207 @@
+package postal
+
+import (
+	"ec-platform/models"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+	"unicode"
+)
+
+// страна адреса, если она не указана
+const DefaultCountry = "RU"
+
+// Имена полей адреса в ошибках - как в JSON models.Address
+const (
+	FieldHouse   = "house_name"
+	FieldStreet  = "street_name"
+	FieldCity    = "city_name"
+	FieldPincode = "pincode_name"
+	FieldState   = "state_name"
+	FieldCountry = "country"
+)
+
+// FieldErrors - ошибки проверки адреса по полям: поле -> описание
+type FieldErrors map[string]string
+
+func (e FieldErrors) Error() string {
+	fields := make([]string, 0, len(e))
+
+	for field := range e {
+		fields = append(fields, field)
+	}
+
+	sort.Strings(fields)
+
+	parts := make([]string, 0, len(fields))
+
+	for _, field := range fields {
+		parts = append(parts, field+": "+e[field])
+	}
+
+	return "invalid address: " + strings.Join(parts, "; ")
+}
+
+// Validator - правила адресов одной страны. Normalize вызывается до Validate,
+// после общей нормализации пробелов
+type Validator interface {
+	Normalize(address *models.Address)
+	Validate(address models.Address) FieldErrors
+}
+
+var (
+	mu         sync.RWMutex
+	validators = make(map[string]Validator)
+)
+
+func init() {
+	for country, rules := range loadRules() {
+		Register(country, rules)
+	}
+}
+
+// Register подключает правила страны (заменяет правила из встроенного набора)
+func Register(country string, validator Validator) {
+	mu.Lock()
+	defer mu.Unlock()
+
+	validators[strings.ToUpper(country)] = validator
+}
+
+// Countries возвращает страны, для которых есть правила
+func Countries() []string {
+	mu.RLock()
+	defer mu.RUnlock()
+
+	countries := make([]string, 0, len(validators))
+
+	for country := range validators {
+		countries = append(countries, country)
+	}
+
+	sort.Strings(countries)
+
+	return countries
+}
+
+var countryCode = regexp.MustCompile(`^[A-Z]{2}$`)
+
+// для стран без собственных правил
+var fallback Validator = &Rules{Required: []string{FieldStreet, FieldCity}}
+
+func validatorFor(country string) Validator {
+	mu.RLock()
+	defer mu.RUnlock()
+
+	if validator, ok := validators[country]; ok {
+		return validator
+	}
+
+	return fallback
+}
+
+// Normalize приводит адрес к каноническому виду: лишние пробелы, пустые строки - nil,
+// код страны в верхнем регистре (по умолчанию DefaultCountry), город, набранный целиком
+// в одном регистре, - с заглавных букв; затем правила страны (формат индекса, код региона)
+func Normalize(address *models.Address) {
+	for _, field := range []**string{&address.House, &address.Street, &address.City, &address.Pincode, &address.State, &address.Country} {
+		*field = cleanSpaces(*field)
+	}
+
+	country := DefaultCountry
+
+	if address.Country != nil {
+		country = strings.ToUpper(*address.Country)
+	}
+
+	address.Country = &country
+
+	if address.City != nil {
+		city := fixCasing(*address.City)
+		address.City = &city
+	}
+
+	validatorFor(country).Normalize(address)
+}
+
+// Validate проверяет нормализованный адрес по правилам его страны; ошибка - FieldErrors
+func Validate(address models.Address) error {
+	errs := FieldErrors{}
+
+	country := DefaultCountry
+
+	if address.Country != nil {
+		country = *address.Country
+	}
+
+	if !countryCode.MatchString(country) {
+		errs[FieldCountry] = "must be a two-letter ISO 3166-1 code"
+		return errs
+	}
+
+	for field, message := range validatorFor(country).Validate(address) {
+		errs[field] = message
+	}
+
+	if len(errs) > 0 {
+		return errs
+	}
+
+	return nil
+}
+
+// NormalizeAndValidate - Normalize и Validate за один вызов
+func NormalizeAndValidate(address *models.Address) error {
+	Normalize(address)
+	return Validate(*address)
+}
+
+// обрезает и схлопывает пробелы; пустая строка - nil
+func cleanSpaces(value *string) *string {
+	if value == nil {
+		return nil
+	}
+
+	cleaned := strings.Join(strings.Fields(*value), " ")
+
+	if cleaned == "" {
+		return nil
+	}
+
+	return &cleaned
+}
+
+// служебные слова внутри составных названий остаются строчными: Ростов-на-Дону, Stratford-upon-Avon
+var lowercaseParticles = map[string]bool{
+	"на": true, "над": true, "под": true, "де": true,
+	"am": true, "de": true, "en": true, "la": true, "le": true, "on": true, "sur": true, "upon": true,
+}
+
+// "МОСКВА" и "москва" -> "Москва", "РОСТОВ-НА-ДОНУ" -> "Ростов-на-Дону";
+// смешанный регистр оставляем как ввел пользователь
+func fixCasing(value string) string {
+	if value != strings.ToUpper(value) && value != strings.ToLower(value) {
+		return value
+	}
+
+	words := strings.Fields(strings.ToLower(value))
+
+	for i, word := range words {
+		parts := strings.Split(word, "-")
+
+		for j, part := range parts {
+			if part == "" || (i+j > 0 && lowercaseParticles[part]) {
+				continue
+			}
+
+			runes := []rune(part)
+			runes[0] = unicode.ToUpper(runes[0])
+			parts[j] = string(runes)
+		}
+
+		words[i] = strings.Join(parts, "-")
+	}
+
+	return strings.Join(words, " ")
+}
@@ -0,0 +1,194 @@
+package postal
+
+import (
+	"ec-platform/models"
+	"errors"
+	"testing"
+)
+
+func ptr(value string) *string {
+	return &value
+}
+
+func deref(value *string) string {
+	if value == nil {
+		return "<nil>"
+	}
+
+	return *value
+}
+
+func TestFixCasing(t *testing.T) {
+	tests := []struct {
+		input string
+		want  string
+	}{
+		{"МОСКВА", "Москва"},
+		{"москва", "Москва"},
+		{"РОСТОВ-НА-ДОНУ", "Ростов-на-Дону"},
+		{"ростов-на-дону", "Ростов-на-Дону"},
+		{"САНКТ-ПЕТЕРБУРГ", "Санкт-Петербург"},
+		{"КОМСОМОЛЬСК-НА-АМУРЕ", "Комсомольск-на-Амуре"},
+		{"НИЖНИЙ НОВГОРОД", "Нижний Новгород"},
+		{"STRATFORD-UPON-AVON", "Stratford-upon-Avon"},
+		{"frankfurt am main", "Frankfurt am Main"},
+		{"Ростов-на-Дону", "Ростов-на-Дону"},
+		{"McAllen", "McAllen"},
+		{"-", "-"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.input, func(t *testing.T) {
+			if got := fixCasing(tt.input); got != tt.want {
+				t.Errorf("fixCasing(%q) = %q, want %q", tt.input, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestNormalize(t *testing.T) {
+	tests := []struct {
+		name        string
+		address     models.Address
+		wantCountry string
+		wantCity    string
+		wantPincode string
+		wantState   string
+	}{
+		{
+			name:        "default country",
+			address:     models.Address{City: ptr("  МОСКВА "), Pincode: ptr(" 101000 ")},
+			wantCountry: "RU", wantCity: "Москва", wantPincode: "101000", wantState: "<nil>",
+		},
+		{
+			name:        "empty fields become nil",
+			address:     models.Address{City: ptr("   "), Country: ptr("ru")},
+			wantCountry: "RU", wantCity: "<nil>", wantPincode: "<nil>", wantState: "<nil>",
+		},
+		{
+			name:        "gb postcode format",
+			address:     models.Address{Pincode: ptr("sw1a1aa"), Country: ptr("gb")},
+			wantCountry: "GB", wantCity: "<nil>", wantPincode: "SW1A 1AA", wantState: "<nil>",
+		},
+		{
+			name:        "gb short postcode",
+			address:     models.Address{Pincode: ptr("m11ae"), Country: ptr("GB")},
+			wantCountry: "GB", wantCity: "<nil>", wantPincode: "M1 1AE", wantState: "<nil>",
+		},
+		{
+			name:        "us zip+4",
+			address:     models.Address{Pincode: ptr("941031234"), State: ptr("california"), Country: ptr("US")},
+			wantCountry: "US", wantCity: "<nil>", wantPincode: "94103-1234", wantState: "CA",
+		},
+		{
+			name:        "us zip and state code",
+			address:     models.Address{Pincode: ptr("94103"), State: ptr("ca"), Country: ptr("US")},
+			wantCountry: "US", wantCity: "<nil>", wantPincode: "94103", wantState: "CA",
+		},
+		{
+			name:        "ca postcode",
+			address:     models.Address{Pincode: ptr("k1a-0b1"), State: ptr("British Columbia"), Country: ptr("CA")},
+			wantCountry: "CA", wantCity: "<nil>", wantPincode: "K1A 0B1", wantState: "BC",
+		},
+		{
+			name:        "de state name",
+			address:     models.Address{State: ptr("BADEN-WÜRTTEMBERG"), Country: ptr("DE")},
+			wantCountry: "DE", wantCity: "<nil>", wantPincode: "<nil>", wantState: "BW",
+		},
+		{
+			name:        "unknown state kept",
+			address:     models.Address{State: ptr("Atlantis"), Country: ptr("US")},
+			wantCountry: "US", wantCity: "<nil>", wantPincode: "<nil>", wantState: "Atlantis",
+		},
+		{
+			name:        "fallback keeps postcode",
+			address:     models.Address{Pincode: ptr("75001 "), State: ptr("ile-de-france"), Country: ptr("fr")},
+			wantCountry: "FR", wantCity: "<nil>", wantPincode: "75001", wantState: "ile-de-france",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			address := tt.address
+			Normalize(&address)
+
+			got := [4]string{deref(address.Country), deref(address.City), deref(address.Pincode), deref(address.State)}
+			want := [4]string{tt.wantCountry, tt.wantCity, tt.wantPincode, tt.wantState}
+
+			if got != want {
+				t.Errorf("Normalize() country, city, pincode, state = %q, want %q", got, want)
+			}
+		})
+	}
+}
+
+func TestNormalizeAndValidate(t *testing.T) {
+	ru := func(pincode string) models.Address {
+		return models.Address{House: ptr("1"), Street: ptr("Тверская"), City: ptr("Москва"), Pincode: ptr(pincode)}
+	}
+
+	tests := []struct {
+		name       string
+		address    models.Address
+		wantFields []string
+	}{
+		{"ru valid", ru("101000"), nil},
+		{"ru leading zero", ru("012345"), []string{FieldPincode}},
+		{"ru short postcode", ru("10100"), []string{FieldPincode}},
+		{"ru letters", ru("10100A"), []string{FieldPincode}},
+		{"ru required fields", models.Address{City: ptr("Москва")}, []string{FieldHouse, FieldStreet, FieldPincode}},
+		{"by valid", models.Address{House: ptr("1"), Street: ptr("Немига"), City: ptr("Минск"), Pincode: ptr("220030"), Country: ptr("BY")}, nil},
+		{"by outside range", models.Address{House: ptr("1"), Street: ptr("Немига"), City: ptr("Минск"), Pincode: ptr("250030"), Country: ptr("BY")}, []string{FieldPincode}},
+		{"gb valid", models.Address{Street: ptr("Downing St"), City: ptr("London"), Pincode: ptr("sw1a 2aa"), Country: ptr("GB")}, nil},
+		{"gb girobank", models.Address{Street: ptr("Bootle"), City: ptr("Liverpool"), Pincode: ptr("GIR 0AA"), Country: ptr("GB")}, nil},
+		{"gb invalid", models.Address{Street: ptr("Downing St"), City: ptr("London"), Pincode: ptr("12345"), Country: ptr("GB")}, []string{FieldPincode}},
+		{"us valid", models.Address{House: ptr("1"), Street: ptr("Market St"), City: ptr("San Francisco"), Pincode: ptr("94103"), State: ptr("California"), Country: ptr("US")}, nil},
+		{"us state required", models.Address{House: ptr("1"), Street: ptr("Market St"), City: ptr("San Francisco"), Pincode: ptr("94103"), Country: ptr("US")}, []string{FieldState}},
+		{"us unknown state", models.Address{House: ptr("1"), Street: ptr("Market St"), City: ptr("San Francisco"), Pincode: ptr("94103"), State: ptr("Atlantis"), Country: ptr("US")}, []string{FieldState}},
+		{"us bad zip", models.Address{House: ptr("1"), Street: ptr("Market St"), City: ptr("San Francisco"), Pincode: ptr("9410"), State: ptr("CA"), Country: ptr("US")}, []string{FieldPincode}},
+		{"de unknown state", models.Address{House: ptr("1"), Street: ptr("Unter den Linden"), City: ptr("Berlin"), Pincode: ptr("10117"), State: ptr("Tirol"), Country: ptr("DE")}, []string{FieldState}},
+		{"fallback valid", models.Address{Street: ptr("Rue de Rivoli"), City: ptr("Paris"), Pincode: ptr("any code"), State: ptr("anything"), Country: ptr("FR")}, nil},
+		{"fallback required", models.Address{Pincode: ptr("75001"), Country: ptr("FR")}, []string{FieldStreet, FieldCity}},
+		{"invalid country", models.Address{Street: ptr("Main"), City: ptr("Town"), Country: ptr("RUS")}, []string{FieldCountry}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			address := tt.address
+			err := NormalizeAndValidate(&address)
+
+			if tt.wantFields == nil {
+				if err != nil {
+					t.Fatalf("NormalizeAndValidate() error = %v, want nil", err)
+				}
+
+				return
+			}
+
+			var errs FieldErrors
+
+			if !errors.As(err, &errs) {
+				t.Fatalf("NormalizeAndValidate() error = %v, want FieldErrors", err)
+			}
+
+			if len(errs) != len(tt.wantFields) {
+				t.Errorf("NormalizeAndValidate() error = %v, want fields %v", errs, tt.wantFields)
+			}
+
+			for _, field := range tt.wantFields {
+				if _, ok := errs[field]; !ok {
+					t.Errorf("NormalizeAndValidate() error = %v, missing field %s", errs, field)
+				}
+			}
+		})
+	}
+}
+
+func TestFieldErrorsSortedByField(t *testing.T) {
+	errs := FieldErrors{FieldStreet: "is required", FieldCity: "is required"}
+	want := "invalid address: city_name: is required; street_name: is required"
+
+	if got := errs.Error(); got != want {
+		t.Errorf("Error() = %q, want %q", got, want)
+	}
+}
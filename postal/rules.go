@@ -0,0 +1,145 @@
+package postal
+
+import (
+	"ec-platform/models"
+	_ "embed"
+	"encoding/json"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// Встроенный набор правил стран (работает без внешних сервисов)
+//
+//go:embed rules.json
+var rulesData []byte
+
+// Rules - правила страны из набора данных:
+//   - Postal_Code - регулярное выражение для индекса без пробелов и дефисов, в верхнем регистре;
+//   - Postal_Code_Formats - шаблон записи индекса по его длине, # - очередной символ индекса;
+//   - Required - обязательные поля (имена как в JSON адреса);
+//   - States - допустимые регионы: код -> название. Пустой список - регион не проверяется
+type Rules struct {
+	Name                string            `json:"name"`
+	Postal_Code         string            `json:"postal_code"`
+	Postal_Code_Formats map[string]string `json:"postal_code_formats"`
+	Required            []string          `json:"required"`
+	States              map[string]string `json:"states"`
+
+	postalCode *regexp.Regexp
+}
+
+func loadRules() map[string]*Rules {
+	var rules map[string]*Rules
+
+	if err := json.Unmarshal(rulesData, &rules); err != nil {
+		panic("postal: invalid rules.json: " + err.Error())
+	}
+
+	for _, countryRules := range rules {
+		if countryRules.Postal_Code != "" {
+			countryRules.postalCode = regexp.MustCompile(countryRules.Postal_Code)
+		}
+	}
+
+	return rules
+}
+
+// Normalize форматирует индекс по шаблону страны и заменяет регион (код или название
+// в любом регистре) его кодом
+func (r *Rules) Normalize(address *models.Address) {
+	if address.Pincode != nil {
+		pincode := r.formatPostalCode(compactPostalCode(*address.Pincode))
+		address.Pincode = &pincode
+	}
+
+	if address.State != nil && len(r.States) > 0 {
+		if code, ok := r.stateCode(*address.State); ok {
+			address.State = &code
+		}
+	}
+}
+
+// Validate проверяет обязательные поля, формат индекса и регион
+func (r *Rules) Validate(address models.Address) FieldErrors {
+	errs := FieldErrors{}
+
+	values := map[string]*string{
+		FieldHouse:   address.House,
+		FieldStreet:  address.Street,
+		FieldCity:    address.City,
+		FieldPincode: address.Pincode,
+		FieldState:   address.State,
+	}
+
+	for _, field := range r.Required {
+		if values[field] == nil {
+			errs[field] = "is required"
+		}
+	}
+
+	if address.Pincode != nil && r.postalCode != nil && !r.postalCode.MatchString(compactPostalCode(*address.Pincode)) {
+		errs[FieldPincode] = "is not a valid postal code for " + r.Name
+	}
+
+	if address.State != nil && len(r.States) > 0 {
+		if _, ok := r.States[*address.State]; !ok {
+			errs[FieldState] = "is not a known region of " + r.Name
+		}
+	}
+
+	return errs
+}
+
+// код региона по коду или названию без учета регистра
+func (r *Rules) stateCode(state string) (string, bool) {
+	upper := strings.ToUpper(state)
+
+	if _, ok := r.States[upper]; ok {
+		return upper, true
+	}
+
+	for code, name := range r.States {
+		if strings.EqualFold(name, state) {
+			return code, true
+		}
+	}
+
+	return "", false
+}
+
+// раскладывает индекс по шаблону для его длины; без шаблона - как есть
+func (r *Rules) formatPostalCode(compact string) string {
+	format, ok := r.Postal_Code_Formats[strconv.Itoa(len([]rune(compact)))]
+
+	chars := []rune(compact)
+
+	if !ok || strings.Count(format, "#") != len(chars) {
+		return compact
+	}
+
+	var formatted strings.Builder
+
+	for _, ch := range format {
+		if ch == '#' {
+			formatted.WriteRune(chars[0])
+			chars = chars[1:]
+
+		} else {
+			formatted.WriteRune(ch)
+		}
+	}
+
+	return formatted.String()
+}
+
+// индекс в верхнем регистре без пробелов и дефисов
+func compactPostalCode(pincode string) string {
+	return strings.Map(func(r rune) rune {
+		if r == ' ' || r == '-' {
+			return -1
+		}
+
+		return r
+	}, strings.ToUpper(pincode))
+}
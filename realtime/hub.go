@@ -0,0 +1,100 @@
+package realtime
+
+import (
+	"context"
+	"ec-platform/database"
+	"ec-platform/events"
+	"log"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+// Hub держит одно соединение LISTEN на процесс и будит подписчиков заказа при смене его статуса.
+// NOTIFY получают все экземпляры приложения, поэтому подписчик узнает о переходе,
+// сделанном на любом из них
+type Hub struct {
+	db *pgxpool.Pool
+
+	mu          sync.Mutex
+	subscribers map[uuid.UUID]map[chan struct{}]struct{}
+}
+
+func NewHub(db *pgxpool.Pool) *Hub {
+	return &Hub{
+		db:          db,
+		subscribers: make(map[uuid.UUID]map[chan struct{}]struct{}),
+	}
+}
+
+// Subscribe возвращает канал, в который приходит сигнал после каждого перехода статуса заказа.
+// Сигналы не накапливаются: подписчик сам читает новые переходы из истории.
+// Вызов cancel снимает подписку
+func (h *Hub) Subscribe(orderID uuid.UUID) (<-chan struct{}, func()) {
+	ch := make(chan struct{}, 1)
+
+	h.mu.Lock()
+
+	if h.subscribers[orderID] == nil {
+		h.subscribers[orderID] = make(map[chan struct{}]struct{})
+	}
+
+	h.subscribers[orderID][ch] = struct{}{}
+	h.mu.Unlock()
+
+	cancel := func() {
+		h.mu.Lock()
+		defer h.mu.Unlock()
+
+		delete(h.subscribers[orderID], ch)
+
+		if len(h.subscribers[orderID]) == 0 {
+			delete(h.subscribers, orderID)
+		}
+	}
+
+	return ch, cancel
+}
+
+// Run слушает уведомления до отмены ctx, переподключаясь после обрыва соединения
+func (h *Hub) Run(ctx context.Context) {
+	attempt := 0
+
+	for {
+		started := time.Now()
+		err := database.ListenOrderStatus(ctx, h.db, h.notify)
+
+		if ctx.Err() != nil {
+			return
+		}
+
+		// После долгой нормальной работы задержка начинается заново
+		if time.Since(started) > time.Minute {
+			attempt = 0
+		}
+
+		attempt++
+		log.Printf("order status listener stopped, reconnecting: %v", err)
+
+		select {
+		case <-ctx.Done():
+			return
+
+		case <-time.After(events.Backoff(attempt)):
+		}
+	}
+}
+
+func (h *Hub) notify(orderID uuid.UUID) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	for ch := range h.subscribers[orderID] {
+		select {
+		case ch <- struct{}{}:
+		default:
+		}
+	}
+}
@@ -8,7 +8,14 @@ import (
 func UserRoutes(incomingRoutes *gin.Engine, app *controllers.Application) {
 	incomingRoutes.POST("/users/signup", app.SignUp())
 	incomingRoutes.POST("/users/login", app.Login())
-	incomingRoutes.POST("/admin/addproduct", app.ProductViewerAdmin())
 	incomingRoutes.GET("/users/productview", app.SearchProduct())
 	incomingRoutes.GET("/users/search", app.SearchProductByQuery())
+	incomingRoutes.GET("/currencies", app.GetCurrencies())
+	incomingRoutes.GET("/products/:id", app.GetProduct())
+	incomingRoutes.GET("/products/:id/reviews", app.GetProductReviews())
+	incomingRoutes.GET("/products/:id/images", app.GetProductImages())
+	incomingRoutes.GET("/images/*key", app.ServeImage())
+	incomingRoutes.POST("/payments/webhook/:provider", app.PaymentWebhook())
+	incomingRoutes.GET("/cart/restore/:token", app.RestoreCart())
+	incomingRoutes.GET("/wishlists/shared/:token", app.GetSharedWishlist())
 }
@@ -0,0 +1,122 @@
+package shipping
+
+import (
+	"ec-platform/currency"
+	"ec-platform/models"
+	"errors"
+	"sort"
+	"strings"
+)
+
+// Способы доставки
+const (
+	MethodStandard = "standard"
+	MethodExpress  = "express"
+	MethodPickup   = "pickup"
+)
+
+// AnyRegion - тариф действует для любого региона
+const AnyRegion = "*"
+
+var (
+	ErrUnknownMethod = errors.New("unknown shipping method")
+	ErrNoRate        = errors.New("no shipping rate for this region and weight")
+)
+
+// RateTable рассчитывает стоимость доставки по способу, региону и весу заказа.
+// Реализацию можно подменить (тарифы из БД, API перевозчика и т.д.)
+type RateTable interface {
+	Quote(method string, region string, weightGrams int64) (models.Money, error)
+}
+
+// Rate - строка тарифной сетки
+type Rate struct {
+	Method         string       `json:"method"`
+	Region         string       `json:"region"`
+	MaxWeightGrams int64        `json:"max_weight_grams"` // 0 - без ограничения по весу
+	Price          models.Money `json:"price"`
+}
+
+// StaticTable - тарифная сетка, хранящаяся в памяти
+type StaticTable struct {
+	rates []Rate
+}
+
+// создает тарифную сетку из списка тарифов
+func NewStaticTable(rates []Rate) *StaticTable {
+	sorted := make([]Rate, len(rates))
+	copy(sorted, rates)
+
+	// Сортируем по весу, тарифы без ограничения - в конец
+	sort.SliceStable(sorted, func(i, j int) bool {
+		wi, wj := sorted[i].MaxWeightGrams, sorted[j].MaxWeightGrams
+
+		if wi == 0 || wj == 0 {
+			return wj == 0 && wi != 0
+		}
+
+		return wi < wj
+	})
+
+	return &StaticTable{rates: sorted}
+}
+
+// возвращает стоимость доставки: сначала ищется тариф для конкретного региона, затем общий
+func (t *StaticTable) Quote(method string, region string, weightGrams int64) (models.Money, error) {
+	method = strings.ToLower(strings.TrimSpace(method))
+	region = strings.ToLower(strings.TrimSpace(region))
+
+	knownMethod := false
+
+	for _, wanted := range []string{region, AnyRegion} {
+		for _, rate := range t.rates {
+			if rate.Method != method {
+				continue
+			}
+
+			knownMethod = true
+
+			if strings.ToLower(rate.Region) != wanted {
+				continue
+			}
+
+			if rate.MaxWeightGrams == 0 || weightGrams <= rate.MaxWeightGrams {
+				return rate.Price, nil
+			}
+		}
+	}
+
+	if !knownMethod {
+		return 0, ErrUnknownMethod
+	}
+
+	return 0, ErrNoRate
+}
+
+// тарифы по умолчанию в целых единицах базовой валюты (для RUB - в рублях)
+var defaultRates = []Rate{
+	{Method: MethodStandard, Region: "moscow", MaxWeightGrams: 5000, Price: 250},
+	{Method: MethodStandard, Region: AnyRegion, MaxWeightGrams: 1000, Price: 300},
+	{Method: MethodStandard, Region: AnyRegion, MaxWeightGrams: 5000, Price: 500},
+	{Method: MethodStandard, Region: AnyRegion, MaxWeightGrams: 20000, Price: 900},
+	{Method: MethodStandard, Region: AnyRegion, Price: 1500},
+	{Method: MethodExpress, Region: "moscow", MaxWeightGrams: 5000, Price: 600},
+	{Method: MethodExpress, Region: AnyRegion, MaxWeightGrams: 5000, Price: 900},
+	{Method: MethodExpress, Region: AnyRegion, MaxWeightGrams: 20000, Price: 2000},
+	{Method: MethodPickup, Region: AnyRegion, Price: 0},
+}
+
+// тарифы по умолчанию в минорных единицах базовой валюты base: 250 - это 25000 для RUB и 250 для JPY
+func DefaultRates(base string) *StaticTable {
+	toMinor := currency.Rate{Currency: base, Value: "1", Scale: currency.MinorUnits(base)}
+	rates := make([]Rate, len(defaultRates))
+
+	for i, rate := range defaultRates {
+		rates[i] = rate
+
+		// Тарифы - небольшие константы, пересчет не переполняется
+		rates[i].Price, _ = toMinor.Convert(rate.Price)
+	}
+
+	return NewStaticTable(rates)
+}
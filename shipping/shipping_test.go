@@ -0,0 +1,117 @@
+package shipping
+
+import (
+	"ec-platform/models"
+	"errors"
+	"testing"
+)
+
+// тарифы в произвольном порядке: сетка сама сортирует их по весу
+var testRates = []Rate{
+	{Method: MethodStandard, Region: AnyRegion, Price: 1500},
+	{Method: MethodStandard, Region: AnyRegion, MaxWeightGrams: 5000, Price: 500},
+	{Method: MethodStandard, Region: "Moscow", MaxWeightGrams: 5000, Price: 250},
+	{Method: MethodStandard, Region: AnyRegion, MaxWeightGrams: 1000, Price: 300},
+	{Method: MethodExpress, Region: AnyRegion, MaxWeightGrams: 20000, Price: 2000},
+	{Method: MethodExpress, Region: "moscow", MaxWeightGrams: 5000, Price: 600},
+	{Method: MethodExpress, Region: AnyRegion, MaxWeightGrams: 5000, Price: 900},
+	{Method: MethodPickup, Region: AnyRegion, Price: 0},
+}
+
+func TestStaticTableQuote(t *testing.T) {
+	table := NewStaticTable(testRates)
+
+	tests := []struct {
+		name    string
+		method  string
+		region  string
+		weight  int64
+		want    models.Money
+		wantErr error
+	}{
+		{"lightest bracket", MethodStandard, "kazan", 500, 300, nil},
+		{"bracket upper bound", MethodStandard, "kazan", 1000, 300, nil},
+		{"next bracket", MethodStandard, "kazan", 1001, 500, nil},
+		{"unlimited weight", MethodStandard, "kazan", 50000, 1500, nil},
+		{"zero weight", MethodStandard, "kazan", 0, 300, nil},
+		{"region over any region", MethodStandard, "moscow", 500, 250, nil},
+		{"region at its limit", MethodStandard, "moscow", 5000, 250, nil},
+		{"region over its limit falls back", MethodStandard, "moscow", 5001, 1500, nil},
+		{"case and spaces", " Express ", " MOSCOW ", 1000, 600, nil},
+		{"express any region", MethodExpress, "kazan", 1000, 900, nil},
+		{"express heavy", MethodExpress, "moscow", 20000, 2000, nil},
+		{"over max weight", MethodExpress, "kazan", 20001, 0, ErrNoRate},
+		{"over max weight in region", MethodExpress, "moscow", 25000, 0, ErrNoRate},
+		{"free pickup", MethodPickup, "", 100000, 0, nil},
+		{"unknown method", "drone", "moscow", 1000, 0, ErrUnknownMethod},
+		{"empty method", "", "moscow", 1000, 0, ErrUnknownMethod},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := table.Quote(tt.method, tt.region, tt.weight)
+
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("Quote(%q, %q, %d) error = %v, want %v", tt.method, tt.region, tt.weight, err, tt.wantErr)
+			}
+
+			if got != tt.want {
+				t.Errorf("Quote(%q, %q, %d) = %d, want %d", tt.method, tt.region, tt.weight, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestNewStaticTableSortsByWeight(t *testing.T) {
+	input := make([]Rate, len(testRates))
+	copy(input, testRates)
+
+	table := NewStaticTable(input)
+
+	for i, rate := range input {
+		if rate != testRates[i] {
+			t.Fatalf("NewStaticTable() changed input rate %d: %+v", i, rate)
+		}
+	}
+
+	unlimited := false
+
+	for i, rate := range table.rates {
+		if rate.MaxWeightGrams == 0 {
+			unlimited = true
+			continue
+		}
+
+		if unlimited {
+			t.Fatalf("rate %d (%+v) with a weight limit is after an unlimited rate", i, rate)
+		}
+
+		if i > 0 && rate.MaxWeightGrams < table.rates[i-1].MaxWeightGrams {
+			t.Errorf("rate %d (%+v) is lighter than the previous one", i, rate)
+		}
+	}
+}
+
+func TestDefaultRatesUseMinorUnitsOfBaseCurrency(t *testing.T) {
+	tests := []struct {
+		base string
+		want models.Money
+	}{
+		{"RUB", 25000},
+		{"USD", 25000},
+		{"JPY", 250},
+		{"KRW", 250},
+	}
+
+	for _, tt := range tests {
+		price, err := DefaultRates(tt.base).Quote(MethodStandard, "moscow", 1000)
+
+		if err != nil {
+			t.Fatalf("%s: Quote() error = %v", tt.base, err)
+		}
+
+		if price != tt.want {
+			t.Errorf("%s: standard delivery to moscow = %d, want %d", tt.base, price, tt.want)
+		}
+	}
+}
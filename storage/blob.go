@@ -0,0 +1,30 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"io"
+	"time"
+)
+
+var (
+	ErrBlobNotFound = errors.New("blob not found")
+	ErrInvalidKey   = errors.New("invalid blob key")
+)
+
+// BlobStore - хранилище файлов по ключу вида "products/<id>/<name>.jpg".
+// Ключи неизменяемы: новый файл - новый ключ, поэтому отдавать их можно с долгим кешированием
+type BlobStore interface {
+	Put(ctx context.Context, key string, r io.Reader, contentType string) error
+	Open(ctx context.Context, key string) (*Blob, error)
+	Delete(ctx context.Context, key string) error
+}
+
+// Blob - открытый файл хранилища; закрывает вызывающий
+type Blob struct {
+	io.ReadSeekCloser
+
+	ContentType string
+	Size        int64
+	ModTime     time.Time
+}
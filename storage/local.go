@@ -0,0 +1,131 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"io"
+	"io/fs"
+	"mime"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+)
+
+// LocalStore хранит файлы в каталоге на диске; тип содержимого определяется по расширению ключа
+type LocalStore struct {
+	dir string
+}
+
+func NewLocalStore(dir string) (*LocalStore, error) {
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return nil, err
+	}
+
+	return &LocalStore{dir: dir}, nil
+}
+
+// Put записывает файл через временный файл и переименование - читатели не увидят его недописанным
+func (s *LocalStore) Put(ctx context.Context, key string, r io.Reader, contentType string) error {
+	name, err := s.path(key)
+
+	if err != nil {
+		return err
+	}
+
+	if err := os.MkdirAll(filepath.Dir(name), 0o755); err != nil {
+		return err
+	}
+
+	tmp, err := os.CreateTemp(filepath.Dir(name), ".upload-*")
+
+	if err != nil {
+		return err
+	}
+
+	defer os.Remove(tmp.Name())
+
+	if _, err := io.Copy(tmp, r); err != nil {
+		tmp.Close()
+		return err
+	}
+
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+
+	return os.Rename(tmp.Name(), name)
+}
+
+func (s *LocalStore) Open(ctx context.Context, key string) (*Blob, error) {
+	name, err := s.path(key)
+
+	if err != nil {
+		return nil, err
+	}
+
+	file, err := os.Open(name)
+
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil, ErrBlobNotFound
+	}
+
+	if err != nil {
+		return nil, err
+	}
+
+	info, err := file.Stat()
+
+	if err != nil {
+		file.Close()
+		return nil, err
+	}
+
+	if info.IsDir() {
+		file.Close()
+		return nil, ErrBlobNotFound
+	}
+
+	contentType := mime.TypeByExtension(path.Ext(key))
+
+	if contentType == "" {
+		contentType = "application/octet-stream"
+	}
+
+	return &Blob{
+		ReadSeekCloser: file,
+		ContentType:    contentType,
+		Size:           info.Size(),
+		ModTime:        info.ModTime(),
+	}, nil
+}
+
+// Delete удаляет файл; отсутствующий файл - не ошибка
+func (s *LocalStore) Delete(ctx context.Context, key string) error {
+	name, err := s.path(key)
+
+	if err != nil {
+		return err
+	}
+
+	if err := os.Remove(name); err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return err
+	}
+
+	return nil
+}
+
+// путь файла в каталоге хранилища; ключ не может выйти за пределы каталога
+func (s *LocalStore) path(key string) (string, error) {
+	if key == "" || strings.Contains(key, "\\") {
+		return "", ErrInvalidKey
+	}
+
+	cleaned := path.Clean("/" + key)
+
+	if cleaned == "/" || cleaned != "/"+strings.TrimPrefix(key, "/") {
+		return "", ErrInvalidKey
+	}
+
+	return filepath.Join(s.dir, filepath.FromSlash(cleaned)), nil
+}
@@ -18,11 +18,12 @@ type SignedDetails struct {
 	First_Name string
 	Last_Name  string
 	Uid        string
+	Is_Admin   bool
 	jwt.RegisteredClaims
 }
 
-// генерирует access и refresh токены
-func TokenGenerator(email string, firstname string, lastname string) (signedToken string, signedRefreshToken string, err error) {
+// генерирует access и refresh токены; isAdmin попадает в access токен и открывает роуты /admin/*
+func TokenGenerator(email string, firstname string, lastname string, isAdmin bool) (signedToken string, signedRefreshToken string, err error) {
 	if SECRET_KEY == "" {
 		SECRET_KEY = "your-secret-key-change-this-in-production"
 		log.Println("WARNING: Using default SECRET_KEY. Set SECRET_KEY environment variable in production!")
@@ -32,6 +33,7 @@ func TokenGenerator(email string, firstname string, lastname string) (signedToke
 		Email:      email,
 		First_Name: firstname,
 		Last_Name:  lastname,
+		Is_Admin:   isAdmin,
 		RegisteredClaims: jwt.RegisteredClaims{
 			ExpiresAt: jwt.NewNumericDate(time.Now().Add(24 * time.Hour)),
 			IssuedAt:  jwt.NewNumericDate(time.Now()),
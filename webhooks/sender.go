@@ -0,0 +1,235 @@
+package webhooks
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"ec-platform/database"
+	"ec-platform/events"
+	"ec-platform/models"
+	"ec-platform/payments"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"net"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+// Заголовки исходящего webhook. Подпись - в payments.SignatureHeader (тот же формат, что у входящих)
+const (
+	EventHeader    = "X-Webhook-Event"
+	DeliveryHeader = "X-Webhook-Delivery"
+)
+
+// Параметры доставки по умолчанию
+const (
+	DefaultInterval    = 2 * time.Second
+	DefaultBatchSize   = 10
+	DefaultMaxAttempts = 12
+	DefaultPauseAfter  = 20
+	DefaultTimeout     = 10 * time.Second
+
+	// на это время выбранная пачка закрепляется за отправителем: с запасом на BatchSize запросов по DefaultTimeout
+	DefaultLease = 5 * time.Minute
+)
+
+// тело webhook: событие outbox в конверте с идентификатором для дедупликации у получателя
+type envelope struct {
+	ID        string          `json:"id"`
+	Type      string          `json:"type"`
+	CreatedAt time.Time       `json:"created_at"`
+	Data      json.RawMessage `json:"data"`
+}
+
+// Sender раскладывает доменные события по подпискам и доставляет их подписчикам
+type Sender struct {
+	store       database.WebhookStore
+	client      *http.Client
+	Interval    time.Duration
+	BatchSize   int
+	MaxAttempts int
+	PauseAfter  int
+}
+
+func NewSender(db *pgxpool.Pool) *Sender {
+	return &Sender{
+		store:       database.NewPgWebhookStore(db),
+		client:      newClient(),
+		Interval:    DefaultInterval,
+		BatchSize:   DefaultBatchSize,
+		MaxAttempts: DefaultMaxAttempts,
+		PauseAfter:  DefaultPauseAfter,
+	}
+}
+
+// HTTP клиент доставки: соединяется только с публичными адресами (см. dialControl) и без прокси
+// из окружения, через который проверку можно было бы обойти
+func newClient() *http.Client {
+	dialer := &net.Dialer{Timeout: DefaultTimeout, Control: dialControl}
+
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.Proxy = nil
+	transport.DialContext = dialer.DialContext
+
+	return &http.Client{Timeout: DefaultTimeout, Transport: transport}
+}
+
+// GenerateSecret создает секрет подписи для новой подписки
+func GenerateSecret() (string, error) {
+	buf := make([]byte, 32)
+
+	if _, err := rand.Read(buf); err != nil {
+		return "", err
+	}
+
+	return "whsec_" + hex.EncodeToString(buf), nil
+}
+
+// FanOut - обработчик outbox: создает доставки события подписчикам. Повторная
+// доставка того же события из outbox дубликатов не создает
+func (s *Sender) FanOut(ctx context.Context, event models.OutboxEvent) error {
+	body, err := json.Marshal(envelope{
+		ID:        "evt_" + strconv.FormatInt(event.ID, 10),
+		Type:      event.Event_Type,
+		CreatedAt: event.Created_At,
+		Data:      event.Payload,
+	})
+
+	if err != nil {
+		return err
+	}
+
+	_, err = s.store.CreateWebhookDeliveries(ctx, event.ID, event.Event_Type, body)
+
+	return err
+}
+
+// Run отправляет доставки до отмены ctx
+func (s *Sender) Run(ctx context.Context) {
+	ticker := time.NewTicker(s.Interval)
+	defer ticker.Stop()
+
+	for {
+		for {
+			count, err := s.dispatch(ctx)
+
+			if err != nil {
+				if ctx.Err() == nil {
+					log.Printf("error dispatching webhook deliveries: %v", err)
+				}
+
+				break
+			}
+
+			if count < s.BatchSize {
+				break
+			}
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+
+		case <-ticker.C:
+		}
+	}
+}
+
+// отправляет одну пачку доставок и возвращает количество выбранных. Выбор пачки и запись результата
+// каждой попытки - отдельные короткие транзакции, HTTP запросы идут вне транзакции. Неудачная доставка
+// повторяется через events.Backoff(попытка), после MaxAttempts - failed
+func (s *Sender) dispatch(ctx context.Context) (int, error) {
+	deliveries, subscriptions, err := s.store.ClaimWebhookDeliveries(ctx, s.BatchSize, DefaultLease)
+
+	if err != nil {
+		return 0, err
+	}
+
+	paused := make(map[uuid.UUID]bool)
+
+	for _, delivery := range deliveries {
+		// подписка приостановлена в этой же пачке - остальные ее доставки ждут возобновления
+		if paused[delivery.Subscription_ID] {
+			continue
+		}
+
+		started := time.Now()
+		code, sendErr := s.send(ctx, subscriptions[delivery.Subscription_ID], delivery)
+
+		attempt := models.WebhookDeliveryAttempt{
+			Duration_MS:  int(time.Since(started).Milliseconds()),
+			Attempted_At: started.UTC(),
+		}
+
+		if code != 0 {
+			attempt.Response_Code = &code
+		}
+
+		status := models.WebhookDeliverySucceeded
+		attempts := delivery.Attempts + 1
+
+		if sendErr != nil {
+			message := sendErr.Error()
+			attempt.Error = &message
+			status = models.WebhookDeliveryPending
+
+			if attempts >= s.MaxAttempts {
+				status = models.WebhookDeliveryFailed
+			}
+		}
+
+		retryAt := time.Now().UTC().Add(events.Backoff(attempts))
+
+		isPaused, err := s.store.RecordWebhookAttempt(ctx, delivery, attempt, status, retryAt, s.PauseAfter)
+
+		if err != nil {
+			return 0, err
+		}
+
+		if isPaused {
+			paused[delivery.Subscription_ID] = true
+		}
+	}
+
+	return len(deliveries), nil
+}
+
+// отправляет подписанный POST; успех - только ответ 2xx
+func (s *Sender) send(ctx context.Context, subscription models.WebhookSubscription, delivery models.WebhookDelivery) (int, error) {
+	body := []byte(delivery.Payload)
+
+	request, err := http.NewRequestWithContext(ctx, http.MethodPost, subscription.URL, bytes.NewReader(body))
+
+	if err != nil {
+		return 0, err
+	}
+
+	request.Header.Set("Content-Type", "application/json")
+	request.Header.Set(EventHeader, delivery.Event_Type)
+	request.Header.Set(DeliveryHeader, strconv.FormatInt(delivery.ID, 10))
+	request.Header.Set(payments.SignatureHeader, payments.Sign(subscription.Secret, time.Now(), body))
+
+	response, err := s.client.Do(request)
+
+	if err != nil {
+		return 0, err
+	}
+
+	defer response.Body.Close()
+
+	// тело ответа не нужно, но вычитываем его, чтобы соединение переиспользовалось
+	io.Copy(io.Discard, io.LimitReader(response.Body, 64<<10))
+
+	if response.StatusCode < 200 || response.StatusCode >= 300 {
+		return response.StatusCode, fmt.Errorf("subscriber responded with status %d", response.StatusCode)
+	}
+
+	return response.StatusCode, nil
+}
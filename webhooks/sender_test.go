@@ -0,0 +1,285 @@
+package webhooks
+
+import (
+	"context"
+	"ec-platform/events"
+	"ec-platform/models"
+	"ec-platform/payments"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// очередь доставок в памяти вместо таблиц webhook_*; now - время, с которым сравнивается next_attempt_at
+type memoryWebhookStore struct {
+	now           time.Time
+	subscriptions map[uuid.UUID]*models.WebhookSubscription
+	deliveries    []*models.WebhookDelivery
+	attempts      map[int64][]models.WebhookDeliveryAttempt
+}
+
+func newMemoryWebhookStore(subscription *models.WebhookSubscription, count int) *memoryWebhookStore {
+	store := &memoryWebhookStore{
+		now:           time.Now().UTC(),
+		subscriptions: map[uuid.UUID]*models.WebhookSubscription{subscription.Subscription_ID: subscription},
+		attempts:      make(map[int64][]models.WebhookDeliveryAttempt),
+	}
+
+	for i := 1; i <= count; i++ {
+		store.deliveries = append(store.deliveries, &models.WebhookDelivery{
+			ID:              int64(i),
+			Subscription_ID: subscription.Subscription_ID,
+			Outbox_Event_ID: int64(i),
+			Event_Type:      "order.placed",
+			Payload:         []byte(`{"id":"evt_` + strconv.Itoa(i) + `","type":"order.placed"}`),
+			Status:          models.WebhookDeliveryPending,
+			Next_Attempt_At: store.now,
+		})
+	}
+
+	return store
+}
+
+func (s *memoryWebhookStore) CreateWebhookDeliveries(ctx context.Context, outboxEventID int64, eventType string, body []byte) (int64, error) {
+	return 0, nil
+}
+
+func (s *memoryWebhookStore) ClaimWebhookDeliveries(ctx context.Context, batch int, lease time.Duration) ([]models.WebhookDelivery, map[uuid.UUID]models.WebhookSubscription, error) {
+	var claimed []models.WebhookDelivery
+	subscriptions := make(map[uuid.UUID]models.WebhookSubscription)
+
+	for _, delivery := range s.deliveries {
+		subscription := s.subscriptions[delivery.Subscription_ID]
+
+		if len(claimed) == batch || delivery.Status != models.WebhookDeliveryPending ||
+			delivery.Next_Attempt_At.After(s.now) || subscription.Paused_At != nil {
+			continue
+		}
+
+		delivery.Next_Attempt_At = s.now.Add(lease)
+		claimed = append(claimed, *delivery)
+		subscriptions[subscription.Subscription_ID] = *subscription
+	}
+
+	return claimed, subscriptions, nil
+}
+
+func (s *memoryWebhookStore) RecordWebhookAttempt(ctx context.Context, delivery models.WebhookDelivery, attempt models.WebhookDeliveryAttempt, status string, retryAt time.Time, pauseAfter int) (bool, error) {
+	stored := s.deliveries[delivery.ID-1]
+	subscription := s.subscriptions[delivery.Subscription_ID]
+
+	s.attempts[delivery.ID] = append(s.attempts[delivery.ID], attempt)
+
+	stored.Status = status
+	stored.Attempts++
+	stored.Response_Code = attempt.Response_Code
+	stored.Last_Error = attempt.Error
+
+	if status == models.WebhookDeliverySucceeded {
+		subscription.Consecutive_Failures = 0
+		return false, nil
+	}
+
+	stored.Next_Attempt_At = retryAt
+	subscription.Consecutive_Failures++
+
+	if subscription.Consecutive_Failures >= pauseAfter {
+		pausedAt := s.now
+		subscription.Paused_At = &pausedAt
+	}
+
+	return subscription.Paused_At != nil, nil
+}
+
+// отправитель с очередью в памяти; клиент httptest, так как проверка адреса не пускает на loopback
+func newTestSender(t *testing.T, handler http.HandlerFunc, count int) (*Sender, *memoryWebhookStore) {
+	t.Helper()
+
+	server := httptest.NewServer(handler)
+	t.Cleanup(server.Close)
+
+	subscription := &models.WebhookSubscription{
+		Subscription_ID: uuid.New(),
+		URL:             server.URL + "/hooks",
+		Secret:          "whsec_test_secret_0123456789",
+		Event_Types:     []string{"*"},
+	}
+
+	store := newMemoryWebhookStore(subscription, count)
+
+	sender := &Sender{
+		store:       store,
+		client:      server.Client(),
+		Interval:    DefaultInterval,
+		BatchSize:   DefaultBatchSize,
+		MaxAttempts: DefaultMaxAttempts,
+		PauseAfter:  DefaultPauseAfter,
+	}
+
+	return sender, store
+}
+
+func TestSenderSignsDelivery(t *testing.T) {
+	var sender *Sender
+	var store *memoryWebhookStore
+
+	sender, store = newTestSender(t, func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		secret := store.subscriptions[store.deliveries[0].Subscription_ID].Secret
+
+		if err := payments.VerifySignature(secret, r.Header.Get(payments.SignatureHeader), body, payments.SignatureTolerance, time.Now()); err != nil {
+			t.Errorf("receiver: %v", err)
+		}
+
+		if got := r.Header.Get(EventHeader); got != "order.placed" {
+			t.Errorf("receiver: %s = %q, want order.placed", EventHeader, got)
+		}
+
+		if got := r.Header.Get(DeliveryHeader); got != "1" {
+			t.Errorf("receiver: %s = %q, want 1", DeliveryHeader, got)
+		}
+
+		if got := r.Header.Get("Content-Type"); got != "application/json" {
+			t.Errorf("receiver: Content-Type = %q, want application/json", got)
+		}
+
+		w.WriteHeader(http.StatusNoContent)
+	}, 1)
+
+	count, err := sender.dispatch(context.Background())
+
+	if err != nil || count != 1 {
+		t.Fatalf("dispatch() = %d, %v, want 1, nil", count, err)
+	}
+
+	delivery := store.deliveries[0]
+
+	if delivery.Status != models.WebhookDeliverySucceeded || delivery.Attempts != 1 {
+		t.Errorf("delivery = %s after %d attempts, want succeeded after 1", delivery.Status, delivery.Attempts)
+	}
+
+	if code := store.attempts[1][0].Response_Code; code == nil || *code != http.StatusNoContent {
+		t.Errorf("logged response code = %v, want 204", code)
+	}
+}
+
+func TestSenderRetriesServerErrorsWithBackoff(t *testing.T) {
+	var requests atomic.Int32
+
+	sender, store := newTestSender(t, func(w http.ResponseWriter, r *http.Request) {
+		if requests.Add(1) == 1 {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+
+		w.WriteHeader(http.StatusOK)
+	}, 1)
+
+	ctx := context.Background()
+	delivery := store.deliveries[0]
+
+	if _, err := sender.dispatch(ctx); err != nil {
+		t.Fatalf("dispatch() error = %v", err)
+	}
+
+	if delivery.Status != models.WebhookDeliveryPending || delivery.Last_Error == nil {
+		t.Fatalf("delivery after 503 = %s (error %v), want pending with error", delivery.Status, delivery.Last_Error)
+	}
+
+	// Повтор - не раньше задержки первой попытки
+	attempt := store.attempts[1][0]
+	delay := delivery.Next_Attempt_At.Sub(attempt.Attempted_At)
+
+	if delay < events.Backoff(1) || delay > events.Backoff(1)+time.Second {
+		t.Errorf("retry delay = %s, want %s", delay, events.Backoff(1))
+	}
+
+	if count, _ := sender.dispatch(ctx); count != 0 {
+		t.Fatalf("dispatch() before backoff claimed %d deliveries, want 0", count)
+	}
+
+	store.now = delivery.Next_Attempt_At
+
+	if count, err := sender.dispatch(ctx); err != nil || count != 1 {
+		t.Fatalf("dispatch() after backoff = %d, %v, want 1, nil", count, err)
+	}
+
+	if delivery.Status != models.WebhookDeliverySucceeded || delivery.Attempts != 2 {
+		t.Errorf("delivery = %s after %d attempts, want succeeded after 2", delivery.Status, delivery.Attempts)
+	}
+
+	if failures := store.subscriptions[delivery.Subscription_ID].Consecutive_Failures; failures != 0 {
+		t.Errorf("consecutive failures after success = %d, want 0", failures)
+	}
+}
+
+func TestSenderFailsDeliveryAfterMaxAttempts(t *testing.T) {
+	sender, store := newTestSender(t, func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusInternalServerError)
+	}, 1)
+
+	sender.MaxAttempts = 2
+	delivery := store.deliveries[0]
+
+	for range 2 {
+		store.now = delivery.Next_Attempt_At
+
+		if _, err := sender.dispatch(context.Background()); err != nil {
+			t.Fatalf("dispatch() error = %v", err)
+		}
+	}
+
+	if delivery.Status != models.WebhookDeliveryFailed || delivery.Attempts != 2 {
+		t.Errorf("delivery = %s after %d attempts, want failed after 2", delivery.Status, delivery.Attempts)
+	}
+}
+
+func TestSenderPausesSubscriptionAfterFailures(t *testing.T) {
+	var requests atomic.Int32
+
+	sender, store := newTestSender(t, func(w http.ResponseWriter, r *http.Request) {
+		requests.Add(1)
+		w.WriteHeader(http.StatusBadGateway)
+	}, 5)
+
+	sender.PauseAfter = 3
+	ctx := context.Background()
+
+	if count, err := sender.dispatch(ctx); err != nil || count != 5 {
+		t.Fatalf("dispatch() = %d, %v, want 5, nil", count, err)
+	}
+
+	// После третьей неудачи подряд остальные доставки пачки не отправляются
+	if got := requests.Load(); got != 3 {
+		t.Errorf("receiver got %d requests, want 3", got)
+	}
+
+	subscription := store.subscriptions[store.deliveries[0].Subscription_ID]
+
+	if subscription.Paused_At == nil {
+		t.Fatal("subscription is not paused")
+	}
+
+	for _, delivery := range store.deliveries[3:] {
+		if delivery.Attempts != 0 || delivery.Status != models.WebhookDeliveryPending {
+			t.Errorf("delivery %d = %s after %d attempts, want pending without attempts", delivery.ID, delivery.Status, delivery.Attempts)
+		}
+	}
+
+	// Приостановленная подписка не получает доставок, пока ее не возобновят
+	store.now = store.now.Add(time.Hour)
+
+	if count, _ := sender.dispatch(ctx); count != 0 {
+		t.Errorf("dispatch() for paused subscription claimed %d deliveries, want 0", count)
+	}
+
+	if got := requests.Load(); got != 3 {
+		t.Errorf("receiver got %d requests after pause, want 3", got)
+	}
+}
@@ -0,0 +1,93 @@
+package webhooks
+
+import (
+	"context"
+	"errors"
+	"net"
+	"net/netip"
+	"net/url"
+	"syscall"
+)
+
+var (
+	ErrInvalidURL      = errors.New("webhook url must be an absolute http or https url")
+	ErrForbiddenTarget = errors.New("webhook url must not point to a loopback, private or link-local address")
+)
+
+// диапазоны, не покрытые методами netip.Addr: "этот" хост, общий адрес провайдера (CGNAT),
+// служебные и документационные сети. Адреса подписчика в них - признак попытки SSRF
+var forbiddenPrefixes = []netip.Prefix{
+	netip.MustParsePrefix("0.0.0.0/8"),
+	netip.MustParsePrefix("100.64.0.0/10"),
+	netip.MustParsePrefix("192.0.0.0/24"),
+	netip.MustParsePrefix("198.18.0.0/15"),
+	netip.MustParsePrefix("240.0.0.0/4"),
+	netip.MustParsePrefix("64:ff9b::/96"),
+}
+
+// IsPublicAddr - можно ли отправлять webhook на адрес: не loopback, не частная сеть,
+// не link-local (в том числе метаданные облака 169.254.169.254) и не служебный диапазон
+func IsPublicAddr(addr netip.Addr) bool {
+	addr = addr.Unmap()
+
+	if !addr.IsValid() || addr.IsUnspecified() || addr.IsLoopback() || addr.IsPrivate() ||
+		addr.IsLinkLocalUnicast() || addr.IsLinkLocalMulticast() || addr.IsInterfaceLocalMulticast() || addr.IsMulticast() {
+		return false
+	}
+
+	for _, prefix := range forbiddenPrefixes {
+		if prefix.Contains(addr) {
+			return false
+		}
+	}
+
+	return true
+}
+
+// ValidateURL проверяет адрес подписки: http(s) и все адреса хоста публичные.
+// Проверка при создании подписки не защищает от смены DNS - поэтому Sender проверяет адрес еще раз при соединении
+func ValidateURL(ctx context.Context, raw string) error {
+	target, err := url.Parse(raw)
+
+	if err != nil || (target.Scheme != "http" && target.Scheme != "https") || target.Hostname() == "" || target.User != nil {
+		return ErrInvalidURL
+	}
+
+	if addr, err := netip.ParseAddr(target.Hostname()); err == nil {
+		if !IsPublicAddr(addr) {
+			return ErrForbiddenTarget
+		}
+
+		return nil
+	}
+
+	addrs, err := net.DefaultResolver.LookupNetIP(ctx, "ip", target.Hostname())
+
+	if err != nil {
+		return err
+	}
+
+	for _, addr := range addrs {
+		if !IsPublicAddr(addr) {
+			return ErrForbiddenTarget
+		}
+	}
+
+	return nil
+}
+
+// отказывает в соединении с непубличным адресом: вызывается для каждого адреса после разрешения DNS,
+// поэтому защищает и от перенаправлений, и от смены DNS после создания подписки
+func dialControl(network string, address string, conn syscall.RawConn) error {
+	addrPort, err := netip.ParseAddrPort(address)
+
+	if err != nil {
+		return err
+	}
+
+	if !IsPublicAddr(addrPort.Addr()) {
+		return ErrForbiddenTarget
+	}
+
+	return nil
+}